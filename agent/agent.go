@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"erinyes/conf"
+	"erinyes/logs"
+	"erinyes/parser"
+	"erinyes/wal"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Run 启动采集进程并把日志转发到中心 erinyes，ctx 结束后退出
+// 日志按批写入本地缓存，由 forwarder 依次上报，上报成功后才从缓存中删除，中心不可达时日志保留在本地
+func Run(ctx context.Context) error {
+	host := hostIdentity()
+	spool, err := wal.Open(conf.Config.Agent.SpoolDir, wal.Options{ // 与服务端持久化队列使用相同的分段参数
+		SegmentBytes:   conf.Config.Ingest.WAL.SegmentBytes,
+		CommitInterval: time.Duration(conf.Config.Ingest.WAL.CommitInterval) * time.Millisecond,
+	})
+	if err != nil {
+		return err
+	}
+	logs.Logger.Infof("agent %s(%s) forwards sysdig logs to %s, spool backlog %d bytes",
+		host.ID, host.Name, conf.Config.Agent.Server, spool.Backlog())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		newForwarder(host).run(ctx, spool)
+	}()
+
+	for {
+		if err := capture(ctx, spool); err != nil {
+			logs.Logger.WithError(err).Errorf("sysdig capture exited")
+		}
+		select {
+		case <-ctx.Done():
+			err = spool.Close() // forwarder 的 Next 随之返回
+			wg.Wait()
+			return err
+		case <-time.After(time.Duration(conf.Config.Agent.RestartInterval) * time.Second):
+		}
+		logs.Logger.Infof("restart sysdig capture")
+	}
+}
+
+// capture 运行一次采集进程，按 BatchSize 或 FlushInterval 将标准输出中的日志写入本地缓存
+func capture(ctx context.Context, spool *wal.Queue) error {
+	cmd := exec.CommandContext(ctx, conf.Config.Agent.SysdigPath, BuildArgs()...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	logs.Logger.Infof("sysdig capture started, pid %d", cmd.Process.Pid)
+
+	lines := make(chan string, conf.Config.Agent.BatchSize)
+	go func() {
+		defer close(lines)
+		s := bufio.NewScanner(stdout)
+		s.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+
+	ticker := time.NewTicker(time.Duration(conf.Config.Agent.FlushInterval) * time.Millisecond)
+	defer ticker.Stop()
+	var batch []string
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				spoolBatch(spool, batch)
+				return cmd.Wait()
+			}
+			if err := parser.ValidateSysdigLine(line); err != nil {
+				logs.Logger.Debugf("skip sysdig output %q: %v", line, err)
+				continue
+			}
+			batch = append(batch, line)
+			if len(batch) >= conf.Config.Agent.BatchSize {
+				spoolBatch(spool, batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			spoolBatch(spool, batch)
+			batch = nil
+		}
+	}
+}
+
+// spoolBatch 将一批日志写入本地缓存，缓存已满时丢弃
+func spoolBatch(spool *wal.Queue, batch []string) {
+	if len(batch) == 0 {
+		return
+	}
+	if conf.Config.Agent.SpoolMaxBytes > 0 && spool.Backlog() > conf.Config.Agent.SpoolMaxBytes {
+		logs.Logger.Warnf("spool is full, drop %d sysdig logs", len(batch))
+		return
+	}
+	if err := spool.Append([][]byte{[]byte(strings.Join(batch, "\n"))}); err != nil {
+		logs.Logger.WithError(err).Errorf("spool %d sysdig logs failed", len(batch))
+	}
+}
+
+// hostIdentity 返回本机标识，未配置时使用 /etc/machine-id 与主机名
+func hostIdentity() parser.Host {
+	hostName := conf.Config.Agent.HostName
+	if hostName == "" {
+		hostName, _ = os.Hostname()
+	}
+	hostID := conf.Config.Agent.HostID
+	if hostID == "" {
+		if data, err := ioutil.ReadFile("/etc/machine-id"); err == nil {
+			hostID = strings.TrimSpace(string(data))
+		}
+	}
+	if hostID == "" {
+		hostID = hostName
+	}
+	return parser.Host{ID: hostID, Name: hostName}
+}
@@ -0,0 +1,282 @@
+package agent
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"erinyes/conf"
+	"erinyes/logs"
+	"erinyes/parser"
+	"erinyes/service"
+	"erinyes/wal"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ingestServer 模拟中心 erinyes 的 /api/sysdig/logs，按顺序使用 responses 中的状态码应答，用完后返回 200
+type ingestServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	responses []response
+	maxBytes  int        // 解压后的请求体超过该字节数时返回 413，为 0 时不限制
+	requests  [][]string // 每次请求上报的日志
+	accepted  []string   // 被接收的日志
+}
+
+type response struct {
+	status int
+	next   int // 429 时接收前 next 条
+}
+
+func newIngestServer(t *testing.T, responses ...response) *ingestServer {
+	s := &ingestServer{responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *ingestServer) handle(w http.ResponseWriter, r *http.Request) {
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, _ := ioutil.ReadAll(gz)
+	lines := strings.Split(string(body), "\n")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, lines)
+	if s.maxBytes > 0 && len(body) > s.maxBytes {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	resp := response{status: http.StatusOK}
+	if len(s.responses) > 0 {
+		resp, s.responses = s.responses[0], s.responses[1:]
+	}
+	w.Header().Set("Retry-After", "0")
+	switch resp.status {
+	case http.StatusOK:
+		s.accepted = append(s.accepted, lines...)
+		json.NewEncoder(w).Encode(service.IngestResult{Accepted: len(lines)})
+	case http.StatusTooManyRequests:
+		s.accepted = append(s.accepted, lines[:resp.next]...)
+		w.WriteHeader(resp.status)
+		json.NewEncoder(w).Encode(service.IngestResult{Accepted: resp.next, Next: resp.next})
+	default:
+		time.Sleep(10 * time.Millisecond) // 避免客户端立即重试时空转
+		w.WriteHeader(resp.status)
+	}
+}
+
+// snapshot 返回请求次数与被接收的日志
+func (s *ingestServer) snapshot() (int, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests), append([]string(nil), s.accepted...)
+}
+
+// sysdigLines 生成 n 条格式正确的日志，线程 id 依次为 from、from+1……
+func sysdigLines(from int, n int) []string {
+	var lines []string
+	for i := from; i < from+n; i++ {
+		lines = append(lines, fmt.Sprintf("2023-01-01 10:00:00.%09d cat %d 10 1 > read /etc/passwd 1 /bin/cat 3 c1 web res=3", i, i))
+	}
+	return lines
+}
+
+// setupAgent 将配置指向 server 与临时目录，返回本地缓存目录
+func setupAgent(t *testing.T, server string) string {
+	logs.Logger = logrus.New()
+	logs.Logger.SetLevel(logrus.ErrorLevel)
+	saved := conf.Config
+	t.Cleanup(func() { conf.Config = saved })
+	dir := t.TempDir()
+	conf.Config.Agent.Server = server
+	conf.Config.Agent.SpoolDir = filepath.Join(dir, "spool")
+	conf.Config.Agent.HostID, conf.Config.Agent.HostName = "h1", "host-1"
+	conf.Config.Agent.BatchSize = 2
+	conf.Config.Agent.FlushInterval = 10
+	conf.Config.Agent.RetryInterval = 0
+	conf.Config.Agent.Timeout = 5
+	conf.Config.Agent.RestartInterval = 0
+	conf.Config.Agent.SpoolMaxBytes = 0
+	conf.Config.Ingest.WAL.SegmentBytes = 0
+	conf.Config.Ingest.WAL.CommitInterval = 10
+	return dir
+}
+
+// fakeSysdig 写入代替采集程序的脚本：第一次启动时输出 lines，之后不再输出，直到被结束
+func fakeSysdig(t *testing.T, dir string, lines []string) {
+	data := filepath.Join(dir, "sysdig.out")
+	if err := ioutil.WriteFile(data, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "sysdig.sh")
+	content := fmt.Sprintf("#!/bin/sh\nif [ ! -f %[1]s.done ]; then touch %[1]s.done; cat %[1]s; fi\nexec sleep 60\n", data)
+	if err := ioutil.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	conf.Config.Agent.SysdigPath = script
+}
+
+// startAgent 在后台运行 Run，返回结束并等待其退出的函数
+func startAgent(t *testing.T) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx)
+	}()
+	return func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("agent did not stop")
+		}
+	}
+}
+
+// waitFor 等待 cond 成立
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAgentSpoolsWhileServerIsDown(t *testing.T) {
+	down := make([]response, 1000)
+	for i := range down {
+		down[i] = response{status: http.StatusServiceUnavailable}
+	}
+	server := newIngestServer(t, down...)
+	dir := setupAgent(t, server.URL)
+	lines := sysdigLines(1, 5)
+	fakeSysdig(t, dir, lines)
+
+	stop := startAgent(t)
+	waitFor(t, "forwarding attempts", func() bool {
+		requests, _ := server.snapshot()
+		return requests >= 3
+	})
+	stop()
+	if _, accepted := server.snapshot(); len(accepted) != 0 {
+		t.Fatalf("%d logs accepted while server is down", len(accepted))
+	}
+	spool, err := wal.Open(conf.Config.Agent.SpoolDir, wal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backlog := spool.Backlog()
+	spool.Close()
+	if backlog == 0 {
+		t.Fatal("spool is empty after the server was down")
+	}
+
+	// 中心恢复后重新启动，缓存中的日志按原来的顺序上报一次，采集进程不再输出新的日志
+	server.mu.Lock()
+	server.responses = nil
+	server.mu.Unlock()
+	stop = startAgent(t)
+	waitFor(t, "spooled logs", func() bool {
+		_, accepted := server.snapshot()
+		return len(accepted) >= len(lines)
+	})
+	stop()
+	if _, accepted := server.snapshot(); !reflect.DeepEqual(accepted, lines) {
+		t.Fatalf("accepted %q, want %q", accepted, lines)
+	}
+}
+
+// forward 将 batches 写入本地缓存并运行 forwarder，直到缓存清空
+func forward(t *testing.T, server *ingestServer, batches ...[]string) {
+	setupAgent(t, server.URL)
+	spool, err := wal.Open(conf.Config.Agent.SpoolDir, wal.Options{CommitInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, batch := range batches {
+		spoolBatch(spool, batch)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		newForwarder(parser.Host{ID: "h1", Name: "host-1"}).run(ctx, spool)
+	}()
+	waitFor(t, "empty spool", func() bool { return spool.Backlog() == 0 })
+	cancel()
+	spool.Close()
+	<-done
+}
+
+func TestForwarderResumesFromNext(t *testing.T) {
+	server := newIngestServer(t, response{status: http.StatusTooManyRequests, next: 2}, response{status: http.StatusTooManyRequests, next: 0})
+	lines := sysdigLines(1, 5)
+	forward(t, server, lines)
+	if !reflect.DeepEqual(server.requests, [][]string{lines, lines[2:], lines[2:]}) {
+		t.Fatalf("requests %q", server.requests)
+	}
+	if !reflect.DeepEqual(server.accepted, lines) {
+		t.Fatalf("accepted %q, want %q", server.accepted, lines)
+	}
+}
+
+func TestForwarderDropsRejectedBatch(t *testing.T) {
+	server := newIngestServer(t, response{status: http.StatusBadRequest})
+	first, second := sysdigLines(1, 2), sysdigLines(3, 2)
+	forward(t, server, first, second)
+	if !reflect.DeepEqual(server.requests, [][]string{first, second}) {
+		t.Fatalf("requests %q", server.requests)
+	}
+	if !reflect.DeepEqual(server.accepted, second) {
+		t.Fatalf("accepted %q, want %q", server.accepted, second)
+	}
+}
+
+func TestForwarderSplitsOversizedBatch(t *testing.T) {
+	lines := sysdigLines(1, 5)
+	server := newIngestServer(t)
+	server.maxBytes = 2*len(lines[0]) + 1 // 一次最多上报两条
+	forward(t, server, lines)
+	want := [][]string{lines, lines[:2], lines[2:4], lines[4:]}
+	if !reflect.DeepEqual(server.requests, want) {
+		t.Fatalf("requests %q, want %q", server.requests, want)
+	}
+	if !reflect.DeepEqual(server.accepted, lines) {
+		t.Fatalf("accepted %q, want %q", server.accepted, lines)
+	}
+}
+
+func TestForwarderDropsOversizedLog(t *testing.T) {
+	lines := sysdigLines(1, 3)
+	lines[1] += strings.Repeat(" x", len(lines[1]))
+	server := newIngestServer(t)
+	server.maxBytes = len(lines[0]) + 1
+	forward(t, server, lines)
+	want := [][]string{lines, lines[:1], lines[1:2], lines[2:]}
+	if !reflect.DeepEqual(server.requests, want) {
+		t.Fatalf("requests %q, want %q", server.requests, want)
+	}
+	if accepted := []string{lines[0], lines[2]}; !reflect.DeepEqual(server.accepted, accepted) {
+		t.Fatalf("accepted %q, want %q", server.accepted, accepted)
+	}
+}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"erinyes/conf"
+	"erinyes/logs"
+	"erinyes/parser"
+	"erinyes/service"
+	"erinyes/wal"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// forwarder 将本地缓存中的日志按批上报到中心 erinyes 的 /api/sysdig/logs
+type forwarder struct {
+	host   parser.Host
+	url    string
+	client *http.Client
+}
+
+func newForwarder(host parser.Host) *forwarder {
+	return &forwarder{
+		host:   host,
+		url:    strings.TrimRight(conf.Config.Agent.Server, "/") + "/api/sysdig/logs",
+		client: &http.Client{Timeout: time.Duration(conf.Config.Agent.Timeout) * time.Second},
+	}
+}
+
+func (f *forwarder) run(ctx context.Context, spool *wal.Queue) {
+	for {
+		payload, ack, err := spool.Next()
+		if err == wal.ErrClosed {
+			return
+		} else if err != nil {
+			logs.Logger.WithError(err).Error("stop forwarding spooled sysdig logs")
+			return
+		}
+		lines := strings.Split(string(payload), "\n")
+		size := len(lines) // 每次上报的条数，请求体过大时减半
+		for len(lines) > 0 {
+			n := size
+			if n > len(lines) {
+				n = len(lines)
+			}
+			next, wait, err := f.send(ctx, lines[:n])
+			if err == errTooLarge {
+				if n > 1 {
+					size = n / 2
+					continue
+				}
+				logs.Logger.Errorf("drop a sysdig log of %d bytes that exceeds the request size limit of server", len(lines[0]))
+				next, err = 1, nil
+			}
+			if err != nil {
+				logs.Logger.WithError(err).Warnf("forward %d sysdig logs failed, retry in %s", n, wait)
+			}
+			lines = lines[next:]
+			if len(lines) == 0 {
+				break
+			}
+			select {
+			case <-ctx.Done(): // 未确认的日志在下次启动时重新上报
+				return
+			case <-time.After(wait):
+			}
+		}
+		ack()
+	}
+}
+
+// errTooLarge 请求体超过中心的 Ingest.MaxBodyBytes，需要拆分后重新上报
+var errTooLarge = errors.New("request body is too large")
+
+// send 上报一批日志，返回已被中心接收（或无法接收）的日志条数，以及重试前应等待的时间
+func (f *forwarder) send(ctx context.Context, lines []string) (int, time.Duration, error) {
+	retry := time.Duration(conf.Config.Agent.RetryInterval) * time.Second
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(strings.Join(lines, "\n")))
+	gz.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, &buf)
+	if err != nil {
+		return 0, retry, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set(service.HeaderHostID, f.host.ID)
+	req.Header.Set(service.HeaderHostName, f.host.Name)
+	if dataset := conf.Config.Agent.Dataset; dataset != "" {
+		req.Header.Set(service.HeaderDataset, dataset)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, retry, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		retry = time.Duration(seconds) * time.Second
+	}
+
+	var result service.IngestResult
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.Unmarshal(body, &result); err == nil && result.Rejected > 0 {
+			logs.Logger.Warnf("%d sysdig logs rejected by server: %+v", result.Rejected, result.Errors)
+		}
+		return len(lines), 0, nil
+	case http.StatusTooManyRequests: // 从 next 开始重新上报
+		if err := json.Unmarshal(body, &result); err == nil && result.Next > 0 && result.Next <= len(lines) {
+			return result.Next, retry, fmt.Errorf("server is busy")
+		}
+		return 0, retry, fmt.Errorf("server is busy")
+	case http.StatusServiceUnavailable:
+		return 0, retry, fmt.Errorf("server is not ready")
+	case http.StatusRequestEntityTooLarge:
+		return 0, 0, errTooLarge
+	case http.StatusBadRequest: // 重试也无法成功，丢弃
+		logs.Logger.Errorf("drop %d sysdig logs rejected by server: %s", len(lines), body)
+		return len(lines), 0, nil
+	}
+	return 0, retry, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+}
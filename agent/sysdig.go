@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"erinyes/conf"
+	"erinyes/parser"
+	"fmt"
+	"strings"
+)
+
+// BuildFilter 根据配置生成 sysdig 的过滤条件
+func BuildFilter() string {
+	var conds []string
+	for _, id := range conf.Config.Agent.ExcludeContainerIDs {
+		conds = append(conds, "container.id!="+id)
+	}
+	conds = append(conds, "container.name!=<N/A>")
+	for _, image := range conf.Config.Agent.ExcludeImages {
+		conds = append(conds, "container.image!="+image)
+	}
+	if len(conf.Config.Agent.EventTypes) > 0 {
+		var types []string
+		for _, t := range conf.Config.Agent.EventTypes {
+			types = append(types, "evt.type="+t)
+		}
+		conds = append(conds, "("+strings.Join(types, " or ")+")")
+	}
+	if conf.Config.Agent.Filter != "" {
+		conds = append(conds, "("+conf.Config.Agent.Filter+")")
+	}
+	return strings.Join(conds, " and ")
+}
+
+// BuildArgs 返回启动采集进程的参数，输出格式固定为 parser.SysdigFormat
+func BuildArgs() []string {
+	args := append([]string{}, conf.Config.Agent.SysdigArgs...)
+	return append(args, fmt.Sprintf("-p%s", parser.SysdigFormat), BuildFilter())
+}
@@ -0,0 +1,204 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentSuffix = ".gz"
+	cacheSegments = 16 // 读取时缓存的解压后分段数
+)
+
+// Ref 一条原始日志在归档中的位置：分段的内容哈希与解压后分段内的偏移、长度
+type Ref struct {
+	Segment string `json:"segment"`
+	Offset  int64  `json:"offset"`
+	Length  int    `json:"length"`
+}
+
+// Valid 是否指向了归档中的日志，开启归档之前写入的边没有位置
+func (r Ref) Valid() bool {
+	return r.Segment != ""
+}
+
+// Archive 以内容寻址的方式保存原始日志：一批日志以换行拼接后 gzip 压缩为一个分段文件，
+// 文件名为未压缩内容的 sha256，内容相同的分段只保存一次。分段写入后不再修改，可以并发读写
+type Archive struct {
+	dir string
+
+	mu    sync.Mutex
+	cache map[string][]byte // 分段哈希 -> 解压后的内容
+	order []string          // 缓存的淘汰顺序
+}
+
+// Open 打开归档目录，不存在时创建
+func Open(dir string) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Archive{dir: dir, cache: make(map[string][]byte)}, nil
+}
+
+func (a *Archive) path(segment string) string {
+	return filepath.Join(a.dir, segment[:2], segment+segmentSuffix)
+}
+
+// Write 将一批原始日志写入一个分段，fsync 后返回每条日志的位置
+func (a *Archive) Write(lines []string) ([]Ref, error) {
+	var content bytes.Buffer
+	refs := make([]Ref, len(lines))
+	for i, line := range lines {
+		refs[i] = Ref{Offset: int64(content.Len()), Length: len(line)}
+		content.WriteString(line)
+		content.WriteByte('\n')
+	}
+	sum := sha256.Sum256(content.Bytes())
+	segment := hex.EncodeToString(sum[:])
+	for i := range refs {
+		refs[i].Segment = segment
+	}
+
+	name := a.path(segment)
+	if _, err := os.Stat(name); err == nil { // 相同内容的分段已经存在
+		return refs, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	// 先写临时文件再重命名，读取方不会看到写了一半的分段
+	tmp, err := ioutil.TempFile(filepath.Dir(name), segment+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	if _, err := zw.Write(content.Bytes()); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// Read 返回位置对应的原始日志
+func (a *Archive) Read(ref Ref) (string, error) {
+	if !ref.Valid() {
+		return "", fmt.Errorf("no raw log recorded")
+	}
+	content, err := a.segment(ref.Segment)
+	if err != nil {
+		return "", err
+	}
+	end := ref.Offset + int64(ref.Length)
+	if ref.Offset < 0 || ref.Length < 0 || end > int64(len(content)) {
+		return "", fmt.Errorf("range [%d, %d) out of segment %s", ref.Offset, end, ref.Segment)
+	}
+	return string(content[ref.Offset:end]), nil
+}
+
+// validSegment 分段名是否为 sha256 的十六进制表示
+func validSegment(segment string) bool {
+	return len(segment) == sha256.Size*2 && strings.Trim(segment, "0123456789abcdef") == ""
+}
+
+// Segments 返回归档中的全部分段，不包括正在写入的临时文件
+func (a *Archive) Segments() ([]string, error) {
+	var segments []string
+	err := filepath.Walk(a.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if !info.IsDir() && strings.HasSuffix(name, segmentSuffix) && validSegment(strings.TrimSuffix(name, segmentSuffix)) {
+			segments = append(segments, strings.TrimSuffix(name, segmentSuffix))
+		}
+		return nil
+	})
+	return segments, err
+}
+
+// Remove 删除分段，调用方需保证没有边引用它，且没有正在写入相同内容的批次
+func (a *Archive) Remove(segment string) error {
+	if !validSegment(segment) {
+		return fmt.Errorf("invalid segment %s", segment)
+	}
+	a.mu.Lock()
+	if _, ok := a.cache[segment]; ok {
+		delete(a.cache, segment)
+		for i, cached := range a.order {
+			if cached == segment {
+				a.order = append(a.order[:i], a.order[i+1:]...)
+				break
+			}
+		}
+	}
+	a.mu.Unlock()
+	if err := os.Remove(a.path(segment)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// segment 读取并校验解压后的分段内容
+func (a *Archive) segment(segment string) ([]byte, error) {
+	a.mu.Lock()
+	content, ok := a.cache[segment]
+	a.mu.Unlock()
+	if ok {
+		return content, nil
+	}
+
+	if !validSegment(segment) {
+		return nil, fmt.Errorf("invalid segment %s", segment)
+	}
+	f, err := os.Open(a.path(segment))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("read segment %s: %w", segment, err)
+	}
+	if content, err = ioutil.ReadAll(zr); err != nil {
+		return nil, fmt.Errorf("read segment %s: %w", segment, err)
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != segment {
+		return nil, fmt.Errorf("segment %s is corrupted", segment)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.cache[segment]; !ok {
+		if len(a.order) >= cacheSegments {
+			delete(a.cache, a.order[0])
+			a.order = a.order[1:]
+		}
+		a.cache[segment] = content
+		a.order = append(a.order, segment)
+	}
+	return content, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"erinyes/builder"
+	"erinyes/store"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseProvenanceArgs 从参数中依次取出 dataset=、pid= 等过滤条件、direction=、from= 等溯源限制和 root=，返回其余参数
+// 返回的 Options 中已经设置了 Direction 和 Filter，Depth 由各命令按自己的参数格式设置
+func parseProvenanceArgs(args []string) ([]string, builder.Options, []builder.Root, error) {
+	args, err := useDataset(args)
+	if err != nil {
+		return nil, builder.Options{}, nil, err
+	}
+	args, filter, err := parseEventFilter(args)
+	if err != nil {
+		return nil, builder.Options{}, nil, err
+	}
+	args, direction, err := parseDirection(args)
+	if err != nil {
+		return nil, builder.Options{}, nil, err
+	}
+	args, opts, err := parseQueryOptions(args)
+	if err != nil {
+		return nil, builder.Options{}, nil, err
+	}
+	args, roots, err := parseRoots(args)
+	if err != nil {
+		return nil, builder.Options{}, nil, err
+	}
+	opts.Direction, opts.Filter = direction, filter
+	return args, opts, roots, nil
+}
+
+// useDataset 从参数中取出 dataset=<name>，将全局存储切换到该数据集，返回其余参数
+func useDataset(args []string) ([]string, error) {
+	var rest []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "dataset=") {
+			rest = append(rest, arg)
+			continue
+		}
+		if err := store.UseDataset(strings.TrimPrefix(arg, "dataset=")); err != nil {
+			return nil, err
+		}
+	}
+	return rest, nil
+}
+
+// parseEventFilter 从参数中取出 pid=、tid=、ret=、bytes=、arg= 形式的过滤条件，返回其余参数
+func parseEventFilter(args []string) ([]string, builder.EventFilter, error) {
+	var (
+		rest   []string
+		filter builder.EventFilter
+	)
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			rest = append(rest, arg)
+			continue
+		}
+		switch kv[0] {
+		case "pid":
+			filter.Pid = kv[1]
+		case "tid":
+			filter.Tid = kv[1]
+		case "ret":
+			filter.Ret = kv[1]
+		case "bytes":
+			n, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				return nil, filter, fmt.Errorf("bytes is not valid: %s", kv[1])
+			}
+			filter.MinBytes = n
+		case "arg":
+			filter.Arg = kv[1]
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, filter, nil
+}
+
+// parseDirection 从参数中取出 direction=<backward|forward|both>，没有时为逆向溯源，返回其余参数
+func parseDirection(args []string) ([]string, builder.Direction, error) {
+	var rest []string
+	direction := builder.Backward
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "direction=") {
+			rest = append(rest, arg)
+			continue
+		}
+		d, err := builder.ParseDirection(strings.TrimPrefix(arg, "direction="))
+		if err != nil {
+			return nil, direction, err
+		}
+		direction = d
+	}
+	return rest, direction, nil
+}
+
+// parseQueryOptions 从参数中取出 from=、to=、max-nodes=、max-edges=、timeout=、exclude= 形式的溯源限制，返回其余参数
+// 没有指定的超时与上限使用配置 Provenance 中的默认值（max-nodes=0 等取消限制），exclude= 可以出现多次，追加在配置的排除条件之后
+func parseQueryOptions(args []string) ([]string, builder.Options, error) {
+	var rest []string
+	opts := builder.DefaultOptions()
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			rest = append(rest, arg)
+			continue
+		}
+		var err error
+		switch kv[0] {
+		case "from":
+			opts.From, err = parseTimestamp(kv[1])
+		case "to":
+			opts.To, err = parseTimestamp(kv[1])
+		case "max-nodes":
+			opts.MaxNodes, err = strconv.Atoi(kv[1])
+		case "max-edges":
+			opts.MaxEdges, err = strconv.Atoi(kv[1])
+		case "timeout":
+			opts.Timeout, err = time.ParseDuration(kv[1])
+		case "exclude":
+			opts.Exclude = append(opts.Exclude, kv[1])
+		default:
+			rest = append(rest, arg)
+		}
+		if err != nil {
+			return nil, opts, fmt.Errorf("%s is not valid: %s", kv[0], kv[1])
+		}
+	}
+	return rest, opts, nil
+}
+
+// parseRoots 从参数中取出一个或多个 root=<root>，格式见 builder.ParseRoot，返回其余参数
+func parseRoots(args []string) ([]string, []builder.Root, error) {
+	var (
+		rest  []string
+		roots []builder.Root
+	)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "root=") {
+			rest = append(rest, arg)
+			continue
+		}
+		root, err := builder.ParseRoot(strings.TrimPrefix(arg, "root="))
+		if err != nil {
+			return nil, nil, err
+		}
+		roots = append(roots, root)
+	}
+	return rest, roots, nil
+}
+
+// parseTimestamp 解析 16 位微秒时间戳或 RFC3339 格式的时间
+func parseTimestamp(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("time is not valid: %s", s)
+	}
+	return t.UnixNano() / int64(time.Microsecond), nil
+}
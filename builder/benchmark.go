@@ -0,0 +1,169 @@
+package builder
+
+import (
+	"context"
+	"erinyes/models"
+	"erinyes/store"
+	"fmt"
+	"gonum.org/v1/gonum/graph/multi"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// TraversalBenchmark 一种遍历方式多次溯源的耗时、存储调用次数与子图规模
+type TraversalBenchmark struct {
+	Name      string
+	Rounds    int
+	Total     time.Duration
+	Min       time.Duration
+	Max       time.Duration
+	Queries   int // 每次溯源调用存储的次数，批量查询按一次计
+	Nodes     int
+	Edges     int
+	Truncated Truncation // 最后一次溯源截断的原因
+}
+
+// Average 每次溯源的平均耗时
+func (b TraversalBenchmark) Average() time.Duration {
+	if b.Rounds == 0 {
+		return 0
+	}
+	return b.Total / time.Duration(b.Rounds)
+}
+
+// BenchmarkProvenance 分别逐个顶点查询（原来的遍历方式）与按层批量查询对同一组起点溯源 rounds 次
+// 两种方式交替执行，避免数据库缓存偏向其中一种；两者都没有截断、得到的子图（顶点、到达方向与边）不同时返回错误
+// 截断时按层遍历只读取了上限以内的边，截断的位置可能与逐个顶点查询不同，不做比较
+func BenchmarkProvenance(ctx context.Context, s store.Store, roots []Root, opts Options, rounds int) ([]TraversalBenchmark, error) {
+	if rounds < 1 {
+		return nil, fmt.Errorf("rounds must be positive: %d", rounds)
+	}
+	fetchers := []levelFetcher{fetchLevelPerNode, fetchLevel}
+	results := []TraversalBenchmark{{Name: "node"}, {Name: "level"}}
+	last := make([]Result, len(fetchers))
+	for round := 0; round < rounds; round++ {
+		for i, fetch := range fetchers {
+			cs := &countingStore{Store: s}
+			start := time.Now()
+			res, err := provenanceFrom(ctx, cs, roots, opts, fetch)
+			elapsed := time.Since(start)
+			if err != nil {
+				return nil, err
+			}
+			r := &results[i]
+			r.Rounds++
+			r.Total += elapsed
+			if r.Min == 0 || elapsed < r.Min {
+				r.Min = elapsed
+			}
+			if elapsed > r.Max {
+				r.Max = elapsed
+			}
+			r.Queries, r.Nodes, r.Edges, r.Truncated = cs.calls, res.Graph.Nodes().Len(), len(SubgraphEdges(res.Graph)), res.Truncated
+			last[i] = res
+		}
+	}
+	nodeVertices, levelVertices := reachedVertices(last[0].Graph), reachedVertices(last[1].Graph)
+	if last[0].Truncated != "" || last[1].Truncated != "" {
+		return results, nil
+	}
+	if !reflect.DeepEqual(nodeVertices, levelVertices) || !reflect.DeepEqual(SubgraphEdges(last[0].Graph), SubgraphEdges(last[1].Graph)) {
+		return results, fmt.Errorf("level traversal differs from node traversal: %d/%d vertices, %d/%d edges",
+			len(levelVertices), len(nodeVertices), results[1].Edges, results[0].Edges)
+	}
+	return results, nil
+}
+
+// reachedVertices 子图中每个顶点的标识与到达方向，排序后用于比较
+func reachedVertices(g *multi.WeightedDirectedGraph) []string {
+	var vertices []string
+	nodes := g.Nodes()
+	for nodes.Next() {
+		n := nodes.Node().(GraphNode)
+		vertices = append(vertices, n.LinkID()+"|"+string(n.Reached()))
+	}
+	sort.Strings(vertices)
+	return vertices
+}
+
+// countingStore 记录溯源过程中调用存储的次数
+type countingStore struct {
+	store.Store
+	calls int
+}
+
+func (c *countingStore) GetProcess(id int) (models.Process, error) {
+	c.calls++
+	return c.Store.GetProcess(id)
+}
+
+func (c *countingStore) GetFile(id int) (models.File, error) {
+	c.calls++
+	return c.Store.GetFile(id)
+}
+
+func (c *countingStore) GetSocket(id int) (models.Socket, error) {
+	c.calls++
+	return c.Store.GetSocket(id)
+}
+
+func (c *countingStore) GetProcesses(ids []int) ([]models.Process, error) {
+	c.calls++
+	return c.Store.GetProcesses(ids)
+}
+
+func (c *countingStore) GetFiles(ids []int) ([]models.File, error) {
+	c.calls++
+	return c.Store.GetFiles(ids)
+}
+
+func (c *countingStore) GetSockets(ids []int) ([]models.Socket, error) {
+	c.calls++
+	return c.Store.GetSockets(ids)
+}
+
+func (c *countingStore) FindProcess(hostID string, containerID string, vpid string, name string) (models.Process, error) {
+	c.calls++
+	return c.Store.FindProcess(hostID, containerID, vpid, name)
+}
+
+func (c *countingStore) MatchFiles(hostID string, containerID string, pattern string) ([]models.File, error) {
+	c.calls++
+	return c.Store.MatchFiles(hostID, containerID, pattern)
+}
+
+func (c *countingStore) MatchSockets(hostID string, containerID string, ipPattern string, portPattern string) ([]models.Socket, error) {
+	c.calls++
+	return c.Store.MatchSockets(hostID, containerID, ipPattern, portPattern)
+}
+
+func (c *countingStore) FetchEvents(vertexID int, classes []string, reverse bool, uuid string) ([]models.Event, error) {
+	c.calls++
+	return c.Store.FetchEvents(vertexID, classes, reverse, uuid)
+}
+
+func (c *countingStore) FetchNets(socketID int, reverse bool, uuid string) ([]models.Net, error) {
+	c.calls++
+	return c.Store.FetchNets(socketID, reverse, uuid)
+}
+
+func (c *countingStore) FetchFrontierEvents(ctx context.Context, vertexIDs []int, classes []string, reverse bool, uuid string, window store.TimeWindow, afterID int, limit int) ([]models.Event, error) {
+	c.calls++
+	return c.Store.FetchFrontierEvents(ctx, vertexIDs, classes, reverse, uuid, window, afterID, limit)
+}
+
+func (c *countingStore) FetchFrontierNets(ctx context.Context, socketIDs []int, reverse bool, uuid string, window store.TimeWindow, afterID int, limit int) ([]models.Net, error) {
+	c.calls++
+	return c.Store.FetchFrontierNets(ctx, socketIDs, reverse, uuid, window, afterID, limit)
+}
+
+func (c *countingStore) ScanEvents(afterID int, limit int, uuid string) ([]models.Event, error) {
+	c.calls++
+	return c.Store.ScanEvents(afterID, limit, uuid)
+}
+
+func (c *countingStore) ScanNets(afterID int, limit int, uuid string) ([]models.Net, error) {
+	c.calls++
+	return c.Store.ScanNets(afterID, limit, uuid)
+}
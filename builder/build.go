@@ -1,13 +1,12 @@
 package builder
 
 import (
-	"erinyes/helper"
 	"erinyes/logs"
 	"erinyes/models"
 	"erinyes/parser"
+	"erinyes/store"
 	"github.com/awalterschulze/gographviz"
 	"os"
-	"strings"
 )
 
 func createDir(dirName string) {
@@ -19,112 +18,109 @@ func createDir(dirName string) {
 	}
 }
 
-// GenerateDotGraph 生成内存中的dot
-func GenerateDotGraph(uuid string) *gographviz.Graph {
+// GenerateDotGraph 生成 s 当前数据集的内存中的dot，uuid 不为空时只包含属于该请求的边
+func GenerateDotGraph(s store.Store, uuid string) *gographviz.Graph {
 	graphAst, _ := gographviz.Parse([]byte(`digraph G{}`))
 	graph := gographviz.NewGraph()
 	gographviz.Analyse(graphAst, graph)
-	db := models.GetMysqlDB()
 
 	// 遍历 Event 表和 Net 表
 	pageSize := 100
-	pageNumber := 1
+	mergedEvents, mergedNets := s.MergedCaptureEdges() // 已与 sysdig 事件关联的流量边不再重复生成
 	// 1. 遍历 Event 表
+	lastID := 0
 	for {
-		var events []models.Event
-		db.Order("id").Limit(pageSize).Offset((pageNumber - 1) * pageSize).Find(&events)
+		events, _ := s.ScanEvents(lastID, pageSize, uuid)
 		if len(events) == 0 {
 			break
 		}
 		for _, event := range events { // 遍历所有边
-			var start models.DotVertex
-			var end models.DotVertex
-			switch event.EventClass { // eventType 决定了从哪两个表中查询数据
-			case parser.PROCESS: // process -> process
-				var startProcess models.Process
-				var endProcess models.Process
-				result1 := startProcess.FindByID(db, event.SrcID)
-				result2 := endProcess.FindByID(db, event.DstID)
-				if !(result1 && result2) {
-					continue
-				}
-				start = startProcess
-				end = endProcess
-			case parser.FILEV1: // process -> file
-				var startProcess models.Process
-				var endFile models.File
-				result1 := startProcess.FindByID(db, event.SrcID)
-				result2 := endFile.FindByID(db, event.DstID)
-				if !(result1 && result2) {
-					continue
-				}
-				start = startProcess
-				end = endFile
-			case parser.FILEV2: // file -> process
-				var startFile models.File
-				var endProcess models.Process
-				result1 := startFile.FindByID(db, event.SrcID)
-				result2 := endProcess.FindByID(db, event.DstID)
-				if !(result1 && result2) {
-					continue
-				}
-				start = startFile
-				end = endProcess
-			case parser.NETWORKV1: // process -> socket
-				var startProcess models.Process
-				var endSocket models.Socket
-				result1 := startProcess.FindByID(db, event.SrcID)
-				result2 := endSocket.FindByID(db, event.DstID)
-				if !(result1 && result2) {
-					continue
-				}
-				start = startProcess
-				end = endSocket
-			case parser.NETWORKV2: // socket -> process
-				var startSocket models.Socket
-				var endProcess models.Process
-				result1 := startSocket.FindByID(db, event.SrcID)
-				result2 := endProcess.FindByID(db, event.DstID)
-				if !(result1 && result2) {
-					continue
-				}
-				start = startSocket
-				end = endProcess
-			default:
-				logs.Logger.Warnf("Unknown event class: %s in event tables", event.EventClass)
+			lastID = event.ID
+			if mergedEvents[event.ID] {
+				continue
+			}
+			start, end, ok := EventVertices(s, event)
+			if !ok {
+				continue
 			}
-			GenerateEdge(start, end, event, graph, uuid)
+			GenerateEdge(start, end, event, graph)
 		}
-		pageNumber++
 	}
 	// 2. 遍历 Net 表
-	pageNumber = 1
+	lastID = 0
 	for {
-		var nets []models.Net
-		db.Order("id").Limit(pageSize).Offset((pageNumber - 1) * pageSize).Find(&nets)
+		nets, _ := s.ScanNets(lastID, pageSize, uuid)
 		if len(nets) == 0 {
 			break
 		}
 		for _, net := range nets {
-			var startSocket models.Socket
-			var endSocket models.Socket
-			result1 := startSocket.FindByID(db, net.SrcID)
-			result2 := endSocket.FindByID(db, net.DstID)
-			if !(result1 && result2) {
+			lastID = net.ID
+			if mergedNets[net.ID] {
+				continue
+			}
+			start, end, ok := NetVertices(s, net)
+			if !ok {
 				continue
 			}
-			GenerateEdge(startSocket, endSocket, net, graph, uuid)
+			GenerateEdge(start, end, net, graph)
 		}
-		pageNumber++
 	}
 	return graph
 }
 
+// EventVertices 根据 event 的事件类型查询其起点和终点，任一顶点不存在时返回 false
+func EventVertices(s store.Store, event models.Event) (models.DotVertex, models.DotVertex, bool) {
+	var srcTable, dstTable string
+	switch event.EventClass { // eventType 决定了从哪两个表中查询数据
+	case parser.PROCESS: // process -> process
+		srcTable, dstTable = ProcessTable, ProcessTable
+	case parser.FILEV1: // process -> file
+		srcTable, dstTable = ProcessTable, FileTable
+	case parser.FILEV2: // file -> process
+		srcTable, dstTable = FileTable, ProcessTable
+	case parser.NETWORKV1: // process -> socket
+		srcTable, dstTable = ProcessTable, SocketTable
+	case parser.NETWORKV2: // socket -> process
+		srcTable, dstTable = SocketTable, ProcessTable
+	default:
+		logs.Logger.Warnf("Unknown event class: %s in event tables", event.EventClass)
+		return nil, nil, false
+	}
+	start, err1 := findVertex(s, srcTable, event.SrcID)
+	end, err2 := findVertex(s, dstTable, event.DstID)
+	return start, end, err1 == nil && err2 == nil
+}
+
+// NetVertices 查询 net 边两端的 socket
+func NetVertices(s store.Store, net models.Net) (models.DotVertex, models.DotVertex, bool) {
+	start, err1 := findVertex(s, SocketTable, net.SrcID)
+	end, err2 := findVertex(s, SocketTable, net.DstID)
+	return start, end, err1 == nil && err2 == nil
+}
+
+// findVertex 从指定表中查询顶点
+func findVertex(s store.Store, table string, id int) (models.DotVertex, error) {
+	var vertex models.DotVertex
+	var err error
+	switch table {
+	case ProcessTable:
+		vertex, err = s.GetProcess(id)
+	case FileTable:
+		vertex, err = s.GetFile(id)
+	case SocketTable:
+		vertex, err = s.GetSocket(id)
+	}
+	if err != nil {
+		logs.Logger.Errorf("query %s by id = %d failed: %v", table, id, err)
+	}
+	return vertex, err
+}
+
 // GenerateDot 生成dot图文件
 func GenerateDot(fileName string, uuid string) {
 	createDir("graphs/")
 	dotName := "graphs/" + fileName + ".dot"
-	graph := GenerateDotGraph(uuid)
+	graph := GenerateDotGraph(store.GetStore(), uuid)
 	// 写入文件中
 	fo, err := os.OpenFile(dotName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 	if err != nil {
@@ -135,19 +131,7 @@ func GenerateDot(fileName string, uuid string) {
 }
 
 // GenerateEdge 在图中生成一条边
-func GenerateEdge(startVertex models.DotVertex, endVertex models.DotVertex, edge models.DotEdge, graph *gographviz.Graph, uuid string) {
-	// 基于 UUID 过滤一部分边
-	if uuid != "" {
-		if !edge.HasEdgeUUID() {
-			return
-		}
-		uuidStr := edge.GetUUID()
-		uuids := strings.Split(uuidStr, ",")
-		if !helper.SliceContainsTarget(uuids, uuid) {
-			return
-		}
-	}
-
+func GenerateEdge(startVertex models.DotVertex, endVertex models.DotVertex, edge models.DotEdge, graph *gographviz.Graph) {
 	// 边属性
 	edgeM := make(map[string]string)
 	edgeM["label"] = edge.EdgeName()
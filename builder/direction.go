@@ -0,0 +1,46 @@
+package builder
+
+import "fmt"
+
+// Direction 溯源的方向，也用来标记溯源图中的顶点是从哪个方向到达的
+type Direction string
+
+const (
+	Backward Direction = "backward" // 逆向：哪些顶点在之前影响了 root
+	Forward  Direction = "forward"  // 正向：root 在之后影响了哪些顶点
+	Both     Direction = "both"     // 正向与逆向，两次遍历分别使用各自的时间戳限制
+	Origin   Direction = "root"     // 只用于标记起点（root）顶点
+)
+
+// ParseDirection 解析 backward、forward、both，空字符串为 Backward
+func ParseDirection(s string) (Direction, error) {
+	switch d := Direction(s); d {
+	case "":
+		return Backward, nil
+	case Backward, Forward, Both:
+		return d, nil
+	}
+	return "", fmt.Errorf("direction is not valid: %s, use backward, forward or both", s)
+}
+
+// merge 顶点被另一个方向再次到达时的标记
+func (d Direction) merge(other Direction) Direction {
+	switch {
+	case d == "" || d == other:
+		return other
+	case d == Origin:
+		return Origin
+	}
+	return Both
+}
+
+// color dot 中顶点的颜色，逆向到达的顶点与 root 保持默认颜色
+func (d Direction) color() string {
+	switch d {
+	case Forward:
+		return "blue"
+	case Both:
+		return "purple"
+	}
+	return ""
+}
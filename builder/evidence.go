@@ -0,0 +1,100 @@
+package builder
+
+import (
+	"erinyes/archive"
+	"erinyes/conf"
+	"erinyes/models"
+	"erinyes/store"
+	"fmt"
+	"gonum.org/v1/gonum/graph/multi"
+	"sort"
+	"sync"
+)
+
+// Evidence 一条边及产生它的原始日志
+type Evidence struct {
+	Table string `json:"table"`
+	ID    int    `json:"id"`
+	archive.Ref
+	Raw   string `json:"raw"`
+	Count int    `json:"count,omitempty"` // 合并到该边上的事件数（见 Inserter.Reduce），大于 1 时 Raw 只是第一次事件的原始日志，其余事件的原始日志没有保留
+	Error string `json:"error,omitempty"` // 边不存在、没有记录原始日志或读取归档失败的原因
+}
+
+var (
+	evidenceArchive     *archive.Archive
+	evidenceArchiveErr  error
+	evidenceArchiveOnce sync.Once
+)
+
+// rawArchive 打开 conf.Config.Archive.Dir 中的归档，关闭归档后仍然可以读取之前记录的原始日志
+func rawArchive() (*archive.Archive, error) {
+	evidenceArchiveOnce.Do(func() {
+		evidenceArchive, evidenceArchiveErr = archive.Open(conf.Config.Archive.Dir)
+	})
+	return evidenceArchive, evidenceArchiveErr
+}
+
+// SubgraphEdges 返回溯源子图中所有边在数据库中的位置，按表和主键排序
+func SubgraphEdges(g *multi.WeightedDirectedGraph) []RecordLoc {
+	var edges []RecordLoc
+	es := g.Edges()
+	for es.Next() {
+		e := es.Edge()
+		lines := g.WeightedLines(e.From().ID(), e.To().ID())
+		for lines.Next() {
+			if l := lines.WeightedLine().(GraphLine); l.Record.Table != "" {
+				edges = append(edges, l.Record)
+			}
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Table != edges[j].Table {
+			return edges[i].Table < edges[j].Table
+		}
+		return edges[i].Key < edges[j].Key
+	})
+	return edges
+}
+
+// FetchEvidence 读取每条边对应的原始日志，单条边失败时记录在其 Error 中，不影响其他边
+func FetchEvidence(s store.Store, edges []RecordLoc) []Evidence {
+	a, err := rawArchive()
+	evidences := make([]Evidence, len(edges))
+	for i, edge := range edges {
+		evidences[i] = Evidence{Table: edge.Table, ID: edge.Key}
+		ref, count, refErr := edgeRef(s, edge)
+		if refErr != nil {
+			evidences[i].Error = refErr.Error()
+			continue
+		}
+		evidences[i].Ref, evidences[i].Count = ref, count
+		if err != nil {
+			evidences[i].Error = err.Error()
+			continue
+		}
+		if evidences[i].Raw, refErr = a.Read(ref); refErr != nil {
+			evidences[i].Error = refErr.Error()
+		}
+	}
+	return evidences
+}
+
+// edgeRef 查询边上记录的原始日志位置，以及合并到边上的事件数
+func edgeRef(s store.Store, edge RecordLoc) (archive.Ref, int, error) {
+	switch edge.Table {
+	case (models.Event{}).TableName():
+		e, err := s.GetEvent(edge.Key)
+		if err != nil {
+			return archive.Ref{}, 0, err
+		}
+		return archive.Ref{Segment: e.RawSegment, Offset: e.RawOffset, Length: e.RawLength}, e.Count, nil
+	case (models.Net{}).TableName():
+		n, err := s.GetNet(edge.Key)
+		if err != nil {
+			return archive.Ref{}, 0, err
+		}
+		return archive.Ref{Segment: n.RawSegment, Offset: n.RawOffset, Length: n.RawLength}, 0, nil
+	}
+	return archive.Ref{}, 0, fmt.Errorf("unknown edge table %s", edge.Table)
+}
@@ -0,0 +1,50 @@
+package builder
+
+import (
+	"erinyes/models"
+	"strings"
+)
+
+// RetError 作为 EventFilter.Ret 时匹配所有失败（返回值为负数）的系统调用
+const RetError = "error"
+
+// EventFilter 按系统调用属性过滤 event 边，字段为零值时不限制；net 边没有这些属性，不受影响
+type EventFilter struct {
+	Pid      string `json:"pid"`
+	Tid      string `json:"tid"`
+	Ret      string `json:"ret"`      // 返回值，RetError 匹配所有失败的系统调用
+	MinBytes int64  `json:"minBytes"` // 读写的字节数不少于该值
+	Arg      string `json:"arg"`      // 原始参数中包含该子串，需要开启 Inserter.KeepArgs
+}
+
+// IsEmpty 是否没有任何过滤条件
+func (f EventFilter) IsEmpty() bool {
+	return f == EventFilter{}
+}
+
+// Match 判断 event 边是否满足全部过滤条件
+func (f EventFilter) Match(e models.Event) bool {
+	if f.Pid != "" && e.Pid != f.Pid {
+		return false
+	}
+	if f.Tid != "" && e.Tid != f.Tid {
+		return false
+	}
+	if f.Ret == RetError {
+		if !strings.HasPrefix(e.Ret, "-") {
+			return false
+		}
+	} else if f.Ret != "" && e.Ret != f.Ret {
+		return false
+	}
+	if f.MinBytes > 0 && e.Bytes < f.MinBytes {
+		return false
+	}
+	if f.Arg != "" {
+		args, err := e.DecodeArgs()
+		if err != nil || !strings.Contains(strings.Join(args, " "), f.Arg) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,266 @@
+package builder
+
+import (
+	"erinyes/logs"
+	"erinyes/models"
+	"erinyes/store"
+	"fmt"
+)
+
+// frontierEdge 与当前层某个顶点相连的一条 event 或 net 边
+type frontierEdge struct {
+	neighbour RecordLoc // 边另一端的顶点
+	relation  string
+	time      int64 // 第一次发生的时间
+	endTime   int64 // 最后一次发生的时间，合并的重复边晚于 time
+	record    RecordLoc
+}
+
+// before 逆向遍历时边是否有发生在时间戳 t 之前（含）的事件
+func (e frontierEdge) before(t int64) bool {
+	return e.time <= t
+}
+
+// after 正向遍历时边是否有发生在时间戳 t 之后（含）的事件
+func (e frontierEdge) after(t int64) bool {
+	return e.endTime >= t
+}
+
+// reachedAt 经过这条边到达另一端顶点的时间：正向为不早于 t 的第一次事件，逆向为第一次事件
+// CPR 保证合并的事件之间终点没有流出（正向）、起点没有流入（逆向），取其中任何一次得到的子图相同
+func (e frontierEdge) reachedAt(t int64, reverse bool) int64 {
+	if !reverse && t > e.time {
+		return t
+	}
+	return e.time
+}
+
+// entity 从存储中读取的顶点
+type entity struct {
+	nodeType NodeType
+	nodeInfo NodeInfo
+}
+
+// levelFetcher 取出当前层每个顶点满足 uuid、window 与 filter 的边（event 边在 net 边之前），以及读取边另一端顶点的方法
+// partial 为 true 时可以加入子图的边超过了 MaxEdges 剩余的数量，只读取了其中一部分
+type levelFetcher func(q *query, frontier []RecordLoc, node2time map[RecordLoc]int64, reverse bool, window store.TimeWindow) (edges map[RecordLoc][]frontierEdge, lookup func(RecordLoc) (entity, error), partial bool, err error)
+
+// frontierWindow 当前层所有顶点时间戳限制的并集：逆向不晚于最大的时间戳，正向不早于最小的时间戳，有顶点没有时间戳时不限制
+// 处理该层时顶点的时间戳只会更新为已经满足限制的边的时间，不会超出这个范围
+func frontierWindow(frontier []RecordLoc, node2time map[RecordLoc]int64, reverse bool) store.TimeWindow {
+	var bound int64
+	for _, loc := range frontier {
+		t := node2time[loc]
+		if t == 0 {
+			return store.TimeWindow{}
+		}
+		if bound == 0 || reverse && t > bound || !reverse && t < bound {
+			bound = t
+		}
+	}
+	if reverse {
+		return store.TimeWindow{To: bound}
+	}
+	return store.TimeWindow{From: bound}
+}
+
+// eventEdge 将 event 边转换为从表 table 中当前层顶点出发的边，返回当前层的顶点
+func eventEdge(e models.Event, table string, reverse bool) (RecordLoc, frontierEdge, error) {
+	tableName, err := GetTableName(e.EventClass, reverse)
+	if err != nil {
+		return RecordLoc{}, frontierEdge{}, err
+	}
+	cur, neighbour := RecordLoc{Key: e.SrcID, Table: table}, RecordLoc{Key: e.DstID, Table: tableName}
+	if reverse {
+		cur, neighbour = RecordLoc{Key: e.DstID, Table: table}, RecordLoc{Key: e.SrcID, Table: tableName}
+	}
+	end := e.EndTime
+	if end < e.Time {
+		end = e.Time
+	}
+	return cur, frontierEdge{neighbour: neighbour, relation: e.Relation, time: e.Time, endTime: end, record: RecordLoc{Key: e.ID, Table: e.TableName()}}, nil
+}
+
+// netEdge 将 net 边转换为从当前层 socket 出发的边，返回当前层的顶点
+func netEdge(n models.Net, reverse bool) (RecordLoc, frontierEdge) {
+	cur, neighbour := RecordLoc{Key: n.SrcID, Table: SocketTable}, RecordLoc{Key: n.DstID, Table: SocketTable}
+	if reverse {
+		cur, neighbour = neighbour, cur
+	}
+	return cur, frontierEdge{neighbour: neighbour, relation: n.Method, time: n.Time, endTime: n.Time, record: RecordLoc{Key: n.ID, Table: n.TableName()}}
+}
+
+// edgeBudget 子图还可以加入的边数，为 -1 时不限制
+func (q *query) edgeBudget() int {
+	if q.opts.MaxEdges <= 0 {
+		return -1
+	}
+	if n := q.opts.MaxEdges - len(q.addedEventLine) - len(q.addedNetLine); n > 0 {
+		return n
+	}
+	return 0
+}
+
+// fetchLevel 按层批量读取：当前层的边按顶点所在的表用 IN 查询按主键分页取出，uuid 与 window 在查询中过滤，边另一端不在图中的顶点再按表批量读取
+// 设置了 MaxEdges 时每页不超过剩余的边数（多读一条用来判断是否超过），读到的可以加入子图的边超过剩余的边数后不再读取，该层一定会被截断；
+// 没有设置时一次读取所有的边
+func fetchLevel(q *query, frontier []RecordLoc, node2time map[RecordLoc]int64, reverse bool, window store.TimeWindow) (map[RecordLoc][]frontierEdge, func(RecordLoc) (entity, error), bool, error) {
+	keys := make(map[string][]int)
+	for _, loc := range frontier {
+		keys[loc.Table] = append(keys[loc.Table], loc.Key)
+	}
+	edges := make(map[RecordLoc][]frontierEdge)
+	budget, fresh, partial := q.edgeBudget(), 0, false // fresh 为已经读取的、可以加入子图的边数
+	// candidate 边不在图中且满足当前顶点的时间戳；处理该层时顶点的时间戳只会放宽，满足的边在遍历时一定也满足
+	candidate := func(cur RecordLoc, edge frontierEdge, added map[int]bool) bool {
+		t := node2time[cur]
+		return !added[edge.record.Key] && (!q.opts.TimeLimit || t == 0 || reverse && edge.before(t) || !reverse && edge.after(t))
+	}
+	pageLimit := func() int {
+		if budget < 0 {
+			return 0
+		}
+		return budget - fresh + 1
+	}
+	exceeded := func() bool {
+		partial = partial || budget >= 0 && fresh > budget
+		return partial
+	}
+	for _, table := range []string{ProcessTable, FileTable, SocketTable} {
+		if len(keys[table]) == 0 {
+			continue
+		}
+		for afterID := 0; !exceeded(); {
+			limit := pageLimit()
+			events, err := q.s.FetchFrontierEvents(q.ctx, keys[table], eventClasses(table, reverse), reverse, q.opts.UUID, window, afterID, limit)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			for _, e := range events {
+				afterID = e.ID
+				if !q.opts.Filter.Match(e) {
+					continue
+				}
+				cur, edge, err := eventEdge(e, table, reverse)
+				if err != nil {
+					logs.Logger.WithError(err).Errorf("failed to get table name")
+					continue // 忽略这条边以及对应的顶点
+				}
+				edges[cur] = append(edges[cur], edge)
+				if candidate(cur, edge, q.addedEventLine) {
+					fresh++
+				}
+			}
+			if limit == 0 || len(events) < limit {
+				break
+			}
+		}
+	}
+	if len(keys[SocketTable]) > 0 {
+		for afterID := 0; !exceeded(); {
+			limit := pageLimit()
+			nets, err := q.s.FetchFrontierNets(q.ctx, keys[SocketTable], reverse, q.opts.UUID, window, afterID, limit)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			for _, n := range nets {
+				afterID = n.ID
+				cur, edge := netEdge(n, reverse)
+				edges[cur] = append(edges[cur], edge)
+				if candidate(cur, edge, q.addedNetLine) {
+					fresh++
+				}
+			}
+			if limit == 0 || len(nets) < limit {
+				break
+			}
+		}
+	}
+	entities, err := q.loadEntities(edges)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return edges, func(loc RecordLoc) (entity, error) {
+		if en, ok := entities[loc]; ok {
+			return en, nil
+		}
+		return entity{}, fmt.Errorf("%s %d not found", loc.Table, loc.Key)
+	}, partial, nil
+}
+
+// fetchLevelPerNode 逐个顶点查询边，逐个读取新顶点，结果与 fetchLevel 相同，只用于与其比较性能
+func fetchLevelPerNode(q *query, frontier []RecordLoc, _ map[RecordLoc]int64, reverse bool, window store.TimeWindow) (map[RecordLoc][]frontierEdge, func(RecordLoc) (entity, error), bool, error) {
+	edges := make(map[RecordLoc][]frontierEdge)
+	for _, cur := range frontier {
+		for _, e := range FetchEvents(q.s, cur.Key, cur.Table, reverse, q.opts.UUID) {
+			if !window.Overlaps(e.Time, e.EndTime) || !q.opts.Filter.Match(e) {
+				continue
+			}
+			_, edge, err := eventEdge(e, cur.Table, reverse)
+			if err != nil {
+				logs.Logger.WithError(err).Errorf("failed to get table name")
+				continue
+			}
+			edges[cur] = append(edges[cur], edge)
+		}
+		for _, n := range FetchNets(q.s, cur.Key, cur.Table, reverse, q.opts.UUID) {
+			if window.Contains(n.Time) {
+				_, edge := netEdge(n, reverse)
+				edges[cur] = append(edges[cur], edge)
+			}
+		}
+	}
+	return edges, func(loc RecordLoc) (entity, error) {
+		nodeType, nodeInfo, err := GetEntityNode(q.s, loc)
+		return entity{nodeType, nodeInfo}, err
+	}, false, nil
+}
+
+// loadEntities 按表批量读取边另一端不在图中、也没有被排除的顶点，其中一部分可能因为时间戳或上限最终不会加入图中
+func (q *query) loadEntities(edges map[RecordLoc][]frontierEdge) (map[RecordLoc]entity, error) {
+	keys := make(map[string][]int)
+	seen := make(map[RecordLoc]bool)
+	for _, es := range edges {
+		for _, e := range es {
+			if _, ok := q.addedNode[e.neighbour]; ok || seen[e.neighbour] || q.excluded[e.neighbour] {
+				continue
+			}
+			seen[e.neighbour] = true
+			keys[e.neighbour.Table] = append(keys[e.neighbour.Table], e.neighbour.Key)
+		}
+	}
+	return q.loadVertices(keys)
+}
+
+// loadVertices 按表批量读取顶点，keys 为每个表中顶点的主键，不存在的顶点不在返回值中
+func (q *query) loadVertices(keys map[string][]int) (map[RecordLoc]entity, error) {
+	entities := make(map[RecordLoc]entity)
+	if len(keys[ProcessTable]) > 0 {
+		processes, err := q.s.GetProcesses(keys[ProcessTable])
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range processes {
+			entities[RecordLoc{Key: p.ID, Table: ProcessTable}] = entity{Process, processInfo(p)}
+		}
+	}
+	if len(keys[FileTable]) > 0 {
+		files, err := q.s.GetFiles(keys[FileTable])
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			entities[RecordLoc{Key: f.ID, Table: FileTable}] = entity{File, fileInfo(f)}
+		}
+	}
+	if len(keys[SocketTable]) > 0 {
+		sockets, err := q.s.GetSockets(keys[SocketTable])
+		if err != nil {
+			return nil, err
+		}
+		for _, so := range sockets {
+			entities[RecordLoc{Key: so.ID, Table: SocketTable}] = entity{Socket, socketInfo(so)}
+		}
+	}
+	return entities, nil
+}
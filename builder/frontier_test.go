@@ -0,0 +1,90 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// layeredEdges 生成 layers 层、每层 width 个顶点的图：偶数层为进程，奇数层为文件，每个顶点向下一层随机连 fanout 条边
+// 边的时间随层数递增并带有随机扰动，部分边为合并的重复边，因此时间戳限制会剪掉一部分路径
+func layeredEdges(layers int, width int, fanout int, seed int64) []fixtureEdge {
+	r := rand.New(rand.NewSource(seed))
+	name := func(layer int, i int) string {
+		if layer%2 == 0 {
+			return fmt.Sprintf("p%d_%d", layer, i)
+		}
+		return fmt.Sprintf("f%d_%d", layer, i)
+	}
+	var edges []fixtureEdge
+	for layer := 0; layer+1 < layers; layer++ {
+		for i := 0; i < width; i++ {
+			for k := 0; k < fanout; k++ {
+				time := int64(layer*100 + r.Intn(150) + 1)
+				var end int64
+				if r.Intn(4) == 0 {
+					end = time + int64(r.Intn(100))
+				}
+				edges = append(edges, fixtureEdge{name(layer, i), name(layer+1, r.Intn(width)), time, end})
+			}
+		}
+	}
+	return edges
+}
+
+func TestFetchLevelMatchesPerNode(t *testing.T) {
+	f := newFixture(t, layeredEdges(6, 8, 3, 1))
+	ts := func(t int64) *int64 { return &t }
+	depth := func(d int) *int { return &d }
+	cases := []struct {
+		name  string
+		roots []string
+		opts  Options
+	}{
+		{"backward", []string{"p4_0"}, Options{Direction: Backward}},
+		{"forward", []string{"p0_0"}, Options{Direction: Forward}},
+		{"both from the middle", []string{"f3_1"}, Options{Direction: Both}},
+		{"forward with time limit", []string{"p0_1"}, Options{Direction: Forward, TimeLimit: true, Timestamp: ts(50)}},
+		{"backward with time limit", []string{"p4_2"}, Options{Direction: Backward, TimeLimit: true, Timestamp: ts(450)}},
+		{"both with time limit", []string{"p2_3", "f1_4"}, Options{Direction: Both, TimeLimit: true, Timestamp: ts(250)}},
+		{"time window", []string{"p0_2"}, Options{Direction: Forward, From: 80, To: 320}},
+		{"depth", []string{"f5_0"}, Options{Direction: Backward, Depth: depth(2)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, level := f.run(t, context.Background(), c.roots, c.opts, fetchLevel)
+			_, node := f.run(t, context.Background(), c.roots, c.opts, fetchLevelPerNode)
+			if level.Truncated != "" || node.Truncated != "" {
+				t.Fatalf("truncated: %q, %q", level.Truncated, node.Truncated)
+			}
+			if len(SubgraphEdges(level.Graph)) == 0 {
+				t.Fatal("empty subgraph")
+			}
+			if !reflect.DeepEqual(reachedVertices(level.Graph), reachedVertices(node.Graph)) {
+				t.Fatalf("vertices %v, want %v", reachedVertices(level.Graph), reachedVertices(node.Graph))
+			}
+			if !reflect.DeepEqual(SubgraphEdges(level.Graph), SubgraphEdges(node.Graph)) {
+				t.Fatalf("edges %v, want %v", SubgraphEdges(level.Graph), SubgraphEdges(node.Graph))
+			}
+		})
+	}
+}
+
+func benchmarkFetch(b *testing.B, fetch levelFetcher) {
+	f := newFixture(b, layeredEdges(10, 200, 4, 1))
+	opts := Options{Direction: Both}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.run(b, context.Background(), []string{"p4_0", "p4_1"}, opts, fetch)
+	}
+}
+
+func BenchmarkFetchLevel(b *testing.B) {
+	benchmarkFetch(b, fetchLevel)
+}
+
+func BenchmarkFetchLevelPerNode(b *testing.B) {
+	benchmarkFetch(b, fetchLevelPerNode)
+}
@@ -0,0 +1,72 @@
+package builder
+
+import (
+	"encoding/json"
+	"gonum.org/v1/gonum/graph/multi"
+	"io/ioutil"
+)
+
+// JSONNode 溯源图顶点的 JSON 表示
+type JSONNode struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Name      string    `json:"name"`
+	Cluster   string    `json:"cluster"`
+	Direction Direction `json:"direction"` // 从哪个方向到达该顶点：root、backward、forward 或 both
+}
+
+// JSONEdge 溯源图边的 JSON 表示
+type JSONEdge struct {
+	From      int64   `json:"from"`
+	To        int64   `json:"to"`
+	Relation  string  `json:"relation"`
+	TimeStamp int64   `json:"timestamp"`
+	Weight    float64 `json:"weight"`
+}
+
+// JSONGraph 溯源图的 JSON 表示
+type JSONGraph struct {
+	Nodes []JSONNode `json:"nodes"`
+	Edges []JSONEdge `json:"edges"`
+}
+
+// ToJSONGraph 将带权有向多重图转换为 JSON 表示
+func ToJSONGraph(g *multi.WeightedDirectedGraph) JSONGraph {
+	jg := JSONGraph{Nodes: []JSONNode{}, Edges: []JSONEdge{}}
+	nodes := g.Nodes()
+	for nodes.Next() {
+		n := nodes.Node().(GraphNode)
+		jg.Nodes = append(jg.Nodes, JSONNode{
+			ID:        n.ID(),
+			Type:      n.nodeType.String(),
+			Name:      n.nodeInfo.Info(),
+			Cluster:   n.nodeInfo.Flag(),
+			Direction: n.Reached(),
+		})
+	}
+	edges := g.Edges()
+	for edges.Next() {
+		e := edges.Edge()
+		lines := g.WeightedLines(e.From().ID(), e.To().ID())
+		for lines.Next() {
+			l := lines.WeightedLine().(GraphLine)
+			jg.Edges = append(jg.Edges, JSONEdge{
+				From:      l.From().ID(),
+				To:        l.To().ID(),
+				Relation:  l.Relation,
+				TimeStamp: l.TimeStamp,
+				Weight:    l.W,
+			})
+		}
+	}
+	return jg
+}
+
+// WriteJSON 将带权有向多重图写为 JSON 文件
+func WriteJSON(g *multi.WeightedDirectedGraph, path string) error {
+	data, err := json.MarshalIndent(ToJSONGraph(g), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0666)
+}
@@ -28,6 +28,19 @@ func callSystem(s string, args ...string) error {
 
 // Visualize 可视化带权有向多重图
 func Visualize(g *multi.WeightedDirectedGraph, filename string) error {
+	if err := WriteDot(g, "graphs/"+filename+".dot"); err != nil {
+		return err
+	}
+	return RenderSVG("graphs/"+filename+".dot", "graphs/"+filename+".svg")
+}
+
+// RenderSVG 调用 graphviz 将 dot 文件渲染为 svg
+func RenderSVG(dotPath string, svgPath string) error {
+	return callSystem("dot", "-T", "svg", dotPath, "-o", svgPath)
+}
+
+// WriteDot 将带权有向多重图写为 dot 文件
+func WriteDot(g *multi.WeightedDirectedGraph, path string) error {
 	graphAst, _ := gographviz.ParseString(`digraph G{}`)
 	graph := gographviz.NewGraph()
 	if err := gographviz.Analyse(graphAst, graph); err != nil {
@@ -40,6 +53,9 @@ func Visualize(g *multi.WeightedDirectedGraph, filename string) error {
 		N := nodes.Node()
 		n := N.(GraphNode)
 		GenerateVertex(n, graph)
+		if color := n.Reached().color(); color != "" { // 正向到达的顶点用颜色区分
+			graph.Nodes.Lookup[n.VertexName()].Attrs.Add("color", color)
+		}
 	}
 
 	// 填入所有edge
@@ -72,9 +88,5 @@ func Visualize(g *multi.WeightedDirectedGraph, filename string) error {
 	}
 	logs.Logger.Infof("Edges: %d", count)
 	//fmt.Println(graph.String())
-	if err := ioutil.WriteFile("graphs/"+filename+".dot", []byte(graph.String()), 0666); err != nil {
-		return err
-	}
-	return callSystem("dot", "-T", "svg", "graphs/"+filename+".dot", "-o", "graphs/"+filename+".svg")
-	//return nil
+	return ioutil.WriteFile(path, []byte(graph.String()), 0666)
 }
@@ -0,0 +1,131 @@
+package builder
+
+import (
+	"context"
+	"erinyes/conf"
+	"erinyes/store"
+	"fmt"
+	"gonum.org/v1/gonum/graph/multi"
+	"time"
+)
+
+// Options 一次溯源的参数与限制，零值为逆向溯源、不限制层数与时间、不截断
+type Options struct {
+	Direction Direction
+	Depth     *int   // 最大层数，为空时不限制
+	Timestamp *int64 // 所有起点的时间戳，为空时见 ProvenanceFrom
+	TimeLimit bool   // 正向只经过时间递增的边，逆向只经过时间递减的边
+	UUID      string // 只经过属于该请求的边
+	Filter    EventFilter
+	From      int64 // 只经过时间在 [From, To] 内的边（16 位微秒时间戳），为 0 的一端不限制
+	To        int64
+	MaxNodes  int           // 子图最多的顶点数（包括起点），为 0 时不限制
+	MaxEdges  int           // 子图最多的边数，为 0 时不限制
+	Timeout   time.Duration // 溯源的最长时间，与调用方 ctx 的期限取较早者，为 0 时不限制
+	// Exclude 匹配其中任一模式的顶点不加入子图，也不再从其继续遍历，* 匹配任意字符串
+	// 文件匹配路径，进程匹配可执行文件路径或名称，socket 匹配 <ip>:<port>；起点不受影响
+	Exclude []string
+}
+
+// DefaultOptions 开启时间戳限制，超时、上限与排除的顶点使用配置 Provenance 中的默认值
+func DefaultOptions() Options {
+	return Options{
+		TimeLimit: true,
+		Timeout:   time.Duration(conf.Config.Provenance.Timeout) * time.Second,
+		MaxNodes:  conf.Config.Provenance.MaxNodes,
+		MaxEdges:  conf.Config.Provenance.MaxEdges,
+		Exclude:   append([]string(nil), conf.Config.Provenance.Exclude...),
+	}
+}
+
+// window 与 [From, To] 相交后的时间范围
+func (o Options) window(w store.TimeWindow) store.TimeWindow {
+	if o.From != 0 && (w.From == 0 || o.From > w.From) {
+		w.From = o.From
+	}
+	if o.To != 0 && (w.To == 0 || o.To < w.To) {
+		w.To = o.To
+	}
+	return w
+}
+
+// excludes 顶点是否匹配 Exclude 中的任一模式
+func (o Options) excludes(info NodeInfo) bool {
+	var values []string
+	switch i := info.(type) {
+	case ProcessInfo:
+		values = []string{i.Path, i.Name}
+	case FileInfo:
+		values = []string{i.Path}
+	case SocketInfo:
+		values = []string{i.DstIP + ":" + i.DstPort}
+	}
+	for _, pattern := range o.Exclude {
+		for _, v := range values {
+			if store.MatchPattern(pattern, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Truncation 溯源提前结束的原因，为空时没有截断
+type Truncation string
+
+const (
+	TruncatedNodes    Truncation = "max_nodes" // 顶点数达到 MaxNodes，仍有顶点没有加入
+	TruncatedEdges    Truncation = "max_edges" // 边数达到 MaxEdges，仍有边没有加入
+	TruncatedTimeout  Truncation = "timeout"   // ctx 超时
+	TruncatedCanceled Truncation = "canceled"  // ctx 被取消，如 HTTP 请求已经断开
+	TruncatedError    Truncation = "error"     // 读取存储失败
+)
+
+// Result 溯源的结果，Truncated 不为空时子图只包含截断之前遍历到的部分
+type Result struct {
+	Graph     *multi.WeightedDirectedGraph
+	Truncated Truncation
+	Reason    string // 截断的具体原因
+}
+
+// truncate 记录截断的原因，只保留第一次
+func (q *query) truncate(t Truncation) {
+	if q.result.Truncated != "" {
+		return
+	}
+	q.result.Truncated = t
+	switch t {
+	case TruncatedNodes:
+		q.result.Reason = fmt.Sprintf("subgraph reached max nodes %d", q.opts.MaxNodes)
+	case TruncatedEdges:
+		q.result.Reason = fmt.Sprintf("subgraph reached max edges %d", q.opts.MaxEdges)
+	case TruncatedTimeout:
+		q.result.Reason = "query exceeded its deadline"
+		if q.opts.Timeout > 0 {
+			q.result.Reason = fmt.Sprintf("query exceeded timeout %v", q.opts.Timeout)
+		}
+	case TruncatedCanceled:
+		q.result.Reason = "query canceled"
+	}
+}
+
+// fail 读取存储失败时记录截断的原因，ctx 结束导致的失败记录为超时或取消
+func (q *query) fail(err error) {
+	if q.stopped() {
+		return
+	}
+	q.truncate(TruncatedError)
+	q.result.Reason = fmt.Sprintf("failed to read store: %v", err)
+}
+
+// stopped ctx 结束时记录截断的原因，返回是否需要停止遍历
+func (q *query) stopped() bool {
+	switch q.ctx.Err() {
+	case nil:
+	case context.DeadlineExceeded:
+		q.truncate(TruncatedTimeout)
+	default:
+		q.truncate(TruncatedCanceled)
+	}
+	return q.result.Truncated != ""
+}
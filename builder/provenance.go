@@ -1,14 +1,14 @@
 package builder
 
 import (
+	"context"
 	"erinyes/helper"
 	"erinyes/logs"
 	"erinyes/models"
 	"erinyes/parser"
+	"erinyes/store"
 	"fmt"
 	"gonum.org/v1/gonum/graph/multi"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -18,57 +18,93 @@ const (
 	SocketTable  = "socket"
 )
 
-// RecordLoc 用来标识数据库中的一个顶点
+// RecordLoc 用来标识数据库中的一个顶点或一条边
 type RecordLoc struct {
 	Key   int    // primary key
 	Table string // identify which table
 }
 
-// Provenance 根据 processID 溯源
-func Provenance(hostID string, containerID string, processID string, processName string, timestamp *int64, depth *int, timeLimit bool, uuid string) *multi.WeightedDirectedGraph {
-	// get root process
-	mysqlDB := models.GetMysqlDB()
-	var process models.Process
-	if err := mysqlDB.First(&process, models.Process{HostID: hostID, ContainerID: containerID, ProcessVPID: processID, ProcessName: processName}).Error; err != nil {
-		logs.Logger.WithError(err).Errorf("failed to build subgraph for process[host: %s, container: %s,process_vid: %s, process_name: %s]", hostID, containerID, processID, processName)
-		return nil
-	}
-	g := multi.NewWeightedDirectedGraph()
-	addedEventLine := make(map[int]bool)   // key为db/event中的primary id
-	addedNetLine := make(map[int]bool)     // key为db/net中的primary id
-	addedNode := make(map[RecordLoc]int64) // key为RecordLoc value为GraphNode的id
-	id := AddNewGraphNode(g, Process,
-		ProcessInfo{
-			Path:          process.ProcessExepath,
-			Name:          process.ProcessName,
-			Pid:           process.ProcessVPID,
-			ContainerID:   process.ContainerID,
-			ContainerName: process.ContainerName,
-			HostID:        process.HostID,
-			HostName:      process.HostName})
+// Provenance 从 <hostID, containerID, processID, processName> 确定的进程溯源，见 ProvenanceFrom
+func Provenance(ctx context.Context, s store.Store, hostID string, containerID string, processID string, processName string, opts Options) (Result, error) {
+	return ProvenanceFrom(ctx, s, []Root{ProcessRootOf(hostID, containerID, processID, processName)}, opts)
+}
 
-	root := RecordLoc{Key: process.ID, Table: ProcessTable}
-	addedNode[root] = id // 存入已访问顶点集合
-	//logs.Logger.Infof("开始构建溯源图，processID: %s, processName: %s, 其所在表: %s, 对应主键: %d", processID, process.ProcessName, ProcessTable, process.ID)
-	//logs.Logger.Infof("开始正向BFS溯源...")
-	//startTime := time.Now()
-	node2time := make(map[RecordLoc]int64) // key为RecordLoc value为timestamp 使用该map进行搜索时的时间戳过滤
-	//if timestamp != nil {
-	//	node2time[root] = *timestamp
-	//}
-	//BFS(g, root, addedEventLine, addedNetLine, addedNode, node2time, false, depth, timeLimit, uuid)
-	//logs.Logger.Infof("It takes about %v seconds to forward BFS", time.Since(startTime).Seconds())
-	middleTime := time.Now()
-	logs.Logger.Infof("开始逆向BFS溯源...")
-	node2time = make(map[RecordLoc]int64) // 这里通过重新赋值来清空map 如果map不清空，时间戳过滤会产生错误
-	if timestamp != nil {
-		node2time[root] = *timestamp
+// ProvenanceFrom 从一个或多个起点同时溯源，每个起点都必须至少对应一个顶点，所有起点对应的顶点都标记为 Origin
+// direction 为 Both 时先正向再逆向遍历，两次遍历从起点的时间戳开始各自记录时间戳：正向只经过时间递增的边，逆向只经过时间递减的边
+// opts.Timestamp 不为空时作为所有起点的时间戳，否则 uuid 起点使用请求中的边的时间，其他起点不限制
+// 达到顶点、边的上限、ctx 结束或遍历中读取存储失败时停止遍历，返回已经遍历到的子图及截断的原因，起点不存在等错误才返回 error
+func ProvenanceFrom(ctx context.Context, s store.Store, roots []Root, opts Options) (Result, error) {
+	return provenanceFrom(ctx, s, roots, opts, fetchLevel)
+}
+
+// query 一次溯源中正向与逆向遍历共用的状态
+type query struct {
+	ctx            context.Context
+	s              store.Store
+	g              *multi.WeightedDirectedGraph
+	opts           Options
+	addedEventLine map[int]bool        // key为db/event中的primary id
+	addedNetLine   map[int]bool        // key为db/net中的primary id
+	addedNode      map[RecordLoc]int64 // key为RecordLoc value为GraphNode的id
+	excluded       map[RecordLoc]bool  // 匹配 opts.Exclude 的顶点
+	result         Result
+}
+
+// provenanceFrom 使用 fetch 取出每一层的边与顶点进行溯源
+func provenanceFrom(ctx context.Context, s store.Store, roots []Root, opts Options, fetch levelFetcher) (Result, error) {
+	if len(roots) == 0 {
+		return Result{}, fmt.Errorf("no root to build provenance graph")
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	q := &query{
+		ctx:            ctx,
+		s:              s,
+		g:              multi.NewWeightedDirectedGraph(),
+		opts:           opts,
+		addedEventLine: make(map[int]bool),
+		addedNetLine:   make(map[int]bool),
+		addedNode:      make(map[RecordLoc]int64),
+		excluded:       make(map[RecordLoc]bool),
 	}
-	BFS(g, root, addedEventLine, addedNetLine, addedNode, node2time, true, depth, timeLimit, uuid)
-	logs.Logger.Infof("It takes about %v seconds to backward BFS", time.Since(middleTime).Seconds())
-	logs.Logger.Infof("子图构建成功...")
-	//logs.Logger.Infof("It takes about %v seconds to build Provenance Graph", time.Since(startTime).Seconds())
-	return g
+	sd, err := q.resolveRoots(roots)
+	if err != nil {
+		return Result{}, err
+	}
+	// node2time key为RecordLoc value为timestamp 使用该map进行搜索时的时间戳过滤，正向与逆向使用单独的 map，混用会产生错误的过滤
+	rootTimes := func(times map[RecordLoc]int64) map[RecordLoc]int64 {
+		node2time := make(map[RecordLoc]int64)
+		for _, loc := range sd.locs {
+			if opts.Timestamp != nil {
+				node2time[loc] = *opts.Timestamp
+			} else if times[loc] != 0 {
+				node2time[loc] = times[loc]
+			}
+		}
+		return node2time
+	}
+	if (opts.Direction == Forward || opts.Direction == Both) && q.result.Truncated == "" {
+		startTime := time.Now()
+		logs.Logger.Infof("开始正向BFS溯源...")
+		q.bfs(sd.locs, rootTimes(sd.first), false, fetch)
+		logs.Logger.Infof("It takes about %v seconds to forward BFS", time.Since(startTime).Seconds())
+	}
+	if opts.Direction != Forward && q.result.Truncated == "" {
+		middleTime := time.Now()
+		logs.Logger.Infof("开始逆向BFS溯源...")
+		q.bfs(sd.locs, rootTimes(sd.last), true, fetch)
+		logs.Logger.Infof("It takes about %v seconds to backward BFS", time.Since(middleTime).Seconds())
+	}
+	if q.result.Truncated != "" {
+		logs.Logger.Warnf("子图构建被截断: %s", q.result.Reason)
+	} else {
+		logs.Logger.Infof("子图构建成功...")
+	}
+	q.result.Graph = q.g
+	return q.result, nil
 }
 
 func AddNewGraphNode(g *multi.WeightedDirectedGraph, nodeType NodeType, nodeInfo NodeInfo) int64 {
@@ -77,12 +113,13 @@ func AddNewGraphNode(g *multi.WeightedDirectedGraph, nodeType NodeType, nodeInfo
 		id:       temp.ID(),
 		nodeType: nodeType,
 		nodeInfo: nodeInfo,
+		reached:  new(Direction),
 	}
 	g.AddNode(graphNode)
 	return temp.ID()
 }
 
-func AddNewGraphEdge(g *multi.WeightedDirectedGraph, from int64, to int64, relation string, timestamp int64, weight float64) {
+func AddNewGraphEdge(g *multi.WeightedDirectedGraph, from int64, to int64, relation string, timestamp int64, weight float64, record RecordLoc) {
 	weightedLine := g.NewWeightedLine(GraphNode{id: from}, GraphNode{id: to}, weight)
 	graphLine := GraphLine{
 		F:         g.Node(from),
@@ -91,263 +128,162 @@ func AddNewGraphEdge(g *multi.WeightedDirectedGraph, from int64, to int64, relat
 		Relation:  relation,
 		TimeStamp: timestamp,
 		UID:       weightedLine.ID(),
+		Record:    record,
 	}
 	g.SetWeightedLine(graphLine)
 }
 
-// BFS 对数据库进行遍历，获取某个实体int的所有前向(后向)遍历子图(不包括root)
-func BFS(g *multi.WeightedDirectedGraph, root RecordLoc, addedEventLine map[int]bool, addedNetLine map[int]bool, addedNode map[RecordLoc]int64, node2time map[RecordLoc]int64, reverse bool, maxLevel *int, timeLimit bool, uuid string) {
+// bfs 对数据库进行遍历，获取 roots 中所有实体的前向(后向)遍历子图(不包括roots)，经过的顶点标记为 Forward(Backward)
+// 按层遍历：fetch 取出当前层所有顶点的边（uuid 与该层的时间范围已经过滤），边仍按顶点在队列中的顺序处理
+// 加入顶点或边会超过上限、ctx 结束或读取存储失败时停止，截断的原因记录在 q.result 中
+func (q *query) bfs(roots []RecordLoc, node2time map[RecordLoc]int64, reverse bool, fetch levelFetcher) {
 	// 无需处理root
-	visitedNode := map[RecordLoc]bool{root: true}
-	var queue []RecordLoc
-	currLevel := 0
-	queue = append(queue, root)
-	for {
-		if len(queue) == 0 { // isEmpty(queue)
+	visitedNode := make(map[RecordLoc]bool, len(roots))
+	for _, root := range roots {
+		visitedNode[root] = true
+	}
+	reached := Direction(helper.MyStringIf(reverse, string(Backward), string(Forward)))
+	queue := append([]RecordLoc(nil), roots...)
+	for currLevel := 0; len(queue) > 0; currLevel++ {
+		if q.opts.Depth != nil && currLevel >= *q.opts.Depth { // 到达指定遍历层数
 			break
 		}
-		if maxLevel != nil {
-			if currLevel >= *maxLevel { // 到达指定遍历层数
-				break
-			}
+		if q.stopped() {
+			return
+		}
+		window := q.opts.window(store.TimeWindow{})
+		if q.opts.TimeLimit {
+			window = q.opts.window(frontierWindow(queue, node2time, reverse))
+		}
+		edges, lookup, partial, err := fetch(q, queue, node2time, reverse, window)
+		if err != nil {
+			logs.Logger.WithError(err).Errorf("failed to fetch level %d from db", currLevel)
+			q.fail(err)
+			return
 		}
-		size := len(queue)
-		for i := 0; i < size; i++ { // 遍历当前层所有顶点（已经处理过）
-			cur := queue[0]                                    // 必须用0 不能用i
-			events := FetchEvents(cur.Key, cur.Table, reverse) // 寻找该顶点出发的所有Event边
-			for _, e := range events {
-				if uuid != "" {
-					uuids := strings.Split(e.UUID, ",")
-					if !helper.SliceContainsTarget(uuids, uuid) {
+		var next []RecordLoc
+		for _, cur := range queue {
+			if q.stopped() {
+				return
+			}
+			for _, e := range edges[cur] {
+				if q.opts.TimeLimit && node2time[cur] != 0 {
+					if reverse && !e.before(node2time[cur]) || !reverse && !e.after(node2time[cur]) { // 逆向时间戳应该递减，正向应该递增
 						continue
 					}
 				}
-				if timeLimit { // 时间戳限制
-					if reverse { // 逆向搜索，时间戳应该递减
-						if node2time[cur] != 0 && node2time[cur] < e.Time {
-							continue
-						}
-					} else { // 正向搜索，时间戳应该递增
-						if node2time[cur] != 0 && node2time[cur] > e.Time {
-							continue
-						}
-					}
+				at := e.reachedAt(node2time[cur], reverse)
+				added := q.addedEventLine
+				if e.record.Table == (models.Net{}).TableName() {
+					added = q.addedNetLine
 				}
-				// 先存顶点
-				var tempRecord RecordLoc
-				tableName, err := GetTableName(e.EventClass, reverse)
-				if err != nil {
-					logs.Logger.WithError(err).Errorf("failed to get table name")
-					continue // 忽略这条边以及对应的顶点
-				}
-				if reverse { // 逆向
-					tempRecord = RecordLoc{Key: e.SrcID, Table: tableName}
-				} else { // 正向
-					tempRecord = RecordLoc{Key: e.DstID, Table: tableName}
-				}
-				if _, ok := visitedNode[tempRecord]; !ok { // 该顶点没有访问过
-					// 判断该顶点是否已经存在于图中
-					if _, ok := addedNode[tempRecord]; ok { // 该顶点已经在图中
-						visitedNode[tempRecord] = true
-						queue = append(queue, tempRecord) // 该顶点已经存在于图中，但依然需要遍历一次（正向和逆向都经过该点，但后续路劲存在差异）
-					} else { // 该顶点不在图中
-						if nodeType, nodeInfo, err := GetEntityNode(tempRecord); err != nil {
-							logs.Logger.WithError(err).Errorf("failed to fetch entity")
-							continue // 不再考虑边
-						} else {
-							id := AddNewGraphNode(g, nodeType, nodeInfo) // 处理该顶点，加入图中
-							visitedNode[tempRecord] = true
-							addedNode[tempRecord] = id
-							queue = append(queue, tempRecord) // 只有将该顶点成功加入Graph中，才将该顶点送入queue
-						}
-					}
-					// 该顶点没有访问过（即便由于此前的一次正向遍历，已经存在于图中），直接赋值时间戳
-					if timeLimit {
-						node2time[tempRecord] = e.Time
-					}
-				} else { // 该顶点访问过，需要更新一次时间戳
-					if timeLimit {
-						if reverse { // 逆向搜索，时间戳取max
-							if node2time[tempRecord] != 0 && node2time[tempRecord] < e.Time {
-								node2time[tempRecord] = e.Time
-							}
-						} else { // 正向搜索，时间戳取min
-							if node2time[tempRecord] != 0 && node2time[tempRecord] > e.Time {
-								node2time[tempRecord] = e.Time
-							}
-						}
-					}
-				}
-				// 再存边
-				if _, ok := addedEventLine[e.ID]; !ok { // 该事件(line)没有访问过
-					addedEventLine[e.ID] = true
-					var (
-						fromID int64
-						toID   int64
-						tempA  int64
-						tempB  int64
-					)
-					if tempA, ok = addedNode[tempRecord]; !ok {
-						panic("No such Node in the graph")
-					}
-					if tempB, ok = addedNode[cur]; !ok {
-						panic("No such Node in the graph")
-					}
-					if reverse { // 逆向
-						fromID = tempA
-						toID = tempB
-					} else { // 正向
-						fromID = tempB
-						toID = tempA
-					}
-					AddNewGraphEdge(g, fromID, toID, e.Relation, e.Time, 0) // weight暂时为空
+				newEdge := !added[e.record.Key]
+				if newEdge && q.opts.MaxEdges > 0 && len(q.addedEventLine)+len(q.addedNetLine) >= q.opts.MaxEdges {
+					q.truncate(TruncatedEdges)
+					return
 				}
-			}
-			nets := FetchNets(cur.Key, cur.Table, reverse)
-			for _, n := range nets {
-				if uuid != "" {
-					uuids := strings.Split(n.UUID, ",")
-					if !helper.SliceContainsTarget(uuids, uuid) {
+				// 先存顶点
+				if !visitedNode[e.neighbour] {
+					if q.excluded[e.neighbour] {
 						continue
 					}
-				}
-				if timeLimit { // 时间戳限制
-					if reverse { // 逆向搜索，时间戳应该递减
-						if node2time[cur] != 0 && node2time[cur] < n.Time {
-							continue
+					id, ok := q.addedNode[e.neighbour]
+					if !ok { // 该顶点不在图中；已经在图中的顶点依然需要遍历一次（正向和逆向都经过该点，但后续路径存在差异）
+						en, err := lookup(e.neighbour)
+						if err != nil {
+							logs.Logger.WithError(err).Errorf("failed to fetch entity")
+							continue // 不再考虑边
 						}
-					} else { // 正向搜索，时间戳应该递增
-						if node2time[cur] != 0 && node2time[cur] > n.Time {
+						if q.opts.excludes(en.nodeInfo) {
+							q.excluded[e.neighbour] = true
 							continue
 						}
-					}
-				}
-				// 先存顶点
-				var tempRecord RecordLoc
-				if reverse { // 逆向
-					tempRecord = RecordLoc{Key: n.SrcID, Table: SocketTable}
-				} else { // 正向
-					tempRecord = RecordLoc{Key: n.DstID, Table: SocketTable}
-				}
-				if _, ok := visitedNode[tempRecord]; !ok { // 该顶点没有访问过
-					// 判断该顶点是否已经存在于图中
-					if _, ok := addedNode[tempRecord]; ok { // 该顶点已经在图中
-						visitedNode[tempRecord] = true
-						queue = append(queue, tempRecord) // 该顶点已经存在于图中，但依然需要遍历一次（正向和逆向都经过该点，但后续路劲存在差异）
-					} else { // 该顶点不在图中
-						if nodeType, nodeInfo, err := GetEntityNode(tempRecord); err != nil {
-							logs.Logger.WithError(err).Errorf("failed to fetch entity")
-							continue // 不再考虑边
-						} else {
-							id := AddNewGraphNode(g, nodeType, nodeInfo) // 处理该顶点，加入图中
-							visitedNode[tempRecord] = true
-							addedNode[tempRecord] = id
-							queue = append(queue, tempRecord) // 只有将该顶点成功加入Graph中，才将该顶点送入queue
+						if q.opts.MaxNodes > 0 && len(q.addedNode) >= q.opts.MaxNodes {
+							q.truncate(TruncatedNodes)
+							return
 						}
+						id = AddNewGraphNode(q.g, en.nodeType, en.nodeInfo)
+						q.addedNode[e.neighbour] = id
 					}
-					if timeLimit {
-						node2time[tempRecord] = n.Time
+					q.g.Node(id).(GraphNode).reach(reached)
+					visitedNode[e.neighbour] = true
+					next = append(next, e.neighbour)
+					if q.opts.TimeLimit { // 该顶点没有访问过（即便由于此前的一次正向遍历，已经存在于图中），直接赋值时间戳
+						node2time[e.neighbour] = at
 					}
-				} else {
-					if timeLimit {
-						if reverse { // 逆向搜索，时间戳取max
-							if node2time[tempRecord] != 0 && node2time[tempRecord] < n.Time {
-								node2time[tempRecord] = n.Time
-							}
-						} else { // 正向搜索，时间戳取min
-							if node2time[tempRecord] != 0 && node2time[tempRecord] > n.Time {
-								node2time[tempRecord] = n.Time
-							}
-						}
+				} else if q.opts.TimeLimit && node2time[e.neighbour] != 0 { // 该顶点访问过，逆向时间戳取max，正向取min
+					if reverse && node2time[e.neighbour] < at || !reverse && node2time[e.neighbour] > at {
+						node2time[e.neighbour] = at
 					}
 				}
 				// 再存边
-				if _, ok := addedNetLine[n.ID]; !ok { // 该事件(line)没有访问过
-					addedNetLine[n.ID] = true
-					var (
-						fromID int64
-						toID   int64
-						tempA  int64
-						tempB  int64
-					)
-					if tempA, ok = addedNode[tempRecord]; !ok {
-						panic("No such Node in the graph")
-					}
-					if tempB, ok = addedNode[cur]; !ok {
-						panic("No such Node in the graph")
-					}
-					if reverse { // 逆向
-						fromID = tempA
-						toID = tempB
-					} else { // 正向
-						fromID = tempB
-						toID = tempA
-					}
-					AddNewGraphEdge(g, fromID, toID, n.Method, n.Time, 0) // weight暂时为空
+				if !newEdge {
+					continue
 				}
+				added[e.record.Key] = true
+				fromID, toID := q.addedNode[cur], q.addedNode[e.neighbour]
+				if reverse {
+					fromID, toID = toID, fromID
+				}
+				AddNewGraphEdge(q.g, fromID, toID, e.relation, e.time, 0, e.record) // weight暂时为空
 			}
-			queue = queue[1:] // 删除头部
 		}
-		currLevel++
+		if partial { // 该层还有超过上限、没有读取的边
+			q.truncate(TruncatedEdges)
+			return
+		}
+		queue = next
+	}
+}
+
+// FetchEvents 寻找与该顶点相连的所有的event边，uuid 不为空时只寻找属于该请求的边
+func FetchEvents(s store.Store, key int, table string, reverse bool, uuid string) []models.Event {
+	classes := eventClasses(table, reverse)
+	if classes == nil {
+		logs.Logger.Errorf("failed to parse table %s, fetch events failed", table)
+		return nil
+	}
+	events, err := s.FetchEvents(key, classes, reverse, uuid)
+	if err != nil {
+		logs.Logger.WithError(err).Errorf("failed to fetch events(edges) from db")
+		return nil
 	}
+	return events
 }
 
-// FetchEvents 寻找与该顶点相连的所有的event边
-func FetchEvents(key int, table string, reverse bool) []models.Event {
-	mysqlDB := models.GetMysqlDB()
-	// 根据该实体所在表推断其sql
-	sqlStr := "event_class = ?"
+// eventClasses 根据该实体所在表推断其事件类型，未知的表返回 nil
+func eventClasses(table string, reverse bool) []string {
+	var classes []string
 	switch table {
 	case ProcessTable:
 		if reverse { // 1. process -> process 2. file -> process 3. socket -> process
-			mysqlDB = mysqlDB.Where(sqlStr+" or "+sqlStr+" or "+sqlStr,
-				parser.PROCESS, parser.FILEV2, parser.NETWORKV2)
+			classes = []string{parser.PROCESS, parser.FILEV2, parser.NETWORKV2}
 		} else { // 1. process -> process 2. process -> file 3. process -> socket
-			mysqlDB = mysqlDB.Where(sqlStr+" or "+sqlStr+" or "+sqlStr,
-				parser.PROCESS, parser.FILEV1, parser.NETWORKV1)
+			classes = []string{parser.PROCESS, parser.FILEV1, parser.NETWORKV1}
 		}
 	case FileTable:
 		if reverse { // 1. process -> file
-			mysqlDB = mysqlDB.Where(sqlStr, parser.FILEV1)
+			classes = []string{parser.FILEV1}
 		} else { // 1. file -> process
-			mysqlDB = mysqlDB.Where(sqlStr, parser.FILEV2)
+			classes = []string{parser.FILEV2}
 		}
 	case SocketTable:
 		if reverse { // 1. process -> socket
-			mysqlDB = mysqlDB.Where(sqlStr, parser.NETWORKV1)
+			classes = []string{parser.NETWORKV1}
 		} else { // 1. socket -> process
-			mysqlDB = mysqlDB.Where(sqlStr, parser.NETWORKV2)
+			classes = []string{parser.NETWORKV2}
 		}
-	default:
-		logs.Logger.Errorf("failed to parse table %s, fetch events failed", table)
-		return nil
-	}
-	if reverse { // 逆向
-		mysqlDB = mysqlDB.Where("dst_id = ?", strconv.Itoa(key))
-	} else { // 正向
-		mysqlDB = mysqlDB.Where("src_id = ?", strconv.Itoa(key))
 	}
-	var events []models.Event
-	if err := mysqlDB.Find(&events).Error; err != nil {
-		logs.Logger.WithError(err).Errorf("failed to fetch events(edges) from db")
-		return nil
-	}
-	return events
+	return classes
 }
 
 // FetchNets 寻找所有与该顶点有关的网络流量边
-func FetchNets(key int, table string, reverse bool) []models.Net {
+func FetchNets(s store.Store, key int, table string, reverse bool, uuid string) []models.Net {
 	if table != SocketTable { // 如果当前顶点是 socket，则还需要寻找有关的net边
 		return nil
 	}
-	var nets []models.Net
-	mysqlDB := models.GetMysqlDB()
-	if reverse {
-		mysqlDB = mysqlDB.Where("dst_id = ?", strconv.Itoa(key))
-	} else {
-		mysqlDB = mysqlDB.Where("src_id = ?", strconv.Itoa(key))
-	}
-	if err := mysqlDB.Find(&nets).Error; err != nil {
+	nets, err := s.FetchNets(key, reverse, uuid)
+	if err != nil {
 		logs.Logger.WithError(err).Errorf("failed to fetch nets(edges) from db")
 		return nil
 	}
@@ -371,45 +307,56 @@ func GetTableName(eventClass string, reverse bool) (string, error) {
 	return "", fmt.Errorf("failed to calculate the table by eventClass: %s", eventClass)
 }
 
-func GetEntityNode(r RecordLoc) (NodeType, NodeInfo, error) {
-	mysqlDB := models.GetMysqlDB()
+func GetEntityNode(s store.Store, r RecordLoc) (NodeType, NodeInfo, error) {
 	switch r.Table {
 	case ProcessTable:
-		var process models.Process
-		if err := mysqlDB.First(&process, r.Key).Error; err != nil {
+		process, err := s.GetProcess(r.Key)
+		if err != nil {
 			return -1, nil, fmt.Errorf("failed to get process entity node from db, err: %w", err)
 		}
-		return Process, ProcessInfo{
-			Path:          process.ProcessExepath,
-			Name:          process.ProcessName,
-			Pid:           process.ProcessVPID,
-			HostName:      process.HostName,
-			HostID:        process.HostID,
-			ContainerName: process.ContainerName,
-			ContainerID:   process.ContainerID}, nil
+		return Process, processInfo(process), nil
 	case FileTable:
-		var file models.File
-		if err := mysqlDB.First(&file, r.Key).Error; err != nil {
+		file, err := s.GetFile(r.Key)
+		if err != nil {
 			return -1, nil, fmt.Errorf("failed to get file entity node from db, err: %w", err)
 		}
-		return File, FileInfo{
-			HostName:      file.HostName,
-			HostID:        file.HostID,
-			ContainerID:   file.ContainerID,
-			ContainerName: file.ContainerName,
-			Path:          file.FilePath}, nil
+		return File, fileInfo(file), nil
 	case SocketTable:
-		var socket models.Socket
-		if err := mysqlDB.First(&socket, r.Key).Error; err != nil {
+		socket, err := s.GetSocket(r.Key)
+		if err != nil {
 			return -1, nil, fmt.Errorf("failed to get socket entity node from db, err: %w", err)
 		}
-		return Socket, SocketInfo{
-			DstIP:         socket.DstIP,
-			DstPort:       socket.DstPort,
-			ContainerName: socket.ContainerName,
-			ContainerID:   socket.ContainerID,
-			HostID:        socket.HostID,
-			HostName:      socket.HostName}, nil
+		return Socket, socketInfo(socket), nil
 	}
 	return -1, nil, fmt.Errorf("unknown record %s, can't find the entity from db", r.Table)
 }
+
+func processInfo(process models.Process) ProcessInfo {
+	return ProcessInfo{
+		Path:          process.ProcessExepath,
+		Name:          process.ProcessName,
+		Pid:           process.ProcessVPID,
+		HostName:      process.HostName,
+		HostID:        process.HostID,
+		ContainerName: process.ContainerName,
+		ContainerID:   process.ContainerID}
+}
+
+func fileInfo(file models.File) FileInfo {
+	return FileInfo{
+		HostName:      file.HostName,
+		HostID:        file.HostID,
+		ContainerID:   file.ContainerID,
+		ContainerName: file.ContainerName,
+		Path:          file.FilePath}
+}
+
+func socketInfo(socket models.Socket) SocketInfo {
+	return SocketInfo{
+		DstIP:         socket.DstIP,
+		DstPort:       socket.DstPort,
+		ContainerName: socket.ContainerName,
+		ContainerID:   socket.ContainerID,
+		HostID:        socket.HostID,
+		HostName:      socket.HostName}
+}
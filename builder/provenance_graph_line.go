@@ -4,10 +4,11 @@ import "gonum.org/v1/gonum/graph"
 
 type GraphLine struct {
 	F, T      graph.Node
-	W         float64 // 稀有路径得分
-	Relation  string  // 边的关系
-	TimeStamp int64   // 17位时间戳
-	UID       int64   // 两个共同顶点之间的平行边，需要用UID区分
+	W         float64   // 稀有路径得分
+	Relation  string    // 边的关系
+	TimeStamp int64     // 17位时间戳
+	UID       int64     // 两个共同顶点之间的平行边，需要用UID区分
+	Record    RecordLoc // 边在数据库中的位置
 }
 
 // From To ReversedLine ID Weight implements the WeightedLine interface
@@ -98,9 +98,10 @@ type NodeInfo interface {
 
 // GraphNode is provenance graph node
 type GraphNode struct {
-	id       int64    // unique node id
-	nodeType NodeType // node type
-	nodeInfo NodeInfo // node information
+	id       int64      // unique node id
+	nodeType NodeType   // node type
+	nodeInfo NodeInfo   // node information
+	reached  *Direction // 从哪个方向到达该顶点，图中保存的是值，用指针在加入图之后更新
 }
 
 // ID implements Node interface
@@ -108,6 +109,21 @@ func (n GraphNode) ID() int64 {
 	return n.id
 }
 
+// Reached 该顶点是从哪个方向到达的：Origin、Backward、Forward 或 Both
+func (n GraphNode) Reached() Direction {
+	if n.reached == nil {
+		return ""
+	}
+	return *n.reached
+}
+
+// reach 记录又从方向 d 到达了该顶点
+func (n GraphNode) reach(d Direction) {
+	if n.reached != nil {
+		*n.reached = n.reached.merge(d)
+	}
+}
+
 func (n GraphNode) VertexClusterID() string {
 	return helper.AddQuotation(n.nodeInfo.Flag())
 }
@@ -120,11 +136,13 @@ func (n GraphNode) VertexShape() string {
 	return n.nodeInfo.Shape()
 }
 
-// 只是为了实现接口，偷懒了...
+// LinkID 与 models 中顶点的 LinkID 相同，用来在前端的图中找到该顶点
 func (n GraphNode) LinkID() string {
-	return ""
+	return n.nodeInfo.Info()
 }
 
+// 只是为了实现接口，偷懒了...
+
 func (n GraphNode) LinkName() string {
 	return ""
 }
@@ -0,0 +1,268 @@
+package builder
+
+import (
+	"context"
+	"erinyes/logs"
+	"erinyes/models"
+	"erinyes/parser"
+	"erinyes/store"
+	"github.com/sirupsen/logrus"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixtureEdge 一条 event 边，p 开头的顶点为进程，其他为文件；end 为 0 时与 time 相同
+type fixtureEdge struct {
+	src, dst  string
+	time, end int64
+}
+
+// fixture 内存存储中按名称建立的顶点与边
+type fixture struct {
+	s     store.Store
+	locs  map[string]RecordLoc
+	edges map[int]string // event 主键 -> src>dst
+}
+
+func newFixture(t testing.TB, edges []fixtureEdge) *fixture {
+	logs.Logger = logrus.New()
+	logs.Logger.SetLevel(logrus.WarnLevel)
+	s, err := store.OpenMemory("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{s: s, locs: make(map[string]RecordLoc), edges: make(map[int]string)}
+	vertex := func(name string) RecordLoc {
+		if loc, ok := f.locs[name]; ok {
+			return loc
+		}
+		var loc RecordLoc
+		if strings.HasPrefix(name, "p") {
+			p := &models.Process{HostID: "h", ContainerID: "c", ProcessVPID: name, ProcessName: name, ProcessExepath: "/bin/" + name}
+			if _, err := s.UpsertProcesses([]*models.Process{p}); err != nil {
+				t.Fatal(err)
+			}
+			loc = RecordLoc{Key: p.ID, Table: ProcessTable}
+		} else {
+			file := &models.File{HostID: "h", ContainerID: "c", FilePath: "/" + name}
+			if _, err := s.UpsertFiles([]*models.File{file}); err != nil {
+				t.Fatal(err)
+			}
+			loc = RecordLoc{Key: file.ID, Table: FileTable}
+		}
+		f.locs[name] = loc
+		return loc
+	}
+	var events []*models.Event
+	for _, e := range edges {
+		src, dst := vertex(e.src), vertex(e.dst)
+		class := parser.PROCESS
+		if src.Table == FileTable {
+			class = parser.FILEV2
+		} else if dst.Table == FileTable {
+			class = parser.FILEV1
+		}
+		end := e.end
+		if end == 0 {
+			end = e.time
+		}
+		events = append(events, &models.Event{SrcID: src.Key, DstID: dst.Key, EventClass: class, Relation: "r", Operation: "r", Time: e.time, EndTime: end, Count: 1, UUID: "unknown"})
+	}
+	if _, err := s.InsertEvents(events, false); err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range events {
+		f.edges[e.ID] = edges[i].src + ">" + edges[i].dst
+	}
+	return f
+}
+
+// root 以名称为 name 的顶点为起点
+func (f *fixture) root(name string) Root {
+	if strings.HasPrefix(name, "p") {
+		return ProcessRootOf("h", "c", name, name)
+	}
+	return Root{Type: FileRoot, Path: "/" + name}
+}
+
+// run 使用 fetch 溯源，返回子图中排序后的边
+func (f *fixture) run(t testing.TB, ctx context.Context, roots []string, opts Options, fetch levelFetcher) ([]string, Result) {
+	var rs []Root
+	for _, name := range roots {
+		rs = append(rs, f.root(name))
+	}
+	res, err := provenanceFrom(ctx, f.s, rs, opts, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var edges []string
+	for _, loc := range SubgraphEdges(res.Graph) {
+		edges = append(edges, f.edges[loc.Key])
+	}
+	sort.Strings(edges)
+	return edges, res
+}
+
+var fetchers = []struct {
+	name  string
+	fetch levelFetcher
+}{{"level", fetchLevel}, {"node", fetchLevelPerNode}}
+
+func TestMergedEdgeTimeLimit(t *testing.T) {
+	// p0 -> f1 合并了时间 10 到 100 的多次写入
+	f := newFixture(t, []fixtureEdge{{"p0", "f1", 10, 100}, {"f1", "p2", 60, 0}, {"f1", "p3", 40, 0}})
+	ts := func(t int64) *int64 { return &t }
+	cases := []struct {
+		name  string
+		root  string
+		opts  Options
+		edges []string
+	}{
+		{
+			name:  "forward from a timestamp inside the merged interval",
+			root:  "p0",
+			opts:  Options{Direction: Forward, TimeLimit: true, Timestamp: ts(50)},
+			edges: []string{"f1>p2", "p0>f1"},
+		},
+		{
+			name:  "forward from a timestamp after the merged interval",
+			root:  "p0",
+			opts:  Options{Direction: Forward, TimeLimit: true, Timestamp: ts(101)},
+			edges: nil,
+		},
+		{
+			name:  "from inside the merged interval",
+			root:  "p0",
+			opts:  Options{Direction: Forward, From: 80},
+			edges: []string{"p0>f1"},
+		},
+		{
+			name:  "to before the merged interval ends",
+			root:  "p2",
+			opts:  Options{Direction: Backward, To: 70},
+			edges: []string{"f1>p2", "p0>f1"},
+		},
+		{
+			name:  "backward uses the first event",
+			root:  "p2",
+			opts:  Options{Direction: Backward, TimeLimit: true, Timestamp: ts(70)},
+			edges: []string{"f1>p2", "p0>f1"},
+		},
+	}
+	for _, c := range cases {
+		for _, fetcher := range fetchers {
+			t.Run(c.name+"/"+fetcher.name, func(t *testing.T) {
+				edges, _ := f.run(t, context.Background(), []string{c.root}, c.opts, fetcher.fetch)
+				if !reflect.DeepEqual(edges, c.edges) {
+					t.Fatalf("edges %v, want %v", edges, c.edges)
+				}
+			})
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	f := newFixture(t, []fixtureEdge{{"p0", "f1", 10, 0}, {"p0", "f2", 20, 0}, {"p0", "f3", 30, 0}, {"f1", "p4", 40, 0}, {"f2", "p5", 50, 0}, {"p0", "f6", 60, 0}})
+	one := 1
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	cases := []struct {
+		name      string
+		ctx       context.Context
+		opts      Options
+		edges     []string
+		truncated Truncation
+	}{
+		{
+			name:  "no limit",
+			edges: []string{"f1>p4", "f2>p5", "p0>f1", "p0>f2", "p0>f3", "p0>f6"},
+		},
+		{
+			name:      "max nodes counts the root",
+			opts:      Options{MaxNodes: 3},
+			edges:     []string{"p0>f1", "p0>f2"},
+			truncated: TruncatedNodes,
+		},
+		{
+			name:  "max nodes not reached",
+			opts:  Options{MaxNodes: 7},
+			edges: []string{"f1>p4", "f2>p5", "p0>f1", "p0>f2", "p0>f3", "p0>f6"},
+		},
+		{
+			name:      "max edges inside a level",
+			opts:      Options{MaxEdges: 1},
+			edges:     []string{"p0>f1"},
+			truncated: TruncatedEdges,
+		},
+		{
+			name:      "max edges at the next level",
+			opts:      Options{MaxEdges: 4},
+			edges:     []string{"p0>f1", "p0>f2", "p0>f3", "p0>f6"},
+			truncated: TruncatedEdges,
+		},
+		{
+			name:  "max edges not reached",
+			opts:  Options{MaxEdges: 6},
+			edges: []string{"f1>p4", "f2>p5", "p0>f1", "p0>f2", "p0>f3", "p0>f6"},
+		},
+		{
+			// 按层读取时第一页读到 3 条可以加入的边，超过剩余的 2 条，不再读取 p0>f6；排除 f1 后只加入 2 条边，只遍历一层，由 partial 截断
+			name:      "partial page with an excluded neighbour",
+			opts:      Options{MaxEdges: 2, Exclude: []string{"/f1"}, Depth: &one},
+			edges:     []string{"p0>f2", "p0>f3"},
+			truncated: TruncatedEdges,
+		},
+		{
+			name:  "exclude a file",
+			opts:  Options{Exclude: []string{"/f1"}},
+			edges: []string{"f2>p5", "p0>f2", "p0>f3", "p0>f6"},
+		},
+		{
+			name:  "exclude a process by name",
+			opts:  Options{Exclude: []string{"p5"}},
+			edges: []string{"f1>p4", "p0>f1", "p0>f2", "p0>f3", "p0>f6"},
+		},
+		{
+			name:  "exclude with a wildcard",
+			opts:  Options{Exclude: []string{"/bin/*"}},
+			edges: []string{"p0>f1", "p0>f2", "p0>f3", "p0>f6"},
+		},
+		{
+			name:  "root is not excluded",
+			opts:  Options{Exclude: []string{"p0"}},
+			edges: []string{"f1>p4", "f2>p5", "p0>f1", "p0>f2", "p0>f3", "p0>f6"},
+		},
+		{
+			name:      "timeout",
+			opts:      Options{Timeout: time.Nanosecond},
+			truncated: TruncatedTimeout,
+		},
+		{
+			name:      "canceled",
+			ctx:       canceled,
+			truncated: TruncatedCanceled,
+		},
+	}
+	for _, c := range cases {
+		for _, fetcher := range fetchers {
+			t.Run(c.name+"/"+fetcher.name, func(t *testing.T) {
+				ctx := c.ctx
+				if ctx == nil {
+					ctx = context.Background()
+				}
+				opts := c.opts
+				opts.Direction = Forward
+				edges, res := f.run(t, ctx, []string{"p0"}, opts, fetcher.fetch)
+				if !reflect.DeepEqual(edges, c.edges) {
+					t.Fatalf("edges %v, want %v", edges, c.edges)
+				}
+				if res.Truncated != c.truncated || (res.Truncated != "") != (res.Reason != "") {
+					t.Fatalf("truncated %q (%s), want %q", res.Truncated, res.Reason, c.truncated)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package builder
+
+import (
+	"erinyes/store"
+	"fmt"
+	"strings"
+)
+
+// 溯源起点的类型
+const (
+	ProcessRoot = "process"
+	FileRoot    = "file"
+	SocketRoot  = "socket"
+	UUIDRoot    = "uuid" // 以某个请求的所有边为起点
+)
+
+// Root 溯源的起点，Type 决定使用哪些字段
+// 文件路径、socket 的 ip 和端口中 * 匹配任意字符串，可以匹配多个顶点；文件和 socket 的 HostID、ContainerID 为空时不限制
+type Root struct {
+	Type        string `json:"type"`
+	HostID      string `json:"hostID"`
+	ContainerID string `json:"containerID"`
+	VPid        string `json:"vpid"`
+	ProcessName string `json:"processName"`
+	Path        string `json:"path"`
+	IP          string `json:"ip"`
+	Port        string `json:"port"`
+	UUID        string `json:"uuid"`
+}
+
+// ProcessRootOf 由 <HostID, ContainerID, VPid, ProcessName> 确定的进程起点
+func ProcessRootOf(hostID string, containerID string, vpid string, name string) Root {
+	return Root{Type: ProcessRoot, HostID: hostID, ContainerID: containerID, VPid: vpid, ProcessName: name}
+}
+
+// ParseRoot 解析命令行中的起点：process:<host>,<container>,<vpid>,<name>、file:<path>、socket:<ip>:<port>、uuid:<uuid>
+// 没有类型前缀时按 <host>,<container>,<vpid>,<name> 解析为进程
+func ParseRoot(s string) (Root, error) {
+	kv := strings.SplitN(s, ":", 2)
+	if len(kv) == 1 || strings.Contains(kv[0], ",") {
+		kv = []string{ProcessRoot, s}
+	}
+	switch kv[0] {
+	case ProcessRoot:
+		if p := strings.Split(kv[1], ","); len(p) == 4 {
+			return ProcessRootOf(p[0], p[1], p[2], p[3]), nil
+		}
+		return Root{}, fmt.Errorf("process root must be <host>,<container>,<vpid>,<name>: %s", s)
+	case FileRoot:
+		if kv[1] != "" {
+			return Root{Type: FileRoot, Path: kv[1]}, nil
+		}
+	case SocketRoot:
+		if i := strings.LastIndex(kv[1], ":"); i > 0 && i < len(kv[1])-1 {
+			return Root{Type: SocketRoot, IP: kv[1][:i], Port: kv[1][i+1:]}, nil
+		}
+		return Root{}, fmt.Errorf("socket root must be <ip>:<port>: %s", s)
+	case UUIDRoot:
+		if kv[1] != "" {
+			return Root{Type: UUIDRoot, UUID: kv[1]}, nil
+		}
+	default:
+		return Root{}, fmt.Errorf("unknown root type %s, use process, file, socket or uuid", kv[0])
+	}
+	return Root{}, fmt.Errorf("root is empty: %s", s)
+}
+
+func (r Root) String() string {
+	switch r.Type {
+	case ProcessRoot:
+		return fmt.Sprintf("process %s_%s#%s_%s", r.VPid, r.ProcessName, r.HostID, r.ContainerID)
+	case FileRoot:
+		return "file " + r.Path
+	case SocketRoot:
+		return "socket " + r.IP + ":" + r.Port
+	case UUIDRoot:
+		return "uuid " + r.UUID
+	}
+	return "unknown root " + r.Type
+}
+
+// seeds 溯源起点对应的顶点，以及起点的时间戳：正向从每个起点最早的时间开始，逆向从最晚的时间开始
+// 进程、文件、socket 起点没有时间，request 起点的时间为该请求中与该顶点相连的边的时间
+type seeds struct {
+	locs    []RecordLoc
+	first   map[RecordLoc]int64
+	last    map[RecordLoc]int64
+	matched int        // 加入过的顶点数，包括重复的，用来判断起点是否对应了顶点
+	edges   []seedEdge // uuid 起点中请求的边，两端的顶点读取后加入图中
+}
+
+// seedEdge uuid 起点中的一条边
+type seedEdge struct {
+	from     RecordLoc
+	to       RecordLoc
+	relation string
+	time     int64
+	endTime  int64 // 合并的重复边最后一次事件的时间
+	record   RecordLoc
+}
+
+// addSeed 加入一个起点，first、last 为起点在请求中最早与最晚的时间，新的顶点会超过 MaxNodes 时记录截断并返回 false
+func (q *query) addSeed(sd *seeds, loc RecordLoc, first int64, last int64) bool {
+	if _, ok := sd.first[loc]; !ok {
+		if q.opts.MaxNodes > 0 && len(sd.locs) >= q.opts.MaxNodes {
+			q.truncate(TruncatedNodes)
+			return false
+		}
+		sd.matched++
+		sd.locs = append(sd.locs, loc)
+		sd.first[loc], sd.last[loc] = first, last
+		return true
+	}
+	sd.matched++
+	if first != 0 && (sd.first[loc] == 0 || first < sd.first[loc]) {
+		sd.first[loc] = first
+	}
+	if last > sd.last[loc] {
+		sd.last[loc] = last
+	}
+	return true
+}
+
+// resolveRoots 找到每个起点对应的顶点（表由起点的类型决定）并加入图中，uuid 起点同时加入该请求中满足 filter 与时间范围的所有边
+// 起点同样受 MaxNodes、MaxEdges 与 ctx 的限制，截断时不再处理之后的起点，截断的原因记录在 q.result 中
+func (q *query) resolveRoots(roots []Root) (*seeds, error) {
+	sd := &seeds{first: make(map[RecordLoc]int64), last: make(map[RecordLoc]int64)}
+	for _, root := range roots {
+		if q.stopped() {
+			break
+		}
+		before := sd.matched
+		switch root.Type {
+		case ProcessRoot:
+			process, err := q.s.FindProcess(root.HostID, root.ContainerID, root.VPid, root.ProcessName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find root %s: %w", root, err)
+			}
+			q.addSeed(sd, RecordLoc{Key: process.ID, Table: ProcessTable}, 0, 0)
+		case FileRoot:
+			files, err := q.s.MatchFiles(root.HostID, root.ContainerID, root.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find root %s: %w", root, err)
+			}
+			for _, f := range files {
+				if !q.addSeed(sd, RecordLoc{Key: f.ID, Table: FileTable}, 0, 0) {
+					break
+				}
+			}
+		case SocketRoot:
+			sockets, err := q.s.MatchSockets(root.HostID, root.ContainerID, root.IP, root.Port)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find root %s: %w", root, err)
+			}
+			for _, so := range sockets {
+				if !q.addSeed(sd, RecordLoc{Key: so.ID, Table: SocketTable}, 0, 0) {
+					break
+				}
+			}
+		case UUIDRoot:
+			if err := q.requestSeeds(sd, root.UUID); err != nil {
+				return nil, fmt.Errorf("failed to find root %s: %w", root, err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown root type %s, use process, file, socket or uuid", root.Type)
+		}
+		if q.result.Truncated != "" {
+			break
+		}
+		if sd.matched == before {
+			return nil, fmt.Errorf("no vertex matches root %s", root)
+		}
+	}
+	if err := q.addSeeds(sd); err != nil {
+		return nil, err
+	}
+	return sd, nil
+}
+
+// requestSeeds 记录请求中的边，两端的顶点都作为起点
+func (q *query) requestSeeds(sd *seeds, uuid string) error {
+	const pageSize = 500
+	window := q.opts.window(store.TimeWindow{})
+	// addEdge 两端的顶点或边会超过上限时记录截断并返回 false
+	addEdge := func(e seedEdge) bool {
+		if q.opts.MaxEdges > 0 && len(sd.edges) >= q.opts.MaxEdges {
+			q.truncate(TruncatedEdges)
+			return false
+		}
+		if !q.addSeed(sd, e.from, e.time, e.endTime) || !q.addSeed(sd, e.to, e.time, e.endTime) {
+			return false
+		}
+		sd.edges = append(sd.edges, e)
+		return true
+	}
+	for lastID := 0; !q.stopped(); {
+		events, err := q.s.ScanEvents(lastID, pageSize, uuid)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, e := range events {
+			lastID = e.ID
+			if q.addedEventLine[e.ID] || !q.opts.Filter.Match(e) || !window.Overlaps(e.Time, e.EndTime) {
+				continue
+			}
+			srcTable, err1 := GetTableName(e.EventClass, true)
+			dstTable, err2 := GetTableName(e.EventClass, false)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			end := e.EndTime
+			if end < e.Time {
+				end = e.Time
+			}
+			if !addEdge(seedEdge{RecordLoc{Key: e.SrcID, Table: srcTable}, RecordLoc{Key: e.DstID, Table: dstTable}, e.Relation, e.Time, end, RecordLoc{Key: e.ID, Table: e.TableName()}}) {
+				return nil
+			}
+			q.addedEventLine[e.ID] = true
+		}
+	}
+	for lastID := 0; !q.stopped(); {
+		nets, err := q.s.ScanNets(lastID, pageSize, uuid)
+		if err != nil || len(nets) == 0 {
+			return err
+		}
+		for _, n := range nets {
+			lastID = n.ID
+			if q.addedNetLine[n.ID] || !window.Contains(n.Time) {
+				continue
+			}
+			if !addEdge(seedEdge{RecordLoc{Key: n.SrcID, Table: SocketTable}, RecordLoc{Key: n.DstID, Table: SocketTable}, n.Method, n.Time, n.Time, RecordLoc{Key: n.ID, Table: n.TableName()}}) {
+				return nil
+			}
+			q.addedNetLine[n.ID] = true
+		}
+	}
+	return nil
+}
+
+// addSeeds 按表批量读取起点对应的顶点并加入图中，再加入 uuid 起点中的边
+func (q *query) addSeeds(sd *seeds) error {
+	keys := make(map[string][]int)
+	for _, loc := range sd.locs {
+		keys[loc.Table] = append(keys[loc.Table], loc.Key)
+	}
+	entities, err := q.loadVertices(keys)
+	if err != nil {
+		return err
+	}
+	for _, loc := range sd.locs {
+		en, ok := entities[loc]
+		if !ok {
+			return fmt.Errorf("%s %d not found", loc.Table, loc.Key)
+		}
+		id := AddNewGraphNode(q.g, en.nodeType, en.nodeInfo)
+		q.addedNode[loc] = id
+		q.g.Node(id).(GraphNode).reach(Origin)
+	}
+	for _, e := range sd.edges {
+		AddNewGraphEdge(q.g, q.addedNode[e.from], q.addedNode[e.to], e.relation, e.time, 0, e.record)
+	}
+	return nil
+}
@@ -16,9 +16,86 @@ type ConfigStruct struct {
 		MaxOpenConns int    `yaml:"MaxOpenConns"`
 		MaxIdleConns int    `yaml:"MaxIdleConns"`
 	} `yaml:"Mysql"`
+	Storage struct {
+		Driver string `yaml:"Driver"` // mysql、sqlite 或 memory
+		Path   string `yaml:"Path"`   // sqlite 数据库文件路径，memory 时为启动时加载的快照文件
+	} `yaml:"Storage"`
 	Service struct {
 		Port string `yaml:"Port"`
 	} `yaml:"Service"`
+	Ingest struct {
+		ReadyTimeout int   `yaml:"ReadyTimeout"` // 等待解析流水线就绪的最长时间，单位秒
+		RetryAfter   int   `yaml:"RetryAfter"`   // 缓冲区已满或流水线未就绪时建议客户端重试的间隔，单位秒
+		MaxBodyBytes int64 `yaml:"MaxBodyBytes"` // 单个请求解压后的最大字节数
+		WAL          struct {
+			Enable         bool   `yaml:"Enable"`         // 启用后日志先写入磁盘队列，落盘后才返回 200
+			Dir            string `yaml:"Dir"`            // 队列目录
+			SegmentBytes   int64  `yaml:"SegmentBytes"`   // 单个段文件的最大字节数
+			MaxBytes       int64  `yaml:"MaxBytes"`       // 未消费的日志超过该字节数时拒绝上报，0 表示不限制
+			CommitInterval int    `yaml:"CommitInterval"` // 持久化消费偏移的间隔，单位毫秒
+			PinTTL         int    `yaml:"PinTTL"`         // 解析器状态（execve 进入事件、请求标记）阻止确认的最长时间，单位秒，0 表示不限制
+			MaxPins        int    `yaml:"MaxPins"`        // 每个解析器阻止确认的最大状态数，超过后淘汰最早的，0 表示不限制
+		} `yaml:"WAL"`
+	} `yaml:"Ingest"`
+	Inserter struct {
+		BatchSize     int  `yaml:"BatchSize"`     // 每批插入的边数
+		FlushInterval int  `yaml:"FlushInterval"` // 未满一批时的最长等待时间，单位毫秒
+		CacheShards   int  `yaml:"CacheShards"`   // 顶点主键缓存的分片数
+		CacheSize     int  `yaml:"CacheSize"`     // 每个分片缓存的最大顶点数，超过后清空该分片
+		Reduce        bool `yaml:"Reduce"`        // 合并不影响因果关系的重复边（CPR），启用后只使用一个插入协程
+		ReduceSize    int  `yaml:"ReduceSize"`    // 等待合并的边的最大数量，超过后全部关闭
+		KeepArgs      bool `yaml:"KeepArgs"`      // 以 gzip 压缩的 JSON 保存系统调用的原始参数（evt.info）
+		Retries       int  `yaml:"Retries"`       // 写入数据库失败时的重试次数，仍然失败的一批日志写入持久化队列的死信文件后确认
+	} `yaml:"Inserter"`
+	GRPC struct {
+		Port                 string `yaml:"Port"`                 // gRPC 上报服务的监听地址，为空表示不启用
+		MaxRecvMsgBytes      int    `yaml:"MaxRecvMsgBytes"`      // 单条消息（一批日志）的最大字节数
+		MaxConcurrentStreams uint32 `yaml:"MaxConcurrentStreams"` // 单个连接上的最大并发流数
+	} `yaml:"GRPC"`
+	Agent struct {
+		SysdigPath          string   `yaml:"SysdigPath"`          // 采集程序路径，测试时可以替换为输出日志的脚本
+		SysdigArgs          []string `yaml:"SysdigArgs"`          // 额外的采集参数，如 -B 使用 eBPF 探针
+		EventTypes          []string `yaml:"EventTypes"`          // 采集的系统调用
+		ExcludeContainerIDs []string `yaml:"ExcludeContainerIDs"` // 不采集的容器 id
+		ExcludeImages       []string `yaml:"ExcludeImages"`       // 不采集的镜像
+		Filter              string   `yaml:"Filter"`              // 额外的过滤条件，与上述条件取交集
+		Server              string   `yaml:"Server"`              // 中心 erinyes 的地址，如 http://10.0.88.125:8080
+		HostID              string   `yaml:"HostID"`              // 为空时使用 /etc/machine-id 或主机名
+		HostName            string   `yaml:"HostName"`            // 为空时使用主机名
+		Dataset             string   `yaml:"Dataset"`             // 日志写入的数据集，为空时写入默认数据集
+		BatchSize           int      `yaml:"BatchSize"`           // 每批上报的日志条数
+		FlushInterval       int      `yaml:"FlushInterval"`       // 未满一批时的最长等待时间，单位毫秒
+		SpoolDir            string   `yaml:"SpoolDir"`            // 本地缓存目录，中心不可达时日志保存在这里
+		SpoolMaxBytes       int64    `yaml:"SpoolMaxBytes"`       // 本地缓存的最大字节数，超过后丢弃新的日志，0 表示不限制
+		RetryInterval       int      `yaml:"RetryInterval"`       // 上报失败后的重试间隔，单位秒
+		Timeout             int      `yaml:"Timeout"`             // 单次上报的超时时间，单位秒
+		RestartInterval     int      `yaml:"RestartInterval"`     // 采集进程退出后重新启动的间隔，单位秒
+	} `yaml:"Agent"`
+	Correlation struct {
+		Window   int64 `yaml:"Window"`   // 关联 sysdig 事件与流量日志时允许的最大时间差，单位毫秒
+		Interval int   `yaml:"Interval"` // 服务模式下定期关联的间隔，单位秒，0 表示不启用
+		Slack    int64 `yaml:"Slack"`    // 流量日志相对 sysdig 日志的最大延迟，单位秒；两侧最新的 flow 越过 time + Window + Slack 后不再重试关联
+	} `yaml:"Correlation"`
+	Retention struct {
+		Days      int `yaml:"Days"`      // 服务模式下保留的天数，更早的边及孤立顶点被定期删除，0 表示不启用
+		Interval  int `yaml:"Interval"`  // 定期删除的间隔，单位秒
+		ChunkSize int `yaml:"ChunkSize"` // 每个事务删除的最大行数
+	} `yaml:"Retention"`
+	Archive struct {
+		Enable bool   `yaml:"Enable"` // 将原始日志压缩保存到内容寻址的分段文件中，边上记录其位置，用于查看边对应的原始日志
+		Dir    string `yaml:"Dir"`    // 分段文件目录
+	} `yaml:"Archive"`
+	Ledger struct {
+		Enable             bool   `yaml:"Enable"`             // 插入、删除的边追加到防篡改的哈希链中，用 verify 校验
+		KeyFile            string `yaml:"KeyFile"`            // 签名检查点的 ed25519 私钥文件，不存在时自动生成
+		CheckpointInterval int    `yaml:"CheckpointInterval"` // 服务模式下定期签名检查点的间隔，单位秒，0 表示不启用
+	} `yaml:"Ledger"`
+	Provenance struct {
+		Timeout  int      `yaml:"Timeout"`  // 单次溯源的最长时间，单位秒，超时后返回已经遍历到的子图，0 表示不限制
+		MaxNodes int      `yaml:"MaxNodes"` // 溯源子图的最大顶点数，0 表示不限制
+		MaxEdges int      `yaml:"MaxEdges"` // 溯源子图的最大边数，0 表示不限制
+		Exclude  []string `yaml:"Exclude"`  // 溯源时排除的顶点，如 /proc/*，* 匹配任意字符串
+	} `yaml:"Provenance"`
 	IPMap      map[string]string `yaml:"IPMap"`
 	GatewayMap map[string]bool   `yaml:"GatewayMap"`
 	HostIP     string            `yaml:"HostIP"`
@@ -0,0 +1,311 @@
+package exchange
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"erinyes/models"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	CDMFormat = "cdm"
+
+	CDMVersion   = "18"
+	cdmNamespace = "com.bbn.tc.schema.avro.cdm18."
+	cdmSource    = "SOURCE_LINUX_SYSCALL_TRACE"
+)
+
+// DARPA TC CDM 18 的映射，每行一条 Avro JSON 编码的记录（与公开数据集一致，可选字段按 {"类型": 值} 包装）：
+//
+//	主机（host_id）    -> Host，每台主机一个 Principal（PRINCIPAL_LOCAL，userId unknown）
+//	process            -> Subject，SUBJECT_PROCESS，cid 为 process_vpid，cmdLine 为 process_exe_path
+//	file               -> FileObject，FILE_OBJECT_FILE，路径在 baseObject.properties.path
+//	socket             -> NetFlowObject，remoteAddress/remotePort 为 dst_ip/dst_port，本地地址未知
+//	event              -> Event，subject 为边上的进程，predicateObject 为另一端，类型见 cdmEventTypes
+//	net                -> Event，EVENT_FLOWS_TO，predicateObject 为起点 socket，predicateObject2 为终点
+//
+// 顶点的 uuid 由唯一键生成（不含数据集），同一个顶点在不同的导出中 uuid 相同；边的 uuid 由数据集、表和主键生成
+// erinyes 特有的字段放在 properties 中
+var cdmEventTypes = map[string]string{
+	"fork":     "EVENT_FORK",
+	"vfork":    "EVENT_FORK",
+	"clone":    "EVENT_CLONE",
+	"execve":   "EVENT_EXECUTE",
+	"bind":     "EVENT_BIND",
+	"accept":   "EVENT_ACCEPT",
+	"accept4":  "EVENT_ACCEPT",
+	"connect":  "EVENT_CONNECT",
+	"sendto":   "EVENT_SENDTO",
+	"recvfrom": "EVENT_RECVFROM",
+	"open":     "EVENT_OPEN",
+	"openat":   "EVENT_OPEN",
+	"read":     "EVENT_READ",
+	"readv":    "EVENT_READ",
+	"write":    "EVENT_WRITE",
+	"writev":   "EVENT_WRITE",
+}
+
+// cdmEventType 其他 relation（如 listen、HTTP 方法）映射为 EVENT_OTHER
+func cdmEventType(relation string) string {
+	if t, ok := cdmEventTypes[relation]; ok {
+		return t
+	}
+	return "EVENT_OTHER"
+}
+
+// nameUUID 由名称生成确定的 UUID（SHA-1，版本 5 的格式）
+func nameUUID(parts ...string) string {
+	sum := sha1.Sum([]byte("erinyes\x00" + strings.Join(parts, "\x00")))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%X-%X-%X-%X-%X", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func hostUUID(hostID string) string {
+	return nameUUID("host", hostID)
+}
+
+func principalUUID(hostID string) string {
+	return nameUUID("principal", hostID)
+}
+
+func (p Process) uuid() string {
+	return nameUUID(ProcessType, p.HostID, p.ContainerID, p.ProcessVPID, p.ProcessName)
+}
+
+func (f File) uuid() string {
+	return nameUUID(FileType, f.HostID, f.ContainerID, f.FilePath)
+}
+
+func (s Socket) uuid() string {
+	return nameUUID(SocketType, s.HostID, s.ContainerID, s.DstIP, s.DstPort)
+}
+
+// cdmRecord 一行记录
+type cdmRecord struct {
+	Datum      map[string]interface{} `json:"datum"`
+	CDMVersion string                 `json:"CDMVersion"`
+	Source     string                 `json:"source"`
+}
+
+func cdmUUID(uuid string) map[string]string {
+	return map[string]string{cdmNamespace + "UUID": uuid}
+}
+
+func cdmProperties(kv ...string) map[string]interface{} {
+	m := map[string]string{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			m[kv[i]] = kv[i+1]
+		}
+	}
+	return map[string]interface{}{"map": m}
+}
+
+// WriteCDM 将图写为 CDM 记录：Host、Principal、Subject、FileObject、NetFlowObject，然后是按时间排序的 Event
+func WriteCDM(g *Graph, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	write := func(kind string, datum map[string]interface{}) error {
+		return enc.Encode(cdmRecord{
+			Datum:      map[string]interface{}{cdmNamespace + kind: datum},
+			CDMVersion: CDMVersion,
+			Source:     cdmSource,
+		})
+	}
+
+	hosts := map[string]string{} // host_id -> host_name
+	for _, p := range g.Processes {
+		hosts[p.HostID] = p.HostName
+	}
+	for _, f := range g.Files {
+		hosts[f.HostID] = f.HostName
+	}
+	for _, s := range g.Sockets {
+		hosts[s.HostID] = s.HostName
+	}
+	hostIDs := make([]string, 0, len(hosts))
+	for id := range hosts {
+		hostIDs = append(hostIDs, id)
+	}
+	sort.Strings(hostIDs)
+	for _, id := range hostIDs {
+		if err := write("Host", map[string]interface{}{
+			"uuid":            hostUUID(id),
+			"hostName":        hosts[id],
+			"hostIdentifiers": []map[string]string{{"idType": "erinyes_host_id", "idValue": id}},
+			"hostType":        "HOST_SERVER",
+		}); err != nil {
+			return err
+		}
+		if err := write("Principal", map[string]interface{}{
+			"uuid":     principalUUID(id),
+			"type":     "PRINCIPAL_LOCAL",
+			"hostId":   hostUUID(id),
+			"userId":   "unknown",
+			"groupIds": []string{},
+		}); err != nil {
+			return err
+		}
+	}
+
+	subjects := map[int]string{} // 文件中的 id -> uuid
+	processHosts := map[int]string{}
+	for _, p := range g.Processes {
+		subjects[p.ID], processHosts[p.ID] = p.uuid(), p.HostID
+		datum := map[string]interface{}{
+			"uuid":                subjects[p.ID],
+			"type":                "SUBJECT_PROCESS",
+			"hostId":              hostUUID(p.HostID),
+			"localPrincipal":      principalUUID(p.HostID),
+			"startTimestampNanos": 0,
+			"cmdLine":             map[string]string{"string": p.ProcessExepath},
+			"properties": cdmProperties("name", p.ProcessName, "path", p.ProcessExepath, "vpid", p.ProcessVPID,
+				"container_id", p.ContainerID, "container_name", p.ContainerName, "host_id", p.HostID),
+		}
+		if cid, err := strconv.Atoi(p.ProcessVPID); err == nil {
+			datum["cid"] = cid
+		}
+		if err := write("Subject", datum); err != nil {
+			return err
+		}
+	}
+	files := map[int]File{}
+	for _, f := range g.Files {
+		files[f.ID] = f
+		if err := write("FileObject", map[string]interface{}{
+			"uuid": f.uuid(),
+			"type": "FILE_OBJECT_FILE",
+			"baseObject": map[string]interface{}{
+				"hostId": hostUUID(f.HostID),
+				"properties": cdmProperties("path", f.FilePath, "container_id", f.ContainerID,
+					"container_name", f.ContainerName, "host_id", f.HostID),
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	sockets := map[int]string{}
+	for _, s := range g.Sockets {
+		sockets[s.ID] = s.uuid()
+		port, _ := strconv.Atoi(s.DstPort)
+		if err := write("NetFlowObject", map[string]interface{}{
+			"uuid": sockets[s.ID],
+			"baseObject": map[string]interface{}{
+				"hostId": hostUUID(s.HostID),
+				"properties": cdmProperties("container_id", s.ContainerID, "container_name", s.ContainerName,
+					"host_id", s.HostID),
+			},
+			"localAddress":  "",
+			"localPort":     0,
+			"remoteAddress": s.DstIP,
+			"remotePort":    port,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// 边按时间排序，sequence 为排序后的序号
+	type edge struct {
+		time  int64
+		table string
+		id    int
+		datum map[string]interface{}
+	}
+	var edges []edge
+	for _, e := range g.Events {
+		var (
+			process      int // 边上作为 subject 的进程
+			object, path string
+		)
+		switch e.EventClass {
+		case "Process":
+			process, object = e.SrcID, subjects[e.DstID]
+		case "File_V1":
+			process = e.SrcID
+			if f, ok := files[e.DstID]; ok {
+				object, path = f.uuid(), f.FilePath
+			}
+		case "File_V2":
+			process = e.DstID
+			if f, ok := files[e.SrcID]; ok {
+				object, path = f.uuid(), f.FilePath
+			}
+		case "Network_V1":
+			process, object = e.SrcID, sockets[e.DstID]
+		case "Network_V2":
+			process, object = e.DstID, sockets[e.SrcID]
+		default:
+			return fmt.Errorf("unknown event class %s of event %d", e.EventClass, e.ID)
+		}
+		subject := subjects[process]
+		if subject == "" || object == "" {
+			return fmt.Errorf("endpoint of event %d not found", e.ID)
+		}
+		var args string
+		if decoded, err := (models.Event{Args: e.Args}).DecodeArgs(); err == nil {
+			args = strings.Join(decoded, " ")
+		}
+		datum := map[string]interface{}{
+			"uuid":            nameUUID(eventTable, g.Dataset, strconv.Itoa(e.ID)),
+			"type":            cdmEventType(e.Relation),
+			"subject":         cdmUUID(subject),
+			"predicateObject": cdmUUID(object),
+			"timestampNanos":  e.Time * 1000,
+			"name":            map[string]string{"string": e.Operation},
+			"hostId":          hostUUID(processHosts[process]),
+			"properties": cdmProperties("event_class", e.EventClass, "relation", e.Relation, "uuid", e.UUID,
+				"pid", e.Pid, "ret", e.Ret, "count", strconv.Itoa(e.Count), "end_time", strconv.FormatInt(e.EndTime, 10),
+				"args", args, "raw_segment", e.RawSegment, "erinyes_id", eventTable+":"+strconv.Itoa(e.ID)),
+		}
+		if path != "" {
+			datum["predicateObjectPath"] = map[string]string{"string": path}
+		}
+		if tid, err := strconv.Atoi(e.Tid); err == nil {
+			datum["threadId"] = map[string]int{"int": tid}
+		}
+		if e.Bytes > 0 {
+			datum["size"] = map[string]int64{"long": e.Bytes}
+		}
+		edges = append(edges, edge{time: e.Time, table: eventTable, id: e.ID, datum: datum})
+	}
+	for _, n := range g.Nets {
+		if sockets[n.SrcID] == "" || sockets[n.DstID] == "" {
+			return fmt.Errorf("endpoint of net %d not found", n.ID)
+		}
+		datum := map[string]interface{}{
+			"uuid":             nameUUID(netTable, g.Dataset, strconv.Itoa(n.ID)),
+			"type":             "EVENT_FLOWS_TO",
+			"predicateObject":  cdmUUID(sockets[n.SrcID]),
+			"predicateObject2": cdmUUID(sockets[n.DstID]),
+			"timestampNanos":   n.Time * 1000,
+			"name":             map[string]string{"string": n.Method},
+			"properties": cdmProperties("method", n.Method, "payload", n.Payload, "uuid", n.UUID,
+				"seq_num", strconv.Itoa(n.SeqNum), "ack_num", strconv.Itoa(n.AckNum), "raw_segment", n.RawSegment,
+				"erinyes_id", netTable+":"+strconv.Itoa(n.ID)),
+		}
+		if n.PayloadLen > 0 {
+			datum["size"] = map[string]int64{"long": int64(n.PayloadLen)}
+		}
+		edges = append(edges, edge{time: n.Time, table: netTable, id: n.ID, datum: datum})
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].time != edges[j].time {
+			return edges[i].time < edges[j].time
+		}
+		if edges[i].table != edges[j].table {
+			return edges[i].table < edges[j].table
+		}
+		return edges[i].id < edges[j].id
+	})
+	for i, e := range edges {
+		e.datum["sequence"] = map[string]int{"long": i + 1}
+		if err := write("Event", e.datum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package exchange
+
+import (
+	"bufio"
+	"encoding/json"
+	"erinyes/conf"
+	"erinyes/models"
+	"erinyes/store"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// cdmRelations CDM 事件类型对应的 relation，与 cdmEventTypes 相反；不在其中的类型去掉 EVENT_ 前缀后转为小写
+var cdmRelations = map[string]string{
+	"EVENT_FORK":     "fork",
+	"EVENT_CLONE":    "clone",
+	"EVENT_EXECUTE":  "execve",
+	"EVENT_BIND":     "bind",
+	"EVENT_ACCEPT":   "accept",
+	"EVENT_CONNECT":  "connect",
+	"EVENT_SENDTO":   "sendto",
+	"EVENT_RECVFROM": "recvfrom",
+	"EVENT_OPEN":     "open",
+	"EVENT_READ":     "read",
+	"EVENT_WRITE":    "write",
+}
+
+// cdmWrites 数据从进程流向对象的事件类型，对应 File_V1、Network_V1；其他类型对应 File_V2、Network_V2
+var cdmWrites = map[string]bool{
+	"EVENT_WRITE":                  true,
+	"EVENT_SENDTO":                 true,
+	"EVENT_SENDMSG":                true,
+	"EVENT_CONNECT":                true,
+	"EVENT_BIND":                   true,
+	"EVENT_CREATE_OBJECT":          true,
+	"EVENT_MODIFY_FILE_ATTRIBUTES": true,
+	"EVENT_RENAME":                 true,
+	"EVENT_TRUNCATE":               true,
+	"EVENT_UNLINK":                 true,
+	"EVENT_LINK":                   true,
+	"EVENT_UPDATE":                 true,
+	"EVENT_WRITE_SOCKET_PARAMS":    true,
+	"EVENT_ADD_OBJECT_ATTRIBUTE":   true,
+}
+
+// cdmValue 去掉 Avro JSON 对可选字段的包装，如 {"string": "x"}、{"long": 1}、{"com.bbn.tc.schema.avro.cdm18.UUID": "..."}
+func cdmValue(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return v
+	}
+	for k, inner := range m {
+		switch {
+		case k == "string" || k == "int" || k == "long" || k == "boolean" || k == "double" || k == "float":
+			return inner
+		case strings.HasSuffix(k, ".UUID"):
+			return inner
+		}
+	}
+	return v
+}
+
+// cdmString 读取字符串或数值字段，不存在时返回空字符串
+func cdmString(datum map[string]interface{}, key string) string {
+	switch v := cdmValue(datum[key]).(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+func cdmInt(datum map[string]interface{}, key string) int64 {
+	n, _ := strconv.ParseInt(cdmString(datum, key), 10, 64)
+	return n
+}
+
+// cdmMap 读取 properties 这样的 {"map": {...}} 字段
+func cdmMap(datum map[string]interface{}, key string) map[string]string {
+	props := map[string]string{}
+	m, _ := cdmValue(datum[key]).(map[string]interface{})
+	if inner, ok := m["map"].(map[string]interface{}); ok {
+		m = inner
+	}
+	for k, v := range m {
+		if s, ok := v.(string); ok {
+			props[k] = s
+		}
+	}
+	return props
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// cdmImporter 按 CDM 记录的顺序导入，Host 与 FileObject 的信息需要在之后的记录中使用
+type cdmImporter struct {
+	*sourceImporter
+	hosts        map[string]string       // Host uuid -> hostName
+	pendingFiles map[string]*models.File // 没有路径的 FileObject，等待事件中的 predicateObjectPath
+	subjectPids  map[string]string       // Subject uuid -> cid
+}
+
+// ImportCDM 导入 DARPA TC CDM 的 JSON 记录（每行一条，Avro JSON 编码，兼容 CDM 17 至 20），返回导入的统计
+// Subject 导入为 process，FileObject 为 file，NetFlowObject 为 socket，Event 按对象的类型和事件类型导入为 event 或 net，其他记录跳过
+func ImportCDM(s store.Store, r io.Reader) (SourceReport, error) {
+	im := &cdmImporter{
+		sourceImporter: newSourceImporter(s, models.UUIDSourceCDM),
+		hosts:          map[string]string{},
+		pendingFiles:   map[string]*models.File{},
+		subjectPids:    map[string]string{},
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record struct {
+			Datum map[string]map[string]interface{} `json:"datum"`
+		}
+		dec := json.NewDecoder(strings.NewReader(scanner.Text()))
+		dec.UseNumber()
+		if err := dec.Decode(&record); err != nil {
+			return im.report, fmt.Errorf("line %d: %w", line, err)
+		}
+		im.report.Records++
+		for kind, datum := range record.Datum {
+			im.record(kind[strings.LastIndex(kind, ".")+1:], datum)
+		}
+		if im.err != nil {
+			return im.report, im.err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return im.report, err
+	}
+	return im.finish()
+}
+
+// hostOf 记录所在主机的 host_id 与 host_name，没有 hostId（CDM 17）时使用配置中的主机
+func (im *cdmImporter) hostOf(datum map[string]interface{}, props map[string]string) (string, string) {
+	if id := props["host_id"]; id != "" {
+		return id, firstNonEmpty(im.hosts[cdmString(datum, "hostId")], id)
+	}
+	if id := cdmString(datum, "hostId"); id != "" {
+		return id, firstNonEmpty(im.hosts[id], id)
+	}
+	return conf.MockHostID, conf.MockHostName
+}
+
+func (im *cdmImporter) record(kind string, datum map[string]interface{}) {
+	uuid := cdmString(datum, "uuid")
+	switch kind {
+	case "Host":
+		im.hosts[uuid] = cdmString(datum, "hostName")
+	case "Subject":
+		if parent := cdmString(datum, "parentSubject"); cdmString(datum, "type") != "SUBJECT_PROCESS" && parent != "" {
+			im.addAlias(uuid, parent) // 线程、执行单元归属于其进程
+			return
+		}
+		props := cdmMap(datum, "properties")
+		hostID, hostName := im.hostOf(datum, props)
+		exe := props["path"]
+		if fields := strings.Fields(cdmString(datum, "cmdLine")); exe == "" && len(fields) > 0 {
+			exe = fields[0]
+		}
+		name := props["name"]
+		if name == "" && exe != "" {
+			name = path.Base(exe)
+		}
+		name = firstNonEmpty(name, "unknown")
+		vpid := firstNonEmpty(props["vpid"], cdmString(datum, "cid"))
+		im.subjectPids[uuid] = vpid
+		im.addProcess(uuid, &models.Process{
+			HostID:         hostID,
+			HostName:       hostName,
+			ContainerID:    firstNonEmpty(props["container_id"], hostContainer),
+			ContainerName:  firstNonEmpty(props["container_name"], hostContainer),
+			ProcessVPID:    vpid,
+			ProcessName:    name,
+			ProcessExepath: firstNonEmpty(exe, name),
+		})
+	case "FileObject":
+		base, _ := datum["baseObject"].(map[string]interface{})
+		props := cdmMap(base, "properties")
+		hostID, hostName := im.hostOf(base, props)
+		f := &models.File{
+			HostID:        hostID,
+			HostName:      hostName,
+			ContainerID:   firstNonEmpty(props["container_id"], hostContainer),
+			ContainerName: firstNonEmpty(props["container_name"], hostContainer),
+			FilePath:      firstNonEmpty(props["path"], props["filename"], cdmString(datum, "filename")),
+		}
+		if f.FilePath == "" {
+			im.pendingFiles[uuid] = f // 路径只出现在事件的 predicateObjectPath 中
+			return
+		}
+		im.addFile(uuid, f)
+	case "NetFlowObject":
+		base, _ := datum["baseObject"].(map[string]interface{})
+		props := cdmMap(base, "properties")
+		hostID, hostName := im.hostOf(base, props)
+		im.addSocket(uuid, &models.Socket{
+			HostID:        hostID,
+			HostName:      hostName,
+			ContainerID:   firstNonEmpty(props["container_id"], conf.OuterContainerID),
+			ContainerName: firstNonEmpty(props["container_name"], conf.OuterContainerName),
+			DstIP:         cdmString(datum, "remoteAddress"),
+			DstPort:       cdmString(datum, "remotePort"),
+		})
+	case "Event":
+		im.event(datum)
+	default:
+		im.skip()
+	}
+}
+
+// resolveFile 事件引用了没有路径的 FileObject 时，用事件中的路径（没有时用 cdm:<uuid>）创建文件顶点
+func (im *cdmImporter) resolveFile(uuid string, path string) {
+	f, ok := im.pendingFiles[uuid]
+	if !ok {
+		return
+	}
+	delete(im.pendingFiles, uuid)
+	f.FilePath = firstNonEmpty(path, "cdm:"+uuid)
+	im.addFile(uuid, f)
+}
+
+func (im *cdmImporter) event(datum map[string]interface{}) {
+	typ := cdmString(datum, "type")
+	props := cdmMap(datum, "properties")
+	relation := firstNonEmpty(props["relation"], cdmRelations[typ], strings.ToLower(strings.TrimPrefix(typ, "EVENT_")))
+	subject, object, object2 := cdmString(datum, "subject"), cdmString(datum, "predicateObject"), cdmString(datum, "predicateObject2")
+	time := cdmInt(datum, "timestampNanos") / 1000
+	uuid := firstNonEmpty(props["uuid"], "unknown")
+
+	if typ == "EVENT_FLOWS_TO" && subject == "" { // 两个 socket 之间的流量
+		seq, _ := strconv.Atoi(props["seq_num"])
+		ack, _ := strconv.Atoi(props["ack_num"])
+		im.addNet(sourceNet{src: object, dst: object2, net: models.Net{
+			Method:     firstNonEmpty(props["method"], cdmString(datum, "name")),
+			Payload:    props["payload"],
+			PayloadLen: int(cdmInt(datum, "size")),
+			SeqNum:     seq,
+			AckNum:     ack,
+			Time:       time,
+			UUID:       uuid,
+		}})
+		return
+	}
+	if subject == "" || object == "" {
+		im.skip()
+		return
+	}
+	im.resolveFile(object, cdmString(datum, "predicateObjectPath"))
+	write := cdmWrites[typ]
+	switch props["event_class"] { // erinyes 导出的 CDM 中记录了原来的方向
+	case "File_V1", "Network_V1":
+		write = true
+	case "File_V2", "Network_V2":
+		write = false
+	}
+	count, _ := strconv.Atoi(props["count"])
+	endTime, _ := strconv.ParseInt(props["end_time"], 10, 64)
+	im.addEdge(sourceEdge{subject: subject, object: object, write: write, event: models.Event{
+		Count:     count,
+		EndTime:   endTime,
+		Relation:  relation,
+		Operation: firstNonEmpty(cdmString(datum, "name"), relation),
+		Time:      time,
+		UUID:      uuid,
+		Pid:       firstNonEmpty(props["pid"], im.subjectPids[subject]),
+		Tid:       cdmString(datum, "threadId"),
+		Ret:       firstNonEmpty(props["ret"], props["return_value"]),
+		Bytes:     cdmInt(datum, "size"),
+	}})
+}
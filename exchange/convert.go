@@ -0,0 +1,171 @@
+package exchange
+
+import (
+	"erinyes/models"
+	"sort"
+)
+
+func processOf(p models.Process) Process {
+	return Process{
+		ID:             p.ID,
+		HostID:         p.HostID,
+		HostName:       p.HostName,
+		ContainerID:    p.ContainerID,
+		ContainerName:  p.ContainerName,
+		ProcessVPID:    p.ProcessVPID,
+		ProcessName:    p.ProcessName,
+		ProcessExepath: p.ProcessExepath,
+	}
+}
+
+// model 转换为待插入的记录，主键和数据集由存储填充
+func (p Process) model() *models.Process {
+	return &models.Process{
+		HostID:         p.HostID,
+		HostName:       p.HostName,
+		ContainerID:    p.ContainerID,
+		ContainerName:  p.ContainerName,
+		ProcessVPID:    p.ProcessVPID,
+		ProcessName:    p.ProcessName,
+		ProcessExepath: p.ProcessExepath,
+	}
+}
+
+func fileOf(f models.File) File {
+	return File{
+		ID:            f.ID,
+		HostID:        f.HostID,
+		HostName:      f.HostName,
+		ContainerID:   f.ContainerID,
+		ContainerName: f.ContainerName,
+		FilePath:      f.FilePath,
+	}
+}
+
+func (f File) model() *models.File {
+	return &models.File{
+		HostID:        f.HostID,
+		HostName:      f.HostName,
+		ContainerID:   f.ContainerID,
+		ContainerName: f.ContainerName,
+		FilePath:      f.FilePath,
+	}
+}
+
+func socketOf(s models.Socket) Socket {
+	return Socket{
+		ID:            s.ID,
+		HostID:        s.HostID,
+		HostName:      s.HostName,
+		ContainerID:   s.ContainerID,
+		ContainerName: s.ContainerName,
+		DstIP:         s.DstIP,
+		DstPort:       s.DstPort,
+	}
+}
+
+func (s Socket) model() *models.Socket {
+	return &models.Socket{
+		HostID:        s.HostID,
+		HostName:      s.HostName,
+		ContainerID:   s.ContainerID,
+		ContainerName: s.ContainerName,
+		DstIP:         s.DstIP,
+		DstPort:       s.DstPort,
+	}
+}
+
+func eventOf(e models.Event) Event {
+	return Event{
+		ID:         e.ID,
+		SrcID:      e.SrcID,
+		DstID:      e.DstID,
+		EventClass: e.EventClass,
+		Relation:   e.Relation,
+		Operation:  e.Operation,
+		Time:       e.Time,
+		EndTime:    e.EndTime,
+		Count:      e.Count,
+		UUID:       e.UUID,
+		Pid:        e.Pid,
+		Tid:        e.Tid,
+		Ret:        e.Ret,
+		Bytes:      e.Bytes,
+		Args:       e.Args,
+		Dedup:      e.DedupKey != nil,
+		RawSegment: e.RawSegment,
+		RawOffset:  e.RawOffset,
+		RawLength:  e.RawLength,
+	}
+}
+
+// model 转换为待插入的边，两端顶点的主键由调用方填充
+func (e Event) model() *models.Event {
+	po := &models.Event{
+		EventClass: e.EventClass,
+		Relation:   e.Relation,
+		Operation:  e.Operation,
+		Time:       e.Time,
+		EndTime:    e.EndTime,
+		Count:      e.Count,
+		UUID:       e.UUID,
+		Pid:        e.Pid,
+		Tid:        e.Tid,
+		Ret:        e.Ret,
+		Bytes:      e.Bytes,
+		Args:       e.Args,
+		RawSegment: e.RawSegment,
+		RawOffset:  e.RawOffset,
+		RawLength:  e.RawLength,
+	}
+	if po.EndTime == 0 {
+		po.EndTime = po.Time
+	}
+	if po.Count == 0 {
+		po.Count = 1
+	}
+	return po
+}
+
+func netOf(n models.Net) Net {
+	return Net{
+		ID:         n.ID,
+		SrcID:      n.SrcID,
+		DstID:      n.DstID,
+		Method:     n.Method,
+		Payload:    n.Payload,
+		PayloadLen: n.PayloadLen,
+		SeqNum:     n.SeqNum,
+		AckNum:     n.AckNum,
+		Time:       n.Time,
+		UUID:       n.UUID,
+		Dedup:      n.DedupKey != nil,
+		RawSegment: n.RawSegment,
+		RawOffset:  n.RawOffset,
+		RawLength:  n.RawLength,
+	}
+}
+
+func (n Net) model() *models.Net {
+	return &models.Net{
+		Method:     n.Method,
+		Payload:    n.Payload,
+		PayloadLen: n.PayloadLen,
+		SeqNum:     n.SeqNum,
+		AckNum:     n.AckNum,
+		Time:       n.Time,
+		UUID:       n.UUID,
+		RawSegment: n.RawSegment,
+		RawOffset:  n.RawOffset,
+		RawLength:  n.RawLength,
+	}
+}
+
+func sortedIDs(set map[int]bool) []int {
+	ids := make([]int, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,186 @@
+package exchange
+
+import (
+	"erinyes/conf"
+	"erinyes/models"
+	"erinyes/store"
+	"fmt"
+	"github.com/awalterschulze/gographviz"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DotFormat 导入 dot 文件时使用的格式名
+const DotFormat = "dot"
+
+// DotOptions 导入 dot 文件时顶点所在的主机与容器
+type DotOptions struct {
+	HostID      string // 为空时 GenerateDot 格式的顶点使用名称中的主机，旧格式使用 conf.MockHostID
+	ContainerID string // 不为空时所有进程、文件及容器内的 socket 都属于该容器；旧格式必须指定
+}
+
+// DotFileContainer 旧格式 dot 文件名中的容器 ID，如 low/attack-<container_id>-1.dot，文件名中没有时返回空字符串
+func DotFileContainer(path string) string {
+	parts := strings.Split(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), "-")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
+
+// ImportDot 导入 GenerateDot 生成的 dot 文件，或 dot2mysql 使用的旧格式（顶点名称为 Process##<vpid>、File##<path>、NetPeer##<ip>:<port>，边的 label 为时间）
+// 整个文件在一个事务中导入（存储实现了 store.Transactor 时），失败时不留下任何记录；边去重插入，重复导入同一个文件不会产生新的边
+func ImportDot(s store.Store, data []byte, opts DotOptions) (SourceReport, error) {
+	graph, err := gographviz.Read(data)
+	if err != nil {
+		return SourceReport{}, err
+	}
+	var report SourceReport
+	importDot := func(tx store.Store) error {
+		im := &sourceImporter{s: tx, source: DotFormat, dedup: true, ids: map[string]vertexRef{}} // dot 中的顶点名称不保存到 uuid_map
+		err := im.addDot(graph, opts)
+		report = im.report
+		return err
+	}
+	if t, ok := s.(store.Transactor); ok {
+		err = t.Transaction(importDot)
+	} else {
+		err = importDot(s)
+	}
+	return report, err
+}
+
+// dotNodeHost 将 GenerateDot 顶点名称中 # 之后的 <host_id>_<container_id> 拆开，主机名中不会出现下划线
+func dotNodeHost(name string) (string, string, string, bool) {
+	i := strings.LastIndex(name, "#")
+	if i < 0 {
+		return "", "", "", false
+	}
+	hostContainer := strings.SplitN(name[i+1:], "_", 2)
+	if len(hostContainer) != 2 {
+		return "", "", "", false
+	}
+	return name[:i], hostContainer[0], hostContainer[1], true
+}
+
+// dotHostName dot 文件中只有主机与容器的 ID，名称取配置中的名称或 ID 本身
+func dotHostName(hostID string) string {
+	if hostID == conf.MockHostID {
+		return conf.MockHostName
+	}
+	return hostID
+}
+
+func dotContainerName(containerID string) string {
+	if containerID == conf.OuterContainerID {
+		return conf.OuterContainerName
+	}
+	return containerID
+}
+
+// addDotNode 按顶点名称（旧格式）或形状（GenerateDot 格式）加入顶点，返回顶点所在的表，无法识别或容器顶点返回空字符串
+func (im *sourceImporter) addDotNode(name string, shape string, opts DotOptions) string {
+	if kind := strings.SplitN(name, "##", 2); len(kind) == 2 {
+		hostID, containerID := firstNonEmpty(opts.HostID, conf.MockHostID), opts.ContainerID
+		switch kind[0] {
+		case "Process":
+			im.addProcess(name, &models.Process{HostID: hostID, HostName: dotHostName(hostID), ContainerID: containerID, ContainerName: dotContainerName(containerID),
+				ProcessVPID: kind[1], ProcessName: "unknown", ProcessExepath: "unknown"})
+			return ProcessType
+		case "File":
+			im.addFile(name, &models.File{HostID: hostID, HostName: dotHostName(hostID), ContainerID: containerID, ContainerName: dotContainerName(containerID),
+				FilePath: kind[1]})
+			return FileType
+		case "NetPeer":
+			i := strings.LastIndex(kind[1], ":")
+			if i < 0 {
+				return ""
+			}
+			so := &models.Socket{HostID: hostID, HostName: dotHostName(hostID), ContainerID: containerID, ContainerName: dotContainerName(containerID),
+				DstIP: kind[1][:i], DstPort: kind[1][i+1:]}
+			if so.DstPort == "53" || so.DstPort == "8080" { // 与 dot2mysql 一致，DNS 与网关端口属于外部容器
+				so.ContainerID, so.ContainerName = conf.OuterContainerID, conf.OuterContainerName
+			}
+			im.addSocket(name, so)
+			return SocketType
+		}
+		return "" // Container##<id> 等
+	}
+
+	value, hostID, containerID, ok := dotNodeHost(name)
+	if !ok {
+		return ""
+	}
+	hostID = firstNonEmpty(opts.HostID, hostID)
+	if opts.ContainerID != "" && (shape != (models.Socket{}).VertexShape() || containerID != conf.OuterContainerID) {
+		containerID = opts.ContainerID
+	}
+	switch shape {
+	case (models.Process{}).VertexShape(): // <vpid>_<name>
+		vpidName := strings.SplitN(value, "_", 2)
+		if len(vpidName) != 2 {
+			return ""
+		}
+		im.addProcess(name, &models.Process{HostID: hostID, HostName: dotHostName(hostID), ContainerID: containerID, ContainerName: dotContainerName(containerID),
+			ProcessVPID: vpidName[0], ProcessName: vpidName[1], ProcessExepath: vpidName[1]})
+		return ProcessType
+	case (models.File{}).VertexShape():
+		im.addFile(name, &models.File{HostID: hostID, HostName: dotHostName(hostID), ContainerID: containerID, ContainerName: dotContainerName(containerID),
+			FilePath: value})
+		return FileType
+	case (models.Socket{}).VertexShape(): // <ip>:<port>
+		i := strings.LastIndex(value, ":")
+		if i < 0 {
+			return ""
+		}
+		im.addSocket(name, &models.Socket{HostID: hostID, HostName: dotHostName(hostID), ContainerID: containerID, ContainerName: dotContainerName(containerID),
+			DstIP: value[:i], DstPort: value[i+1:]})
+		return SocketType
+	}
+	return ""
+}
+
+// addDot 加入 dot 图中的全部顶点和边，边的类型由两端顶点所在的表决定
+func (im *sourceImporter) addDot(graph *gographviz.Graph, opts DotOptions) error {
+	tables := make(map[string]string) // 顶点名称 -> 表
+	for _, node := range graph.Nodes.Nodes {
+		im.report.Records++
+		name := strings.Trim(node.Name, `"`)
+		if strings.Contains(name, "##") && opts.ContainerID == "" {
+			return fmt.Errorf("vertex %s of legacy dot file needs a container id", name)
+		}
+		if tables[name] = im.addDotNode(name, strings.Trim(node.Attrs["shape"], `"`), opts); tables[name] == "" {
+			im.skip()
+		}
+	}
+	for _, edge := range graph.Edges.Edges {
+		im.report.Records++
+		src, dst := strings.Trim(edge.Src, `"`), strings.Trim(edge.Dst, `"`)
+		label := strings.Trim(edge.Attrs["label"], `"`)
+		legacy := strings.Contains(src, "##")
+		event := models.Event{Relation: label, Operation: label, UUID: "unknown"}
+		if legacy { // 旧格式的 label 为时间，没有 relation
+			event.Relation, event.Operation = "unknown", "unknown"
+			event.Time, _ = strconv.ParseInt(label, 10, 64)
+		}
+		switch {
+		case tables[src] == "" || tables[dst] == "":
+			im.skip()
+		case tables[src] == SocketType && tables[dst] == SocketType:
+			net := models.Net{Method: label, Time: event.Time}
+			if legacy {
+				net.Method = "post"
+			}
+			im.addNet(sourceNet{src: src, dst: dst, net: net})
+		case tables[src] == ProcessType:
+			im.addEdge(sourceEdge{subject: src, object: dst, write: true, event: event})
+		case tables[dst] == ProcessType:
+			im.addEdge(sourceEdge{subject: dst, object: src, event: event})
+		default:
+			im.skip()
+		}
+	}
+	_, err := im.finish()
+	return err
+}
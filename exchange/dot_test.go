@@ -0,0 +1,50 @@
+package exchange
+
+import (
+	"erinyes/builder"
+	"erinyes/models"
+	"testing"
+)
+
+func TestDotRoundTrip(t *testing.T) {
+	src := newTestStore(t)
+	dot := builder.GenerateDotGraph(src, "").String()
+
+	dst := newEmptyStore(t)
+	report, err := ImportDot(dst, []byte(dot), DotOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 孤立的文件不在 dot 中；流量边与 sysdig 边一样只保留名称与 label
+	if report.Processes != 2 || report.Files != 2 || report.Sockets != 2 || report.Events != 4 || report.Nets != 1 || report.Skipped != 0 {
+		t.Fatalf("report %s", report)
+	}
+	if got := builder.GenerateDotGraph(dst, "").String(); got != dot {
+		t.Fatalf("dot of imported graph differs:\n%s\nwant\n%s", got, dot)
+	}
+
+	// 再次导入时顶点按唯一键复用，边去重
+	if report, err = ImportDot(dst, []byte(dot), DotOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if report.Processes != 0 || report.Files != 0 || report.Sockets != 0 || report.Events != 0 || report.Nets != 0 || report.Duplicates != 5 {
+		t.Fatalf("report of the second import %s", report)
+	}
+
+	// 目标存储中已有的顶点被复用
+	other := newEmptyStore(t)
+	sh := &models.Process{HostID: "h1", HostName: "h1", ContainerID: "c1", ContainerName: "c1", ProcessVPID: "7", ProcessName: "sh", ProcessExepath: "sh"}
+	if _, err := other.UpsertProcesses([]*models.Process{sh}); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = ImportDot(other, []byte(dot), DotOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if report.Processes != 1 || report.Events != 4 {
+		t.Fatalf("report of the import into a store with process sh %s", report)
+	}
+	events, err := other.FetchEvents(sh.ID, []string{"File_V1", "Network_V1"}, false, "")
+	if err != nil || len(events) != 2 {
+		t.Fatalf("edges from existing process sh %+v (%v), want 2", events, err)
+	}
+}
@@ -0,0 +1,378 @@
+package exchange
+
+import (
+	"erinyes/models"
+	"erinyes/store"
+	"fmt"
+)
+
+const (
+	FormatName    = "erinyes-graph" // JSON 文件中 format 字段的值
+	FormatVersion = 1
+
+	ProcessType = "process"
+	FileType    = "file"
+	SocketType  = "socket"
+)
+
+// Filter 导出的范围，字段为零值时不限制
+// 指定 UUID 或时间范围时只导出匹配的边及其两端的顶点，否则导出数据集中的所有顶点（包括孤立顶点）
+type Filter struct {
+	UUID string `json:"uuid,omitempty"`
+	From int64  `json:"from,omitempty"` // 边的时间戳（16 位微秒）不小于该值，合并的重复边比较最后一次事件的时间
+	To   int64  `json:"to,omitempty"`   // 边的时间戳小于该值，合并的重复边比较第一次事件的时间
+}
+
+// IsEmpty 是否没有任何过滤条件
+func (f Filter) IsEmpty() bool {
+	return f == Filter{}
+}
+
+// match 时间段 [start, end] 是否与 [From, To) 相交
+func (f Filter) match(start int64, end int64) bool {
+	if end < start {
+		end = start
+	}
+	return (f.From == 0 || end >= f.From) && (f.To == 0 || start < f.To)
+}
+
+// Graph 导出的溯源图，JSON 格式即该结构的序列化；顶点与边的 id 是导出时的主键，只在文件内有意义
+type Graph struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Dataset   string    `json:"dataset"`
+	Filter    Filter    `json:"filter"`
+	Processes []Process `json:"processes"`
+	Files     []File    `json:"files"`
+	Sockets   []Socket  `json:"sockets"`
+	Events    []Event   `json:"events"`
+	Nets      []Net     `json:"nets"`
+}
+
+type Process struct {
+	ID             int    `json:"id"`
+	HostID         string `json:"host_id"`
+	HostName       string `json:"host_name"`
+	ContainerID    string `json:"container_id"`
+	ContainerName  string `json:"container_name"`
+	ProcessVPID    string `json:"process_vpid"`
+	ProcessName    string `json:"process_name"`
+	ProcessExepath string `json:"process_exe_path"`
+}
+
+type File struct {
+	ID            int    `json:"id"`
+	HostID        string `json:"host_id"`
+	HostName      string `json:"host_name"`
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	FilePath      string `json:"file_path"`
+}
+
+type Socket struct {
+	ID            int    `json:"id"`
+	HostID        string `json:"host_id"`
+	HostName      string `json:"host_name"`
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	DstIP         string `json:"dst_ip"`
+	DstPort       string `json:"dst_port"`
+}
+
+// Event 起点、终点所在的顶点表由 event_class 决定，与数据库中一致
+type Event struct {
+	ID         int    `json:"id"`
+	SrcID      int    `json:"src_id"`
+	DstID      int    `json:"dst_id"`
+	EventClass string `json:"event_class"`
+	Relation   string `json:"relation"`
+	Operation  string `json:"operation"`
+	Time       int64  `json:"time"`
+	EndTime    int64  `json:"end_time"`
+	Count      int    `json:"count"`
+	UUID       string `json:"uuid"`
+	Pid        string `json:"pid"`
+	Tid        string `json:"tid"`
+	Ret        string `json:"ret"`
+	Bytes      int64  `json:"bytes"`
+	Args       []byte `json:"args"`  // gzip 压缩的 evt.info，base64 编码
+	Dedup      bool   `json:"dedup"` // 插入时是否去重，导入时以同样的方式插入
+	RawSegment string `json:"raw_segment"`
+	RawOffset  int64  `json:"raw_offset"`
+	RawLength  int    `json:"raw_length"`
+}
+
+// Net 起点、终点都是 socket
+type Net struct {
+	ID         int    `json:"id"`
+	SrcID      int    `json:"src_id"`
+	DstID      int    `json:"dst_id"`
+	Method     string `json:"method"`
+	Payload    string `json:"payload"`
+	PayloadLen int    `json:"payload_len"`
+	SeqNum     int    `json:"seq_num"`
+	AckNum     int    `json:"ack_num"`
+	Time       int64  `json:"time"`
+	UUID       string `json:"uuid"`
+	Dedup      bool   `json:"dedup"`
+	RawSegment string `json:"raw_segment"`
+	RawOffset  int64  `json:"raw_offset"`
+	RawLength  int    `json:"raw_length"`
+}
+
+// pageSize 导出时分页扫描的行数
+const pageSize = 500
+
+// Export 从存储当前的数据集中导出匹配 filter 的溯源图
+func Export(s store.Store, filter Filter) (*Graph, error) {
+	g := &Graph{
+		Format:    FormatName,
+		Version:   FormatVersion,
+		Dataset:   s.Dataset(),
+		Filter:    filter,
+		Processes: []Process{},
+		Files:     []File{},
+		Sockets:   []Socket{},
+		Events:    []Event{},
+		Nets:      []Net{},
+	}
+	vertices := map[string]map[int]bool{ProcessType: {}, FileType: {}, SocketType: {}} // 边引用的顶点
+
+	lastID := 0
+	for {
+		events, err := s.ScanEvents(lastID, pageSize, filter.UUID)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, e := range events {
+			lastID = e.ID
+			if !filter.match(e.Time, e.EndTime) {
+				continue
+			}
+			src, dst, ok := store.EventEndpoints(e.EventClass)
+			if !ok {
+				return nil, fmt.Errorf("unknown event class %s of event %d", e.EventClass, e.ID)
+			}
+			vertices[src][e.SrcID], vertices[dst][e.DstID] = true, true
+			g.Events = append(g.Events, eventOf(e))
+		}
+	}
+	lastID = 0
+	for {
+		nets, err := s.ScanNets(lastID, pageSize, filter.UUID)
+		if err != nil {
+			return nil, err
+		}
+		if len(nets) == 0 {
+			break
+		}
+		for _, n := range nets {
+			lastID = n.ID
+			if !filter.match(n.Time, n.Time) {
+				continue
+			}
+			vertices[SocketType][n.SrcID], vertices[SocketType][n.DstID] = true, true
+			g.Nets = append(g.Nets, netOf(n))
+		}
+	}
+
+	if filter.IsEmpty() {
+		return g, exportAllVertices(s, g)
+	}
+	return g, exportVertices(s, g, vertices)
+}
+
+// exportAllVertices 按主键顺序导出数据集中的所有顶点
+func exportAllVertices(s store.Store, g *Graph) error {
+	lastID := 0
+	for {
+		processes, err := s.ScanProcesses(lastID, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(processes) == 0 {
+			break
+		}
+		for _, p := range processes {
+			lastID = p.ID
+			g.Processes = append(g.Processes, processOf(p))
+		}
+	}
+	lastID = 0
+	for {
+		files, err := s.ScanFiles(lastID, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			break
+		}
+		for _, f := range files {
+			lastID = f.ID
+			g.Files = append(g.Files, fileOf(f))
+		}
+	}
+	lastID = 0
+	for {
+		sockets, err := s.ScanSockets(lastID, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(sockets) == 0 {
+			break
+		}
+		for _, so := range sockets {
+			lastID = so.ID
+			g.Sockets = append(g.Sockets, socketOf(so))
+		}
+	}
+	return nil
+}
+
+// exportVertices 按主键导出边引用的顶点
+func exportVertices(s store.Store, g *Graph, vertices map[string]map[int]bool) error {
+	for _, id := range sortedIDs(vertices[ProcessType]) {
+		p, err := s.GetProcess(id)
+		if err != nil {
+			return fmt.Errorf("process %d: %w", id, err)
+		}
+		g.Processes = append(g.Processes, processOf(p))
+	}
+	for _, id := range sortedIDs(vertices[FileType]) {
+		f, err := s.GetFile(id)
+		if err != nil {
+			return fmt.Errorf("file %d: %w", id, err)
+		}
+		g.Files = append(g.Files, fileOf(f))
+	}
+	for _, id := range sortedIDs(vertices[SocketType]) {
+		so, err := s.GetSocket(id)
+		if err != nil {
+			return fmt.Errorf("socket %d: %w", id, err)
+		}
+		g.Sockets = append(g.Sockets, socketOf(so))
+	}
+	return nil
+}
+
+// ImportReport 导入的各类记录数，顶点只统计新建的
+type ImportReport struct {
+	Processes int
+	Files     int
+	Sockets   int
+	Events    int
+	Nets      int
+}
+
+func (r ImportReport) String() string {
+	return fmt.Sprintf("processes: %d, files: %d, sockets: %d, events: %d, nets: %d",
+		r.Processes, r.Files, r.Sockets, r.Events, r.Nets)
+}
+
+// Import 将图导入存储当前的数据集：顶点按唯一键与已有顶点去重，边按导入文件中记录的方式插入（dedup 为 false 的边重复导入时会重复插入），请求关联随插入重新生成
+func Import(s store.Store, g *Graph) (ImportReport, error) {
+	var report ImportReport
+	if g.Format != FormatName || g.Version > FormatVersion {
+		return report, fmt.Errorf("unsupported graph format %s version %d", g.Format, g.Version)
+	}
+	ids := map[string]map[int]int{ProcessType: {}, FileType: {}, SocketType: {}} // 顶点类型 -> 文件中的 id -> 主键
+
+	processes := make([]*models.Process, len(g.Processes))
+	for i, p := range g.Processes {
+		processes[i] = p.model()
+	}
+	created, err := s.UpsertProcesses(processes)
+	if err != nil {
+		return report, err
+	}
+	report.Processes = created
+	for i, p := range g.Processes {
+		ids[ProcessType][p.ID] = processes[i].ID
+	}
+
+	files := make([]*models.File, len(g.Files))
+	for i, f := range g.Files {
+		files[i] = f.model()
+	}
+	if report.Files, err = s.UpsertFiles(files); err != nil {
+		return report, err
+	}
+	for i, f := range g.Files {
+		ids[FileType][f.ID] = files[i].ID
+	}
+
+	sockets := make([]*models.Socket, len(g.Sockets))
+	for i, so := range g.Sockets {
+		sockets[i] = so.model()
+	}
+	if report.Sockets, err = s.UpsertSockets(sockets); err != nil {
+		return report, err
+	}
+	for i, so := range g.Sockets {
+		ids[SocketType][so.ID] = sockets[i].ID
+	}
+
+	var events [2][]*models.Event // 不去重、去重插入的边
+	for _, e := range g.Events {
+		src, dst, ok := store.EventEndpoints(e.EventClass)
+		if !ok {
+			return report, fmt.Errorf("unknown event class %s of event %d", e.EventClass, e.ID)
+		}
+		po := e.model()
+		if po.SrcID, ok = ids[src][e.SrcID]; !ok {
+			return report, fmt.Errorf("%s %d of event %d not found", src, e.SrcID, e.ID)
+		}
+		if po.DstID, ok = ids[dst][e.DstID]; !ok {
+			return report, fmt.Errorf("%s %d of event %d not found", dst, e.DstID, e.ID)
+		}
+		dedup := 0
+		if e.Dedup {
+			dedup = 1
+		}
+		events[dedup] = append(events[dedup], po)
+	}
+	var nets [2][]*models.Net
+	for _, n := range g.Nets {
+		po := n.model()
+		var ok bool
+		if po.SrcID, ok = ids[SocketType][n.SrcID]; !ok {
+			return report, fmt.Errorf("socket %d of net %d not found", n.SrcID, n.ID)
+		}
+		if po.DstID, ok = ids[SocketType][n.DstID]; !ok {
+			return report, fmt.Errorf("socket %d of net %d not found", n.DstID, n.ID)
+		}
+		dedup := 0
+		if n.Dedup {
+			dedup = 1
+		}
+		nets[dedup] = append(nets[dedup], po)
+	}
+	for dedup := range events {
+		inserted, err := s.InsertEvents(events[dedup], dedup == 1)
+		report.Events += count(inserted)
+		if err != nil {
+			return report, err
+		}
+	}
+	for dedup := range nets {
+		inserted, err := s.InsertNets(nets[dedup], dedup == 1)
+		report.Nets += count(inserted)
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func count(inserted []bool) int {
+	n := 0
+	for _, ok := range inserted {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
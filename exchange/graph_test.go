@@ -0,0 +1,187 @@
+package exchange
+
+import (
+	"bytes"
+	"erinyes/logs"
+	"erinyes/models"
+	"erinyes/store"
+	"github.com/sirupsen/logrus"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newTestStore 创建内存存储，包含各类顶点与边：去重与不去重插入的 event、合并的重复边、带参数和原始日志位置的边、net
+func newTestStore(t *testing.T) store.Store {
+	logs.Logger = logrus.New()
+	logs.Logger.SetLevel(logrus.WarnLevel)
+	s, err := store.OpenMemory("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	processes := []*models.Process{
+		{HostID: "h1", HostName: "host-1", ContainerID: "c1", ContainerName: "web", ProcessVPID: "1", ProcessName: "nginx", ProcessExepath: "/usr/sbin/nginx"},
+		{HostID: "h1", HostName: "host-1", ContainerID: "c1", ContainerName: "web", ProcessVPID: "7", ProcessName: "sh", ProcessExepath: "/bin/sh"},
+	}
+	files := []*models.File{
+		{HostID: "h1", HostName: "host-1", ContainerID: "c1", ContainerName: "web", FilePath: "/etc/passwd"},
+		{HostID: "h1", HostName: "host-1", ContainerID: "c1", ContainerName: "web", FilePath: "/tmp/x"},
+		{HostID: "h1", HostName: "host-1", ContainerID: "c1", ContainerName: "web", FilePath: "/var/unused"}, // 孤立顶点
+	}
+	sockets := []*models.Socket{
+		{HostID: "h1", HostName: "host-1", ContainerID: "c1", ContainerName: "web", DstIP: "10.0.0.2", DstPort: "80"},
+		{HostID: "h2", HostName: "host-2", ContainerID: "c2", ContainerName: "db", DstIP: "10.0.0.3", DstPort: "3306"},
+	}
+	for _, err := range []error{
+		second(s.UpsertProcesses(processes)),
+		second(s.UpsertFiles(files)),
+		second(s.UpsertSockets(sockets)),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	args, err := models.EncodeArgs([]string{"fd=3(<f>/etc/passwd)", "size=32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dedup := []*models.Event{
+		{SrcID: processes[0].ID, DstID: processes[1].ID, EventClass: "Process", Relation: "fork", Operation: "fork", Time: 100, EndTime: 100, Count: 1, UUID: "r1", Pid: "1", Tid: "1"},
+		{SrcID: files[0].ID, DstID: processes[1].ID, EventClass: "File_V2", Relation: "read", Operation: "read", Time: 200, EndTime: 260, Count: 3, UUID: "r1,r2", Pid: "7", Tid: "7", Ret: "32", Bytes: 96,
+			Args: args, RawSegment: "ab", RawOffset: 10, RawLength: 20},
+		{SrcID: processes[1].ID, DstID: sockets[0].ID, EventClass: "Network_V1", Relation: "sendto", Operation: "sendto", Time: 300, EndTime: 300, Count: 1, UUID: "r2", Pid: "7", Tid: "8", Ret: "-1"},
+	}
+	plain := []*models.Event{
+		{SrcID: processes[1].ID, DstID: files[1].ID, EventClass: "File_V1", Relation: "write", Operation: "write", Time: 250, EndTime: 250, Count: 1, UUID: "unknown", Pid: "7", Tid: "7", Bytes: 4},
+	}
+	nets := []*models.Net{
+		{SrcID: sockets[0].ID, DstID: sockets[1].ID, Method: "POST", Payload: "a,\"b\"\nc", PayloadLen: 7, SeqNum: 1, AckNum: 2, Time: 310, UUID: "r2"},
+	}
+	for _, err := range []error{
+		second(s.InsertEvents(dedup, true)),
+		second(s.InsertEvents(plain, false)),
+		second(s.InsertNets(nets, true)),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func second(_ interface{}, err error) error {
+	return err
+}
+
+// withoutEdgeIDs 导入时不去重与去重的边分开插入，边的主键与导出时不同，比较前清空主键并按时间排序
+func withoutEdgeIDs(g *Graph) *Graph {
+	c := *g
+	c.Events = append([]Event(nil), g.Events...)
+	c.Nets = append([]Net(nil), g.Nets...)
+	for i := range c.Events {
+		c.Events[i].ID = 0
+	}
+	for i := range c.Nets {
+		c.Nets[i].ID = 0
+	}
+	sort.Slice(c.Events, func(i, j int) bool { return c.Events[i].Time < c.Events[j].Time })
+	sort.Slice(c.Nets, func(i, j int) bool { return c.Nets[i].Time < c.Nets[j].Time })
+	return &c
+}
+
+func newEmptyStore(t *testing.T) store.Store {
+	logs.Logger = logrus.New()
+	logs.Logger.SetLevel(logrus.WarnLevel)
+	s, err := store.OpenMemory("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestGraphRoundTrip(t *testing.T) {
+	src := newTestStore(t)
+	exported, err := Export(src, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported.Processes) != 2 || len(exported.Files) != 3 || len(exported.Sockets) != 2 || len(exported.Events) != 4 || len(exported.Nets) != 1 {
+		t.Fatalf("exported %d processes, %d files, %d sockets, %d events, %d nets",
+			len(exported.Processes), len(exported.Files), len(exported.Sockets), len(exported.Events), len(exported.Nets))
+	}
+	for _, format := range []string{JSONFormat, GraphMLFormat} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(exported, format, &buf); err != nil {
+				t.Fatal(err)
+			}
+			data := buf.Bytes()
+			read, err := Read(format, bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst := newEmptyStore(t)
+			report, err := Import(dst, read)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (ImportReport{Processes: 2, Files: 3, Sockets: 2, Events: 4, Nets: 1}); report != want {
+				t.Fatalf("report %s, want %s", report, want)
+			}
+			imported, err := Export(dst, Filter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(withoutEdgeIDs(imported), withoutEdgeIDs(exported)) {
+				t.Fatalf("imported graph differs:\n%+v\nwant\n%+v", imported, exported)
+			}
+
+			// 再次导入：顶点按唯一键复用，去重插入的边不再插入，不去重的边重复插入
+			read, err = Read(format, bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report, err = Import(dst, read); err != nil {
+				t.Fatal(err)
+			}
+			if want := (ImportReport{Events: 1}); report != want {
+				t.Fatalf("report of the second import %s, want %s", report, want)
+			}
+		})
+	}
+}
+
+func TestImportDedupAgainstExistingVertices(t *testing.T) {
+	exported, err := Export(newTestStore(t), Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 目标存储中已有一个唯一键相同的进程与文件，以及无关的顶点，导入后的主键与导出时不同
+	dst := newEmptyStore(t)
+	existing := []*models.Process{
+		{HostID: "h9", ContainerID: "c9", ProcessVPID: "1", ProcessName: "init", ProcessExepath: "/sbin/init"},
+		{HostID: "h1", HostName: "host-1", ContainerID: "c1", ContainerName: "web", ProcessVPID: "7", ProcessName: "sh", ProcessExepath: "/bin/sh"},
+	}
+	if _, err := dst.UpsertProcesses(existing); err != nil {
+		t.Fatal(err)
+	}
+	file := &models.File{HostID: "h1", HostName: "host-1", ContainerID: "c1", ContainerName: "web", FilePath: "/tmp/x"}
+	if _, err := dst.UpsertFiles([]*models.File{file}); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Import(dst, exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ImportReport{Processes: 1, Files: 2, Sockets: 2, Events: 4, Nets: 1}); report != want {
+		t.Fatalf("report %s, want %s", report, want)
+	}
+	sh, err := dst.FindProcess("h1", "c1", "7", "sh")
+	if err != nil || sh.ID != existing[1].ID {
+		t.Fatalf("process sh %d (%v), want existing %d", sh.ID, err, existing[1].ID)
+	}
+	events, err := dst.FetchEvents(sh.ID, []string{"File_V1"}, false, "")
+	if err != nil || len(events) != 1 || events[0].DstID != file.ID {
+		t.Fatalf("writes of sh %+v (%v), want one to existing file %d", events, err, file.ID)
+	}
+}
@@ -0,0 +1,361 @@
+package exchange
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"erinyes/store"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr,omitempty"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr,omitempty"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Data        []graphMLData `xml:"data"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr,omitempty"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+// attribute 顶点或边结构体中的一个字段，GraphML 中的属性名与 JSON 中一致
+type attribute struct {
+	name  string
+	typ   string // GraphML 的 attr.type
+	index int
+}
+
+// attributesOf 返回结构体中除 id、src_id、dst_id 以外的字段，这些字段由 GraphML 的 id、source、target 表示
+func attributesOf(t reflect.Type) []attribute {
+	var attrs []attribute
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "id" || name == "src_id" || name == "dst_id" {
+			continue
+		}
+		typ := "string"
+		switch t.Field(i).Type.Kind() {
+		case reflect.Int, reflect.Int64:
+			typ = "long"
+		case reflect.Bool:
+			typ = "boolean"
+		}
+		attrs = append(attrs, attribute{name: name, typ: typ, index: i})
+	}
+	return attrs
+}
+
+var (
+	nodeTypes = map[string]reflect.Type{
+		ProcessType: reflect.TypeOf(Process{}),
+		FileType:    reflect.TypeOf(File{}),
+		SocketType:  reflect.TypeOf(Socket{}),
+	}
+	edgeTypes = map[string]reflect.Type{
+		eventTable: reflect.TypeOf(Event{}),
+		netTable:   reflect.TypeOf(Net{}),
+	}
+)
+
+const (
+	eventTable = "event"
+	netTable   = "net"
+)
+
+// graphMLKeys 声明图、顶点、边的所有属性，不同类型的顶点（边）中同名的属性只声明一次
+func graphMLKeys() []graphMLKey {
+	keys := []graphMLKey{
+		{ID: "g_format", For: "graph", Name: "format", Type: "string"},
+		{ID: "g_version", For: "graph", Name: "version", Type: "int"},
+		{ID: "g_dataset", For: "graph", Name: "dataset", Type: "string"},
+		{ID: "g_uuid", For: "graph", Name: "uuid", Type: "string"},
+		{ID: "g_from", For: "graph", Name: "from", Type: "long"},
+		{ID: "g_to", For: "graph", Name: "to", Type: "long"},
+		{ID: "v_type", For: "node", Name: "type", Type: "string"},
+		{ID: "e_table", For: "edge", Name: "table", Type: "string"},
+	}
+	declared := map[string]bool{}
+	for _, group := range []struct {
+		prefix string
+		domain string
+		types  []reflect.Type
+	}{
+		{"v_", "node", []reflect.Type{nodeTypes[ProcessType], nodeTypes[FileType], nodeTypes[SocketType]}},
+		{"e_", "edge", []reflect.Type{edgeTypes[eventTable], edgeTypes[netTable]}},
+	} {
+		for _, t := range group.types {
+			for _, attr := range attributesOf(t) {
+				if declared[group.prefix+attr.name] {
+					continue
+				}
+				declared[group.prefix+attr.name] = true
+				keys = append(keys, graphMLKey{ID: group.prefix + attr.name, For: group.domain, Name: attr.name, Type: attr.typ})
+			}
+		}
+	}
+	return keys
+}
+
+// dataOf 将结构体的非零属性转换为 GraphML 的 data
+func dataOf(prefix string, v interface{}) []graphMLData {
+	rv := reflect.ValueOf(v)
+	var data []graphMLData
+	for _, attr := range attributesOf(rv.Type()) {
+		f := rv.Field(attr.index)
+		if f.IsZero() {
+			continue
+		}
+		var value string
+		switch f.Kind() {
+		case reflect.Int, reflect.Int64:
+			value = strconv.FormatInt(f.Int(), 10)
+		case reflect.Bool:
+			value = strconv.FormatBool(f.Bool())
+		case reflect.Slice: // []byte
+			value = base64.StdEncoding.EncodeToString(f.Bytes())
+		default:
+			value = f.String()
+		}
+		data = append(data, graphMLData{Key: prefix + attr.name, Value: value})
+	}
+	return data
+}
+
+// setAttributes 按属性名填充结构体的字段，未知的属性忽略
+func setAttributes(rv reflect.Value, values map[string]string) error {
+	for _, attr := range attributesOf(rv.Type()) {
+		value, ok := values[attr.name]
+		if !ok {
+			continue
+		}
+		f := rv.Field(attr.index)
+		switch f.Kind() {
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return fmt.Errorf("attribute %s: %w", attr.name, err)
+			}
+			f.SetInt(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("attribute %s: %w", attr.name, err)
+			}
+			f.SetBool(b)
+		case reflect.Slice:
+			b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("attribute %s: %w", attr.name, err)
+			}
+			f.SetBytes(b)
+		default:
+			f.SetString(value)
+		}
+	}
+	return nil
+}
+
+// WriteGraphML 将图写为 GraphML，顶点 id 为 <类型>:<id>，边 id 为 <表>:<id>
+func WriteGraphML(g *Graph, w io.Writer) error {
+	doc := graphML{Xmlns: graphMLNamespace, Keys: graphMLKeys()}
+	doc.Graph = graphMLGraph{ID: "G", EdgeDefault: "directed"}
+	doc.Graph.Data = []graphMLData{
+		{Key: "g_format", Value: g.Format},
+		{Key: "g_version", Value: strconv.Itoa(g.Version)},
+		{Key: "g_dataset", Value: g.Dataset},
+	}
+	if g.Filter.UUID != "" {
+		doc.Graph.Data = append(doc.Graph.Data, graphMLData{Key: "g_uuid", Value: g.Filter.UUID})
+	}
+	if g.Filter.From != 0 {
+		doc.Graph.Data = append(doc.Graph.Data, graphMLData{Key: "g_from", Value: strconv.FormatInt(g.Filter.From, 10)})
+	}
+	if g.Filter.To != 0 {
+		doc.Graph.Data = append(doc.Graph.Data, graphMLData{Key: "g_to", Value: strconv.FormatInt(g.Filter.To, 10)})
+	}
+	node := func(typ string, id int, v interface{}) {
+		data := append([]graphMLData{{Key: "v_type", Value: typ}}, dataOf("v_", v)...)
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: fmt.Sprintf("%s:%d", typ, id), Data: data})
+	}
+	for _, p := range g.Processes {
+		node(ProcessType, p.ID, p)
+	}
+	for _, f := range g.Files {
+		node(FileType, f.ID, f)
+	}
+	for _, s := range g.Sockets {
+		node(SocketType, s.ID, s)
+	}
+	for _, e := range g.Events {
+		src, dst, ok := store.EventEndpoints(e.EventClass)
+		if !ok {
+			return fmt.Errorf("unknown event class %s of event %d", e.EventClass, e.ID)
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     fmt.Sprintf("%s:%d", eventTable, e.ID),
+			Source: fmt.Sprintf("%s:%d", src, e.SrcID),
+			Target: fmt.Sprintf("%s:%d", dst, e.DstID),
+			Data:   append([]graphMLData{{Key: "e_table", Value: eventTable}}, dataOf("e_", e)...),
+		})
+	}
+	for _, n := range g.Nets {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     fmt.Sprintf("%s:%d", netTable, n.ID),
+			Source: fmt.Sprintf("%s:%d", SocketType, n.SrcID),
+			Target: fmt.Sprintf("%s:%d", SocketType, n.DstID),
+			Data:   append([]graphMLData{{Key: "e_table", Value: netTable}}, dataOf("e_", n)...),
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ReadGraphML 读取 GraphML，属性按 key 声明中的 attr.name 识别，因此也可以读取其他工具按同样属性名生成的文件
+// 顶点类型取 type 属性（没有时取 id 中冒号之前的部分），边所在的表取 table 属性（没有时同样取 id 的前缀）
+func ReadGraphML(r io.Reader) (*Graph, error) {
+	var doc graphML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(doc.Keys)) // key id -> attr.name
+	for _, key := range doc.Keys {
+		names[key.ID] = key.Name
+	}
+	valuesOf := func(data []graphMLData) map[string]string {
+		values := make(map[string]string, len(data))
+		for _, d := range data {
+			if name, ok := names[d.Key]; ok {
+				values[name] = d.Value
+			}
+		}
+		return values
+	}
+	prefixOf := func(id string) string {
+		if i := strings.Index(id, ":"); i >= 0 {
+			return id[:i]
+		}
+		return ""
+	}
+
+	g := &Graph{}
+	values := valuesOf(doc.Graph.Data)
+	g.Format, g.Dataset, g.Filter.UUID = values["format"], values["dataset"], values["uuid"]
+	g.Version, _ = strconv.Atoi(values["version"])
+	g.Filter.From, _ = strconv.ParseInt(values["from"], 10, 64)
+	g.Filter.To, _ = strconv.ParseInt(values["to"], 10, 64)
+
+	// 文件内的 id 只用于连接顶点和边，按出现顺序重新编号
+	nodeIDs := make(map[string]int, len(doc.Graph.Nodes))
+	nodeTypeOf := make(map[string]string, len(doc.Graph.Nodes))
+	for i, node := range doc.Graph.Nodes {
+		values := valuesOf(node.Data)
+		typ := values["type"]
+		if typ == "" {
+			typ = prefixOf(node.ID)
+		}
+		t, ok := nodeTypes[typ]
+		if !ok {
+			return nil, fmt.Errorf("node %s has unknown type %q", node.ID, typ)
+		}
+		rv := reflect.New(t).Elem()
+		if err := setAttributes(rv, values); err != nil {
+			return nil, fmt.Errorf("node %s: %w", node.ID, err)
+		}
+		id := i + 1
+		rv.FieldByName("ID").SetInt(int64(id))
+		nodeIDs[node.ID], nodeTypeOf[node.ID] = id, typ
+		switch v := rv.Interface().(type) {
+		case Process:
+			g.Processes = append(g.Processes, v)
+		case File:
+			g.Files = append(g.Files, v)
+		case Socket:
+			g.Sockets = append(g.Sockets, v)
+		}
+	}
+	for i, edge := range doc.Graph.Edges {
+		values := valuesOf(edge.Data)
+		table := values["table"]
+		if table == "" {
+			table = prefixOf(edge.ID)
+		}
+		t, ok := edgeTypes[table]
+		if !ok {
+			return nil, fmt.Errorf("edge %s has unknown table %q", edge.ID, table)
+		}
+		src, ok := nodeIDs[edge.Source]
+		if !ok {
+			return nil, fmt.Errorf("source %s of edge %s not found", edge.Source, edge.ID)
+		}
+		dst, ok := nodeIDs[edge.Target]
+		if !ok {
+			return nil, fmt.Errorf("target %s of edge %s not found", edge.Target, edge.ID)
+		}
+		rv := reflect.New(t).Elem()
+		if err := setAttributes(rv, values); err != nil {
+			return nil, fmt.Errorf("edge %s: %w", edge.ID, err)
+		}
+		rv.FieldByName("ID").SetInt(int64(i + 1))
+		rv.FieldByName("SrcID").SetInt(int64(src))
+		rv.FieldByName("DstID").SetInt(int64(dst))
+		switch v := rv.Interface().(type) {
+		case Event:
+			srcType, dstType, ok := store.EventEndpoints(v.EventClass)
+			if !ok {
+				return nil, fmt.Errorf("edge %s has unknown event class %q", edge.ID, v.EventClass)
+			}
+			if nodeTypeOf[edge.Source] != srcType || nodeTypeOf[edge.Target] != dstType {
+				return nil, fmt.Errorf("edge %s of class %s must connect %s to %s", edge.ID, v.EventClass, srcType, dstType)
+			}
+			g.Events = append(g.Events, v)
+		case Net:
+			if nodeTypeOf[edge.Source] != SocketType || nodeTypeOf[edge.Target] != SocketType {
+				return nil, fmt.Errorf("net edge %s must connect two sockets", edge.ID)
+			}
+			g.Nets = append(g.Nets, v)
+		}
+	}
+	return g, nil
+}
@@ -0,0 +1,67 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	JSONFormat    = "json"
+	GraphMLFormat = "graphml"
+)
+
+// FormatOf 按文件扩展名推断格式，无法推断时返回空字符串
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSONFormat
+	case ".graphml", ".xml":
+		return GraphMLFormat
+	}
+	return ""
+}
+
+// WriteJSON 将图写为 JSON
+func WriteJSON(g *Graph, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// ReadJSON 读取 WriteJSON 写出的图
+func ReadJSON(r io.Reader) (*Graph, error) {
+	var g Graph
+	if err := json.NewDecoder(r).Decode(&g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Write 按格式写出图，PROV-JSON 与 CDM 只能导出，不能导入
+func Write(g *Graph, format string, w io.Writer) error {
+	switch format {
+	case JSONFormat:
+		return WriteJSON(g, w)
+	case GraphMLFormat:
+		return WriteGraphML(g, w)
+	case ProvFormat:
+		return WriteProv(g, w)
+	case CDMFormat:
+		return WriteCDM(g, w)
+	}
+	return fmt.Errorf("unknown format %q, expected %s, %s, %s or %s", format, JSONFormat, GraphMLFormat, ProvFormat, CDMFormat)
+}
+
+// Read 按格式读取图
+func Read(format string, r io.Reader) (*Graph, error) {
+	switch format {
+	case JSONFormat:
+		return ReadJSON(r)
+	case GraphMLFormat:
+		return ReadGraphML(r)
+	}
+	return nil, fmt.Errorf("unknown format %q, expected %s or %s", format, JSONFormat, GraphMLFormat)
+}
@@ -0,0 +1,269 @@
+package exchange
+
+import (
+	"encoding/csv"
+	"erinyes/models"
+	"erinyes/store"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// neo4j 中顶点的标签，同时作为各类顶点 id 的命名空间
+var neo4jLabels = map[string]string{
+	ProcessType: "Process",
+	FileType:    "File",
+	SocketType:  "Socket",
+}
+
+var (
+	processHeader = []string{"id:ID(Process)", ":LABEL", "host_id", "host_name", "container_id", "container_name", "process_vpid", "process_name", "process_exe_path"}
+	fileHeader    = []string{"id:ID(File)", ":LABEL", "host_id", "host_name", "container_id", "container_name", "file_path"}
+	socketHeader  = []string{"id:ID(Socket)", ":LABEL", "host_id", "host_name", "container_id", "container_name", "dst_ip", "dst_port"}
+	eventColumns  = []string{":TYPE", "id:long", "event_class", "relation", "operation", "time:long", "end_time:long", "count:int",
+		"uuid", "pid", "tid", "ret", "bytes:long", "args", "raw_segment", "raw_offset:long", "raw_length:int"}
+	netHeader = []string{":START_ID(Socket)", ":END_ID(Socket)", ":TYPE", "id:long", "method", "payload", "payload_len:int",
+		"seq_num:int", "ack_num:int", "time:long", "uuid", "raw_segment", "raw_offset:long", "raw_length:int"}
+)
+
+// Neo4jReport 导出的 CSV 文件及各类记录数
+type Neo4jReport struct {
+	Nodes         []string // 顶点文件，相对于导出目录
+	Relationships []string // 边文件，每种 event_class 一个，net 一个
+	Processes     int
+	Files         int
+	Sockets       int
+	Events        int
+	Nets          int
+}
+
+func (r Neo4jReport) String() string {
+	return fmt.Sprintf("processes: %d, files: %d, sockets: %d, events: %d, nets: %d",
+		r.Processes, r.Files, r.Sockets, r.Events, r.Nets)
+}
+
+// Command 返回导入这些文件的 neo4j-admin 命令，payload 等字段可能包含换行，需要 --multiline-fields
+func (r Neo4jReport) Command(database string) string {
+	args := []string{"neo4j-admin database import full"}
+	for _, f := range r.Nodes {
+		args = append(args, "--nodes="+f)
+	}
+	for _, f := range r.Relationships {
+		args = append(args, "--relationships="+f)
+	}
+	args = append(args, "--multiline-fields=true", database)
+	return strings.Join(args, " ")
+}
+
+// csvFile 导出目录中的一个 CSV 文件
+type csvFile struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func createCSV(path string, header []string) (*csvFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &csvFile{f: f, w: csv.NewWriter(f)}
+	if err := c.w.Write(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *csvFile) Close() error {
+	c.w.Flush()
+	err := c.w.Error()
+	if cerr := c.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// relationshipType 将 relation 转换为 neo4j 的关系类型，如 write -> WRITE
+func relationshipType(relation string) string {
+	t := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, relation)
+	if t == "" {
+		return "UNKNOWN"
+	}
+	return t
+}
+
+// ExportNeo4j 将存储当前数据集中的顶点和边分页写为 neo4j-admin import 使用的 CSV 文件
+// 每类顶点一个文件，标签为 Process、File、Socket；event 按 event_class 分文件（两端的顶点类型不同），关系类型为大写的 relation，net 的关系类型为 NET
+func ExportNeo4j(s store.Store, dir string) (Neo4jReport, error) {
+	var report Neo4jReport
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return report, err
+	}
+	var files []*csvFile
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	create := func(name string, header []string) (*csvFile, error) {
+		f, err := createCSV(filepath.Join(dir, name), header)
+		if err == nil {
+			files = append(files, f)
+		}
+		return f, err
+	}
+
+	f, err := create("process.csv", processHeader)
+	if err != nil {
+		return report, err
+	}
+	report.Nodes = append(report.Nodes, "process.csv")
+	for lastID := 0; ; {
+		processes, err := s.ScanProcesses(lastID, pageSize)
+		if err != nil {
+			return report, err
+		}
+		if len(processes) == 0 {
+			break
+		}
+		for _, p := range processes {
+			lastID = p.ID
+			if err := f.w.Write([]string{strconv.Itoa(p.ID), neo4jLabels[ProcessType], p.HostID, p.HostName,
+				p.ContainerID, p.ContainerName, p.ProcessVPID, p.ProcessName, p.ProcessExepath}); err != nil {
+				return report, err
+			}
+			report.Processes++
+		}
+	}
+
+	if f, err = create("file.csv", fileHeader); err != nil {
+		return report, err
+	}
+	report.Nodes = append(report.Nodes, "file.csv")
+	for lastID := 0; ; {
+		fs, err := s.ScanFiles(lastID, pageSize)
+		if err != nil {
+			return report, err
+		}
+		if len(fs) == 0 {
+			break
+		}
+		for _, fi := range fs {
+			lastID = fi.ID
+			if err := f.w.Write([]string{strconv.Itoa(fi.ID), neo4jLabels[FileType], fi.HostID, fi.HostName,
+				fi.ContainerID, fi.ContainerName, fi.FilePath}); err != nil {
+				return report, err
+			}
+			report.Files++
+		}
+	}
+
+	if f, err = create("socket.csv", socketHeader); err != nil {
+		return report, err
+	}
+	report.Nodes = append(report.Nodes, "socket.csv")
+	for lastID := 0; ; {
+		sockets, err := s.ScanSockets(lastID, pageSize)
+		if err != nil {
+			return report, err
+		}
+		if len(sockets) == 0 {
+			break
+		}
+		for _, so := range sockets {
+			lastID = so.ID
+			if err := f.w.Write([]string{strconv.Itoa(so.ID), neo4jLabels[SocketType], so.HostID, so.HostName,
+				so.ContainerID, so.ContainerName, so.DstIP, so.DstPort}); err != nil {
+				return report, err
+			}
+			report.Sockets++
+		}
+	}
+
+	classes := map[string]*csvFile{} // event_class -> 边文件，遇到时创建
+	for lastID := 0; ; {
+		events, err := s.ScanEvents(lastID, pageSize, "")
+		if err != nil {
+			return report, err
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, e := range events {
+			lastID = e.ID
+			f, ok := classes[e.EventClass]
+			if !ok {
+				src, dst, known := store.EventEndpoints(e.EventClass)
+				if !known {
+					return report, fmt.Errorf("unknown event class %s of event %d", e.EventClass, e.ID)
+				}
+				header := append([]string{":START_ID(" + neo4jLabels[src] + ")", ":END_ID(" + neo4jLabels[dst] + ")"}, eventColumns...)
+				name := "event_" + e.EventClass + ".csv"
+				if f, err = create(name, header); err != nil {
+					return report, err
+				}
+				classes[e.EventClass] = f
+				report.Relationships = append(report.Relationships, name)
+			}
+			if err := f.w.Write(eventRecord(e)); err != nil {
+				return report, err
+			}
+			report.Events++
+		}
+	}
+	sort.Strings(report.Relationships)
+
+	if f, err = create("net.csv", netHeader); err != nil {
+		return report, err
+	}
+	report.Relationships = append(report.Relationships, "net.csv")
+	for lastID := 0; ; {
+		nets, err := s.ScanNets(lastID, pageSize, "")
+		if err != nil {
+			return report, err
+		}
+		if len(nets) == 0 {
+			break
+		}
+		for _, n := range nets {
+			lastID = n.ID
+			if err := f.w.Write([]string{strconv.Itoa(n.SrcID), strconv.Itoa(n.DstID), "NET", strconv.Itoa(n.ID),
+				n.Method, n.Payload, strconv.Itoa(n.PayloadLen), strconv.Itoa(n.SeqNum), strconv.Itoa(n.AckNum),
+				strconv.FormatInt(n.Time, 10), n.UUID, n.RawSegment, strconv.FormatInt(n.RawOffset, 10), strconv.Itoa(n.RawLength)}); err != nil {
+				return report, err
+			}
+			report.Nets++
+		}
+	}
+
+	for _, f := range files {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	files = nil
+	return report, err
+}
+
+// eventRecord event 在 CSV 中的一行，args 解压后以空格拼接
+func eventRecord(e models.Event) []string {
+	var args string
+	if decoded, err := e.DecodeArgs(); err == nil {
+		args = strings.Join(decoded, " ")
+	}
+	return []string{strconv.Itoa(e.SrcID), strconv.Itoa(e.DstID), relationshipType(e.Relation), strconv.Itoa(e.ID),
+		e.EventClass, e.Relation, e.Operation, strconv.FormatInt(e.Time, 10), strconv.FormatInt(e.EndTime, 10),
+		strconv.Itoa(e.Count), e.UUID, e.Pid, e.Tid, e.Ret, strconv.FormatInt(e.Bytes, 10), args,
+		e.RawSegment, strconv.FormatInt(e.RawOffset, 10), strconv.Itoa(e.RawLength)}
+}
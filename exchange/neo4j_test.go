@@ -0,0 +1,69 @@
+package exchange
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// golden 比较 got 与 testdata 中的文件，-update 时改为写入该文件
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s differs from golden file:\n%s\nwant\n%s", name, got, want)
+	}
+}
+
+func TestExportNeo4jGolden(t *testing.T) {
+	dir := t.TempDir()
+	report, err := ExportNeo4j(newTestStore(t), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Processes != 2 || report.Files != 3 || report.Sockets != 2 || report.Events != 4 || report.Nets != 1 {
+		t.Fatalf("report %s", report)
+	}
+	files := append(append([]string(nil), report.Nodes...), report.Relationships...)
+	written, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range written {
+		written[i] = filepath.Base(written[i])
+	}
+	reported := append([]string(nil), files...)
+	sort.Strings(written)
+	sort.Strings(reported)
+	if !reflect.DeepEqual(written, reported) {
+		t.Fatalf("written files %v, reported %v", written, reported)
+	}
+	for _, name := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden(t, filepath.Join("neo4j", name), got)
+	}
+	golden(t, filepath.Join("neo4j", "command.txt"), []byte(report.Command("erinyes")+"\n"))
+}
@@ -0,0 +1,159 @@
+package exchange
+
+import (
+	"encoding/json"
+	"erinyes/models"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	ProvFormat = "prov"
+
+	provPrefix    = "erinyes"
+	provNamespace = "urn:erinyes:"
+)
+
+// W3C PROV 的映射：
+//
+//	process                 -> activity，prov:type erinyes:Process
+//	file、socket            -> entity，prov:type erinyes:File、erinyes:Socket
+//	event Process           -> wasInformedBy，informant 为起点（父进程），informed 为终点
+//	event File_V1/Network_V1 -> wasGeneratedBy，进程写入（生成）文件或 socket
+//	event File_V2/Network_V2 -> used，进程读取（使用）文件或 socket
+//	net                     -> wasDerivedFrom，终点 socket 由起点 socket 派生
+//
+// 顶点与边的标识符为 erinyes:<类型>_<主键>，其余字段作为 erinyes: 前缀的属性，时间为 UTC 的 xsd:dateTime
+var provRelations = map[string]string{
+	"Process":    "wasInformedBy",
+	"File_V1":    "wasGeneratedBy",
+	"Network_V1": "wasGeneratedBy",
+	"File_V2":    "used",
+	"Network_V2": "used",
+}
+
+func provID(kind string, id int) string {
+	return fmt.Sprintf("%s:%s_%d", provPrefix, kind, id)
+}
+
+func provTime(micro int64) map[string]string {
+	return map[string]string{
+		"$":    time.Unix(0, micro*int64(time.Microsecond)).UTC().Format(time.RFC3339Nano),
+		"type": "xsd:dateTime",
+	}
+}
+
+// provAttributes 将结构体的非零字段转换为 erinyes: 前缀的属性，args 解压为字符串
+func provAttributes(v interface{}, skip ...string) map[string]interface{} {
+	attrs := map[string]interface{}{}
+	rv := reflect.ValueOf(v)
+outer:
+	for _, attr := range attributesOf(rv.Type()) {
+		for _, name := range skip {
+			if attr.name == name {
+				continue outer
+			}
+		}
+		f := rv.Field(attr.index)
+		if f.IsZero() {
+			continue
+		}
+		if attr.name == "args" {
+			if args, err := (models.Event{Args: f.Bytes()}).DecodeArgs(); err == nil {
+				attrs[provPrefix+":args"] = strings.Join(args, " ")
+			}
+			continue
+		}
+		attrs[provPrefix+":"+attr.name] = f.Interface()
+	}
+	return attrs
+}
+
+func provType(name string) map[string]string {
+	return map[string]string{"$": provPrefix + ":" + name, "type": "prov:QUALIFIED_NAME"}
+}
+
+// ToProv 将图转换为 PROV-JSON 文档
+func ToProv(g *Graph) (map[string]interface{}, error) {
+	doc := map[string]interface{}{
+		"prefix": map[string]string{
+			provPrefix: provNamespace,
+			"xsd":      "http://www.w3.org/2001/XMLSchema#",
+		},
+	}
+	section := func(name string) map[string]interface{} {
+		m, ok := doc[name].(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+			doc[name] = m
+		}
+		return m
+	}
+	for _, p := range g.Processes {
+		attrs := provAttributes(p)
+		attrs["prov:type"], attrs["prov:label"] = provType("Process"), p.ProcessName
+		section("activity")[provID(ProcessType, p.ID)] = attrs
+	}
+	for _, f := range g.Files {
+		attrs := provAttributes(f)
+		attrs["prov:type"], attrs["prov:label"] = provType("File"), f.FilePath
+		section("entity")[provID(FileType, f.ID)] = attrs
+	}
+	for _, s := range g.Sockets {
+		attrs := provAttributes(s)
+		attrs["prov:type"], attrs["prov:label"] = provType("Socket"), s.DstIP+":"+s.DstPort
+		section("entity")[provID(SocketType, s.ID)] = attrs
+	}
+	for _, e := range g.Events {
+		relation, ok := provRelations[e.EventClass]
+		if !ok {
+			return nil, fmt.Errorf("unknown event class %s of event %d", e.EventClass, e.ID)
+		}
+		attrs := provAttributes(e, "time", "dedup")
+		switch relation {
+		case "wasInformedBy":
+			attrs["prov:informant"] = provID(ProcessType, e.SrcID)
+			attrs["prov:informed"] = provID(ProcessType, e.DstID)
+			attrs[provPrefix+":time"] = provTime(e.Time) // Communication 没有 prov:time
+		case "wasGeneratedBy":
+			dst := FileType
+			if e.EventClass == "Network_V1" {
+				dst = SocketType
+			}
+			attrs["prov:activity"] = provID(ProcessType, e.SrcID)
+			attrs["prov:entity"] = provID(dst, e.DstID)
+			attrs["prov:time"] = provTime(e.Time)
+		case "used":
+			src := FileType
+			if e.EventClass == "Network_V2" {
+				src = SocketType
+			}
+			attrs["prov:entity"] = provID(src, e.SrcID)
+			attrs["prov:activity"] = provID(ProcessType, e.DstID)
+			attrs["prov:time"] = provTime(e.Time)
+		}
+		section(relation)[provID(eventTable, e.ID)] = attrs
+	}
+	for _, n := range g.Nets {
+		attrs := provAttributes(n, "time", "dedup")
+		attrs["prov:usedEntity"] = provID(SocketType, n.SrcID)
+		attrs["prov:generatedEntity"] = provID(SocketType, n.DstID)
+		attrs[provPrefix+":time"] = provTime(n.Time)
+		section("wasDerivedFrom")[provID(netTable, n.ID)] = attrs
+	}
+	return doc, nil
+}
+
+// WriteProv 将图写为 PROV-JSON
+func WriteProv(g *Graph, w io.Writer) error {
+	doc, err := ToProv(g)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
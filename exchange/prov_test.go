@@ -0,0 +1,35 @@
+package exchange
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteProvAndCDMGolden(t *testing.T) {
+	g, err := Export(newTestStore(t), Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		format string
+		file   string
+	}{
+		{ProvFormat, "graph.prov.json"},
+		{CDMFormat, "graph.cdm.json"},
+	} {
+		t.Run(c.format, func(t *testing.T) {
+			var first, second bytes.Buffer
+			if err := Write(g, c.format, &first); err != nil {
+				t.Fatal(err)
+			}
+			// 输出与 map 的遍历顺序无关
+			if err := Write(g, c.format, &second); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(first.Bytes(), second.Bytes()) {
+				t.Fatal("output is not deterministic")
+			}
+			golden(t, c.file, first.Bytes())
+		})
+	}
+}
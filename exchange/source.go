@@ -0,0 +1,392 @@
+package exchange
+
+import (
+	"erinyes/models"
+	"erinyes/store"
+	"fmt"
+)
+
+// sourceBatch 外部数据集每读取多少条记录插入一次
+const sourceBatch = 2000
+
+// 外部数据集中的进程没有容器信息时属于宿主机，与 sysdig 的 container.id 一致
+const hostContainer = "host"
+
+// SourceReport 导入外部数据集的统计，顶点只统计新建的
+type SourceReport struct {
+	Records    int // 读取的记录数
+	Processes  int
+	Files      int
+	Sockets    int
+	Events     int
+	Nets       int
+	Duplicates int // 去重插入时已经存在的边
+	Skipped    int // 没有导入的记录：不支持的顶点或事件类型，或引用了未知的标识符
+}
+
+func (r SourceReport) String() string {
+	return fmt.Sprintf("records: %d, processes: %d, files: %d, sockets: %d, events: %d, nets: %d, duplicates: %d, skipped: %d",
+		r.Records, r.Processes, r.Files, r.Sockets, r.Events, r.Nets, r.Duplicates, r.Skipped)
+}
+
+// vertexRef 标识符对应的顶点
+type vertexRef struct {
+	table string
+	id    int
+}
+
+// sourceEdge 一条待插入的 event，两端用外部标识符表示
+// event_class 在两端的顶点都已知后确定：subject 为进程；object 为进程时是 Process，否则按 write 决定方向
+type sourceEdge struct {
+	subject string
+	object  string
+	write   bool // 数据从进程流向 object（File_V1、Network_V1）
+	event   models.Event
+}
+
+// sourceNet 一条待插入的 net，两端都是 socket
+type sourceNet struct {
+	src string
+	dst string
+	net models.Net
+}
+
+// sourceImporter 分批导入外部数据集：每批先插入顶点并保存标识符的对应关系，再按对应关系插入边
+// 对应关系保存在存储中（存储实现了 store.UUIDMapper 时），每批按需查询，不在内存中累积；否则保存在内存中，只在本次导入中有效
+// 引用的标识符在之后的批次中才出现的别名和边留到导入结束时再插入，届时仍然未知的计入 Skipped
+type sourceImporter struct {
+	s      store.Store
+	source string
+	mapper store.UUIDMapper     // 为 nil 时使用 ids
+	ids    map[string]vertexRef // 没有 mapper 时本次导入的对应关系
+	dedup  bool                 // 是否去重插入边
+	report SourceReport
+
+	processes    []*models.Process
+	processUUIDs []string
+	files        []*models.File
+	fileUUIDs    []string
+	sockets      []*models.Socket
+	socketUUIDs  []string
+	aliases      [][2]string // 指向其他标识符对应顶点的标识符，如 CDM 中线程指向其进程
+	edges        []sourceEdge
+	nets         []sourceNet
+	pending      int // 本批中尚未插入的记录数
+	err          error
+
+	deferredAliases [][2]string
+	deferredEdges   []sourceEdge
+	deferredNets    []sourceNet
+}
+
+// newSourceImporter 边去重插入，重复导入同一个文件时已经存在的边只计入 Duplicates
+func newSourceImporter(s store.Store, source string) *sourceImporter {
+	im := &sourceImporter{s: s, source: source, dedup: true}
+	if mapper, ok := s.(store.UUIDMapper); ok {
+		im.mapper = mapper
+	} else {
+		im.ids = map[string]vertexRef{}
+	}
+	return im
+}
+
+func (im *sourceImporter) addProcess(uuid string, p *models.Process) {
+	im.processes, im.processUUIDs = append(im.processes, p), append(im.processUUIDs, uuid)
+	im.added()
+}
+
+func (im *sourceImporter) addFile(uuid string, f *models.File) {
+	im.files, im.fileUUIDs = append(im.files, f), append(im.fileUUIDs, uuid)
+	im.added()
+}
+
+func (im *sourceImporter) addSocket(uuid string, s *models.Socket) {
+	im.sockets, im.socketUUIDs = append(im.sockets, s), append(im.socketUUIDs, uuid)
+	im.added()
+}
+
+func (im *sourceImporter) addAlias(uuid string, target string) {
+	im.aliases = append(im.aliases, [2]string{uuid, target})
+	im.added()
+}
+
+func (im *sourceImporter) addEdge(e sourceEdge) {
+	im.edges = append(im.edges, e)
+	im.added()
+}
+
+func (im *sourceImporter) addNet(n sourceNet) {
+	im.nets = append(im.nets, n)
+	im.added()
+}
+
+func (im *sourceImporter) skip() {
+	im.report.Skipped++
+}
+
+// added 记录一条待插入的记录，达到 sourceBatch 时插入，插入失败后不再插入，错误由 finish 返回
+func (im *sourceImporter) added() {
+	if im.pending++; im.pending >= sourceBatch && im.err == nil {
+		im.err = im.flush()
+	}
+}
+
+// finish 插入最后一批记录与推迟的别名和边，返回导入过程中的第一个错误
+func (im *sourceImporter) finish() (SourceReport, error) {
+	if im.err == nil {
+		im.err = im.flush()
+	}
+	if im.err == nil {
+		im.err = im.flushDeferred()
+	}
+	return im.report, im.err
+}
+
+// flush 插入本批的顶点，保存对应关系，再插入两端都已知的边，其余的推迟到 flushDeferred
+func (im *sourceImporter) flush() error {
+	defer func() {
+		im.processes, im.processUUIDs = nil, nil
+		im.files, im.fileUUIDs = nil, nil
+		im.sockets, im.socketUUIDs = nil, nil
+		im.aliases, im.edges, im.nets = nil, nil, nil
+		im.pending = 0
+	}()
+	ids := map[string]vertexRef{} // 本批用到的对应关系
+	var maps []*models.UUIDMap
+	mapped := func(uuid string, table string, id int) {
+		ids[uuid] = vertexRef{table: table, id: id}
+		maps = append(maps, &models.UUIDMap{Source: im.source, UUID: uuid, VertexTable: table, VertexID: id})
+	}
+
+	created, err := im.s.UpsertProcesses(im.processes)
+	if err != nil {
+		return err
+	}
+	im.report.Processes += created
+	for i, p := range im.processes {
+		mapped(im.processUUIDs[i], p.TableName(), p.ID)
+	}
+	if created, err = im.s.UpsertFiles(im.files); err != nil {
+		return err
+	}
+	im.report.Files += created
+	for i, f := range im.files {
+		mapped(im.fileUUIDs[i], f.TableName(), f.ID)
+	}
+	if created, err = im.s.UpsertSockets(im.sockets); err != nil {
+		return err
+	}
+	im.report.Sockets += created
+	for i, so := range im.sockets {
+		mapped(im.socketUUIDs[i], so.TableName(), so.ID)
+	}
+
+	if err := im.lookup(ids, im.aliases, im.edges, im.nets); err != nil {
+		return err
+	}
+	for _, a := range im.aliases {
+		if ref, ok := ids[a[1]]; ok {
+			mapped(a[0], ref.table, ref.id)
+		} else {
+			im.deferredAliases = append(im.deferredAliases, a)
+		}
+	}
+	if err := im.save(maps); err != nil {
+		return err
+	}
+	edges, nets := im.resolve(ids, im.edges, im.nets, false)
+	return im.insert(edges, nets)
+}
+
+// flushDeferred 导入结束、所有顶点的对应关系都已保存后，按批插入推迟的别名和边
+func (im *sourceImporter) flushDeferred() error {
+	// 别名可能指向另一个推迟的别名，逐轮解析直到没有进展
+	for len(im.deferredAliases) > 0 {
+		ids := map[string]vertexRef{}
+		if err := im.lookup(ids, im.deferredAliases, nil, nil); err != nil {
+			return err
+		}
+		var maps []*models.UUIDMap
+		var rest [][2]string
+		for _, a := range im.deferredAliases {
+			if ref, ok := ids[a[1]]; ok {
+				maps = append(maps, &models.UUIDMap{Source: im.source, UUID: a[0], VertexTable: ref.table, VertexID: ref.id})
+			} else {
+				rest = append(rest, a)
+			}
+		}
+		if err := im.save(maps); err != nil {
+			return err
+		}
+		if len(maps) == 0 {
+			im.report.Skipped += len(rest)
+			rest = nil
+		}
+		im.deferredAliases = rest
+	}
+	for start := 0; start < len(im.deferredEdges) || start < len(im.deferredNets); start += sourceBatch {
+		edges, nets := batchOf(im.deferredEdges, start), netBatchOf(im.deferredNets, start)
+		ids := map[string]vertexRef{}
+		if err := im.lookup(ids, nil, edges, nets); err != nil {
+			return err
+		}
+		resolvedEdges, resolvedNets := im.resolve(ids, edges, nets, true)
+		if err := im.insert(resolvedEdges, resolvedNets); err != nil {
+			return err
+		}
+	}
+	im.deferredEdges, im.deferredNets = nil, nil
+	return nil
+}
+
+func batchOf(edges []sourceEdge, start int) []sourceEdge {
+	if start >= len(edges) {
+		return nil
+	}
+	if end := start + sourceBatch; end < len(edges) {
+		return edges[start:end]
+	}
+	return edges[start:]
+}
+
+func netBatchOf(nets []sourceNet, start int) []sourceNet {
+	if start >= len(nets) {
+		return nil
+	}
+	if end := start + sourceBatch; end < len(nets) {
+		return nets[start:end]
+	}
+	return nets[start:]
+}
+
+// lookup 将别名、边引用的、ids 中没有的标识符的对应关系加入 ids
+func (im *sourceImporter) lookup(ids map[string]vertexRef, aliases [][2]string, edges []sourceEdge, nets []sourceNet) error {
+	var unknown []string
+	need := func(uuid string) {
+		if _, ok := ids[uuid]; !ok && uuid != "" {
+			unknown = append(unknown, uuid)
+		}
+	}
+	for _, a := range aliases {
+		need(a[1])
+	}
+	for _, e := range edges {
+		need(e.subject)
+		need(e.object)
+	}
+	for _, n := range nets {
+		need(n.src)
+		need(n.dst)
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	if im.mapper == nil {
+		for _, uuid := range unknown {
+			if ref, ok := im.ids[uuid]; ok {
+				ids[uuid] = ref
+			}
+		}
+		return nil
+	}
+	found, err := im.mapper.LookupUUIDs(im.source, unknown)
+	if err != nil {
+		return err
+	}
+	for uuid, m := range found {
+		ids[uuid] = vertexRef{table: m.VertexTable, id: m.VertexID}
+	}
+	return nil
+}
+
+// save 保存对应关系
+func (im *sourceImporter) save(maps []*models.UUIDMap) error {
+	if im.mapper != nil {
+		return im.mapper.SaveUUIDs(maps)
+	}
+	for _, m := range maps {
+		im.ids[m.UUID] = vertexRef{table: m.VertexTable, id: m.VertexID}
+	}
+	return nil
+}
+
+// resolve 将两端都已知的边转换为待插入的边；端点未知的边在 final 时计入 Skipped，否则推迟
+func (im *sourceImporter) resolve(ids map[string]vertexRef, edges []sourceEdge, nets []sourceNet, final bool) ([]*models.Event, []*models.Net) {
+	var events []*models.Event
+	for _, e := range edges {
+		subject, ok1 := ids[e.subject]
+		object, ok2 := ids[e.object]
+		if ok1 && subject.table != ProcessType {
+			im.report.Skipped++
+			continue
+		}
+		if !ok1 || !ok2 {
+			if final {
+				im.report.Skipped++
+			} else {
+				im.deferredEdges = append(im.deferredEdges, e)
+			}
+			continue
+		}
+		po := e.event
+		src, dst := subject, object
+		switch {
+		case object.table == ProcessType:
+			po.EventClass = "Process"
+		case object.table == FileType && e.write:
+			po.EventClass = "File_V1"
+		case object.table == FileType:
+			po.EventClass, src, dst = "File_V2", object, subject
+		case e.write:
+			po.EventClass = "Network_V1"
+		default:
+			po.EventClass, src, dst = "Network_V2", object, subject
+		}
+		po.SrcID, po.DstID = src.id, dst.id
+		if po.EndTime == 0 {
+			po.EndTime = po.Time
+		}
+		if po.Count == 0 {
+			po.Count = 1
+		}
+		events = append(events, &po)
+	}
+	var pos []*models.Net
+	for _, n := range nets {
+		src, ok1 := ids[n.src]
+		dst, ok2 := ids[n.dst]
+		if ok1 && src.table != SocketType || ok2 && dst.table != SocketType {
+			im.report.Skipped++
+			continue
+		}
+		if !ok1 || !ok2 {
+			if final {
+				im.report.Skipped++
+			} else {
+				im.deferredNets = append(im.deferredNets, n)
+			}
+			continue
+		}
+		po := n.net
+		po.SrcID, po.DstID = src.id, dst.id
+		pos = append(pos, &po)
+	}
+	return events, pos
+}
+
+// insert 插入边，去重插入时已经存在的边计入 Duplicates
+func (im *sourceImporter) insert(events []*models.Event, nets []*models.Net) error {
+	inserted, err := im.s.InsertEvents(events, im.dedup)
+	im.report.Events += count(inserted)
+	if err != nil {
+		return err
+	}
+	im.report.Duplicates += len(events) - count(inserted)
+	inserted, err = im.s.InsertNets(nets, im.dedup)
+	im.report.Nets += count(inserted)
+	if err != nil {
+		return err
+	}
+	im.report.Duplicates += len(nets) - count(inserted)
+	return nil
+}
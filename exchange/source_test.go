@@ -0,0 +1,72 @@
+package exchange
+
+import (
+	"encoding/json"
+	"erinyes/store"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// spadeLines 每行一个 SPADE 元素
+func spadeLines(t *testing.T, elements []spadeElement) string {
+	var lines []string
+	for _, e := range elements {
+		b, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(b))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// used 第 i 个读操作，去重键不含时间，每个操作的名称不同
+func used(from string, to string, i int) spadeElement {
+	return spadeElement{Type: "Used", From: from, To: to, Annotations: map[string]string{"operation": "read" + strconv.Itoa(i), "time": strconv.Itoa(1000 + i)}}
+}
+
+func TestImportDefersEdgesToLaterVertices(t *testing.T) {
+	// 文件出现在第一批之后，引用它的边在导入结束时插入；引用不存在的顶点的边被跳过
+	n := sourceBatch + 100
+	elements := []spadeElement{{Type: "Process", ID: "p", Annotations: map[string]string{"pid": "1", "exe": "/bin/cat"}}}
+	for i := 0; i < n; i++ {
+		elements = append(elements, used("p", "f", i))
+	}
+	elements = append(elements, used("p", "missing", 0))
+	elements = append(elements, spadeElement{Type: "Artifact", ID: "f", Annotations: map[string]string{"subtype": "file", "path": "/etc/passwd"}})
+	data := spadeLines(t, elements)
+
+	memory := newEmptyStore(t)
+	sqlite, err := store.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		s    store.Store
+	}{
+		{"memory", memory},
+		{"sqlite", sqlite},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			report, err := ImportSPADE(c.s, strings.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Records != len(elements) || report.Processes != 1 || report.Files != 1 || report.Events != n || report.Skipped != 1 {
+				t.Fatalf("report %s", report)
+			}
+		})
+	}
+
+	// 之前导入的顶点通过 uuid_map 查询
+	report, err := ImportSPADE(sqlite, strings.NewReader(spadeLines(t, []spadeElement{used("p", "f", n), used("p", "f", 0)})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Events != 1 || report.Duplicates != 1 || report.Skipped != 0 {
+		t.Fatalf("report of the second import %s", report)
+	}
+}
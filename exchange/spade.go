@@ -0,0 +1,153 @@
+package exchange
+
+import (
+	"bufio"
+	"encoding/json"
+	"erinyes/conf"
+	"erinyes/models"
+	"erinyes/store"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// SPADEFormat 从 SPADE 导入时使用的格式名
+const SPADEFormat = "spade"
+
+// spadeElement SPADE JSON 输出中的一个顶点或边
+type spadeElement struct {
+	Type        string            `json:"type"`
+	ID          string            `json:"id"`   // 顶点
+	From        string            `json:"from"` // 边
+	To          string            `json:"to"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// ImportSPADE 导入 SPADE 的 JSON 输出（顶点与边组成的数组，或每行一个对象），返回导入的统计
+// Process 导入为 process；Artifact 中 subtype 为 file 的导入为 file，network socket 导入为 socket，其他 Artifact 与 Agent 跳过
+// Used、WasGeneratedBy 导入为进程读、写文件或 socket 的 event，WasTriggeredBy 导入为 Process 类型的 event，两个 socket 之间的 WasDerivedFrom 导入为 net
+func ImportSPADE(s store.Store, r io.Reader) (SourceReport, error) {
+	im := newSourceImporter(s, models.UUIDSourceSPADE)
+	br := bufio.NewReader(r)
+	dec := json.NewDecoder(br)
+	array := false
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return im.finish()
+			}
+			return im.report, err
+		}
+		if strings.TrimSpace(string(b)) != "" {
+			array = b[0] == '['
+			break
+		}
+		br.ReadByte()
+	}
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return im.report, err
+		}
+	}
+	for array && dec.More() || !array {
+		var e spadeElement
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF && !array {
+				break
+			}
+			return im.report, fmt.Errorf("element %d: %w", im.report.Records+1, err)
+		}
+		im.report.Records++
+		im.addSPADE(e)
+		if im.err != nil {
+			return im.report, im.err
+		}
+	}
+	return im.finish()
+}
+
+// spadeTime SPADE 的 time 为秒（可以有小数），转换为 16 位微秒时间戳
+func spadeTime(annotations map[string]string) int64 {
+	seconds, err := strconv.ParseFloat(annotations["time"], 64)
+	if err != nil {
+		return 0
+	}
+	return int64(math.Round(seconds * 1e6))
+}
+
+// addSPADE 按元素的类型加入顶点或边
+func (im *sourceImporter) addSPADE(e spadeElement) {
+	a := e.Annotations
+	switch e.Type {
+	case "Process":
+		exe := firstNonEmpty(a["exe"], a["path"])
+		name := a["name"]
+		if name == "" && exe != "" {
+			name = path.Base(exe)
+		}
+		im.addProcess(e.ID, &models.Process{
+			HostID:         conf.MockHostID,
+			HostName:       conf.MockHostName,
+			ContainerID:    hostContainer,
+			ContainerName:  hostContainer,
+			ProcessVPID:    a["pid"],
+			ProcessName:    firstNonEmpty(name, "unknown"),
+			ProcessExepath: firstNonEmpty(exe, a["command line"], name, "unknown"),
+		})
+	case "Artifact":
+		switch {
+		case a["subtype"] == "file" || a["subtype"] == "" && a["path"] != "":
+			im.addFile(e.ID, &models.File{
+				HostID:        conf.MockHostID,
+				HostName:      conf.MockHostName,
+				ContainerID:   hostContainer,
+				ContainerName: hostContainer,
+				FilePath:      firstNonEmpty(a["path"], "spade:"+e.ID),
+			})
+		case a["subtype"] == "network socket":
+			im.addSocket(e.ID, &models.Socket{
+				HostID:        conf.MockHostID,
+				HostName:      conf.MockHostName,
+				ContainerID:   conf.OuterContainerID,
+				ContainerName: conf.OuterContainerName,
+				DstIP:         a["remote address"],
+				DstPort:       a["remote port"],
+			})
+		default:
+			im.skip()
+		}
+	case "Used", "WasGeneratedBy", "WasTriggeredBy":
+		operation := firstNonEmpty(a["operation"], strings.ToLower(e.Type))
+		size, _ := strconv.ParseInt(a["size"], 10, 64)
+		edge := sourceEdge{event: models.Event{
+			Relation:  operation,
+			Operation: operation,
+			Time:      spadeTime(a),
+			UUID:      "unknown",
+			Bytes:     size,
+		}}
+		switch e.Type {
+		case "Used": // from 进程使用了 to
+			edge.subject, edge.object = e.From, e.To
+		case "WasGeneratedBy": // from 由进程 to 生成
+			edge.subject, edge.object, edge.write = e.To, e.From, true
+		case "WasTriggeredBy": // 进程 from 由进程 to 触发（fork、clone、execve 等）
+			edge.subject, edge.object = e.To, e.From
+		}
+		im.addEdge(edge)
+	case "WasDerivedFrom": // from 由 to 派生，数据从 to 流向 from
+		size, _ := strconv.Atoi(a["size"])
+		im.addNet(sourceNet{src: e.To, dst: e.From, net: models.Net{
+			Method:     firstNonEmpty(a["operation"], "derive"),
+			PayloadLen: size,
+			Time:       spadeTime(a),
+			UUID:       "unknown",
+		}})
+	default:
+		im.skip()
+	}
+}
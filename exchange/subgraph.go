@@ -0,0 +1,55 @@
+package exchange
+
+import (
+	"erinyes/builder"
+	"erinyes/models"
+	"erinyes/store"
+	"fmt"
+	"gonum.org/v1/gonum/graph/multi"
+)
+
+// ExportSubgraph 导出 builder.Provenance 生成的溯源子图：子图中每条边在数据库中的记录及其两端的顶点
+// 子图中没有对应记录的边（如只存在于内存中的边）不导出
+func ExportSubgraph(s store.Store, sub *multi.WeightedDirectedGraph) (*Graph, error) {
+	g := &Graph{
+		Format:    FormatName,
+		Version:   FormatVersion,
+		Dataset:   s.Dataset(),
+		Processes: []Process{},
+		Files:     []File{},
+		Sockets:   []Socket{},
+		Events:    []Event{},
+		Nets:      []Net{},
+	}
+	vertices := map[string]map[int]bool{ProcessType: {}, FileType: {}, SocketType: {}}
+	seen := map[builder.RecordLoc]bool{}
+	for _, edge := range builder.SubgraphEdges(sub) {
+		if seen[edge] {
+			continue
+		}
+		seen[edge] = true
+		switch edge.Table {
+		case (models.Event{}).TableName():
+			e, err := s.GetEvent(edge.Key)
+			if err != nil {
+				return nil, fmt.Errorf("event %d: %w", edge.Key, err)
+			}
+			src, dst, ok := store.EventEndpoints(e.EventClass)
+			if !ok {
+				return nil, fmt.Errorf("unknown event class %s of event %d", e.EventClass, e.ID)
+			}
+			vertices[src][e.SrcID], vertices[dst][e.DstID] = true, true
+			g.Events = append(g.Events, eventOf(e))
+		case (models.Net{}).TableName():
+			n, err := s.GetNet(edge.Key)
+			if err != nil {
+				return nil, fmt.Errorf("net %d: %w", edge.Key, err)
+			}
+			vertices[SocketType][n.SrcID], vertices[SocketType][n.DstID] = true, true
+			g.Nets = append(g.Nets, netOf(n))
+		default:
+			return nil, fmt.Errorf("unknown edge table %s", edge.Table)
+		}
+	}
+	return g, exportVertices(s, g, vertices)
+}
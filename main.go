@@ -1,26 +1,96 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"erinyes/agent"
 	"erinyes/builder"
 	"erinyes/conf"
+	"erinyes/exchange"
 	"erinyes/logs"
 	"erinyes/models"
 	"erinyes/parser"
+	"erinyes/rpc"
 	"erinyes/service"
+	"erinyes/store"
+	"erinyes/wal"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
-	"gonum.org/v1/gonum/graph/multi"
+	"io"
+	"io/ioutil"
+	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 参数较多的命令的完整用法
+const (
+	subgraphLong = `Build the provenance subgraph of a process identified by host, container, vpid and name, or of one or more roots, and visualize it to <output>.
+
+  subgraph <host> <container> <vpid> <name> <output> [depth]
+  subgraph root=<root>... <output> [depth]
+
+root is process:<host>,<container>,<vpid>,<name>, file:<path>, socket:<ip>:<port> or uuid:<uuid>.
+Optional: direction=<backward|forward|both> (default backward), filters pid= tid= ret= bytes= arg=,
+bounds from= to= max-nodes= max-edges= timeout= exclude=, and dataset=<name>.`
+
+	analyzeLong = `Parse log files and build the provenance graph of a process in memory, without database.
+
+  analyze <sysdig_log> <net_log|-> <host> <container> <vpid> <name> <output> [depth] [snapshot]
+
+Optional: direction=<backward|forward|both> (default backward), filters pid= tid= ret= bytes= arg=,
+and bounds from= to= max-nodes= max-edges= timeout= exclude=.`
+
+	benchmarkLong = `Compare provenance traversal querying per node with traversal querying per level from one or more roots.
+
+  benchmark root=<root>... [depth=<n>] [uuid=<uuid>] [rounds=<n>]
+
+Optional: direction=<backward|forward|both> (default backward), filters pid= tid= ret= bytes= arg=,
+bounds from= to= max-nodes= max-edges= timeout= exclude=, and dataset=<name>.`
+
+	evidenceLong = `Print raw logs of the given edges or of every edge in a provenance subgraph.
+
+  evidence event <id>...
+  evidence net <id>...
+  evidence subgraph <host> <container> <vpid> <name> [depth]
+  evidence subgraph root=<root>... [depth]
+
+Optional for subgraph: direction=<backward|forward|both> (default backward), filters pid= tid= ret= bytes= arg=,
+and bounds from= to= max-nodes= max-edges= timeout= exclude=. dataset=<name> optional.`
+
+	exportLong = `Export the graph of a dataset.
+
+  export <graphml|json|prov|cdm> <file> [uuid=<uuid>] [from=<time>] [to=<time>]
+  export <graphml|json|prov|cdm> <file> root=<root>... [depth=<n>]
+  export neo4j <dir>
+
+With root= only the provenance subgraph is exported, root is process:<host>,<container>,<vpid>,<name>,
+file:<path>, socket:<ip>:<port> or uuid:<uuid>. Optional for the subgraph: direction=<backward|forward|both>,
+filters pid= tid= ret= bytes= arg= and bounds max-nodes= max-edges= timeout= exclude=. dataset=<name> optional.`
 )
 
 func main() {
 	logs.Init()
 	conf.Init()
-	models.Init()
 
-	rootCmd := &cobra.Command{}
+	rootCmd := &cobra.Command{
+		PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+			switch cmd.Name() {
+			case "agent": // agent 运行在采集主机上，不需要连接数据库
+			case "analyze": // analyze 使用内存存储
+			case "migrate": // migrate 自行打开数据库，不检查表结构版本
+			default:
+				store.Init()
+			}
+		},
+	}
 	rootCmd.AddCommand([]*cobra.Command{
 		{
 			Use:                "service",
@@ -30,22 +100,105 @@ func main() {
 		},
 		{
 			Use:                "graph",
-			Short:              "Generate graph in db",
+			Short:              "Generate graph in db from sysdig and net logs, or from DARPA TC CDM / SPADE JSON files with format=<cdm|spade>, dataset=<name> optional",
 			DisableFlagParsing: true,
 			Run:                GenerateGraph,
 		},
 		{
 			Use:                "dot",
-			Short:              "Generate dot file",
+			Short:              "Generate dot file, uuid and dataset=<name> optional",
 			DisableFlagParsing: true,
 			Run:                GenerateDot,
 		},
 		{
 			Use:                "subgraph",
-			Short:              "Build sub provenance graph for certain process which identified by process id and host and container",
+			Short:              "Build the provenance subgraph of a process or of root=<root>... and visualize it",
+			Long:               subgraphLong,
 			DisableFlagParsing: true,
 			Run:                BuildSubGraph,
 		},
+		{
+			Use:                "correlate",
+			Short:              "Correlate sysdig socket events with captured net flows, window(ms) and dataset=<name> optional",
+			DisableFlagParsing: true,
+			Run:                CorrelateFlows,
+		},
+		{
+			Use:                "analyze",
+			Short:              "Parse log files and build provenance graph for certain process in memory, without database",
+			Long:               analyzeLong,
+			DisableFlagParsing: true,
+			Run:                Analyze,
+		},
+		{
+			Use:                "migrate",
+			Short:              "Manage database schema: up, down [steps], to <version> or status",
+			DisableFlagParsing: true,
+			Run:                Migrate,
+		},
+		{
+			Use:                "purge",
+			Short:              "Delete edges older than certain days, optionally dataset=<name> host=<id> container=<id> uuid=<uuid> dry-run, then drop orphan vertices",
+			DisableFlagParsing: true,
+			Run:                PurgeData,
+		},
+		{
+			Use:                "dataset",
+			Short:              "Manage datasets: list, copy <src> <dst> or drop <name> [dry-run]",
+			DisableFlagParsing: true,
+			Run:                ManageDataset,
+		},
+		{
+			Use:                "benchmark",
+			Short:              "Compare provenance traversal querying per node with traversal querying per level from root=<root>...",
+			Long:               benchmarkLong,
+			DisableFlagParsing: true,
+			Run:                BenchmarkTraversal,
+		},
+		{
+			Use:                "evidence",
+			Short:              "Print raw logs of edges: event <id>..., net <id>... or subgraph",
+			Long:               evidenceLong,
+			DisableFlagParsing: true,
+			Run:                PrintEvidence,
+		},
+		{
+			Use:                "verify",
+			Short:              "Recompute the ledger hash chain and check every chained edge and checkpoint, exported checkpoints file optional",
+			DisableFlagParsing: true,
+			Run:                VerifyLedger,
+		},
+		{
+			Use:                "checkpoint",
+			Short:              "Sign the current ledger head, or export <file> all signed checkpoints",
+			DisableFlagParsing: true,
+			Run:                LedgerCheckpoint,
+		},
+		{
+			Use:                "export",
+			Short:              "Export graph to <graphml|json|prov|cdm> <file>, or to neo4j <dir> as neo4j-admin import CSV files",
+			Long:               exportLong,
+			DisableFlagParsing: true,
+			Run:                ExportGraph,
+		},
+		{
+			Use:                "import",
+			Short:              "Import graph from an exported <file>, format=<graphml|json> and dataset=<name> optional",
+			DisableFlagParsing: true,
+			Run:                ImportGraph,
+		},
+		{
+			Use:                "import-dot",
+			Short:              "Import dot files or directories generated by dot (or legacy dot2mysql files), container=<node|filename|id> host=<id> and dataset=<name> optional",
+			DisableFlagParsing: true,
+			Run:                ImportDot,
+		},
+		{
+			Use:                "agent",
+			Short:              "Run sysdig on this host and forward logs to a central erinyes",
+			DisableFlagParsing: true,
+			Run:                RunAgent,
+		},
 	}...)
 	if err := rootCmd.Execute(); err != nil {
 		logs.Logger.WithError(err).Fatal("failed to run command")
@@ -57,6 +210,25 @@ func GenerateGraph(_ *cobra.Command, args []string) {
 		sysdigFilepath string
 		netFilepath    string
 	)
+	args, err := useDataset(args)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(-1)
+	}
+	var format string
+	rest := args[:0]
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "format=") {
+			format = strings.TrimPrefix(arg, "format=")
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	args = rest
+	if format != "" && format != "sysdig" {
+		importSource(format, args)
+		return
+	}
 	if len(args) == 0 {
 		fmt.Printf("no filepath after graph\n")
 		os.Exit(-1)
@@ -68,10 +240,72 @@ func GenerateGraph(_ *cobra.Command, args []string) {
 		netFilepath = args[1]
 	}
 	parser.FileLogParse(true, sysdigFilepath, netFilepath)
+	if sysdigFilepath != "" && netFilepath != "" { // 两类日志都存在时才需要关联
+		if _, err := parser.Correlate(conf.Config.Correlation.Window * 1000); err != nil {
+			logs.Logger.WithError(err).Errorf("failed to correlate flows")
+		}
+	}
+}
+
+// importSource 导入 CDM、SPADE 等外部数据集，可以一次导入多个文件，标识符的对应关系在文件之间共享
+func importSource(format string, paths []string) {
+	var importer func(s store.Store, r io.Reader) (exchange.SourceReport, error)
+	switch format {
+	case exchange.CDMFormat:
+		importer = exchange.ImportCDM
+	case exchange.SPADEFormat:
+		importer = exchange.ImportSPADE
+	default:
+		fmt.Printf("unsupported format %s, use format=<sysdig|cdm|spade>.\n", format)
+		os.Exit(-1)
+	}
+	if len(paths) == 0 {
+		fmt.Printf("no filepath after graph\n")
+		os.Exit(-1)
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("Open %s failed, err = %s\n", path, err.Error())
+			os.Exit(-1)
+		}
+		report, err := importer(store.GetStore(), f)
+		f.Close()
+		if err != nil {
+			fmt.Printf("Import %s failed after %s, err = %s\n", path, report, err.Error())
+			os.Exit(-1)
+		}
+		fmt.Printf("Import %s success, %s\n", path, report)
+	}
 }
 
 func StartHTTP(_ *cobra.Command, args []string) {
+	if conf.Config.Ingest.WAL.Enable {
+		err := parser.OpenIngestQueues(conf.Config.Ingest.WAL.Dir, wal.Options{
+			SegmentBytes:   conf.Config.Ingest.WAL.SegmentBytes,
+			CommitInterval: time.Duration(conf.Config.Ingest.WAL.CommitInterval) * time.Millisecond,
+		})
+		if err != nil {
+			logs.Logger.WithError(err).Fatal("failed to open ingest queue")
+		}
+	}
 	go parser.HTTPLogParse(true)
+	if conf.Config.Correlation.Interval > 0 {
+		go parser.CorrelateLoop(time.Duration(conf.Config.Correlation.Interval)*time.Second, conf.Config.Correlation.Window*1000)
+	}
+	if conf.Config.Retention.Days > 0 {
+		go parser.RetentionLoop(time.Duration(conf.Config.Retention.Interval)*time.Second, conf.Config.Retention.Days, conf.Config.Retention.ChunkSize)
+	}
+	if conf.Config.Ledger.Enable && conf.Config.Ledger.CheckpointInterval > 0 {
+		go parser.CheckpointLoop(time.Duration(conf.Config.Ledger.CheckpointInterval)*time.Second, conf.Config.Ledger.KeyFile)
+	}
+	if conf.Config.GRPC.Port != "" {
+		go func() {
+			if err := rpc.Serve(conf.Config.GRPC.Port); err != nil {
+				logs.Logger.WithError(err).Fatal("failed to start gRPC service")
+			}
+		}()
+	}
 	r := gin.Default()
 
 	r.POST("/api/user/login", service.HandleLogin)
@@ -79,10 +313,13 @@ func StartHTTP(_ *cobra.Command, args []string) {
 	r.POST("/api/user/logout", service.HandleLogout)
 
 	r.GET("/api/dashboard", service.HandleDashboard)
+	r.GET("/api/datasets", service.HandleDatasets)
 	r.POST("/api/process", service.HandleProcess)
 	r.POST("/api/file", service.HandleFile)
 	r.POST("/api/socket", service.HandleSocket)
 	r.POST("/api/graph", service.HandleGraph)
+	r.POST("/api/evidence", service.HandleEvidence)
+	r.GET("/api/ledger/checkpoints", service.HandleCheckpoints)
 
 	r.GET("/api/ping", service.HandlePing)
 	r.POST("/api/sysdig/log", service.HandleSysdigLog)
@@ -101,6 +338,11 @@ func StartHTTP(_ *cobra.Command, args []string) {
 
 // GenerateDot 可视化溯源图
 func GenerateDot(_ *cobra.Command, args []string) {
+	args, err := useDataset(args)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(-1)
+	}
 	if len(args) == 0 {
 		fmt.Printf("no filepath after graph\n")
 		os.Exit(-1)
@@ -112,36 +354,788 @@ func GenerateDot(_ *cobra.Command, args []string) {
 	}
 }
 
+// printTruncation 溯源被截断时输出截断的原因
+func printTruncation(r builder.Result) {
+	if r.Truncated != "" {
+		fmt.Printf("Provenance graph truncated (%s): %s\n", r.Truncated, r.Reason)
+	}
+}
+
 func BuildSubGraph(cmd *cobra.Command, args []string) {
-	if !(len(args) == 5 || len(args) == 6) {
-		fmt.Printf("construct cmd must need host, container and process id, depth optional.\n")
+	args, opts, roots, err := parseProvenanceArgs(args)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return
+	}
+	if len(roots) == 0 { // <host> <container> <vpid> <name> <output> [depth]
+		if !(len(args) == 5 || len(args) == 6) {
+			fmt.Printf("construct cmd must need host, container and process id, or root=<root>, depth optional.\n")
+			logs.Logger.Errorf("construct graph failed, args = %s", args)
+			return
+		}
+		roots = []builder.Root{builder.ProcessRootOf(args[0], args[1], args[2], args[3])}
+		args = args[4:]
+	} else if !(len(args) == 1 || len(args) == 2) { // <output> [depth]
+		fmt.Printf("construct cmd with root= must need output, depth optional.\n")
 		logs.Logger.Errorf("construct graph failed, args = %s", args)
 		return
 	}
-	var g *multi.WeightedDirectedGraph
-	timeLimit := true
-	uuid := ""
-	if len(args) == 6 {
-		depth, err := strconv.Atoi(args[5])
-		if err == nil {
-			g = builder.Provenance(args[0], args[1], args[2], args[3], nil, &depth, timeLimit, uuid)
+	var depth *int
+	if len(args) == 2 {
+		if d, err := strconv.Atoi(args[1]); err == nil {
+			depth = &d
 		} else {
 			fmt.Printf("depth is not valid, use default depth.\n")
-			g = builder.Provenance(args[0], args[1], args[2], args[3], nil, nil, timeLimit, uuid)
 		}
 	} else {
 		fmt.Printf("depth not absent, use default depth.\n")
-		g = builder.Provenance(args[0], args[1], args[2], args[3], nil, nil, timeLimit, uuid)
 	}
-	if g == nil {
-		logs.Logger.Infof("failed to get provenance graph")
+	opts.Depth = depth
+	r, err := builder.ProvenanceFrom(context.Background(), store.GetStore(), roots, opts)
+	if err != nil {
+		logs.Logger.WithError(err).Infof("failed to get provenance graph")
+		fmt.Printf("Build provenance graph failed, err = %s\n", err.Error())
 		return
 	}
-	if err := builder.Visualize(g, args[4]); err != nil {
+	printTruncation(r)
+	if err := builder.Visualize(r.Graph, args[0]); err != nil {
 		logs.Logger.WithError(err).Errorf("failed to visualize provenance graph")
-		fmt.Printf("Visualize provenance graph for %s failed, err = %s", args[3], err.Error())
+		fmt.Printf("Visualize provenance graph %s failed, err = %s", args[0], err.Error())
 		return
 	}
-	fmt.Printf("Visualize provenance graph for %s success!", args[2])
+	fmt.Printf("Visualize provenance graph %s success!", args[0])
 	logs.Logger.Infof("success to visualize provenance graph")
 }
+
+// CorrelateFlows 关联 sysdig 套接字事件与流量日志中的同一次网络交互
+func CorrelateFlows(_ *cobra.Command, args []string) {
+	args, err := useDataset(args)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return
+	}
+	window := conf.Config.Correlation.Window
+	if len(args) > 0 {
+		w, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Printf("window is not valid, use default window %dms.\n", window)
+		} else {
+			window = w
+		}
+	}
+	linked, err := parser.Correlate(window * 1000)
+	if err != nil {
+		fmt.Printf("Correlate flows failed, err = %s\n", err.Error())
+		return
+	}
+	fmt.Printf("Correlate %d flows success!\n", linked)
+}
+
+// Analyze 在内存中完成建图和溯源，输出 dot、svg、json，可选地保存内存图快照
+// 参数：<sysdig_log> <net_log|-> <host_id> <container_id> <vpid> <process_name> <output> [depth] [snapshot] [pid= tid= ret= bytes= arg=]
+func Analyze(_ *cobra.Command, args []string) {
+	memory := store.NewMemoryStore()
+	store.SetStore(memory)
+	args, opts, roots, err := parseProvenanceArgs(args)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return
+	}
+	if roots != nil {
+		fmt.Printf("analyze cmd does not support root=, use host, container, process id and process name.\n")
+		return
+	}
+	if !(len(args) >= 7 && len(args) <= 9) {
+		fmt.Printf("analyze cmd must need sysdig log, net log(- if absent), host, container, process id, process name and output, depth and snapshot optional.\n")
+		logs.Logger.Errorf("analyze failed, args = %s", args)
+		return
+	}
+	sysdigFilepath, netFilepath := args[0], args[1]
+	if netFilepath == "-" {
+		netFilepath = ""
+	}
+	parser.FileLogParse(true, sysdigFilepath, netFilepath)
+	if netFilepath != "" {
+		if _, err := parser.Correlate(conf.Config.Correlation.Window * 1000); err != nil {
+			logs.Logger.WithError(err).Errorf("failed to correlate flows")
+		}
+	}
+	if len(args) == 9 {
+		if err := memory.Save(args[8]); err != nil {
+			logs.Logger.WithError(err).Errorf("failed to save snapshot %s", args[8])
+			fmt.Printf("Save snapshot %s failed, err = %s\n", args[8], err.Error())
+		}
+	}
+
+	var depth *int
+	if len(args) >= 8 {
+		if d, err := strconv.Atoi(args[7]); err == nil {
+			depth = &d
+		} else {
+			fmt.Printf("depth is not valid, use default depth.\n")
+		}
+	}
+	opts.Depth = depth
+	r, err := builder.Provenance(context.Background(), store.GetStore(), args[2], args[3], args[4], args[5], opts)
+	if err != nil {
+		fmt.Printf("Build provenance graph for %s failed, err = %s\n", args[5], err.Error())
+		return
+	}
+	printTruncation(r)
+	g := r.Graph
+	output := "graphs/" + args[6]
+	if err := os.MkdirAll("graphs", 0755); err != nil {
+		logs.Logger.WithError(err).Errorf("failed to create graphs directory")
+		return
+	}
+	if err := builder.WriteDot(g, output+".dot"); err != nil {
+		fmt.Printf("Write %s.dot failed, err = %s\n", output, err.Error())
+		return
+	}
+	if err := builder.WriteJSON(g, output+".json"); err != nil {
+		fmt.Printf("Write %s.json failed, err = %s\n", output, err.Error())
+		return
+	}
+	if err := builder.RenderSVG(output+".dot", output+".svg"); err != nil { // 未安装 graphviz 时只输出 dot 和 json
+		logs.Logger.WithError(err).Warnf("failed to render svg")
+	}
+	fmt.Printf("Analyze provenance graph for %s success!\n", args[5])
+}
+
+// Migrate 执行内嵌的表结构迁移
+func Migrate(_ *cobra.Command, args []string) {
+	m, err := store.NewMigrator()
+	if err != nil {
+		fmt.Printf("Open database failed, err = %s\n", err.Error())
+		os.Exit(-1)
+	}
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	var count int
+	switch action {
+	case "up":
+		count, err = m.Up()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				fmt.Printf("steps is not valid.\n")
+				os.Exit(-1)
+			}
+		}
+		count, err = m.Down(steps)
+	case "to":
+		if len(args) < 2 {
+			fmt.Printf("migrate to must need target version.\n")
+			os.Exit(-1)
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			fmt.Printf("version is not valid.\n")
+			os.Exit(-1)
+		}
+		count, err = m.To(version)
+	case "status":
+		current, err := m.Current()
+		if err != nil {
+			fmt.Printf("Get schema version failed, err = %s\n", err.Error())
+			os.Exit(-1)
+		}
+		applied, _ := m.Applied()
+		for _, a := range applied {
+			fmt.Printf("%04d_%s applied at %s\n", a.Version, a.Name, time.Unix(a.AppliedAt, 0).Format("2006-01-02 15:04:05"))
+		}
+		fmt.Printf("current version %d, latest version %d\n", current, m.Latest())
+		return
+	default:
+		fmt.Printf("unknown migrate action %s, use up, down [steps], to <version> or status.\n", action)
+		os.Exit(-1)
+	}
+	if err != nil {
+		fmt.Printf("Migrate failed after %d migrations, err = %s\n", count, err.Error())
+		os.Exit(-1)
+	}
+	current, _ := m.Current()
+	fmt.Printf("Migrate %d versions success, current version %d\n", count, current)
+}
+
+// PurgeData 删除 days 天之前的数据，days 为 0 时删除全部匹配的数据
+func PurgeData(_ *cobra.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Printf("purge cmd must need days, dataset=<name> host=<id> container=<id> uuid=<uuid> dry-run optional.\n")
+		os.Exit(-1)
+	}
+	days, err := strconv.Atoi(args[0])
+	if err != nil || days < 0 {
+		fmt.Printf("days is not valid.\n")
+		os.Exit(-1)
+	}
+	opts := store.PurgeOptions{
+		Before:    time.Now().AddDate(0, 0, -days).UnixNano() / int64(time.Microsecond),
+		ChunkSize: conf.Config.Retention.ChunkSize,
+	}
+	for _, arg := range args[1:] {
+		if arg == "dry-run" {
+			opts.DryRun = true
+			continue
+		}
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			fmt.Printf("unknown purge option %s\n", arg)
+			os.Exit(-1)
+		}
+		switch kv[0] {
+		case "dataset":
+			if err := store.ValidateDataset(kv[1]); err != nil {
+				fmt.Printf("%s\n", err.Error())
+				os.Exit(-1)
+			}
+			opts.Dataset = kv[1]
+		case "host":
+			opts.HostID = kv[1]
+		case "container":
+			opts.ContainerID = kv[1]
+		case "uuid":
+			opts.UUID = kv[1]
+		default:
+			fmt.Printf("unknown purge option %s\n", arg)
+			os.Exit(-1)
+		}
+	}
+	report, err := parser.Purge(opts)
+	if err != nil {
+		fmt.Printf("Purge failed, err = %s\n", err.Error())
+		os.Exit(-1)
+	}
+	if opts.DryRun {
+		fmt.Printf("Dry run, would delete %s\n", report)
+		return
+	}
+	fmt.Printf("Purge success, deleted %s\n", report)
+}
+
+// ManageDataset 列出、复制或删除数据集
+func ManageDataset(_ *cobra.Command, args []string) {
+	manager, ok := store.GetStore().(store.DatasetManager)
+	if !ok {
+		fmt.Printf("current storage does not support datasets.\n")
+		os.Exit(-1)
+	}
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	for _, name := range args[1:] {
+		if name == "dry-run" {
+			continue
+		}
+		if err := store.ValidateDataset(name); err != nil {
+			fmt.Printf("%s\n", err.Error())
+			os.Exit(-1)
+		}
+	}
+	switch action {
+	case "list":
+		datasets, err := manager.ListDatasets()
+		if err != nil {
+			fmt.Printf("List datasets failed, err = %s\n", err.Error())
+			os.Exit(-1)
+		}
+		for _, d := range datasets {
+			fmt.Printf("%s\t%s\n", d.Name, d)
+		}
+	case "copy":
+		if len(args) != 3 {
+			fmt.Printf("dataset copy must need source and destination dataset.\n")
+			os.Exit(-1)
+		}
+		copied, err := manager.CopyDataset(args[1], args[2])
+		if err != nil {
+			fmt.Printf("Copy dataset %s to %s failed, err = %s\n", args[1], args[2], err.Error())
+			os.Exit(-1)
+		}
+		fmt.Printf("Copy dataset %s to %s success, copied %s\n", args[1], args[2], copied)
+	case "drop":
+		if len(args) < 2 || len(args) > 3 || (len(args) == 3 && args[2] != "dry-run") {
+			fmt.Printf("dataset drop must need dataset name, dry-run optional.\n")
+			os.Exit(-1)
+		}
+		opts := store.PurgeOptions{
+			Before:    math.MaxInt64,
+			Dataset:   args[1],
+			ChunkSize: conf.Config.Retention.ChunkSize,
+			DryRun:    len(args) == 3,
+		}
+		// 删除数据集需要删除其中的所有顶点，其他进程缓存的顶点主键会失效
+		if others, err := parser.OtherInserters(); err != nil || (len(others) > 0 && !opts.DryRun) {
+			if err == nil {
+				err = fmt.Errorf("inserting processes %s are running, stop them first", strings.Join(others, ", "))
+			}
+			fmt.Printf("Drop dataset %s failed, err = %s\n", args[1], err.Error())
+			os.Exit(-1)
+		}
+		report, err := parser.Purge(opts)
+		if err != nil {
+			fmt.Printf("Drop dataset %s failed, err = %s\n", args[1], err.Error())
+			os.Exit(-1)
+		}
+		if opts.DryRun {
+			fmt.Printf("Dry run, would delete %s\n", report)
+			return
+		}
+		fmt.Printf("Drop dataset %s success, deleted %s\n", args[1], report)
+	default:
+		fmt.Printf("unknown dataset action %s, use list, copy <src> <dst> or drop <name> [dry-run].\n", action)
+		os.Exit(-1)
+	}
+}
+
+// BenchmarkTraversal 分别逐个顶点查询与按层批量查询溯源，输出两者的耗时、存储调用次数与子图规模
+func BenchmarkTraversal(_ *cobra.Command, args []string) {
+	rounds := 3
+	args, opts, roots, err := parseProvenanceArgs(args)
+	for _, arg := range args {
+		if err != nil {
+			break
+		}
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			err = fmt.Errorf("unknown benchmark option %s", arg)
+			break
+		}
+		switch kv[0] {
+		case "depth":
+			d, perr := strconv.Atoi(kv[1])
+			if perr != nil {
+				err = fmt.Errorf("depth is not valid: %s", kv[1])
+			}
+			opts.Depth = &d
+		case "rounds":
+			if rounds, err = strconv.Atoi(kv[1]); err != nil {
+				err = fmt.Errorf("rounds is not valid: %s", kv[1])
+			}
+		case "uuid":
+			opts.UUID = kv[1]
+		default:
+			err = fmt.Errorf("unknown benchmark option %s", arg)
+		}
+	}
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(-1)
+	}
+	if len(roots) == 0 {
+		fmt.Printf("benchmark cmd must need root=<root>.\n")
+		os.Exit(-1)
+	}
+	results, err := builder.BenchmarkProvenance(context.Background(), store.GetStore(), roots, opts, rounds)
+	for _, r := range results {
+		fmt.Printf("%-6s rounds=%d avg=%v min=%v max=%v queries=%d nodes=%d edges=%d\n",
+			r.Name, r.Rounds, r.Average(), r.Min, r.Max, r.Queries, r.Nodes, r.Edges)
+		if r.Truncated != "" {
+			fmt.Printf("%-6s truncated: %s\n", r.Name, r.Truncated)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Benchmark failed, err = %s\n", err.Error())
+		os.Exit(-1)
+	}
+	if len(results) == 2 && results[1].Average() > 0 {
+		fmt.Printf("level traversal is %.1fx faster with %d fewer queries\n",
+			float64(results[0].Average())/float64(results[1].Average()), results[0].Queries-results[1].Queries)
+	}
+}
+
+// PrintEvidence 输出指定的边或溯源子图中所有边对应的原始日志
+func PrintEvidence(_ *cobra.Command, args []string) {
+	args, opts, roots, err := parseProvenanceArgs(args)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(-1)
+	}
+	if len(args) < 2 {
+		fmt.Printf("evidence must need event <id>..., net <id>... or subgraph <host> <container> <vpid> <name>|root=<root>... [depth].\n")
+		os.Exit(-1)
+	}
+	var edges []builder.RecordLoc
+	switch args[0] {
+	case "event", "net":
+		if roots != nil {
+			fmt.Printf("root= is only valid for evidence subgraph.\n")
+			os.Exit(-1)
+		}
+		for _, arg := range args[1:] {
+			id, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Printf("edge id is not valid: %s\n", arg)
+				os.Exit(-1)
+			}
+			edges = append(edges, builder.RecordLoc{Key: id, Table: args[0]})
+		}
+	case "subgraph":
+		rest := args[1:]
+		if len(roots) == 0 && len(rest) >= 4 { // <host> <container> <vpid> <name> [depth]
+			roots, rest = []builder.Root{builder.ProcessRootOf(rest[0], rest[1], rest[2], rest[3])}, rest[4:]
+		}
+		if len(roots) == 0 || len(rest) > 1 {
+			fmt.Printf("evidence subgraph must need host, container, process id and name, or root=<root>, depth optional.\n")
+			os.Exit(-1)
+		}
+		var depth *int
+		if len(rest) == 1 {
+			d, err := strconv.Atoi(rest[0])
+			if err != nil {
+				fmt.Printf("depth is not valid: %s\n", rest[0])
+				os.Exit(-1)
+			}
+			depth = &d
+		}
+		opts.Depth = depth
+		r, err := builder.ProvenanceFrom(context.Background(), store.GetStore(), roots, opts)
+		if err != nil {
+			fmt.Printf("Build provenance graph failed, err = %s\n", err.Error())
+			os.Exit(-1)
+		}
+		printTruncation(r)
+		edges = builder.SubgraphEdges(r.Graph)
+	default:
+		fmt.Printf("unknown evidence target %s, use event, net or subgraph.\n", args[0])
+		os.Exit(-1)
+	}
+	for _, e := range builder.FetchEvidence(store.GetStore(), edges) {
+		if e.Error != "" {
+			fmt.Printf("%s %d\t<%s>\n", e.Table, e.ID, e.Error)
+			continue
+		}
+		if e.Count > 1 {
+			fmt.Printf("%s %d\t%s\t<first of %d merged events, the others are not archived>\n", e.Table, e.ID, e.Raw, e.Count)
+			continue
+		}
+		fmt.Printf("%s %d\t%s\n", e.Table, e.ID, e.Raw)
+	}
+}
+
+// VerifyLedger 校验哈希链，参数为 checkpoint export 导出的检查点文件
+func VerifyLedger(_ *cobra.Command, args []string) {
+	ledger, ok := store.GetStore().(store.Ledger)
+	if !ok {
+		fmt.Printf("current storage does not support ledger.\n")
+		os.Exit(-1)
+	}
+	if len(args) > 1 {
+		fmt.Printf("verify only accepts an exported checkpoints file.\n")
+		os.Exit(-1)
+	}
+	var extra []models.LedgerCheckpoint
+	if len(args) == 1 {
+		data, err := ioutil.ReadFile(args[0])
+		if err == nil {
+			err = json.Unmarshal(data, &extra)
+		}
+		if err != nil {
+			fmt.Printf("Read checkpoints %s failed, err = %s\n", args[0], err.Error())
+			os.Exit(-1)
+		}
+	}
+	var trusted ed25519.PublicKey
+	if key, err := store.LoadLedgerKey(conf.Config.Ledger.KeyFile, false); err == nil {
+		trusted = key.Public().(ed25519.PublicKey)
+	} else if !os.IsNotExist(err) {
+		fmt.Printf("Load ledger key failed, err = %s\n", err.Error())
+		os.Exit(-1)
+	}
+	report, err := ledger.VerifyLedger(extra, trusted)
+	if err != nil {
+		fmt.Printf("Verify ledger failed, err = %s\n", err.Error())
+		os.Exit(-1)
+	}
+	fmt.Printf("Verified ledger head %s, %s\n", report.Head, report)
+	if report.ProblemCount == 0 {
+		fmt.Printf("Ledger is intact.\n")
+		return
+	}
+	fmt.Printf("First problem: %s\n", report.Problems[0])
+	for _, p := range report.Problems[1:] {
+		fmt.Printf("  %s\n", p)
+	}
+	if report.ProblemCount > len(report.Problems) {
+		fmt.Printf("  ... and %d more\n", report.ProblemCount-len(report.Problems))
+	}
+	os.Exit(1)
+}
+
+// LedgerCheckpoint 对链头签名，或导出所有检查点
+func LedgerCheckpoint(_ *cobra.Command, args []string) {
+	ledger, ok := store.GetStore().(store.Ledger)
+	if !ok {
+		fmt.Printf("current storage does not support ledger.\n")
+		os.Exit(-1)
+	}
+	switch {
+	case len(args) == 0:
+		key, err := store.LoadLedgerKey(conf.Config.Ledger.KeyFile, true)
+		if err != nil {
+			fmt.Printf("Load ledger key failed, err = %s\n", err.Error())
+			os.Exit(-1)
+		}
+		c, err := ledger.Checkpoint(key)
+		if err != nil {
+			fmt.Printf("Create checkpoint failed, err = %s\n", err.Error())
+			os.Exit(-1)
+		}
+		fmt.Printf("Checkpoint at entry %d, hash %s, signed by %s\n", c.Seq, c.Hash, c.PublicKey)
+	case len(args) == 2 && args[0] == "export":
+		checkpoints, err := ledger.Checkpoints()
+		if err != nil {
+			fmt.Printf("Read checkpoints failed, err = %s\n", err.Error())
+			os.Exit(-1)
+		}
+		data, err := json.MarshalIndent(checkpoints, "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(args[1], data, 0644)
+		}
+		if err != nil {
+			fmt.Printf("Export checkpoints failed, err = %s\n", err.Error())
+			os.Exit(-1)
+		}
+		fmt.Printf("Export %d checkpoints to %s success\n", len(checkpoints), args[1])
+	default:
+		fmt.Printf("checkpoint takes no argument, or export <file>.\n")
+		os.Exit(-1)
+	}
+}
+
+// ExportGraph 导出溯源图
+func ExportGraph(_ *cobra.Command, args []string) {
+	args, opts, roots, err := parseProvenanceArgs(args) // direction、过滤条件、max-nodes、max-edges、timeout、exclude 只作用于 root= 的子图
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(-1)
+	}
+	var (
+		rest   []string
+		filter = exchange.Filter{From: opts.From, To: opts.To}
+		depth  *int
+	)
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			rest = append(rest, arg)
+			continue
+		}
+		switch kv[0] {
+		case "uuid":
+			filter.UUID = kv[1]
+		case "depth":
+			d, perr := strconv.Atoi(kv[1])
+			if perr != nil {
+				err = fmt.Errorf("depth is not valid: %s", kv[1])
+			}
+			depth = &d
+		default:
+			err = fmt.Errorf("unknown export option %s", arg)
+		}
+		if err != nil {
+			fmt.Printf("%s\n", err.Error())
+			os.Exit(-1)
+		}
+	}
+	if len(rest) != 2 {
+		fmt.Printf("export cmd must need format (graphml, json, prov, cdm or neo4j) and file (directory for neo4j).\n")
+		os.Exit(-1)
+	}
+	switch rest[0] {
+	case exchange.JSONFormat, exchange.GraphMLFormat, exchange.ProvFormat, exchange.CDMFormat, "neo4j":
+	default:
+		fmt.Printf("unknown export format %s, use graphml, json, prov, cdm or neo4j.\n", rest[0])
+		os.Exit(-1)
+	}
+	if rest[0] == "neo4j" {
+		if !filter.IsEmpty() || roots != nil {
+			fmt.Printf("neo4j export does not support uuid, from, to or root.\n")
+			os.Exit(-1)
+		}
+		report, err := exchange.ExportNeo4j(store.GetStore(), rest[1])
+		if err != nil {
+			fmt.Printf("Export neo4j CSV failed after %s, err = %s\n", report, err.Error())
+			os.Exit(-1)
+		}
+		fmt.Printf("Export %s to %s success, import with:\n  cd %s && %s\n", report, rest[1], rest[1], report.Command("neo4j"))
+		return
+	}
+	var g *exchange.Graph
+	if roots != nil {
+		opts.Depth, opts.UUID = depth, filter.UUID
+		r, err := builder.ProvenanceFrom(context.Background(), store.GetStore(), roots, opts)
+		if err != nil {
+			fmt.Printf("Build provenance graph failed, err = %s\n", err.Error())
+			os.Exit(-1)
+		}
+		printTruncation(r)
+		g, err = exchange.ExportSubgraph(store.GetStore(), r.Graph)
+	} else {
+		g, err = exchange.Export(store.GetStore(), filter)
+	}
+	if err != nil {
+		fmt.Printf("Export graph failed, err = %s\n", err.Error())
+		os.Exit(-1)
+	}
+	f, err := os.Create(rest[1])
+	if err != nil {
+		fmt.Printf("Create %s failed, err = %s\n", rest[1], err.Error())
+		os.Exit(-1)
+	}
+	err = exchange.Write(g, rest[0], f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Printf("Write %s failed, err = %s\n", rest[1], err.Error())
+		os.Exit(-1)
+	}
+	fmt.Printf("Export %d processes, %d files, %d sockets, %d events, %d nets to %s success\n",
+		len(g.Processes), len(g.Files), len(g.Sockets), len(g.Events), len(g.Nets), rest[1])
+}
+
+// ImportGraph 导入 export 导出的溯源图
+func ImportGraph(_ *cobra.Command, args []string) {
+	args, err := useDataset(args)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(-1)
+	}
+	var (
+		path   string
+		format string
+	)
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "format="):
+			format = strings.TrimPrefix(arg, "format=")
+		case path == "":
+			path = arg
+		default:
+			fmt.Printf("import cmd only accepts one file.\n")
+			os.Exit(-1)
+		}
+	}
+	if path == "" {
+		fmt.Printf("import cmd must need file, format=<graphml|json> and dataset=<name> optional.\n")
+		os.Exit(-1)
+	}
+	if format == "" {
+		if format = exchange.FormatOf(path); format == "" {
+			fmt.Printf("cannot infer format of %s, use format=<graphml|json>.\n", path)
+			os.Exit(-1)
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Open %s failed, err = %s\n", path, err.Error())
+		os.Exit(-1)
+	}
+	defer f.Close()
+	g, err := exchange.Read(format, f)
+	if err != nil {
+		fmt.Printf("Read %s failed, err = %s\n", path, err.Error())
+		os.Exit(-1)
+	}
+	report, err := exchange.Import(store.GetStore(), g)
+	if err != nil {
+		fmt.Printf("Import graph failed after %s, err = %s\n", report, err.Error())
+		os.Exit(-1)
+	}
+	fmt.Printf("Import success, created %s\n", report)
+}
+
+// dotPaths 展开参数中的目录，返回其中的 .dot 文件
+func dotPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && (file == path || filepath.Ext(file) == ".dot") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func ImportDot(_ *cobra.Command, args []string) {
+	args, err := useDataset(args)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(-1)
+	}
+	var (
+		paths     []string
+		container = "node" // 顶点所在的容器：node 为顶点名称中的容器，filename 为文件名中的容器，其他为指定的容器 ID
+		opts      exchange.DotOptions
+	)
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "container="):
+			container = strings.TrimPrefix(arg, "container=")
+		case strings.HasPrefix(arg, "host="):
+			opts.HostID = strings.TrimPrefix(arg, "host=")
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 || container == "" {
+		fmt.Printf("import-dot cmd must need files or directories, container=<node|filename|id> host=<id> and dataset=<name> optional.\n")
+		os.Exit(-1)
+	}
+	files, err := dotPaths(paths)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(-1)
+	}
+	failed := 0
+	for _, file := range files {
+		opts := opts
+		switch container {
+		case "node":
+		case "filename":
+			if opts.ContainerID = exchange.DotFileContainer(file); opts.ContainerID == "" {
+				fmt.Printf("%s: no container id in file name\n", file)
+				failed++
+				continue
+			}
+		default:
+			opts.ContainerID = container
+		}
+		data, err := ioutil.ReadFile(file)
+		if err == nil {
+			var report exchange.SourceReport
+			if report, err = exchange.ImportDot(store.GetStore(), data, opts); err == nil {
+				fmt.Printf("%s: %s\n", file, report)
+				continue
+			}
+		}
+		fmt.Printf("%s: import failed, err = %s\n", file, err.Error())
+		failed++
+	}
+	if failed > 0 {
+		fmt.Printf("Import %d of %d dot files failed\n", failed, len(files))
+		os.Exit(-1)
+	}
+	fmt.Printf("Import %d dot files success\n", len(files))
+}
+
+func RunAgent(_ *cobra.Command, _ []string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := agent.Run(ctx); err != nil {
+		logs.Logger.WithError(err).Fatal("agent exited")
+	}
+}
@@ -0,0 +1,13 @@
+package models
+
+// CopyIDMap 复制数据集时一条原记录与复制出的记录的主键
+type CopyIDMap struct {
+	Dataset     string `gorm:"primaryKey;column:dataset"`      // 复制到的数据集
+	RecordTable string `gorm:"primaryKey;column:record_table"` // 记录所在的表
+	SrcID       int    `gorm:"primaryKey;column:src_id"`
+	DstID       int    `gorm:"column:dst_id"`
+}
+
+func (CopyIDMap) TableName() string {
+	return "copy_id_map"
+}
@@ -0,0 +1,35 @@
+package models
+
+import "strings"
+
+// EdgeRequest 记录边属于哪个请求，fwatchdog 同时处理多个请求时一条边属于多个请求
+type EdgeRequest struct {
+	ID        int    `gorm:"primaryKey;column:id"`
+	EdgeTable string `gorm:"column:edge_table"` // 边所在的表：event 或 net
+	EdgeID    int    `gorm:"column:edge_id"`    // 边在对应表中的主键
+	UUID      string `gorm:"column:uuid"`
+}
+
+func (EdgeRequest) TableName() string {
+	return "edge_request"
+}
+
+// SplitUUIDs 拆分边上以逗号拼接的请求 uuid，忽略空值和 unknown
+func SplitUUIDs(uuid string) []string {
+	var uuids []string
+	for _, u := range strings.Split(uuid, ",") {
+		if u != "" && u != "unknown" {
+			uuids = append(uuids, u)
+		}
+	}
+	return uuids
+}
+
+// EdgeRequests 生成一条边与其所属请求的关联
+func EdgeRequests(edgeTable string, edgeID int, uuid string) []EdgeRequest {
+	var requests []EdgeRequest
+	for _, u := range SplitUUIDs(uuid) {
+		requests = append(requests, EdgeRequest{EdgeTable: edgeTable, EdgeID: edgeID, UUID: u})
+	}
+	return requests
+}
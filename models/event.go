@@ -1,20 +1,38 @@
 package models
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"erinyes/helper"
 	"fmt"
+	"io"
 	"strings"
 )
 
 type Event struct {
-	ID         int    `gorm:"primaryKey;column:id"`
-	SrcID      int    `gorm:"column:src_id"`
-	DstID      int    `gorm:"column:dst_id"`
-	EventClass string `gorm:"column:event_class"`
-	Relation   string `gorm:"column:relation"`
-	Operation  string `gorm:"column:operation"`
-	Time       int64  `gorm:"column:time"`
-	UUID       string `gorm:"column:uuid"`
+	ID         int     `gorm:"primaryKey;column:id"`
+	SrcID      int     `gorm:"column:src_id"`
+	DstID      int     `gorm:"column:dst_id"`
+	EventClass string  `gorm:"column:event_class"`
+	Relation   string  `gorm:"column:relation"`
+	Operation  string  `gorm:"column:operation"`
+	Time       int64   `gorm:"column:time"`
+	EndTime    int64   `gorm:"column:end_time"` // 合并重复边后最后一次事件的时间，未合并时与 Time 相同
+	Count      int     `gorm:"column:count"`    // 合并的事件数
+	UUID       string  `gorm:"column:uuid"`
+	Pid        string  `gorm:"column:pid"`         // 主机上的进程 pid
+	Tid        string  `gorm:"column:tid"`         // 线程 id
+	Ret        string  `gorm:"column:ret"`         // 系统调用返回值
+	Bytes      int64   `gorm:"column:bytes"`       // 读写的字节数，合并重复边后为总和
+	Args       []byte  `gorm:"column:args"`        // gzip 压缩的 evt.info（JSON 数组），未开启 Inserter.KeepArgs 时为空
+	DedupKey   *string `gorm:"column:dedup_key"`   // 去重键，不允许重复边时写入，由唯一索引保证同一条边只插入一次
+	Dataset    string  `gorm:"column:dataset"`     // 所属的数据集，与两端顶点一致
+	RawSegment string  `gorm:"column:raw_segment"` // 原始日志所在的归档分段，未开启归档时为空
+	RawOffset  int64   `gorm:"column:raw_offset"`  // 原始日志在解压后分段中的偏移
+	RawLength  int     `gorm:"column:raw_length"`  // 原始日志的字节数
+	ChainHash  string  `gorm:"column:chain_hash"`  // 插入时不可变字段的哈希，开启 Ledger 时写入，见 ComputeChainHash
+	Method     string  `gorm:"-"`                  // 关联到流量日志后的 HTTP 方法，仅用于展示
 }
 
 func (Event) TableName() string {
@@ -43,5 +61,66 @@ func (e Event) LinkLabel() string {
 }
 
 func (e Event) LinkInfo() string {
-	return fmt.Sprintf("relation:%s\ntime:%d\nuuid:%s", e.Relation, e.Time, e.UUID)
+	var b strings.Builder
+	fmt.Fprintf(&b, "relation:%s\n", e.Relation)
+	if e.Method != "" {
+		fmt.Fprintf(&b, "method:%s\n", e.Method)
+	}
+	fmt.Fprintf(&b, "time:%d\n", e.Time)
+	if e.Count > 1 {
+		fmt.Fprintf(&b, "end_time:%d\ncount:%d\n", e.EndTime, e.Count)
+	}
+	if e.Pid != "" {
+		fmt.Fprintf(&b, "pid:%s\ntid:%s\n", e.Pid, e.Tid)
+	}
+	if e.Ret != "" {
+		fmt.Fprintf(&b, "ret:%s\n", e.Ret)
+	}
+	if e.Bytes > 0 {
+		fmt.Fprintf(&b, "bytes:%d\n", e.Bytes)
+	}
+	if args, err := e.DecodeArgs(); err == nil && len(args) > 0 {
+		fmt.Fprintf(&b, "args:%s\n", strings.Join(args, " "))
+	}
+	fmt.Fprintf(&b, "uuid:%s", e.UUID)
+	return b.String()
+}
+
+// EncodeArgs 将 evt.info 编码为 gzip 压缩的 JSON 数组，参数为空时返回 nil
+func EncodeArgs(args []string) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeArgs 解压 Args，没有保存参数时返回 nil
+func (e Event) DecodeArgs() ([]string, error) {
+	if len(e.Args) == 0 {
+		return nil, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(e.Args))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	err = json.Unmarshal(raw, &args)
+	return args, err
 }
@@ -2,9 +2,7 @@ package models
 
 import (
 	"erinyes/helper"
-	"erinyes/logs"
 	"fmt"
-	"gorm.io/gorm"
 )
 
 type File struct {
@@ -14,25 +12,14 @@ type File struct {
 	ContainerID   string `gorm:"column:container_id"`
 	ContainerName string `gorm:"column:container_name"`
 	FilePath      string `gorm:"column:file_path"`
+	Dataset       string `gorm:"column:dataset"`
+	ChainHash     string `gorm:"column:chain_hash"` // 含义同 Process.ChainHash
 }
 
 func (File) TableName() string {
 	return "file"
 }
 
-func (f *File) FindByID(db *gorm.DB, id int) bool {
-	err := db.First(f, id).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			logs.Logger.Errorf("can't find file by id = %d", id)
-		} else {
-			logs.Logger.Errorf("query file by id = %d failed: %w", id, err)
-		}
-		return false
-	}
-	return true
-}
-
 // VertexClusterID 实现点的接口，返回dot文件中点的唯一标识
 func (f File) VertexClusterID() string {
 	return helper.AddQuotation("cluster" + f.HostID + "_" + f.ContainerID)
@@ -0,0 +1,33 @@
+package models
+
+import "fmt"
+
+const (
+	FlowSourceSysdig  = "sysdig"  // 来自 sysdig 套接字读写事件
+	FlowSourceCapture = "capture" // 来自流量采集
+)
+
+// Flow 记录一条网络边对应的四元组、方向和载荷长度，用于关联同一次网络交互的 sysdig 事件与流量日志
+type Flow struct {
+	ID         int    `gorm:"primaryKey;column:id"`
+	EdgeTable  string `gorm:"column:edge_table"` // 边所在的表：event 或 net
+	EdgeID     int    `gorm:"column:edge_id"`    // 边在对应表中的主键
+	Source     string `gorm:"column:source"`     // sysdig 或 capture
+	SrcIP      string `gorm:"column:src_ip"`     // 数据流动方向上的源端
+	SrcPort    string `gorm:"column:src_port"`
+	DstIP      string `gorm:"column:dst_ip"` // 数据流动方向上的目的端
+	DstPort    string `gorm:"column:dst_port"`
+	PayloadLen int    `gorm:"column:payload_len"`
+	Method     string `gorm:"column:method"` // HTTP 方法，sysdig 一侧在关联成功后才会填充
+	Time       int64  `gorm:"column:time"`
+	PeerID     int    `gorm:"column:peer_id"` // 关联到的另一侧 flow 的主键，0 表示尚未关联
+	Dataset    string `gorm:"column:dataset"` // 只与同一数据集中的 flow 关联
+}
+
+func (Flow) TableName() string {
+	return "flow"
+}
+
+func (f Flow) Tuple() string {
+	return fmt.Sprintf("%s:%s->%s:%s", f.SrcIP, f.SrcPort, f.DstIP, f.DstPort)
+}
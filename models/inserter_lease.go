@@ -0,0 +1,11 @@
+package models
+
+// InserterLease 正在插入边的进程登记的租约，持有者定期续期，过期的租约视为进程已经退出
+type InserterLease struct {
+	Holder    string `gorm:"primaryKey;column:holder"` // <主机名>#<pid>
+	ExpiresAt int64  `gorm:"column:expires_at"`        // 毫秒时间戳
+}
+
+func (InserterLease) TableName() string {
+	return "inserter_lease"
+}
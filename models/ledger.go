@@ -0,0 +1,297 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	LedgerInsert = "insert" // 一批插入的边或顶点
+	LedgerPurge  = "purge"  // 一批被 purge 删除的边或顶点
+	LedgerLink   = "link"   // 流量关联补全了 uuid 的 event 边，摘要为 LinkHash
+)
+
+// LedgerGenesis 第一项的 PrevHash
+var LedgerGenesis = strings.Repeat("0", 64)
+
+// LedgerEntry 哈希链中的一项，记录一批插入或删除的边（或顶点），或一批边的 uuid 补全
+type LedgerEntry struct {
+	Seq       int    `gorm:"primaryKey;column:seq;autoIncrement:false"` // 从 1 开始连续递增
+	Kind      string `gorm:"column:kind"`                               // LedgerInsert、LedgerPurge 或 LedgerLink
+	EdgeTable string `gorm:"column:edge_table"`                         // 记录所在的表，顶点为 process、file、socket
+	EdgeIDs   string `gorm:"column:edge_ids"`                           // 主键的区间列表，见 EncodeIDs
+	Digest    string `gorm:"column:digest"`                             // 这批记录的 ChainHash（LedgerLink 为 LinkHash）按主键顺序拼接后的 sha256
+	Time      int64  `gorm:"column:time"`                               // 追加的时间，unix 秒
+	PrevHash  string `gorm:"column:prev_hash"`
+	Hash      string `gorm:"column:hash"`
+}
+
+func (LedgerEntry) TableName() string {
+	return "ledger"
+}
+
+// ComputeHash 计算本项的哈希，覆盖除 Hash 以外的所有字段
+func (l LedgerEntry) ComputeHash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s\x00%s\x00%s\x00%d\x00%s",
+		l.Seq, l.Kind, l.EdgeTable, l.EdgeIDs, l.Digest, l.Time, l.PrevHash)))
+	return hex.EncodeToString(sum[:])
+}
+
+// LedgerCheckpoint 对某一时刻链头的签名，导出后保存在数据库之外，可以证明此前的链没有被整体重写
+type LedgerCheckpoint struct {
+	ID        int    `gorm:"primaryKey;column:id" json:"-"`
+	Seq       int    `gorm:"column:seq" json:"seq"`
+	Hash      string `gorm:"column:hash" json:"hash"`
+	Time      int64  `gorm:"column:time" json:"time"`
+	PublicKey string `gorm:"column:public_key" json:"publicKey"` // hex 编码的 ed25519 公钥
+	Signature string `gorm:"column:signature" json:"signature"`  // hex 编码的 ed25519 签名
+}
+
+func (LedgerCheckpoint) TableName() string {
+	return "ledger_checkpoint"
+}
+
+func (c LedgerCheckpoint) message() []byte {
+	return []byte(fmt.Sprintf("erinyes-ledger\x00%d\x00%s\x00%d", c.Seq, c.Hash, c.Time))
+}
+
+// Sign 用私钥对链头签名，填充 PublicKey 和 Signature
+func (c *LedgerCheckpoint) Sign(key ed25519.PrivateKey) {
+	c.PublicKey = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	c.Signature = hex.EncodeToString(ed25519.Sign(key, c.message()))
+}
+
+// VerifySignature 校验签名是否由 PublicKey 对应的私钥生成
+func (c LedgerCheckpoint) VerifySignature() bool {
+	pub, err := hex.DecodeString(c.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := hex.DecodeString(c.Signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(pub, c.message(), sig)
+}
+
+// chainedEvent 参与哈希的 event 字段
+// 合并重复边会修改 Count、Bytes、EndTime，这些字段不参与；主键在插入前未知，由 LedgerEntry.EdgeIDs 覆盖
+// UUID 按 SplitUUIDs 规范化，unknown 与空值等价；流量关联只补全未知的 uuid，补全后的值由 LedgerLink 项记录
+type chainedEvent struct {
+	SrcID      int    `json:"src_id"`
+	DstID      int    `json:"dst_id"`
+	EventClass string `json:"event_class"`
+	Relation   string `json:"relation"`
+	Operation  string `json:"operation"`
+	Time       int64  `json:"time"`
+	UUID       string `json:"uuid"`
+	Pid        string `json:"pid"`
+	Tid        string `json:"tid"`
+	Ret        string `json:"ret"`
+	Args       string `json:"args"` // hex 编码，空值与 NULL 等价
+	Dataset    string `json:"dataset"`
+	RawSegment string `json:"raw_segment"`
+	RawOffset  int64  `json:"raw_offset"`
+	RawLength  int    `json:"raw_length"`
+}
+
+// chainedNet 参与哈希的 net 字段
+type chainedNet struct {
+	SrcID      int    `json:"src_id"`
+	DstID      int    `json:"dst_id"`
+	Method     string `json:"method"`
+	Payload    string `json:"payload"`
+	PayloadLen int    `json:"payload_len"`
+	SeqNum     int    `json:"seq_num"`
+	AckNum     int    `json:"ack_num"`
+	Time       int64  `json:"time"`
+	UUID       string `json:"uuid"`
+	Dataset    string `json:"dataset"`
+	RawSegment string `json:"raw_segment"`
+	RawOffset  int64  `json:"raw_offset"`
+	RawLength  int    `json:"raw_length"`
+}
+
+func chainHash(table string, v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(append([]byte(table+"\x00"), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// ComputeChainHash 计算 event 插入时不可变字段的哈希
+func (e Event) ComputeChainHash() string {
+	return chainHash(e.TableName(), chainedEvent{
+		SrcID:      e.SrcID,
+		DstID:      e.DstID,
+		EventClass: e.EventClass,
+		Relation:   e.Relation,
+		Operation:  e.Operation,
+		Time:       e.Time,
+		UUID:       strings.Join(SplitUUIDs(e.UUID), ","),
+		Pid:        e.Pid,
+		Tid:        e.Tid,
+		Ret:        e.Ret,
+		Args:       hex.EncodeToString(e.Args),
+		Dataset:    e.Dataset,
+		RawSegment: e.RawSegment,
+		RawOffset:  e.RawOffset,
+		RawLength:  e.RawLength,
+	})
+}
+
+// ComputeChainHash 计算 net 插入时不可变字段的哈希
+func (n Net) ComputeChainHash() string {
+	return chainHash(n.TableName(), chainedNet{
+		SrcID:      n.SrcID,
+		DstID:      n.DstID,
+		Method:     n.Method,
+		Payload:    n.Payload,
+		PayloadLen: n.PayloadLen,
+		SeqNum:     n.SeqNum,
+		AckNum:     n.AckNum,
+		Time:       n.Time,
+		UUID:       n.UUID,
+		Dataset:    n.Dataset,
+		RawSegment: n.RawSegment,
+		RawOffset:  n.RawOffset,
+		RawLength:  n.RawLength,
+	})
+}
+
+// chainedProcess 参与哈希的 process 字段，顶点插入后不再修改
+type chainedProcess struct {
+	HostID         string `json:"host_id"`
+	HostName       string `json:"host_name"`
+	ContainerID    string `json:"container_id"`
+	ContainerName  string `json:"container_name"`
+	ProcessVPID    string `json:"process_vpid"`
+	ProcessName    string `json:"process_name"`
+	ProcessExepath string `json:"process_exe_path"`
+	Dataset        string `json:"dataset"`
+}
+
+type chainedFile struct {
+	HostID        string `json:"host_id"`
+	HostName      string `json:"host_name"`
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	FilePath      string `json:"file_path"`
+	Dataset       string `json:"dataset"`
+}
+
+type chainedSocket struct {
+	HostID        string `json:"host_id"`
+	HostName      string `json:"host_name"`
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	DstIP         string `json:"dst_ip"`
+	DstPort       string `json:"dst_port"`
+	Dataset       string `json:"dataset"`
+}
+
+// ComputeChainHash 计算 process 插入时的哈希
+func (p Process) ComputeChainHash() string {
+	return chainHash(p.TableName(), chainedProcess{
+		HostID:         p.HostID,
+		HostName:       p.HostName,
+		ContainerID:    p.ContainerID,
+		ContainerName:  p.ContainerName,
+		ProcessVPID:    p.ProcessVPID,
+		ProcessName:    p.ProcessName,
+		ProcessExepath: p.ProcessExepath,
+		Dataset:        p.Dataset,
+	})
+}
+
+// ComputeChainHash 计算 file 插入时的哈希
+func (f File) ComputeChainHash() string {
+	return chainHash(f.TableName(), chainedFile{
+		HostID:        f.HostID,
+		HostName:      f.HostName,
+		ContainerID:   f.ContainerID,
+		ContainerName: f.ContainerName,
+		FilePath:      f.FilePath,
+		Dataset:       f.Dataset,
+	})
+}
+
+// ComputeChainHash 计算 socket 插入时的哈希
+func (s Socket) ComputeChainHash() string {
+	return chainHash(s.TableName(), chainedSocket{
+		HostID:        s.HostID,
+		HostName:      s.HostName,
+		ContainerID:   s.ContainerID,
+		ContainerName: s.ContainerName,
+		DstIP:         s.DstIP,
+		DstPort:       s.DstPort,
+		Dataset:       s.Dataset,
+	})
+}
+
+// LinkHash 流量关联为 table 中主键为 id 的边补全的 uuid 的哈希
+func LinkHash(table string, id int, uuid string) string {
+	return chainHash(table+"\x00"+LedgerLink, struct {
+		ID   int    `json:"id"`
+		UUID string `json:"uuid"`
+	}{id, uuid})
+}
+
+// LedgerDigest 一批记录的哈希按主键顺序拼接后的 sha256
+func LedgerDigest(hashes []string) string {
+	h := sha256.New()
+	for _, hash := range hashes {
+		h.Write([]byte(hash))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// EncodeIDs 将主键排序去重后编码为区间列表，如 1-500,503
+func EncodeIDs(ids []int) string {
+	sorted := append([]int(nil), ids...)
+	sort.Ints(sorted)
+	var parts []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] <= sorted[j]+1 {
+			j++
+		}
+		if sorted[i] == sorted[j] {
+			parts = append(parts, strconv.Itoa(sorted[i]))
+		} else {
+			parts = append(parts, strconv.Itoa(sorted[i])+"-"+strconv.Itoa(sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// DecodeIDs 解析 EncodeIDs 生成的区间列表，返回升序的主键
+func DecodeIDs(s string) ([]int, error) {
+	var ids []int
+	if s == "" {
+		return ids, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		lo, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid id range %q", part)
+		}
+		hi := lo
+		if len(bounds) == 2 {
+			if hi, err = strconv.Atoi(bounds[1]); err != nil || hi < lo {
+				return nil, fmt.Errorf("invalid id range %q", part)
+			}
+		}
+		for id := lo; id <= hi; id++ {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodeIDs(t *testing.T) {
+	cases := []struct {
+		ids     []int
+		encoded string
+		decoded []int
+	}{
+		{nil, "", nil},
+		{[]int{7}, "7", []int{7}},
+		{[]int{1, 2, 3}, "1-3", []int{1, 2, 3}},
+		{[]int{5, 1, 3, 2}, "1-3,5", []int{1, 2, 3, 5}},
+		{[]int{4, 4, 5, 9, 9}, "4-5,9", []int{4, 5, 9}},
+		{[]int{1, 3, 5}, "1,3,5", []int{1, 3, 5}},
+		{[]int{10, 11, 12, 20, 21, 30}, "10-12,20-21,30", []int{10, 11, 12, 20, 21, 30}},
+	}
+	for _, c := range cases {
+		encoded := EncodeIDs(c.ids)
+		if encoded != c.encoded {
+			t.Errorf("EncodeIDs(%v) = %q, want %q", c.ids, encoded, c.encoded)
+		}
+		decoded, err := DecodeIDs(encoded)
+		if err != nil {
+			t.Errorf("DecodeIDs(%q): %v", encoded, err)
+			continue
+		}
+		if len(decoded) == 0 && len(c.decoded) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(decoded, c.decoded) {
+			t.Errorf("DecodeIDs(%q) = %v, want %v", encoded, decoded, c.decoded)
+		}
+	}
+}
+
+func TestDecodeIDsInvalid(t *testing.T) {
+	for _, s := range []string{"a", "1-", "-1", "3-1", "1,,2", "1-2-3"} {
+		if ids, err := DecodeIDs(s); err == nil {
+			t.Errorf("DecodeIDs(%q) = %v, want error", s, ids)
+		}
+	}
+}
@@ -7,16 +7,22 @@ import (
 )
 
 type Net struct {
-	ID         int    `gorm:"primaryKey;column:id"`
-	SrcID      int    `gorm:"column:src_id"`
-	DstID      int    `gorm:"column:dst_id"`
-	Method     string `gorm:"column:method"`
-	Payload    string `gorm:"column:payload"`
-	PayloadLen int    `gorm:"column:payload_len"`
-	SeqNum     int    `gorm:"column:seq_num"`
-	AckNum     int    `gorm:"column:ack_num"`
-	Time       int64  `gorm:"column:time"`
-	UUID       string `gorm:"column:uuid"`
+	ID         int     `gorm:"primaryKey;column:id"`
+	SrcID      int     `gorm:"column:src_id"`
+	DstID      int     `gorm:"column:dst_id"`
+	Method     string  `gorm:"column:method"`
+	Payload    string  `gorm:"column:payload"`
+	PayloadLen int     `gorm:"column:payload_len"`
+	SeqNum     int     `gorm:"column:seq_num"`
+	AckNum     int     `gorm:"column:ack_num"`
+	Time       int64   `gorm:"column:time"`
+	UUID       string  `gorm:"column:uuid"`
+	DedupKey   *string `gorm:"column:dedup_key"` // 去重键，含义同 Event.DedupKey
+	Dataset    string  `gorm:"column:dataset"`
+	RawSegment string  `gorm:"column:raw_segment"` // 原始日志的位置，含义同 Event.RawSegment
+	RawOffset  int64   `gorm:"column:raw_offset"`
+	RawLength  int     `gorm:"column:raw_length"`
+	ChainHash  string  `gorm:"column:chain_hash"` // 含义同 Event.ChainHash
 }
 
 func (Net) TableName() string {
@@ -2,9 +2,7 @@ package models
 
 import (
 	"erinyes/helper"
-	"erinyes/logs"
 	"fmt"
-	"gorm.io/gorm"
 )
 
 type Process struct {
@@ -16,25 +14,14 @@ type Process struct {
 	ProcessVPID    string `gorm:"column:process_vpid"`
 	ProcessName    string `gorm:"column:process_name"`
 	ProcessExepath string `gorm:"column:process_exe_path"`
+	Dataset        string `gorm:"column:dataset"`    // 所属的数据集
+	ChainHash      string `gorm:"column:chain_hash"` // 插入时的哈希，开启 Ledger 时写入，见 ComputeChainHash
 }
 
 func (Process) TableName() string {
 	return "process"
 }
 
-func (p *Process) FindByID(db *gorm.DB, id int) bool {
-	err := db.First(p, id).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			logs.Logger.Errorf("can't find process by id = %d", id)
-		} else {
-			logs.Logger.Errorf("query process by id = %d failed: %w", id, err)
-		}
-		return false
-	}
-	return true
-}
-
 // VertexClusterID 实现点的接口，返回dot文件中点的唯一标识
 func (p Process) VertexClusterID() string {
 	return helper.AddQuotation("cluster" + p.HostID + "_" + p.ContainerID)
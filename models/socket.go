@@ -3,9 +3,7 @@ package models
 import (
 	"erinyes/conf"
 	"erinyes/helper"
-	"erinyes/logs"
 	"fmt"
-	"gorm.io/gorm"
 )
 
 type Socket struct {
@@ -16,25 +14,14 @@ type Socket struct {
 	ContainerName string `gorm:"column:container_name"`
 	DstIP         string `gorm:"column:dst_ip"`
 	DstPort       string `gorm:"column:dst_port"`
+	Dataset       string `gorm:"column:dataset"`
+	ChainHash     string `gorm:"column:chain_hash"` // 含义同 Process.ChainHash
 }
 
 func (Socket) TableName() string {
 	return "socket"
 }
 
-func (s *Socket) FindByID(db *gorm.DB, id int) bool {
-	err := db.First(s, id).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			logs.Logger.Errorf("can't find socket by id = %d", id)
-		} else {
-			logs.Logger.Errorf("query socket by id = %d failed: %w", id, err)
-		}
-		return false
-	}
-	return true
-}
-
 // VertexClusterID 实现点的接口，返回dot文件中点的唯一标识
 func (s Socket) VertexClusterID() string {
 	return helper.AddQuotation("cluster" + s.HostID + "_" + s.ContainerID)
@@ -0,0 +1,20 @@
+package models
+
+const (
+	UUIDSourceCDM   = "cdm"   // DARPA TC CDM 记录
+	UUIDSourceSPADE = "spade" // SPADE 的 JSON 输出
+)
+
+// UUIDMap 外部数据集中顶点的标识符与顶点主键的对应关系，多个标识符可以对应同一个顶点
+type UUIDMap struct {
+	ID          int    `gorm:"primaryKey;column:id"`
+	Dataset     string `gorm:"column:dataset"`
+	Source      string `gorm:"column:source"` // UUIDSourceCDM 或 UUIDSourceSPADE
+	UUID        string `gorm:"column:uuid"`
+	VertexTable string `gorm:"column:vertex_table"` // 顶点所在的表：process、file 或 socket
+	VertexID    int    `gorm:"column:vertex_id"`
+}
+
+func (UUIDMap) TableName() string {
+	return "uuid_map"
+}
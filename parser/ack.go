@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"erinyes/conf"
+	"erinyes/logs"
+	"sync"
+	"time"
+)
+
+// lineAck 一行原始日志的确认状态
+type lineAck struct {
+	seq    uint64
+	ack    func()
+	refs   int  // 尚未插入的 ParsedLog 数，解析过程中额外持有 1
+	pinned bool // 设置了解析器状态，状态失效前不确认
+}
+
+// pinEntry 按设置顺序记录的状态，键已被重新设置或清除时过期
+type pinEntry struct {
+	key  string
+	line *lineAck
+	at   time.Time
+}
+
+// retiredLine 状态已经失效的日志，序号不大于 barrier 的日志都完成后确认
+type retiredLine struct {
+	line    *lineAck
+	barrier uint64
+}
+
+// ackTracker 跟踪一个解析器中每行日志的确认，保证持久化队列重放时能重建所有尚未插入的边
+// 一行日志产生的所有 ParsedLog 都插入后才算完成；设置了解析器状态（execve 的进入事件、请求的 uuid）的日志
+// 在状态被取代或消费、且之前的日志（其中可能有使用该状态的边）都完成后才确认
+// 永远不会结束的状态（没有退出事件的 execve、没有结束标记的请求）超过 ttl 或数量超过 maxPins 时按设置顺序淘汰，
+// 视为失效，避免提交偏移永远停在它们之前；重放时不再重建被淘汰的状态
+type ackTracker struct {
+	mu      sync.Mutex
+	next    uint64              // 下一行日志的序号
+	low     uint64              // 序号小于 low 的日志都已完成
+	done    map[uint64]bool     // 已完成、序号不小于 low 的日志
+	pins    map[string]*lineAck // 状态的键 -> 设置该状态的日志
+	order   []pinEntry          // 按设置顺序排列，包括已经过期的项
+	retired []retiredLine       // 按 barrier 排列
+	ttl     time.Duration       // 状态保留的最长时间，0 表示不限制
+	maxPins int                 // 保留的最大状态数，0 表示不限制
+	now     func() time.Time
+}
+
+func newAckTracker() *ackTracker {
+	return &ackTracker{
+		done:    make(map[uint64]bool),
+		pins:    make(map[string]*lineAck),
+		ttl:     time.Duration(conf.Config.Ingest.WAL.PinTTL) * time.Second,
+		maxPins: conf.Config.Ingest.WAL.MaxPins,
+		now:     time.Now,
+	}
+}
+
+// begin 开始解析一行日志，解析结束后调用 release
+func (t *ackTracker) begin(ack func()) *lineAck {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l := &lineAck{seq: t.next, ack: ack, refs: 1}
+	t.evict(l.seq)
+	t.next++
+	return l
+}
+
+// evict 淘汰超时或超出数量的状态，设置它们的日志在序号小于 seq 的日志都完成后确认
+func (t *ackTracker) evict(seq uint64) {
+	for len(t.order) > 0 {
+		e := t.order[0]
+		if t.pins[e.key] == e.line {
+			if !(t.ttl > 0 && t.now().Sub(e.at) > t.ttl) && !(t.maxPins > 0 && len(t.pins) > t.maxPins) {
+				break
+			}
+			logs.Logger.Warnf("parser state %s is held too long, stop pinning it in the ingest queue", e.key)
+			t.retired = append(t.retired, retiredLine{line: e.line, barrier: seq - 1})
+			delete(t.pins, e.key)
+		}
+		t.order = t.order[1:]
+	}
+	if len(t.order) > 2*len(t.pins)+64 { // 过期的项过多时压缩
+		order := make([]pinEntry, 0, len(t.pins))
+		for _, e := range t.order {
+			if t.pins[e.key] == e.line {
+				order = append(order, e)
+			}
+		}
+		t.order = order
+	}
+}
+
+// hold 该行日志产生了一个 ParsedLog，返回插入后调用的确认函数
+func (t *ackTracker) hold(l *lineAck) func() {
+	t.mu.Lock()
+	l.refs++
+	t.mu.Unlock()
+	var once sync.Once
+	return func() { once.Do(func() { t.release(l) }) }
+}
+
+// release 释放一个引用，引用全部释放后该行日志完成
+func (t *ackTracker) release(l *lineAck) {
+	t.mu.Lock()
+	var acks []func()
+	if l.refs--; l.refs == 0 {
+		t.done[l.seq] = true
+		for t.done[t.low] {
+			delete(t.done, t.low)
+			t.low++
+		}
+		if !l.pinned {
+			acks = append(acks, l.ack)
+		}
+		for len(t.retired) > 0 && t.retired[0].barrier < t.low {
+			acks = append(acks, t.retired[0].line.ack)
+			t.retired = t.retired[1:]
+		}
+	}
+	t.mu.Unlock()
+	for _, ack := range acks {
+		if ack != nil {
+			ack()
+		}
+	}
+}
+
+// pin 当前日志 l 设置了 key 对应的状态，之前设置该状态的日志失效
+func (t *ackTracker) pin(key string, l *lineAck) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if old, ok := t.pins[key]; ok && old != l {
+		t.retired = append(t.retired, retiredLine{line: old, barrier: l.seq})
+	}
+	l.pinned = true
+	t.pins[key] = l
+	t.order = append(t.order, pinEntry{key: key, line: l, at: t.now()})
+}
+
+// unpin 当前日志 l 清除或消费了 key 对应的状态，设置该状态的日志在 l 及之前的日志都完成后确认
+func (t *ackTracker) unpin(key string, l *lineAck) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if old, ok := t.pins[key]; ok {
+		t.retired = append(t.retired, retiredLine{line: old, barrier: l.seq})
+		delete(t.pins, key)
+	}
+}
@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"erinyes/logs"
+	"github.com/sirupsen/logrus"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestAckTrackerEvictsPins(t *testing.T) {
+	logs.Logger = logrus.New()
+	cases := []struct {
+		name    string
+		ttl     time.Duration
+		maxPins int
+		pins    []string // 每行日志设置的状态，为空表示不设置
+		elapsed time.Duration
+		acked   []int // 最后一行解析完成后已经确认的日志，按序号排列
+	}{
+		{
+			name:  "pinned lines are held without limits",
+			pins:  []string{"execve#1", "", "execve#2", ""},
+			acked: []int{1, 3},
+		},
+		{
+			name:    "pins older than ttl are evicted",
+			ttl:     time.Minute,
+			pins:    []string{"execve#1", "", "execve#2", ""},
+			elapsed: time.Hour,
+			acked:   []int{0, 1, 2, 3},
+		},
+		{
+			name:    "pins within ttl are kept",
+			ttl:     time.Minute,
+			pins:    []string{"execve#1", "", "execve#2", ""},
+			elapsed: time.Second,
+			acked:   []int{1, 3},
+		},
+		{
+			name:    "oldest pins are evicted over max pins",
+			maxPins: 1,
+			pins:    []string{"execve#1", "execve#2", "execve#3", ""},
+			acked:   []int{0, 1, 3},
+		},
+		{
+			name:    "replaced pin is not evicted twice",
+			maxPins: 1,
+			pins:    []string{"execve#1", "execve#1", "execve#1", ""},
+			acked:   []int{0, 1, 3},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			tr := newAckTracker()
+			tr.ttl, tr.maxPins, tr.now = c.ttl, c.maxPins, func() time.Time { return now }
+			var acked []int
+			for i, key := range c.pins {
+				if i == len(c.pins)-1 {
+					now = now.Add(c.elapsed)
+				}
+				i := i
+				l := tr.begin(func() { acked = append(acked, i) })
+				if key != "" {
+					tr.pin(key, l)
+				}
+				tr.release(l)
+			}
+			sort.Ints(acked)
+			if !reflect.DeepEqual(acked, c.acked) {
+				t.Fatalf("acked %v, want %v", acked, c.acked)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"erinyes/conf"
+	"erinyes/logs"
+	"erinyes/models"
+	"erinyes/store"
+	"sync"
+	"time"
+)
+
+var correlateMu sync.Mutex
+
+// Correlate 将当前数据集中 sysdig 套接字读写事件与流量日志中的同一次网络交互关联起来，返回本次新关联的数量
+// 两侧的四元组（按数据流动方向）与载荷长度必须一致，且时间差不超过 window（微秒）
+func Correlate(window int64) (int, error) {
+	return correlate(store.GetStore(), window, &correlateState{}, conf.Config.Correlation.Slack*1000000)
+}
+
+// correlateState 定期关联时一个数据集的进度，两次关联之间保留
+// 主键不大于 watermark 的 sysdig flow 已经关联或过期，不再扫描；主键不大于 tried 的 flow 至少尝试过一次，过期后不再重试
+type correlateState struct {
+	watermark int
+	tried     int
+}
+
+// correlate 从 state.watermark 之后扫描未关联的 sysdig flow
+// 两侧最新的 flow 都晚于 time + window + slack 时，流量日志中不会再出现对应的 flow，尝试过一次后视为过期
+func correlate(s store.Store, window int64, state *correlateState, slack int64) (int, error) {
+	correlateMu.Lock()
+	defer correlateMu.Unlock()
+	var horizon int64
+	for _, source := range []string{models.FlowSourceSysdig, models.FlowSourceCapture} {
+		latest, err := s.LatestFlowTime(source)
+		if err != nil {
+			return 0, err
+		}
+		if latest > horizon {
+			horizon = latest
+		}
+	}
+	horizon -= window + slack
+	linked := 0
+	lastID := state.watermark
+	settled := true // 扫描过的 flow 都已经关联或过期，watermark 可以前移
+	pageSize := 500
+	for {
+		flows, err := s.ScanUnlinkedFlows(models.FlowSourceSysdig, lastID, pageSize)
+		if err != nil {
+			return linked, err
+		}
+		if len(flows) == 0 {
+			break
+		}
+		for _, flow := range flows {
+			lastID = flow.ID
+			expired := flow.Time < horizon
+			if !expired || flow.ID > state.tried {
+				ok, err := linkFlow(s, flow, window)
+				if err != nil {
+					logs.Logger.WithError(err).Errorf("failed to correlate flow %d(%s)", flow.ID, flow.Tuple())
+					expired = false // 出错的 flow 下次重试
+				} else if ok {
+					linked++
+					expired = true
+				}
+			}
+			if settled = settled && expired; settled {
+				state.watermark = flow.ID
+			}
+		}
+	}
+	if lastID > state.tried {
+		state.tried = lastID
+	}
+	logs.Logger.Infof("Correlate %d sysdig flows with captured flows in dataset %s", linked, s.Dataset())
+	return linked, nil
+}
+
+// linkFlow 为一条 sysdig 侧的 flow 寻找时间最接近的流量侧 flow，并互相记录对方主键
+func linkFlow(s store.Store, flow models.Flow, window int64) (bool, error) {
+	peer, err := s.FindPeerFlow(flow, window)
+	if err != nil || peer == nil {
+		return false, err
+	}
+	// sysdig 事件缺少请求 uuid 时，使用流量日志中解析出的 uuid 补全
+	return s.LinkFlows(flow, *peer, captureUUID(s, *peer))
+}
+
+// captureUUID 查询流量侧边上记录的请求 uuid
+func captureUUID(s store.Store, peer models.Flow) string {
+	uuid := ""
+	if peer.EdgeTable == (models.Net{}).TableName() {
+		if net, err := s.GetNet(peer.EdgeID); err == nil {
+			uuid = net.UUID
+		}
+	} else {
+		if event, err := s.GetEvent(peer.EdgeID); err == nil {
+			uuid = event.UUID
+		}
+	}
+	if uuid == UNKNOWN {
+		return ""
+	}
+	return uuid
+}
+
+// CorrelateLoop 服务模式下定期关联所有数据集，存储不支持列出数据集时只关联当前数据集
+func CorrelateLoop(interval time.Duration, window int64) {
+	states := make(map[string]*correlateState)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s := store.GetStore()
+		datasets := []string{s.Dataset()}
+		if manager, ok := s.(store.DatasetManager); ok {
+			infos, err := manager.ListDatasets()
+			if err != nil {
+				logs.Logger.WithError(err).Errorf("list datasets failed")
+				continue
+			}
+			datasets = datasets[:0]
+			for _, info := range infos {
+				if info.Flows > 0 {
+					datasets = append(datasets, info.Name)
+				}
+			}
+		}
+		for _, dataset := range datasets {
+			state, ok := states[dataset]
+			if !ok {
+				state = &correlateState{}
+				states[dataset] = state
+			}
+			if _, err := correlate(s.WithDataset(dataset), window, state, conf.Config.Correlation.Slack*1000000); err != nil {
+				logs.Logger.WithError(err).Errorf("correlate flows in dataset %s failed", dataset)
+			}
+		}
+	}
+}
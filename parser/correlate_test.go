@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"erinyes/logs"
+	"erinyes/models"
+	"erinyes/store"
+	"github.com/sirupsen/logrus"
+	"testing"
+)
+
+// countingStore 统计为 sysdig flow 查找对端的次数
+type countingStore struct {
+	store.Store
+	finds int
+}
+
+func (s *countingStore) FindPeerFlow(flow models.Flow, window int64) (*models.Flow, error) {
+	s.finds++
+	return s.Store.FindPeerFlow(flow, window)
+}
+
+func TestCorrelateWatermark(t *testing.T) {
+	logs.Logger = logrus.New()
+	logs.Logger.SetLevel(logrus.WarnLevel)
+	mem, err := store.OpenMemory("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &countingStore{Store: mem}
+	const window, slack = 100, 1000
+	sysdig := func(id int, time int64) *models.Flow {
+		return &models.Flow{EdgeTable: "event", EdgeID: id, Source: models.FlowSourceSysdig, SrcIP: "a", SrcPort: "1", DstIP: "b", DstPort: "2", PayloadLen: id, Time: time}
+	}
+	capture := func(id int, time int64) *models.Flow {
+		return &models.Flow{EdgeTable: "net", EdgeID: id, Source: models.FlowSourceCapture, SrcIP: "a", SrcPort: "1", DstIP: "b", DstPort: "2", PayloadLen: id, Time: time}
+	}
+	state := &correlateState{}
+	steps := []struct {
+		name   string
+		flows  []*models.Flow
+		linked int
+		finds  int
+	}{
+		// flow 1 没有对端且已经过期，flow 2 的对端还没有到达
+		{"first pass tries every flow", []*models.Flow{sysdig(1, 1000), sysdig(2, 10000)}, 0, 2},
+		{"late peer is linked", []*models.Flow{capture(2, 10050)}, 1, 1},
+		{"new flows are tried", []*models.Flow{sysdig(3, 20000), sysdig(4, 20010)}, 0, 2},
+		{"unexpired flows are retried", nil, 0, 2},
+		{"expired flows are not retried", []*models.Flow{capture(9, 30000)}, 0, 0},
+		{"nothing left to scan", nil, 0, 0},
+	}
+	for _, step := range steps {
+		if err := s.InsertFlows(step.flows); err != nil {
+			t.Fatal(err)
+		}
+		s.finds = 0
+		linked, err := correlate(s, window, state, slack)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked != step.linked || s.finds != step.finds {
+			t.Fatalf("%s: linked %d with %d lookups, want %d with %d", step.name, linked, s.finds, step.linked, step.finds)
+		}
+	}
+	if state.watermark != 5 { // 主键 3 为流量侧 flow
+		t.Fatalf("watermark %d, want 5", state.watermark)
+	}
+}
@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	EventVertexProcess = "process"
+	EventVertexFile    = "file"
+	EventVertexSocket  = "socket"
+)
+
+// EventVertex 结构化事件中的顶点，ContainerID 为空表示外部的 socket
+type EventVertex struct {
+	Type           string `json:"type"` // process、file 或 socket
+	ContainerID    string `json:"container_id,omitempty"`
+	ContainerName  string `json:"container_name,omitempty"`
+	ProcessVPID    string `json:"process_vpid,omitempty"`
+	ProcessName    string `json:"process_name,omitempty"`
+	ProcessExepath string `json:"process_exe_path,omitempty"`
+	FilePath       string `json:"file_path,omitempty"`
+	IP             string `json:"ip,omitempty"`
+	Port           string `json:"port,omitempty"`
+}
+
+// StructuredEvent 上报方已经解析好的一条边，事件类型由两端顶点的类型决定
+type StructuredEvent struct {
+	Src        EventVertex `json:"src"`
+	Dst        EventVertex `json:"dst"`
+	Relation   string      `json:"relation"` // 系统调用或 HTTP 方法
+	Time       int64       `json:"time"`     // 16位，微秒级别
+	UUID       string      `json:"uuid,omitempty"`
+	PayloadLen int         `json:"payload_len,omitempty"`
+	SeqNum     int         `json:"seq_num,omitempty"`
+	AckNum     int         `json:"ack_num,omitempty"`
+	Pid        string      `json:"pid,omitempty"` // 以下为可选的系统调用属性，仅 event 边保存
+	Tid        string      `json:"tid,omitempty"`
+	Ret        string      `json:"ret,omitempty"`
+	Bytes      int64       `json:"bytes,omitempty"`
+	Args       []string    `json:"args,omitempty"`
+}
+
+func (v EventVertex) validate() error {
+	switch v.Type {
+	case EventVertexProcess:
+		if v.ContainerID == "" || v.ProcessVPID == "" || v.ProcessName == "" {
+			return fmt.Errorf("process vertex needs container_id, process_vpid and process_name")
+		}
+	case EventVertexFile:
+		if v.ContainerID == "" || v.FilePath == "" {
+			return fmt.Errorf("file vertex needs container_id and file_path")
+		}
+	case EventVertexSocket:
+		if v.IP == "" || v.Port == "" {
+			return fmt.Errorf("socket vertex needs ip and port")
+		}
+	default:
+		return fmt.Errorf("unknown vertex type %q", v.Type)
+	}
+	return nil
+}
+
+// EventClass 根据两端顶点类型推断事件类型，socket -> socket 返回 NETTYPE
+func (e StructuredEvent) EventClass() (string, error) {
+	switch e.Src.Type + "->" + e.Dst.Type {
+	case EventVertexProcess + "->" + EventVertexProcess:
+		return PROCESS, nil
+	case EventVertexProcess + "->" + EventVertexFile:
+		return FILEV1, nil
+	case EventVertexFile + "->" + EventVertexProcess:
+		return FILEV2, nil
+	case EventVertexProcess + "->" + EventVertexSocket:
+		return NETWORKV1, nil
+	case EventVertexSocket + "->" + EventVertexProcess:
+		return NETWORKV2, nil
+	case EventVertexSocket + "->" + EventVertexSocket:
+		return NETTYPE, nil
+	}
+	return "", fmt.Errorf("unsupported edge %s -> %s", e.Src.Type, e.Dst.Type)
+}
+
+func (e StructuredEvent) Validate() error {
+	if err := e.Src.validate(); err != nil {
+		return fmt.Errorf("src: %w", err)
+	}
+	if err := e.Dst.validate(); err != nil {
+		return fmt.Errorf("dst: %w", err)
+	}
+	if e.Relation == "" || e.Time <= 0 {
+		return fmt.Errorf("relation and time are required")
+	}
+	_, err := e.EventClass()
+	return err
+}
+
+// ValidateEventLine 在结构化事件入队前检查其格式
+func ValidateEventLine(rawLine string) error {
+	var event StructuredEvent
+	if err := json.Unmarshal([]byte(rawLine), &event); err != nil {
+		return err
+	}
+	return event.Validate()
+}
@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"encoding/json"
+	"erinyes/conf"
+)
+
+// EventParser 解析上报方已经解析好的结构化事件（json 编码的 StructuredEvent）
+type EventParser struct {
+	pusher *Pusher
+	host   Host // 当前正在解析的事件所属主机
+}
+
+func NewEventParser(pusher *Pusher) *EventParser {
+	return &EventParser{
+		pusher: pusher,
+	}
+}
+
+func (p *EventParser) ParserType() string {
+	return EVENT
+}
+
+// ParsePushRawLog 实现 parser 的接口
+func (p *EventParser) ParsePushRawLog(rawLog RawLog) error {
+	p.host = rawLog.Host
+	defer func() { p.host = Host{} }()
+	return p.pusher.pushRawLog(p, rawLog)
+}
+
+// ParsePushLine 实现 parser 的接口
+func (p *EventParser) ParsePushLine(rawLine string) error {
+	p.pusher.raw = rawLine
+	var event StructuredEvent
+	if err := json.Unmarshal([]byte(rawLine), &event); err != nil {
+		return err
+	}
+	if err := event.Validate(); err != nil {
+		return err
+	}
+	eventClass, _ := event.EventClass()
+	pl := ParsedLog{
+		StartVertex: p.convertVertex(event.Src),
+		EndVertex:   p.convertVertex(event.Dst),
+	}
+	if eventClass == NETTYPE {
+		pl.Log = ParsedNetLog{
+			Method:     event.Relation,
+			PayloadLen: event.PayloadLen,
+			SeqNum:     event.SeqNum,
+			AckNum:     event.AckNum,
+			Time:       event.Time,
+			UUID:       event.UUID,
+		}
+	} else {
+		uuid := event.UUID
+		if uuid == "" {
+			uuid = UNKNOWN
+		}
+		pl.Log = ParsedSysdigLog{
+			EventCLass: eventClass,
+			Relation:   event.Relation,
+			Operation:  event.Relation,
+			Time:       event.Time,
+			UUID:       uuid,
+			Pid:        event.Pid,
+			Tid:        event.Tid,
+			Ret:        event.Ret,
+			Bytes:      event.Bytes,
+			Args:       event.Args,
+		}
+	}
+	return p.pusher.PushParsedLog(pl)
+}
+
+// convertVertex 将结构化事件中的顶点转换为 ParsedVertex，ContainerID 为空的 socket 属于外部
+func (p *EventParser) convertVertex(v EventVertex) ParsedVertex {
+	hostID, hostName := conf.MockHostID, conf.MockHostName
+	if p.host.ID != "" {
+		hostID, hostName = p.host.ID, p.host.Name
+	}
+	switch v.Type {
+	case EventVertexProcess:
+		return ProcessVertex{
+			HostID:         hostID,
+			HostName:       hostName,
+			ContainerID:    v.ContainerID,
+			ContainerName:  v.ContainerName,
+			ProcessVPID:    v.ProcessVPID,
+			ProcessName:    v.ProcessName,
+			ProcessExepath: v.ProcessExepath,
+		}
+	case EventVertexFile:
+		return FileVertex{
+			HostID:        hostID,
+			HostName:      hostName,
+			ContainerID:   v.ContainerID,
+			ContainerName: v.ContainerName,
+			FilePath:      v.FilePath,
+		}
+	}
+	if v.ContainerID == "" {
+		return SocketVertex{
+			HostID:        conf.MockHostID,
+			HostName:      conf.MockHostName,
+			ContainerID:   conf.OuterContainerID,
+			ContainerName: conf.OuterContainerName,
+			DstIP:         v.IP,
+			DstPort:       v.Port,
+		}
+	}
+	return SocketVertex{
+		HostID:        hostID,
+		HostName:      hostName,
+		ContainerID:   v.ContainerID,
+		ContainerName: v.ContainerName,
+		DstIP:         v.IP,
+		DstPort:       v.Port,
+	}
+}
@@ -1,21 +1,25 @@
 package parser
 
 import (
+	"erinyes/archive"
+	"erinyes/conf"
 	"erinyes/logs"
 	"erinyes/models"
+	"erinyes/store"
 	"fmt"
-	"gorm.io/gorm"
+	"sync"
+	"time"
 )
 
 type Inserter struct {
 	ParsedLogCh *chan ParsedLog
 }
 
-// InsertOrQueryVertex 根据顶点类型插入相应 table 中，返回 id
-func (pi *Inserter) InsertOrQueryVertex(db *gorm.DB, vertexI ParsedVertex, count *int) (int, error) {
+// vertexPO 将顶点转换为 dataset 中对应 table 的记录，返回其在顶点缓存中的唯一键
+func vertexPO(vertexI ParsedVertex, dataset string) (string, interface{}, error) {
 	if vertexI.VertexType() == PROCESSTYPE {
 		vertex := vertexI.(ProcessVertex)
-		processPO := models.Process{
+		processPO := &models.Process{
 			HostID:         vertex.HostID,
 			HostName:       vertex.HostName,
 			ContainerID:    vertex.ContainerID,
@@ -23,154 +27,453 @@ func (pi *Inserter) InsertOrQueryVertex(db *gorm.DB, vertexI ParsedVertex, count
 			ProcessVPID:    vertex.ProcessVPID,
 			ProcessName:    vertex.ProcessName,
 			ProcessExepath: vertex.ProcessExepath,
+			Dataset:        dataset,
 		}
-		result := db.Create(&processPO)
-		if result.Error != nil { // 违反唯一约束，说明已经存在该顶点，直接查询即可
-			r := db.Where("container_id = ? AND host_id = ? AND process_vpid = ? AND process_name = ?", vertex.ContainerID, vertex.HostID, vertex.ProcessVPID, vertex.ProcessName).First(&processPO)
-			if r.Error != nil {
-				return 0, r.Error
-			}
-		} else {
-			*count++
-		}
-		return processPO.ID, nil
+		key := PROCESSTYPE + "\x00" + dataset + "\x00" + processPO.HostID + "\x00" + processPO.ContainerID + "\x00" + processPO.ProcessVPID + "\x00" + processPO.ProcessName
+		return key, processPO, nil
 	} else if vertexI.VertexType() == FILETYPE {
 		vertex := vertexI.(FileVertex)
-		filePO := models.File{
+		filePO := &models.File{
 			HostID:        vertex.HostID,
 			HostName:      vertex.HostName,
 			ContainerID:   vertex.ContainerID,
 			ContainerName: vertex.ContainerName,
 			FilePath:      vertex.FilePath,
+			Dataset:       dataset,
 		}
-		//logs.Logger.Infof("fileP0: %s", filePO.FilePath)
-		result := db.Create(&filePO)
-		if result.Error != nil { // 违反唯一约束，说明已经存在该顶点，直接查询即可
-			r := db.Where("container_id = ? AND host_id = ? AND file_path = ?", vertex.ContainerID, vertex.HostID, vertex.FilePath).First(&filePO)
-			if r.Error != nil {
-				return 0, r.Error
-			}
-		} else {
-			*count++
-		}
-		return filePO.ID, nil
+		key := FILETYPE + "\x00" + dataset + "\x00" + filePO.HostID + "\x00" + filePO.ContainerID + "\x00" + filePO.FilePath
+		return key, filePO, nil
 	} else if vertexI.VertexType() == SOCKETTYPE {
 		vertex := vertexI.(SocketVertex)
 		// 关联HostIP 和 Cin0IP
-		socketPO := models.Socket{
+		socketPO := &models.Socket{
 			HostID:        vertex.HostID,
 			HostName:      vertex.HostName,
 			ContainerID:   vertex.ContainerID,
 			ContainerName: vertex.ContainerName,
 			DstIP:         vertex.DstIP,
 			DstPort:       vertex.DstPort,
+			Dataset:       dataset,
 		}
 		socketPO.RelateHostAndCin()
 		socketPO.UnionGateway()
-		result := db.Create(&socketPO)
-		if result.Error != nil { // 违反唯一约束，说明已经存在该顶点，直接查询即可
-			r := db.Where("container_id = ? AND host_id = ? AND dst_ip = ? AND dst_port = ?", socketPO.ContainerID, socketPO.HostID, socketPO.DstIP, socketPO.DstPort).First(&socketPO)
-			if r.Error != nil {
-				return 0, r.Error
+		key := SOCKETTYPE + "\x00" + dataset + "\x00" + socketPO.HostID + "\x00" + socketPO.ContainerID + "\x00" + socketPO.DstIP + "\x00" + socketPO.DstPort
+		return key, socketPO, nil
+	}
+	return "", nil, fmt.Errorf("unknown vertex type: %s", vertexI.VertexType())
+}
+
+// resolveVertices 查询一批日志中所有顶点的主键，缓存未命中的顶点按类型批量 upsert 后写入缓存
+// 日志没有指定数据集时顶点属于存储当前的数据集
+// 返回每条日志起点、终点的唯一键（顶点无效时为空）和唯一键到主键的映射
+func (pi *Inserter) resolveVertices(s store.Store, batch []ParsedLog, count *int) ([][2]string, map[string]int, error) {
+	cache := vertexIDCache()
+	keys := make([][2]string, len(batch))
+	ids := make(map[string]int)
+	var (
+		processes             []*models.Process
+		files                 []*models.File
+		sockets               []*models.Socket
+		processKeys, fileKeys []string
+		socketKeys            []string
+	)
+	for i, parsedLog := range batch {
+		for j, vertexI := range []ParsedVertex{parsedLog.StartVertex, parsedLog.EndVertex} {
+			key, po, err := vertexPO(vertexI, datasetOf(s, parsedLog))
+			if err != nil {
+				logs.Logger.WithError(err).Errorf("Insert or query vertex failed")
+				continue
 			}
-		} else {
-			*count++
+			keys[i][j] = key
+			if _, ok := ids[key]; ok {
+				continue
+			}
+			if id, ok := cache.get(key); ok {
+				ids[key] = id
+				continue
+			}
+			ids[key] = 0 // 等待批量 upsert 后回填
+			switch po := po.(type) {
+			case *models.Process:
+				processes, processKeys = append(processes, po), append(processKeys, key)
+			case *models.File:
+				files, fileKeys = append(files, po), append(fileKeys, key)
+			case *models.Socket:
+				sockets, socketKeys = append(sockets, po), append(socketKeys, key)
+			}
+		}
+	}
+
+	if len(processes) > 0 {
+		created, err := s.UpsertProcesses(processes)
+		if err != nil {
+			return nil, nil, err
+		}
+		*count += created
+		for i, p := range processes {
+			ids[processKeys[i]] = p.ID
+			cache.put(processKeys[i], p.ID)
+		}
+	}
+	if len(files) > 0 {
+		created, err := s.UpsertFiles(files)
+		if err != nil {
+			return nil, nil, err
+		}
+		*count += created
+		for i, f := range files {
+			ids[fileKeys[i]] = f.ID
+			cache.put(fileKeys[i], f.ID)
+		}
+	}
+	if len(sockets) > 0 {
+		created, err := s.UpsertSockets(sockets)
+		if err != nil {
+			return nil, nil, err
+		}
+		*count += created
+		for i, so := range sockets {
+			ids[socketKeys[i]] = so.ID
+			cache.put(socketKeys[i], so.ID)
 		}
-		return socketPO.ID, nil
 	}
-	return 0, fmt.Errorf("unknown vertex type: %s", vertexI.VertexType())
+	return keys, ids, nil
 }
 
-// InsertEdge 插入边
-func (pi *Inserter) InsertEdge(db *gorm.DB, edgeI ParsedEdge, startID int, endID int, count *int, repeat bool) {
-	if edgeI.LogType() == SYSDIGTYPE {
-		sysdigEdge := edgeI.(ParsedSysdigLog)
-		if !repeat { // 不可以重复
-			models.Mu.Lock()
-			defer models.Mu.Unlock()
-			// 先判断是否已经存在重复边，考虑并发场景下，必须加锁再判断
-			var existSysdigPO models.Event
-			result := db.Where("src_id = ? AND dst_id = ? AND event_class = ? AND operation = ? AND uuid = ?", startID, endID, sysdigEdge.EventCLass, sysdigEdge.Operation, sysdigEdge.UUID).First(&existSysdigPO)
-			if result.Error == nil { // 存在该记录 不需要插入
-				return
+// datasetOf 日志写入的数据集
+func datasetOf(s store.Store, parsedLog ParsedLog) string {
+	if parsedLog.Dataset != "" {
+		return parsedLog.Dataset
+	}
+	return s.Dataset()
+}
+
+// flowPO 记录网络边的四元组，供 Correlate 关联 sysdig 事件与流量日志
+func flowPO(flow *FlowTuple, edgeTable string, edgeID int, time int64, dataset string) *models.Flow {
+	po := &models.Flow{
+		Dataset:    dataset,
+		EdgeTable:  edgeTable,
+		EdgeID:     edgeID,
+		Source:     flow.Source,
+		SrcIP:      flow.SrcIP,
+		SrcPort:    flow.SrcPort,
+		DstIP:      flow.DstIP,
+		DstPort:    flow.DstPort,
+		PayloadLen: flow.PayloadLen,
+		Time:       time,
+	}
+	if flow.Source == models.FlowSourceCapture { // sysdig 一侧的 method 在关联成功后填充
+		po.Method = flow.Method
+	}
+	return po
+}
+
+var (
+	logArchive     *archive.Archive
+	logArchiveOnce sync.Once
+)
+
+// rawArchive 返回全局的原始日志归档，未启用 conf.Config.Archive.Enable 或打开失败时为 nil
+func rawArchive() *archive.Archive {
+	logArchiveOnce.Do(func() {
+		if !conf.Config.Archive.Enable {
+			return
+		}
+		a, err := archive.Open(conf.Config.Archive.Dir)
+		if err != nil {
+			logs.Logger.WithError(err).Errorf("打开原始日志归档 %s 失败，不再记录边的原始日志", conf.Config.Archive.Dir)
+			return
+		}
+		logArchive = a
+	})
+	return logArchive
+}
+
+// archiveRaw 将一批日志的原始日志写入一个分段，返回每条日志的位置；同一行日志产生的多条边共享一个位置
+// 分段在边插入之前落盘，边上记录的位置总是可以读取
+func archiveRaw(batch []ParsedLog) ([]archive.Ref, error) {
+	refs := make([]archive.Ref, len(batch))
+	a := rawArchive()
+	if a == nil {
+		return refs, nil
+	}
+	var lines []string
+	index := make([]int, len(batch))
+	seen := make(map[string]int)
+	for i, parsedLog := range batch {
+		if parsedLog.Raw == "" {
+			index[i] = -1
+			continue
+		}
+		j, ok := seen[parsedLog.Raw]
+		if !ok {
+			j = len(lines)
+			seen[parsedLog.Raw] = j
+			lines = append(lines, parsedLog.Raw)
+		}
+		index[i] = j
+	}
+	if len(lines) == 0 {
+		return refs, nil
+	}
+	written, err := a.Write(lines)
+	if err != nil {
+		return refs, err
+	}
+	for i, j := range index {
+		if j >= 0 {
+			refs[i] = written[j]
+		}
+	}
+	return refs, nil
+}
+
+// retryWrite 执行一次写入，失败时按指数退避重试 conf.Config.Inserter.Retries 次，返回最后一次的错误
+// 每次写入失败时不会留下任何记录（见 store.Store），重试不会重复写入
+func retryWrite(goroutine int, what string, write func() error) error {
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := write()
+		if err == nil || attempt >= conf.Config.Inserter.Retries {
+			return err
+		}
+		logs.Logger.WithError(err).Warnf("[Inserter goroutine %d] %s失败，%v 后第 %d 次重试", goroutine, what, backoff, attempt+1)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > 5*time.Second {
+			backoff = 5 * time.Second
+		}
+	}
+}
+
+// insertBatch 插入一批 ParsedLog：先批量解析顶点主键，再批量插入边和对应的 flow
+// 任何一步重试后仍然失败时返回错误，这批日志不能确认；之前已经写入的边在重放时由去重跳过（允许重复时会重复插入）
+func (pi *Inserter) insertBatch(s store.Store, goroutine int, batch []ParsedLog, edgeCnt *int, vertexCnt *int, reducedCnt *int, repeat bool) error {
+	purgeMu.RLock()
+	defer purgeMu.RUnlock()
+	var (
+		keys [][2]string
+		ids  map[string]int
+	)
+	err := retryWrite(goroutine, "写入顶点", func() error {
+		var err error
+		keys, ids, err = pi.resolveVertices(s, batch, vertexCnt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("insert or query vertex failed: %w", err)
+	}
+	refs, err := archiveRaw(batch)
+	if err != nil { // 归档失败不影响插入，只是这批边没有原始日志
+		logs.Logger.WithError(err).Errorf("[Inserter goroutine %d] 归档原始日志失败", goroutine)
+	}
+
+	var (
+		events     []*models.Event
+		nets       []*models.Net
+		eventFlows []*FlowTuple
+		netFlows   []*FlowTuple
+		eventEnds  [][2]string
+	)
+	for i, parsedLog := range batch {
+		startID, endID := ids[keys[i][0]], ids[keys[i][1]]
+		if startID == 0 || endID == 0 {
+			continue
+		}
+		if parsedLog.Log.LogType() == SYSDIGTYPE {
+			sysdigEdge := parsedLog.Log.(ParsedSysdigLog)
+			var args []byte
+			if conf.Config.Inserter.KeepArgs {
+				if args, err = models.EncodeArgs(sysdigEdge.Args); err != nil {
+					logs.Logger.WithError(err).Warnf("[Inserter goroutine %d] 压缩事件参数失败", goroutine)
+				}
 			}
+			events = append(events, &models.Event{
+				SrcID:      startID,
+				DstID:      endID,
+				EventClass: sysdigEdge.EventCLass,
+				Relation:   sysdigEdge.Relation,
+				Operation:  sysdigEdge.Operation,
+				Time:       sysdigEdge.Time,
+				EndTime:    sysdigEdge.Time,
+				Count:      1,
+				UUID:       sysdigEdge.UUID,
+				Pid:        sysdigEdge.Pid,
+				Tid:        sysdigEdge.Tid,
+				Ret:        sysdigEdge.Ret,
+				Bytes:      sysdigEdge.Bytes,
+				Args:       args,
+				Dataset:    datasetOf(s, parsedLog),
+				RawSegment: refs[i].Segment,
+				RawOffset:  refs[i].Offset,
+				RawLength:  refs[i].Length,
+			})
+			eventFlows = append(eventFlows, sysdigEdge.Flow)
+			eventEnds = append(eventEnds, keys[i])
+		} else if parsedLog.Log.LogType() == NETTYPE {
+			netEdge := parsedLog.Log.(ParsedNetLog)
+			nets = append(nets, &models.Net{
+				SrcID:      startID,
+				DstID:      endID,
+				Method:     netEdge.Method,
+				Payload:    netEdge.Payload,
+				PayloadLen: netEdge.PayloadLen,
+				SeqNum:     netEdge.SeqNum,
+				AckNum:     netEdge.AckNum,
+				Time:       netEdge.Time,
+				UUID:       netEdge.UUID,
+				Dataset:    datasetOf(s, parsedLog),
+				RawSegment: refs[i].Segment,
+				RawOffset:  refs[i].Offset,
+				RawLength:  refs[i].Length,
+			})
+			netFlows = append(netFlows, netEdge.Flow)
+		} else {
+			logs.Logger.Errorf("Unknown edge type")
 		}
-		sysdigPO := models.Event{
-			SrcID:      startID,
-			DstID:      endID,
-			EventClass: sysdigEdge.EventCLass,
-			Relation:   sysdigEdge.Relation,
-			Operation:  sysdigEdge.Operation,
-			Time:       sysdigEdge.Time,
-			UUID:       sysdigEdge.UUID,
-		}
-		result := db.Create(&sysdigPO)
-		if result.Error != nil {
-			logs.Logger.WithError(result.Error).Errorf("插入边失败 %w", sysdigPO)
-		}
-		*count++
-		return
-	} else if edgeI.LogType() == NETTYPE {
-		netEdge := edgeI.(ParsedNetLog)
-		// 网络流量日志可以允许重复
-		if !repeat {
-			models.Mu.Lock()
-			defer models.Mu.Unlock()
-			var existNetPO models.Net
-			result := db.Where("src_id = ? AND dst_id = ? AND method = ? AND uuid = ?", startID, endID, netEdge.Method, netEdge.UUID).First(&existNetPO)
-			if result.Error == nil { // 存在该记录 不需要插入
-				return
+	}
+
+	var flows []*models.Flow
+	if r := eventReducer(); r != nil && len(events) > 0 {
+		batchSeq := r.nextBatch()
+		total := len(events)
+		var (
+			exts   []store.EventExtension
+			opened []reduceKey
+		)
+		events, eventFlows, exts, opened = r.reduce(batchSeq, events, eventEnds, eventFlows)
+		var inserted []bool
+		err := retryWrite(goroutine, "插入边", func() error { // 插入与合并在同一个事务中，失败时都没有生效，重试不会重复插入或重复累加
+			var err error
+			inserted, err = s.InsertReducedEvents(events, !repeat, exts)
+			return err
+		})
+		r.persisted(batchSeq, opened, events, inserted)
+		if err != nil {
+			r.failed(exts)
+			return fmt.Errorf("insert events failed: %w", err)
+		}
+		*reducedCnt += total - len(events)
+		for i, ok := range inserted {
+			if !ok {
+				continue
+			}
+			*edgeCnt++
+			if eventFlows[i] != nil {
+				flows = append(flows, flowPO(eventFlows[i], events[i].TableName(), events[i].ID, events[i].Time, events[i].Dataset))
 			}
 		}
-		netPO := models.Net{
-			SrcID:      startID,
-			DstID:      endID,
-			Method:     netEdge.Method,
-			Payload:    netEdge.Payload,
-			PayloadLen: netEdge.PayloadLen,
-			SeqNum:     netEdge.SeqNum,
-			AckNum:     netEdge.AckNum,
-			Time:       netEdge.Time,
-			UUID:       netEdge.UUID,
+	} else if len(events) > 0 {
+		var inserted []bool
+		err := retryWrite(goroutine, "插入边", func() error {
+			var err error
+			inserted, err = s.InsertEvents(events, !repeat) // 不可以重复时，已经存在相同的边则不插入
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("insert events failed: %w", err)
+		}
+		for i, ok := range inserted {
+			if !ok {
+				continue
+			}
+			*edgeCnt++
+			if eventFlows[i] != nil {
+				flows = append(flows, flowPO(eventFlows[i], events[i].TableName(), events[i].ID, events[i].Time, events[i].Dataset))
+			}
+		}
+	}
+	if len(nets) > 0 {
+		var inserted []bool
+		err := retryWrite(goroutine, "插入边", func() error {
+			var err error
+			inserted, err = s.InsertNets(nets, !repeat) // 网络流量日志可以允许重复
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("insert nets failed: %w", err)
+		}
+		for i, ok := range inserted {
+			if !ok {
+				continue
+			}
+			*edgeCnt++
+			if netFlows[i] != nil {
+				flows = append(flows, flowPO(netFlows[i], nets[i].TableName(), nets[i].ID, nets[i].Time, nets[i].Dataset))
+			}
 		}
-		result := db.Create(&netPO)
-		if result.Error != nil {
-			logs.Logger.WithError(result.Error).Errorf("插入边失败 %w", netPO)
+	}
+	if len(flows) > 0 {
+		if err := retryWrite(goroutine, "插入 flow", func() error { return s.InsertFlows(flows) }); err != nil {
+			return fmt.Errorf("insert flows failed: %w", err)
 		}
-		*count++
-		return
 	}
-	logs.Logger.Errorf("Unknown edge type")
+	return nil
+}
 
+func ackBatch(batch []ParsedLog) {
+	for _, parsedLog := range batch {
+		if parsedLog.Ack != nil {
+			parsedLog.Ack()
+		}
+	}
 }
 
 // Insert 用于实时的消费 ParsedLogCh 中的数据，构造图结构存入 db 中
+// 日志攒满 conf.Config.Inserter.BatchSize 条或距离上次写入超过 FlushInterval 时批量写入
 func (pi *Inserter) Insert(goroutine int, repeat bool) {
 	logs.Logger.Infof("Start inserter routine %d...", goroutine)
-	db := models.GetMysqlDB()
-	cnt := 0       // 总边数
-	edgeCnt := 0   // 实际插入数据库中的边数（可能有同样顶点之间的，所以会小于cnt）
-	vertexCnt := 0 // 实际插入数据库中的顶点数
-	for parsedLog := range *pi.ParsedLogCh {
-		cnt += 1
-		if cnt%1000 == 0 {
-			logs.Logger.Infof("[Inserter goroutine %d] Now solved %d logs", goroutine, cnt)
-		}
-		EdgeI := parsedLog.Log
+	s := store.GetStore()
+	batchSize := conf.Config.Inserter.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	interval := time.Duration(conf.Config.Inserter.FlushInterval) * time.Millisecond
+	if interval <= 0 {
+		interval = 200 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		StartVertexI := parsedLog.StartVertex
-		EndVertexI := parsedLog.EndVertex
-		startID, err := pi.InsertOrQueryVertex(db, StartVertexI, &vertexCnt)
-		if err != nil {
-			logs.Logger.WithError(err).Errorf("[Inserter goroutine %d] Insert or query vertex failed", goroutine)
-			continue
+	cnt := 0        // 总边数
+	edgeCnt := 0    // 实际插入数据库中的边数（可能有同样顶点之间的，所以会小于cnt）
+	vertexCnt := 0  // 实际插入数据库中的顶点数
+	reducedCnt := 0 // 合并到已有边上的边数
+	batch := make([]ParsedLog, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
 		}
-		endID, err := pi.InsertOrQueryVertex(db, EndVertexI, &vertexCnt)
-		if err != nil {
-			logs.Logger.WithError(err).Errorf("[Inserter goroutine %d] Insert or query vertex failed", goroutine)
-			continue
+		if err := pi.insertBatch(s, goroutine, batch, &edgeCnt, &vertexCnt, &reducedCnt, repeat); err != nil {
+			logs.Logger.WithError(err).Errorf("[Inserter goroutine %d] 写入 %d 条日志失败", goroutine, len(batch))
+			// 写入死信文件后确认，否则持久化队列的提交偏移永远停在这批日志之前；死信也写入失败时不确认，重启后重放
+			if written, err := writeDeadLetter(batch, err); err != nil {
+				logs.Logger.WithError(err).Errorf("[Inserter goroutine %d] 写入死信文件失败", goroutine)
+			} else if written {
+				ackBatch(batch)
+			}
+		} else {
+			ackBatch(batch)
+		}
+		if cnt/1000 != (cnt-len(batch))/1000 {
+			logs.Logger.Infof("[Inserter goroutine %d] Now solved %d logs", goroutine, cnt)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case parsedLog, ok := <-*pi.ParsedLogCh:
+			if !ok {
+				flush()
+				logs.Logger.Infof("Complete inserter goroutine %d, insert %d edges (%d reduced) and %d vertexs", goroutine, edgeCnt, reducedCnt, vertexCnt)
+				return
+			}
+			cnt += 1
+			batch = append(batch, parsedLog)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
 		}
-		pi.InsertEdge(db, EdgeI, startID, endID, &edgeCnt, repeat)
 	}
-	logs.Logger.Infof("Complete inserter goroutine %d, insert %d edges and %d vertexs", goroutine, edgeCnt, vertexCnt)
 }
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"erinyes/logs"
+	"erinyes/store"
+	"fmt"
+	"os"
+	"time"
+)
+
+// leaseTTL 插入进程租约的有效期，每 leaseTTL/3 续期一次，进程异常退出后最多 leaseTTL 过期
+const leaseTTL = 30 * time.Second
+
+// leaseHolder 当前进程在租约中的标识
+var leaseHolder = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s#%d", host, os.Getpid())
+}()
+
+// holdInserterLease 登记当前进程正在插入边并定期续期，返回的函数停止续期并删除租约；存储不支持租约时什么都不做
+func holdInserterLease() func() {
+	leaser, ok := store.GetStore().(store.Leaser)
+	if !ok {
+		return func() {}
+	}
+	renew := func() {
+		if err := leaser.RenewLease(leaseHolder, leaseTTL); err != nil {
+			logs.Logger.WithError(err).Errorf("续期插入进程的租约失败")
+		}
+	}
+	renew()
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(leaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				renew()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		if err := leaser.ReleaseLease(leaseHolder); err != nil {
+			logs.Logger.WithError(err).Errorf("删除插入进程的租约失败")
+		}
+	}
+}
+
+// OtherInserters 返回当前进程之外正在插入边的进程，存储不支持租约时为空
+func OtherInserters() ([]string, error) {
+	leaser, ok := store.GetStore().(store.Leaser)
+	if !ok {
+		return nil, nil
+	}
+	holders, err := leaser.LiveLeases()
+	if err != nil {
+		return nil, err
+	}
+	var others []string
+	for _, holder := range holders {
+		if holder != leaseHolder {
+			others = append(others, holder)
+		}
+	}
+	return others, nil
+}
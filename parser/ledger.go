@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"erinyes/logs"
+	"erinyes/store"
+	"time"
+)
+
+// CheckpointLoop 定期用 keyFile 中的私钥对哈希链的链头签名，链头没有变化时不会重复签名
+func CheckpointLoop(interval time.Duration, keyFile string) {
+	ledger, ok := store.GetStore().(store.Ledger)
+	if !ok {
+		logs.Logger.Errorf("current storage does not support ledger")
+		return
+	}
+	key, err := store.LoadLedgerKey(keyFile, true)
+	if err != nil {
+		logs.Logger.WithError(err).Errorf("load ledger key %s failed", keyFile)
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastHash := ""
+	for range ticker.C {
+		c, err := ledger.Checkpoint(key)
+		if err != nil {
+			logs.Logger.WithError(err).Errorf("create ledger checkpoint failed")
+			continue
+		}
+		if c.Hash != lastHash {
+			logs.Logger.Infof("create ledger checkpoint at entry %d, hash %s", c.Seq, c.Hash)
+		}
+		lastHash = c.Hash
+	}
+}
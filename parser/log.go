@@ -9,12 +9,29 @@ const (
 	PROCESSTYPE = "process_vertex"
 )
 
+// FlowTuple 网络边的四元组（按数据流动方向）与载荷长度，用于关联 sysdig 事件与流量日志
+type FlowTuple struct {
+	Source     string // models.FlowSourceSysdig 或 models.FlowSourceCapture
+	SrcIP      string
+	SrcPort    string
+	DstIP      string
+	DstPort    string
+	PayloadLen int
+	Method     string
+}
+
 type ParsedSysdigLog struct {
 	EventCLass string
 	Relation   string
 	Operation  string
 	Time       int64
 	UUID       string
+	Flow       *FlowTuple // 仅套接字读写事件存在
+	Pid        string     // 主机上的进程 pid
+	Tid        string
+	Ret        string   // 系统调用返回值
+	Bytes      int64    // 读写事件传输的字节数
+	Args       []string // 原始的 evt.info
 }
 
 func (p ParsedSysdigLog) LogType() string {
@@ -29,6 +46,7 @@ type ParsedNetLog struct {
 	AckNum     int
 	Time       int64
 	UUID       string
+	Flow       *FlowTuple
 }
 
 func (p ParsedNetLog) LogType() string {
@@ -86,4 +104,7 @@ type ParsedLog struct {
 	Log         ParsedEdge
 	StartVertex ParsedVertex
 	EndVertex   ParsedVertex
+	Dataset     string // 为空时使用存储当前的数据集
+	Raw         string // 产生这条边的原始日志，开启 Archive 时归档并记录位置
+	Ack         func() // 插入完成后调用，确认原始日志已被处理，可以为空
 }
@@ -3,6 +3,7 @@ package parser
 import (
 	"encoding/json"
 	"erinyes/logs"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -33,6 +34,18 @@ type NetLog struct {
 	UUID       string
 }
 
+// ValidateNetLine 在原始流量日志入队前检查其格式
+func ValidateNetLine(rawLine string) error {
+	var netJson NetJson
+	if err := json.Unmarshal([]byte(rawLine), &netJson); err != nil {
+		return err
+	}
+	if netJson.IPSrc == "" || netJson.IPDst == "" {
+		return fmt.Errorf("missing ip_src or ip_dst")
+	}
+	return nil
+}
+
 // SplitNetLine 解析原始流量日志
 func SplitNetLine(rawLine string) (error, *NetLog) {
 	var netJson NetJson
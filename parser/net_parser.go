@@ -3,11 +3,13 @@ package parser
 import (
 	"erinyes/conf"
 	"erinyes/logs"
+	"erinyes/models"
 	"strings"
 )
 
 type NetParser struct {
 	pusher *Pusher
+	host   Host // 当前正在解析的日志所属主机，只作用于容器内的进程顶点
 }
 
 func NewNetParser(pusher *Pusher) *NetParser {
@@ -20,14 +22,31 @@ func (p *NetParser) ParserType() string {
 	return NET
 }
 
+// ParsePushRawLog 实现 parser 的接口
+func (p *NetParser) ParsePushRawLog(rawLog RawLog) error {
+	p.host = rawLog.Host
+	defer func() { p.host = Host{} }()
+	return p.pusher.pushRawLog(p, rawLog)
+}
+
+// hostIdentity 返回当前日志所属主机，未提供时使用 mock 的主机
+func (p *NetParser) hostIdentity() (string, string) {
+	if p.host.ID != "" {
+		return p.host.ID, p.host.Name
+	}
+	return conf.MockHostID, conf.MockHostName
+}
+
 // ParsePushLine 实现 parser 的接口
 func (p *NetParser) ParsePushLine(rawLine string) error {
+	p.pusher.raw = rawLine
 	err, netLog := SplitNetLine(rawLine)
 	if err != nil {
 		return err
 	}
 	// alastor 会判断 IP 是否为 function 的 ip，则另一个 ip 是 gateway
 	// erinyes 记录的网络日志中，除了gateway、function 的 ip，还有很多其他的，因此如实记录各个ip即可
+	hostID, hostName := p.hostIdentity()
 	pl := ParsedLog{}
 	if containerNameAndID, ok := conf.Config.IPMap[netLog.IPSrc]; ok { // 判断 src 是否为几个 function 中的 ip
 		result := strings.Split(containerNameAndID, "$")
@@ -40,8 +59,8 @@ func (p *NetParser) ParsePushLine(rawLine string) error {
 		//	DstPort:       netLog.PortSrc,
 		//}
 		pl.StartVertex = ProcessVertex{
-			HostID:         conf.MockHostID,
-			HostName:       conf.MockHostName,
+			HostID:         hostID,
+			HostName:       hostName,
 			ContainerID:    result[1],
 			ContainerName:  result[0],
 			ProcessVPID:    "1",
@@ -69,8 +88,8 @@ func (p *NetParser) ParsePushLine(rawLine string) error {
 		//	DstPort:       netLog.PortDst,
 		//}
 		pl.EndVertex = ProcessVertex{
-			HostID:         conf.MockHostID,
-			HostName:       conf.MockHostName,
+			HostID:         hostID,
+			HostName:       hostName,
 			ContainerID:    result[1],
 			ContainerName:  result[0],
 			ProcessVPID:    "1",
@@ -88,6 +107,20 @@ func (p *NetParser) ParsePushLine(rawLine string) error {
 		}
 	}
 
+	// 流量日志中的源、目的即数据流动方向，与 sysdig 读写事件关联时使用
+	var flow *FlowTuple
+	if netLog.PayLoadLen > 0 {
+		flow = &FlowTuple{
+			Source:     models.FlowSourceCapture,
+			SrcIP:      netLog.IPSrc,
+			SrcPort:    netLog.PortSrc,
+			DstIP:      netLog.IPDst,
+			DstPort:    netLog.PortDst,
+			PayloadLen: netLog.PayLoadLen,
+			Method:     netLog.Method,
+		}
+	}
+
 	if pl.StartVertex.VertexType() == SOCKETTYPE && pl.EndVertex.VertexType() == SOCKETTYPE {
 		pl.Log = ParsedNetLog{
 			Method:     netLog.Method,
@@ -96,6 +129,7 @@ func (p *NetParser) ParsePushLine(rawLine string) error {
 			AckNum:     netLog.AckNum,
 			Time:       netLog.Time,
 			UUID:       netLog.UUID,
+			Flow:       flow,
 		}
 		p.pusher.PushParsedLog(pl)
 	} else if pl.StartVertex.VertexType() == PROCESSTYPE && pl.EndVertex.VertexType() == SOCKETTYPE {
@@ -105,6 +139,7 @@ func (p *NetParser) ParsePushLine(rawLine string) error {
 			Operation:  netLog.Method,
 			Time:       netLog.Time,
 			UUID:       netLog.UUID,
+			Flow:       flow,
 		}
 		p.pusher.PushParsedLog(pl)
 	} else if pl.StartVertex.VertexType() == SOCKETTYPE && pl.EndVertex.VertexType() == PROCESSTYPE {
@@ -114,6 +149,7 @@ func (p *NetParser) ParsePushLine(rawLine string) error {
 			Operation:  netLog.Method,
 			Time:       netLog.Time,
 			UUID:       netLog.UUID,
+			Flow:       flow,
 		}
 		p.pusher.PushParsedLog(pl)
 	} else {
@@ -8,12 +8,21 @@ import (
 var wgParser = sync.WaitGroup{}
 var wgInserter = sync.WaitGroup{}
 
+// inserterCount 插入协程数；合并重复边时批次必须按到达的顺序交给合并器，只使用一个协程
+func inserterCount() int {
+	if eventReducer() != nil {
+		return 1
+	}
+	return 10
+}
+
 // FileLogParse 用来解析 sysdig 日志和流量日志
 func FileLogParse(repeat bool, sysdigFilepath string, netFilepath string) {
+	defer holdInserterLease()() // 回收顶点的其他进程据此判断当前进程缓存了顶点主键
 	pChan := make(chan ParsedLog, 1000)
 	inserter := Inserter{ParsedLogCh: &pChan}
 	// 并发解析日志并插入数据库
-	concurrencyNum := 10
+	concurrencyNum := inserterCount()
 	for idx := 0; idx < concurrencyNum; idx++ {
 		wgInserter.Add(1)
 		idx := idx
@@ -23,10 +32,10 @@ func FileLogParse(repeat bool, sysdigFilepath string, netFilepath string) {
 		}()
 	}
 	if sysdigFilepath != "" {
-		addFileLogParse(NewSysdigParser(&Pusher{&pChan}), sysdigFilepath)
+		addFileLogParse(NewSysdigParser(&Pusher{parsedLogCh: &pChan}), sysdigFilepath)
 	}
 	if netFilepath != "" {
-		addFileLogParse(NewNetParser(&Pusher{&pChan}), netFilepath)
+		addFileLogParse(NewNetParser(&Pusher{parsedLogCh: &pChan}), netFilepath)
 	}
 	wgParser.Wait()
 	close(pChan)
@@ -48,10 +57,11 @@ func addFileLogParse(_parser Parser, filename string) {
 
 // HTTPLogParse  用来提供日志解析的HTTP服务版
 func HTTPLogParse(repeat bool) {
+	defer holdInserterLease()() // 回收顶点的其他进程据此判断当前进程缓存了顶点主键
 	pChan := make(chan ParsedLog, 1000)
 	inserter := Inserter{ParsedLogCh: &pChan}
 	// 并发解析日志并插入数据库
-	concurrencyNum := 10
+	concurrencyNum := inserterCount()
 	for idx := 0; idx < concurrencyNum; idx++ {
 		wgInserter.Add(1)
 		idx := idx
@@ -61,8 +71,10 @@ func HTTPLogParse(repeat bool) {
 		}()
 	}
 
-	addHTTPLogParse(NewSysdigParser(&Pusher{&pChan}))
-	addHTTPLogParse(NewNetParser(&Pusher{&pChan}))
+	initRawChan() // 必须在解析协程启动前创建，否则 HTTP 请求可能写入 nil chan
+	addHTTPLogParse(NewSysdigParser(&Pusher{parsedLogCh: &pChan}))
+	addHTTPLogParse(NewNetParser(&Pusher{parsedLogCh: &pChan}))
+	addHTTPLogParse(NewEventParser(&Pusher{parsedLogCh: &pChan}))
 	wgParser.Wait()
 	close(pChan)
 	wgInserter.Wait()
@@ -78,6 +90,8 @@ func addHTTPLogParse(_parser Parser) {
 			ParseSysdigChan(parser)
 		} else if parser.ParserType() == NET {
 			ParseNetChan(parser)
+		} else if parser.ParserType() == EVENT {
+			ParseEventChan(parser)
 		} else {
 			logs.Logger.Errorf("Unknown parser type: %s", parser.ParserType())
 		}
@@ -3,28 +3,82 @@ package parser
 import (
 	"bufio"
 	"erinyes/logs"
+	"fmt"
 	"os"
+	"time"
 )
 
 type Parser interface {
-	ParsePushLine(rawLine string) error // 解析原始日志，生成 ParsedLog 放入 Pusher 中
+	ParsePushLine(rawLine string) error  // 解析原始日志，生成 ParsedLog 放入 Pusher 中
+	ParsePushRawLog(rawLog RawLog) error // 同 ParsePushLine，处理完成后调用 rawLog.Ack
 	ParserType() string
 }
 
+// Host 日志来源主机的标识，为空时使用 conf.MockHostID
+type Host struct {
+	ID   string
+	Name string
+}
+
+// RawLog 在线接收的原始日志
+type RawLog struct {
+	Line    string
+	Host    Host   // 上报方提供的主机标识，可以为空
+	Dataset string // 日志写入的数据集，为空时使用存储当前的数据集
+	Ack     func() // 日志产生的边都插入数据库（或被过滤）、且设置的解析器状态失效后调用，可以为空
+}
+
 const (
 	SYSDIG string = "sysdig"
 	NET    string = "net"
+	EVENT  string = "event" // 已经解析好的结构化事件
 )
 
 type Pusher struct {
 	parsedLogCh *chan ParsedLog
+	acks        *ackTracker // 在线解析时跟踪原始日志的确认
+	line        *lineAck    // 当前正在解析的原始日志，解析文件时为空
+	dataset     string      // 当前正在解析的原始日志所属的数据集
+	raw         string      // 当前正在解析的原始日志，由各 Parser 的 ParsePushLine 设置
 }
 
+// PushParsedLog 一行原始日志可以产生多个 ParsedLog，全部插入后才确认这行日志
 func (p *Pusher) PushParsedLog(pl ParsedLog) error {
+	if p.line != nil {
+		pl.Ack = p.acks.hold(p.line)
+	}
+	pl.Dataset, pl.Raw = p.dataset, p.raw
 	*p.parsedLogCh <- pl
 	return nil
 }
 
+// pin 当前日志设置了解析器中 key 对应的状态，在状态失效之前不确认，重放时可以重建该状态
+func (p *Pusher) pin(key string) {
+	if p.line != nil {
+		p.acks.pin(key, p.line)
+	}
+}
+
+// unpin 当前日志清除或消费了 key 对应的状态，设置该状态的日志在当前及之前的日志都完成后确认
+func (p *Pusher) unpin(key string) {
+	if p.line != nil {
+		p.acks.unpin(key, p.line)
+	}
+}
+
+// pushRawLog 解析一条带确认函数的原始日志，没有产生 ParsedLog（被过滤或解析失败）且没有设置状态时直接确认
+func (p *Pusher) pushRawLog(parser Parser, rawLog RawLog) error {
+	if p.acks == nil {
+		p.acks = newAckTracker()
+	}
+	p.line, p.dataset = p.acks.begin(rawLog.Ack), rawLog.Dataset
+	defer func() {
+		p.acks.release(p.line)
+		p.line, p.dataset = nil, ""
+	}()
+	return parser.ParsePushLine(rawLog.Line)
+}
+
 // ParseFile 用于解析文件并插入 pusher 中
 func ParseFile(name string, parser Parser) error {
 	f, err := os.Open(name)
@@ -47,27 +101,82 @@ func ParseFile(name string, parser Parser) error {
 	return nil
 }
 
-var SysdigRawChan chan string
-var NetRawChan chan string
+const RawChanSize = 1000 // 原始日志 chan 的缓冲大小
+
+var SysdigRawChan chan RawLog
+var NetRawChan chan RawLog
+var EventRawChan chan RawLog
+
+var rawChanReady = make(chan struct{})
+
+// initRawChan 创建原始日志 chan，创建完成后 WaitRawChanReady 才会返回 true
+func initRawChan() {
+	SysdigRawChan = make(chan RawLog, RawChanSize)
+	NetRawChan = make(chan RawLog, RawChanSize)
+	EventRawChan = make(chan RawLog, RawChanSize)
+	close(rawChanReady)
+}
+
+// WaitRawChanReady 等待日志解析流水线就绪，超时返回 false
+func WaitRawChanReady(timeout time.Duration) bool {
+	select {
+	case <-rawChanReady:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// RawChan 根据日志类型返回对应的原始日志 chan
+func RawChan(parserType string) chan RawLog {
+	if parserType == SYSDIG {
+		return SysdigRawChan
+	} else if parserType == NET {
+		return NetRawChan
+	} else if parserType == EVENT {
+		return EventRawChan
+	}
+	return nil
+}
+
+// ValidateRawLine 根据日志类型在入队前校验原始日志
+func ValidateRawLine(parserType string, line string) error {
+	if parserType == SYSDIG {
+		return ValidateSysdigLine(line)
+	} else if parserType == NET {
+		return ValidateNetLine(line)
+	} else if parserType == EVENT {
+		return ValidateEventLine(line)
+	}
+	return fmt.Errorf("unknown log type %s", parserType)
+}
 
 // ParseSysdigChan 用于实时解析 SysdigRawChan 中的日志并插入 pusher 中
 func ParseSysdigChan(parser Parser) {
-	SysdigRawChan = make(chan string, 1000)
-	for rawString := range SysdigRawChan {
-		err := parser.ParsePushLine(rawString)
+	for rawLog := range SysdigRawChan {
+		err := parser.ParsePushRawLog(rawLog)
+		if err != nil {
+			logs.Logger.Errorf("parse sysdig log failed: %s", rawLog.Line)
+		}
+	}
+}
+
+// ParseEventChan 用于实时解析 EventRawChan 中的结构化事件并插入 pusher 中
+func ParseEventChan(parser Parser) {
+	for rawLog := range EventRawChan {
+		err := parser.ParsePushRawLog(rawLog)
 		if err != nil {
-			logs.Logger.Errorf("parse sysdig log failed: %s", rawString)
+			logs.Logger.WithError(err).Errorf("parse event failed: %s", rawLog.Line)
 		}
 	}
 }
 
 // ParseNetChan 用于实时解析 NetRawChan 中的日志并插入 pusher 中
 func ParseNetChan(parser Parser) {
-	NetRawChan = make(chan string, 1000)
-	for rawString := range NetRawChan {
-		err := parser.ParsePushLine(rawString)
+	for rawLog := range NetRawChan {
+		err := parser.ParsePushRawLog(rawLog)
 		if err != nil {
-			logs.Logger.Errorf("parse net log failed: %s", rawString)
+			logs.Logger.Errorf("parse net log failed: %s", rawLog.Line)
 		}
 	}
 }
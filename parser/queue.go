@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"encoding/json"
+	"erinyes/logs"
+	"erinyes/wal"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var SysdigQueue *wal.Queue
+var NetQueue *wal.Queue
+var EventQueue *wal.Queue
+
+// queuedLog 持久化队列中一条记录的内容
+type queuedLog struct {
+	Line     string `json:"line"`
+	HostID   string `json:"host_id,omitempty"`
+	HostName string `json:"host_name,omitempty"`
+	Dataset  string `json:"dataset,omitempty"`
+}
+
+const deadLetterFile = "deadletter.ndjson"
+
+// deadLetter 重试后仍然无法插入的日志，写入后确认，不再阻塞持久化队列的提交偏移
+var deadLetter struct {
+	sync.Mutex
+	path string // 为空表示未启用持久化队列
+}
+
+// deadLetterRecord 死信文件中的一行
+type deadLetterRecord struct {
+	Time    int64  `json:"time"`
+	Error   string `json:"error"`
+	Dataset string `json:"dataset,omitempty"`
+	Raw     string `json:"raw"`
+}
+
+// OpenIngestQueues 打开 sysdig 与流量日志的持久化队列，解析流水线就绪后从上次提交的偏移开始消费
+func OpenIngestQueues(dir string, opts wal.Options) error {
+	var err error
+	deadLetter.path = filepath.Join(dir, deadLetterFile)
+	if SysdigQueue, err = wal.Open(filepath.Join(dir, SYSDIG), opts); err != nil {
+		return err
+	}
+	if NetQueue, err = wal.Open(filepath.Join(dir, NET), opts); err != nil {
+		return err
+	}
+	if EventQueue, err = wal.Open(filepath.Join(dir, EVENT), opts); err != nil {
+		return err
+	}
+	go feedFromQueue(SysdigQueue, SYSDIG)
+	go feedFromQueue(NetQueue, NET)
+	go feedFromQueue(EventQueue, EVENT)
+	return nil
+}
+
+// IngestQueue 根据日志类型返回对应的持久化队列，未启用时返回 nil
+func IngestQueue(parserType string) *wal.Queue {
+	if parserType == SYSDIG {
+		return SysdigQueue
+	} else if parserType == NET {
+		return NetQueue
+	} else if parserType == EVENT {
+		return EventQueue
+	}
+	return nil
+}
+
+// EncodeQueuedLog 将原始日志编码为持久化队列中的记录
+func EncodeQueuedLog(rawLog RawLog) ([]byte, error) {
+	return json.Marshal(queuedLog{Line: rawLog.Line, HostID: rawLog.Host.ID, HostName: rawLog.Host.Name, Dataset: rawLog.Dataset})
+}
+
+// feedFromQueue 按序将队列中的日志送入原始日志 chan，日志插入数据库后才确认
+func feedFromQueue(q *wal.Queue, parserType string) {
+	<-rawChanReady
+	rawChan := RawChan(parserType)
+	for {
+		payload, ack, err := q.Next()
+		if err == wal.ErrClosed {
+			logs.Logger.Infof("stop consuming %s queue", parserType)
+			return
+		} else if err != nil { // 记录损坏，需要人工处理，不能跳过已经确认写入的日志
+			logs.Logger.WithError(err).Errorf("stop consuming %s queue", parserType)
+			return
+		}
+		var record queuedLog
+		if err := json.Unmarshal(payload, &record); err != nil {
+			logs.Logger.WithError(err).Errorf("invalid record in %s queue", parserType)
+			ack()
+			continue
+		}
+		rawChan <- RawLog{Line: record.Line, Host: Host{ID: record.HostID, Name: record.HostName}, Dataset: record.Dataset, Ack: ack}
+	}
+}
+
+// writeDeadLetter 将一批插入失败的日志的原始内容追加到死信文件并 fsync，成功后这批日志可以确认
+// 未启用持久化队列时返回 false，日志本来就不会重放
+func writeDeadLetter(batch []ParsedLog, cause error) (bool, error) {
+	deadLetter.Lock()
+	defer deadLetter.Unlock()
+	if deadLetter.path == "" {
+		return false, nil
+	}
+	f, err := os.OpenFile(deadLetter.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	seen := make(map[string]bool)
+	enc := json.NewEncoder(f)
+	for _, parsedLog := range batch {
+		if parsedLog.Raw == "" || seen[parsedLog.Raw] { // 一行日志可以产生多条边
+			continue
+		}
+		seen[parsedLog.Raw] = true
+		if err := enc.Encode(deadLetterRecord{Time: now, Error: cause.Error(), Dataset: parsedLog.Dataset, Raw: parsedLog.Raw}); err != nil {
+			return false, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,211 @@
+package parser
+
+import (
+	"erinyes/conf"
+	"erinyes/models"
+	"erinyes/store"
+	"sync"
+	"sync/atomic"
+)
+
+// reduceKey 可以合并的重复边：同一对顶点之间类型、系统调用和 uuid 都相同
+type reduceKey struct {
+	class, src, dst, operation, uuid string
+}
+
+// openEdge 仍可以继续合并的边，owner 为尚未插入该边的批次，插入后为 0
+type openEdge struct {
+	event *models.Event
+	owner uint64
+}
+
+// reducer 以 CPR（Causality Preserving Reduction）的方式合并重复边：
+// 同一对顶点之间的同类边 e1、e2，若两者之间起点没有新的流入、终点没有新的流出，则合并 e2 不改变任何溯源结果
+// 每条边到来时先关闭以其终点为起点、以其起点为终点的可合并边，再尝试合并到相同的可合并边上
+// 边需要按时间顺序到来（见 inserterCount）；时间早于可合并边的结束时间，或者可合并边结束之后起点已有流入、
+// 终点已有流出（乱序到达的边）时不合并
+type reducer struct {
+	mu      sync.Mutex
+	open    map[reduceKey]*openEdge
+	bySrc   map[string]map[reduceKey]bool // 顶点唯一键 -> 以其为起点的可合并边
+	byDst   map[string]map[reduceKey]bool
+	inflow  map[string]int64 // 顶点唯一键 -> 最近一次流入的时间
+	outflow map[string]int64 // 顶点唯一键 -> 最近一次流出的时间
+	size    int              // 可合并边（以及记录流入、流出时间的顶点）的最大数量，超过后全部关闭
+	seq     uint64
+}
+
+var (
+	edgeReducer     *reducer
+	edgeReducerOnce sync.Once
+)
+
+// eventReducer 返回全局的边合并器，未启用 conf.Config.Inserter.Reduce 时为 nil
+func eventReducer() *reducer {
+	edgeReducerOnce.Do(func() {
+		if conf.Config.Inserter.Reduce {
+			edgeReducer = newReducer(conf.Config.Inserter.ReduceSize)
+		}
+	})
+	return edgeReducer
+}
+
+func newReducer(size int) *reducer {
+	if size <= 0 {
+		size = 100000
+	}
+	r := &reducer{size: size}
+	r.reset()
+	return r
+}
+
+// reset 关闭所有可合并边
+func (r *reducer) reset() {
+	r.open = make(map[reduceKey]*openEdge)
+	r.bySrc = make(map[string]map[reduceKey]bool)
+	r.byDst = make(map[string]map[reduceKey]bool)
+	r.inflow = make(map[string]int64)
+	r.outflow = make(map[string]int64)
+}
+
+// mergeable e 是否可以合并到可合并边 oe 上：e 不早于 oe 结束，且 oe 结束之后起点没有流入、终点没有流出
+func (r *reducer) mergeable(oe *openEdge, e *models.Event, src string, dst string) bool {
+	end := oe.event.EndTime
+	return e.Time >= end && r.inflow[src] <= end && r.outflow[dst] <= end
+}
+
+// flowed 记录 src 流出、dst 流入的时间
+func (r *reducer) flowed(src string, dst string, t int64) {
+	if len(r.inflow) >= r.size || len(r.outflow) >= r.size {
+		r.reset()
+	}
+	if r.outflow[src] < t {
+		r.outflow[src] = t
+	}
+	if r.inflow[dst] < t {
+		r.inflow[dst] = t
+	}
+}
+
+// nextBatch 分配批次号
+func (r *reducer) nextBatch() uint64 {
+	return atomic.AddUint64(&r.seq, 1)
+}
+
+// seal 关闭 index[vertex] 中的可合并边
+func (r *reducer) seal(index map[string]map[reduceKey]bool, vertex string) {
+	for key := range index[vertex] {
+		delete(r.open, key)
+	}
+	delete(index, vertex)
+}
+
+// reduce 按顺序处理一批 event 边，ends 为每条边起点、终点的唯一键，带四元组的网络边不参与合并
+// 返回需要插入的边及其 flow、合并到已插入边上的事件，以及本批次新增的可合并边
+func (r *reducer) reduce(batch uint64, events []*models.Event, ends [][2]string, flows []*FlowTuple) ([]*models.Event, []*FlowTuple, []store.EventExtension, []reduceKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		keptEvents []*models.Event
+		keptFlows  []*FlowTuple
+		extensions = make(map[int]*store.EventExtension)
+		extOrder   []int
+		opened     []reduceKey
+	)
+	for i, e := range events {
+		src, dst := ends[i][0], ends[i][1]
+		r.seal(r.bySrc, dst) // 终点有新的流入
+		r.seal(r.byDst, src) // 起点有新的流出
+		if flows[i] != nil {
+			r.flowed(src, dst, e.Time)
+			keptEvents, keptFlows = append(keptEvents, e), append(keptFlows, flows[i])
+			continue
+		}
+		key := reduceKey{e.EventClass, src, dst, e.Operation, e.UUID}
+		oe, ok := r.open[key]
+		merge := ok && r.mergeable(oe, e, src, dst)
+		r.flowed(src, dst, e.Time)
+		if merge {
+			if oe.owner == batch { // 本批次中尚未插入的边，直接修改
+				oe.event.Count++
+				oe.event.Bytes += e.Bytes
+				if oe.event.EndTime < e.EndTime {
+					oe.event.EndTime = e.EndTime
+				}
+				continue
+			}
+			if oe.owner == 0 { // 已经插入的边，批次写入后更新；同时更新内存中的结束时间，用于判断之后的边能否合并
+				ext, ok := extensions[oe.event.ID]
+				if !ok {
+					ext = &store.EventExtension{ID: oe.event.ID}
+					extensions[oe.event.ID] = ext
+					extOrder = append(extOrder, oe.event.ID)
+				}
+				ext.Count++
+				ext.Bytes += e.Bytes
+				if ext.EndTime < e.EndTime {
+					ext.EndTime = e.EndTime
+				}
+				if oe.event.EndTime < e.EndTime {
+					oe.event.EndTime = e.EndTime
+				}
+				continue
+			}
+			// 其他批次中尚未插入的边不能修改，由当前边取代
+		}
+		if len(r.open) >= r.size {
+			r.reset()
+		}
+		r.open[key] = &openEdge{event: e, owner: batch}
+		if r.bySrc[src] == nil {
+			r.bySrc[src] = make(map[reduceKey]bool)
+		}
+		if r.byDst[dst] == nil {
+			r.byDst[dst] = make(map[reduceKey]bool)
+		}
+		r.bySrc[src][key], r.byDst[dst][key] = true, true
+		opened = append(opened, key)
+		keptEvents, keptFlows = append(keptEvents, e), append(keptFlows, nil)
+	}
+	exts := make([]store.EventExtension, 0, len(extOrder))
+	for _, id := range extOrder {
+		exts = append(exts, *extensions[id])
+	}
+	return keptEvents, keptFlows, exts, opened
+}
+
+// failed 批次写入失败，合并没有生效，关闭合并的目标边，内存中的结束时间已经与数据库不一致
+func (r *reducer) failed(exts []store.EventExtension) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	extended := make(map[int]bool, len(exts))
+	for _, ext := range exts {
+		extended[ext.ID] = true
+	}
+	for key, oe := range r.open {
+		if oe.owner == 0 && extended[oe.event.ID] {
+			delete(r.open, key)
+		}
+	}
+}
+
+// persisted 批次写入后，已插入的可合并边交由后续批次合并，未插入的边关闭
+func (r *reducer) persisted(batch uint64, opened []reduceKey, events []*models.Event, inserted []bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ok := make(map[*models.Event]bool, len(events))
+	for i, e := range events {
+		ok[e] = i < len(inserted) && inserted[i] && e.ID != 0
+	}
+	for _, key := range opened {
+		oe, exist := r.open[key]
+		if !exist || oe.owner != batch {
+			continue
+		}
+		if ok[oe.event] {
+			oe.owner = 0
+		} else {
+			delete(r.open, key)
+		}
+	}
+}
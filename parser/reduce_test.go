@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"erinyes/models"
+	"erinyes/store"
+	"reflect"
+	"testing"
+)
+
+// reduceStep 一条边：起点、终点的唯一键与时间，flow 为 true 时带四元组
+type reduceStep struct {
+	src, dst string
+	time     int64
+	flow     bool
+}
+
+func TestReducerSealAndMerge(t *testing.T) {
+	cases := []struct {
+		name    string
+		batches [][]reduceStep
+		persist bool    // 每批是否写入成功
+		kept    [][]int // 每批需要插入的边在该批中的下标
+		counts  []int   // 所有插入的边最终的 count，包括之后批次合并到其上的事件
+	}{
+		{
+			name:    "repeated edges merge",
+			batches: [][]reduceStep{{{"a", "b", 1, false}, {"a", "b", 2, false}, {"a", "b", 3, false}}},
+			kept:    [][]int{{0}},
+			counts:  []int{3},
+		},
+		{
+			name:    "inflow to source seals",
+			batches: [][]reduceStep{{{"a", "b", 1, false}, {"x", "a", 2, false}, {"a", "b", 3, false}}},
+			kept:    [][]int{{0, 1, 2}},
+			counts:  []int{1, 1, 1},
+		},
+		{
+			name:    "outflow from destination seals",
+			batches: [][]reduceStep{{{"a", "b", 1, false}, {"b", "y", 2, false}, {"a", "b", 3, false}}},
+			kept:    [][]int{{0, 1, 2}},
+			counts:  []int{1, 1, 1},
+		},
+		{
+			name:    "outflow from source and inflow to destination do not seal",
+			batches: [][]reduceStep{{{"a", "b", 1, false}, {"c", "d", 2, false}, {"a", "c", 3, false}, {"y", "b", 4, false}, {"a", "b", 5, false}}},
+			kept:    [][]int{{0, 1, 2, 3}},
+			counts:  []int{2, 1, 1, 1},
+		},
+		{
+			name:    "edges with flow are never merged",
+			batches: [][]reduceStep{{{"a", "b", 1, true}, {"a", "b", 2, true}}},
+			kept:    [][]int{{0, 1}},
+			counts:  []int{1, 1},
+		},
+		{
+			name:    "earlier edge is not merged",
+			batches: [][]reduceStep{{{"a", "b", 10, false}, {"a", "b", 5, false}}},
+			kept:    [][]int{{0, 1}},
+			counts:  []int{1, 1},
+		},
+		{
+			name:    "late edge is not merged across a seen inflow",
+			batches: [][]reduceStep{{{"x", "a", 20, false}, {"a", "b", 10, false}, {"a", "b", 25, false}}},
+			kept:    [][]int{{0, 1, 2}},
+			counts:  []int{1, 1, 1},
+		},
+		{
+			name:    "merge into inserted edge of an earlier batch",
+			batches: [][]reduceStep{{{"a", "b", 1, false}}, {{"a", "b", 2, false}, {"a", "b", 3, false}}},
+			persist: true,
+			kept:    [][]int{{0}, nil},
+			counts:  []int{3},
+		},
+		{
+			name:    "seal between batches",
+			batches: [][]reduceStep{{{"a", "b", 1, false}}, {{"x", "a", 2, false}}, {{"a", "b", 3, false}}},
+			persist: true,
+			kept:    [][]int{{0}, {0}, {0}},
+			counts:  []int{1, 1, 1},
+		},
+		{
+			name:    "edge of a failed batch is closed",
+			batches: [][]reduceStep{{{"a", "b", 1, false}}, {{"a", "b", 2, false}}},
+			kept:    [][]int{{0}, {0}},
+			counts:  []int{1, 1},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := newReducer(100)
+			byID := make(map[int]*models.Event)
+			var inserted []*models.Event
+			nextID := 1
+			for i, steps := range c.batches {
+				var (
+					events []*models.Event
+					ends   [][2]string
+					flows  []*FlowTuple
+					index  = make(map[*models.Event]int)
+				)
+				for j, s := range steps {
+					e := &models.Event{EventClass: FILEV1, Operation: "write", Time: s.time, EndTime: s.time, Count: 1, UUID: "unknown"}
+					index[e] = j
+					events, ends = append(events, e), append(ends, [2]string{s.src, s.dst})
+					if s.flow {
+						flows = append(flows, &FlowTuple{})
+					} else {
+						flows = append(flows, nil)
+					}
+				}
+				batch := r.nextBatch()
+				kept, _, exts, opened := r.reduce(batch, events, ends, flows)
+				var got []int
+				for _, e := range kept {
+					got = append(got, index[e])
+				}
+				if !reflect.DeepEqual(got, c.kept[i]) {
+					t.Fatalf("batch %d kept %v, want %v", i, got, c.kept[i])
+				}
+				ok := make([]bool, len(kept))
+				for j, e := range kept {
+					if c.persist {
+						e.ID, ok[j] = nextID, true
+						byID[e.ID] = e
+						nextID++
+					}
+					inserted = append(inserted, e)
+				}
+				for _, ext := range exts {
+					e, exist := byID[ext.ID]
+					if !exist {
+						t.Fatalf("batch %d extends unknown event %d", i, ext.ID)
+					}
+					e.Count += ext.Count
+				}
+				r.persisted(batch, opened, kept, ok)
+			}
+			var counts []int
+			for _, e := range inserted {
+				counts = append(counts, e.Count)
+			}
+			if !reflect.DeepEqual(counts, c.counts) {
+				t.Fatalf("counts %v, want %v", counts, c.counts)
+			}
+		})
+	}
+}
+
+func TestReducerClosesEdgesOfFailedExtension(t *testing.T) {
+	r := newReducer(100)
+	step := func(time int64) (*models.Event, []store.EventExtension, []*models.Event, uint64, []reduceKey) {
+		e := &models.Event{EventClass: FILEV1, Operation: "write", Time: time, EndTime: time, Count: 1, UUID: "unknown"}
+		batch := r.nextBatch()
+		kept, _, exts, opened := r.reduce(batch, []*models.Event{e}, [][2]string{{"a", "b"}}, []*FlowTuple{nil})
+		return e, exts, kept, batch, opened
+	}
+	e, _, kept, batch, opened := step(1)
+	e.ID = 1
+	r.persisted(batch, opened, kept, []bool{true})
+
+	_, exts, kept, batch, opened := step(2)
+	if len(kept) != 0 || len(exts) != 1 || exts[0].ID != 1 {
+		t.Fatalf("second event kept %d edges and extended %v, want an extension of edge 1", len(kept), exts)
+	}
+	r.persisted(batch, opened, kept, nil)
+	r.failed(exts)
+
+	if _, exts, kept, _, _ = step(3); len(kept) != 1 || len(exts) != 0 {
+		t.Fatalf("third event kept %d edges and extended %v, want a new edge", len(kept), exts)
+	}
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"erinyes/logs"
+	"erinyes/store"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// purgeMu 回收顶点时不能有正在写入的批次，否则刚解析出主键的顶点可能在边插入前被当作孤立顶点删除
+// 只对当前进程有效；其他进程中的插入协程由租约发现（见 OtherInserters），此时不回收顶点
+var purgeMu sync.RWMutex
+
+// segmentChunk 每次查询引用的归档分段数
+const segmentChunk = 500
+
+// Purge 删除匹配的边，再回收没有边的顶点与原始日志分段，并清空顶点主键缓存
+// 其他进程（service、graph）正在插入时，它们缓存的顶点主键无法清空、写入的分段可能尚未被边引用，只删除边，report.Skipped 记录原因
+func Purge(opts store.PurgeOptions) (store.PurgeReport, error) {
+	purger, ok := store.GetStore().(store.Purger)
+	if !ok {
+		return store.PurgeReport{}, fmt.Errorf("current storage does not support purge")
+	}
+	report, err := purger.PurgeEdges(opts)
+	if err != nil {
+		return report, err
+	}
+	purgeMu.Lock()
+	defer purgeMu.Unlock()
+	others, err := OtherInserters()
+	if err != nil {
+		return report, err
+	}
+	if len(others) > 0 {
+		report.Skipped = fmt.Sprintf("inserting processes %s are running", strings.Join(others, ", "))
+		return report, nil
+	}
+	vertices, err := purger.PurgeVertices(opts)
+	if !opts.DryRun {
+		vertexIDCache().reset()
+		if r := eventReducer(); r != nil { // 可合并的边可能已被删除
+			r.mu.Lock()
+			r.reset()
+			r.mu.Unlock()
+		}
+	}
+	report.Processes, report.Files, report.Sockets = vertices.Processes, vertices.Files, vertices.Sockets
+	if err != nil || opts.DryRun {
+		return report, err
+	}
+	report.Segments, err = collectSegments(purger)
+	return report, err
+}
+
+// collectSegments 删除没有任何边引用的原始日志分段，调用方持有 purgeMu，此时没有写入了分段而尚未插入边的批次
+func collectSegments(purger store.Purger) (int64, error) {
+	a := rawArchive()
+	if a == nil {
+		return 0, nil
+	}
+	segments, err := a.Segments()
+	if err != nil {
+		return 0, err
+	}
+	var removed int64
+	for start := 0; start < len(segments); start += segmentChunk {
+		end := start + segmentChunk
+		if end > len(segments) {
+			end = len(segments)
+		}
+		referenced, err := purger.ReferencedSegments(segments[start:end])
+		if err != nil {
+			return removed, err
+		}
+		for _, segment := range segments[start:end] {
+			if referenced[segment] {
+				continue
+			}
+			if err := a.Remove(segment); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// RetentionLoop 定期删除 days 天之前的数据
+func RetentionLoop(interval time.Duration, days int, chunkSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		before := time.Now().AddDate(0, 0, -days).UnixNano() / int64(time.Microsecond)
+		report, err := Purge(store.PurgeOptions{Before: before, ChunkSize: chunkSize})
+		if err != nil {
+			logs.Logger.WithError(err).Errorf("purge data before %d days failed", days)
+			continue
+		}
+		logs.Logger.Infof("purge data before %d days, %s", days, report)
+	}
+}
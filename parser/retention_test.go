@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"erinyes/archive"
+	"erinyes/conf"
+	"erinyes/logs"
+	"erinyes/models"
+	"erinyes/store"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestPurgeCollectsSegments(t *testing.T) {
+	logs.Logger = logrus.New()
+	dir := t.TempDir()
+	s, err := store.OpenSQLite(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, savedConf := store.GetStore(), conf.Config
+	store.SetStore(s)
+	conf.Config.Archive.Enable, conf.Config.Archive.Dir = true, filepath.Join(dir, "archive")
+	logArchive, logArchiveOnce = nil, sync.Once{}
+	t.Cleanup(func() {
+		store.SetStore(saved)
+		conf.Config = savedConf
+		logArchive, logArchiveOnce = nil, sync.Once{}
+	})
+
+	a := rawArchive()
+	var segments []string
+	for _, line := range []string{"old", "new", "orphan"} {
+		refs, err := a.Write([]string{line})
+		if err != nil {
+			t.Fatal(err)
+		}
+		segments = append(segments, refs[0].Segment)
+	}
+	if _, err := s.UpsertProcesses([]*models.Process{{HostID: "h", ProcessName: "p", ProcessVPID: "1"}, {HostID: "h", ProcessName: "p", ProcessVPID: "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	events := []*models.Event{
+		{SrcID: 1, DstID: 2, EventClass: "Process", Relation: "fork", Time: 1, EndTime: 1, Count: 1, RawSegment: segments[0]},
+		{SrcID: 1, DstID: 2, EventClass: "Process", Relation: "execve", Time: 200, EndTime: 200, Count: 1, RawSegment: segments[1]},
+	}
+	if _, err := s.InsertEvents(events, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// dry-run 不删除分段
+	if report, err := Purge(store.PurgeOptions{Before: 100, DryRun: true}); err != nil || report.Segments != 0 {
+		t.Fatalf("dry run report %s (%v)", report, err)
+	}
+	report, err := Purge(store.PurgeOptions{Before: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Events != 1 || report.Segments != 2 {
+		t.Fatalf("report %s, want 1 event and 2 segments", report)
+	}
+	left, err := a.Segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0] != segments[1] {
+		t.Fatalf("segments %v left, want %s", left, segments[1])
+	}
+	if _, err := a.Read(archive.Ref{Segment: segments[1], Length: 3}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"erinyes/conf"
 	"erinyes/helper"
 	"erinyes/logs"
+	"erinyes/models"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -51,6 +53,9 @@ const (
 
 const UNKNOWN string = "unknown"
 
+// SysdigFormat sysdig -p 的输出格式，字段顺序与 SplitSysdigLine 一致
+const SysdigFormat = "*%evt.datetime %proc.name %thread.tid %proc.pid %proc.vpid %evt.dir %evt.type %fd.name %proc.ppid %proc.exepath %evt.rawres %container.id %container.name %evt.info"
+
 type SysdigLog struct {
 	Time          int64
 	Tid           string // thread id
@@ -99,6 +104,18 @@ func Convert2Datetime(timestamp int64) (string, error) {
 	return formattedTime, nil
 }
 
+// ValidateSysdigLine 在原始日志入队前检查其格式
+func ValidateSysdigLine(rawLine string) error {
+	fields := strings.Split(rawLine, " ")
+	if len(fields) < 15 {
+		return fmt.Errorf("not enough fileds, got %d", len(fields))
+	}
+	if _, err := Convert2Timestamp(fields[0] + " " + fields[1]); err != nil {
+		return fmt.Errorf("invalid datetime %q", fields[0]+" "+fields[1])
+	}
+	return nil
+}
+
 func SplitSysdigLine(rawLine string) (error, *SysdigLog) {
 	fields := strings.Split(rawLine, " ") // args 在最后
 	if len(fields) < 15 {
@@ -202,6 +219,50 @@ func (s *SysdigLog) MustExtractFourTuple() (string, string, string, string) {
 	return leftIP, leftPort, rightIP, rightPort
 }
 
+// SocketFlow 根据套接字读写事件生成按数据流动方向排列的四元组，无法确定载荷长度时返回 nil
+func (s *SysdigLog) SocketFlow() *FlowTuple {
+	payloadLen, err := strconv.Atoi(s.Ret)
+	if err != nil || payloadLen <= 0 {
+		return nil
+	}
+	localIP, localPort, remoteIP, remotePort := s.MustExtractFourTuple()
+	flow := &FlowTuple{Source: models.FlowSourceSysdig, PayloadLen: payloadLen}
+	switch s.EventType {
+	case SYS_SENDTO, SYS_WRITE: // 本端 -> 远端
+		flow.SrcIP, flow.SrcPort, flow.DstIP, flow.DstPort = localIP, localPort, remoteIP, remotePort
+	case SYS_RECVFROM, SYS_READ: // 远端 -> 本端
+		flow.SrcIP, flow.SrcPort, flow.DstIP, flow.DstPort = remoteIP, remotePort, localIP, localPort
+	default:
+		return nil
+	}
+	return flow
+}
+
+// TransferredBytes 读写类系统调用成功时传输的字节数，其他系统调用为 0
+func (s *SysdigLog) TransferredBytes() int64 {
+	switch s.EventType {
+	case SYS_READ, SYS_READV, SYS_WRITE, SYS_WRITEV, SYS_SENDTO, SYS_RECVFROM:
+	default:
+		return 0
+	}
+	n, err := strconv.ParseInt(s.Ret, 10, 64)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return n
+}
+
+// withAttributes 补充边的 pid、tid、返回值、字节数和原始参数
+func (s *SysdigLog) withAttributes(l ParsedSysdigLog) ParsedSysdigLog {
+	l.Pid, l.Tid = s.Pid, s.Tid
+	if s.Ret != NASTR {
+		l.Ret = s.Ret
+	}
+	l.Bytes = s.TransferredBytes()
+	l.Args = s.Info
+	return l
+}
+
 // ExtractPort 根据 Fd 解析 port，可能回解析失败
 func (s *SysdigLog) ExtractPort() (string, bool) {
 	portRegex := regexp.MustCompile(`:::(\d+)`)
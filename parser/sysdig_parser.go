@@ -8,6 +8,7 @@ import (
 type SysdigParser struct {
 	execveMap map[string]map[string]string // 处理execve
 	pusher    *Pusher
+	host      Host // 当前正在解析的日志所属主机
 }
 
 // NewSysdigParser returns a new  sysdig parser
@@ -22,12 +23,24 @@ func (p *SysdigParser) ParserType() string {
 	return SYSDIG
 }
 
+// ParsePushRawLog 实现 parser 接口
+func (p *SysdigParser) ParsePushRawLog(rawLog RawLog) error {
+	p.host = rawLog.Host
+	defer func() { p.host = Host{} }()
+	return p.pusher.pushRawLog(p, rawLog)
+}
+
 // ParsePushLine 实现 parser 接口
 func (p *SysdigParser) ParsePushLine(rawLine string) error {
+	p.pusher.raw = rawLine // 成对的事件记录退出事件的日志
 	err, sysdigLog := SplitSysdigLine(rawLine)
 	if err != nil {
 		return err
 	}
+	if p.host.ID != "" { // 多主机场景下使用上报方提供的主机标识
+		sysdigLog.HostID = p.host.ID
+		sysdigLog.HostName = p.host.Name
+	}
 	pl := ParsedLog{} // 统一的日志
 	// 根据 sysdigLog 判断生成的点类型、边类型
 	if sysdigLog.IsProcessCall() {
@@ -37,6 +50,7 @@ func (p *SysdigParser) ParsePushLine(rawLine string) error {
 				p.execveMap[key] = make(map[string]string)
 				p.execveMap[key]["process_name"] = sysdigLog.ProcessName
 				p.execveMap[key]["process_exepath"] = sysdigLog.Cmd
+				p.pusher.pin("execve#" + key)
 				return nil
 			}
 			if value, exists := p.execveMap[key]; exists {
@@ -67,6 +81,7 @@ func (p *SysdigParser) ParsePushLine(rawLine string) error {
 					UUID:       sysdigLog.GetLastRequestUUID(), // TODO:可以增加判断逻辑只记录node进程的
 				} // Sysdig日志
 				delete(p.execveMap, key)
+				p.pusher.unpin("execve#" + key)
 			}
 		} else { // clone fork vfork
 			if sysdigLog.Dir == ">" || sysdigLog.Ret == "0" || sysdigLog.Ret == "-1" { // 0 属于父进程 -1表示失败
@@ -147,6 +162,7 @@ func (p *SysdigParser) ParsePushLine(rawLine string) error {
 				Operation:  sysdigLog.EventType,
 				Time:       sysdigLog.Time,
 				UUID:       sysdigLog.GetLastRequestUUID(),
+				Flow:       sysdigLog.SocketFlow(), // connect 没有载荷，为 nil
 			}
 		} else if sysdigLog.EventType == SYS_RECVFROM || sysdigLog.EventType == SYS_READ {
 			if sysdigLog.Fd == NASTR || sysdigLog.Fd == NILSTR || !IsSocket(sysdigLog.Fd) { // 对于不符要求的 socket 类型 fd，直接过滤
@@ -188,6 +204,7 @@ func (p *SysdigParser) ParsePushLine(rawLine string) error {
 				Operation:  sysdigLog.EventType,
 				Time:       sysdigLog.Time,
 				UUID:       sysdigLog.GetLastRequestUUID(),
+				Flow:       sysdigLog.SocketFlow(),
 			}
 		} else if sysdigLog.EventType == SYS_BIND || sysdigLog.EventType == SYS_LISTEN { // 方向与 sendto 一致
 			port, valid := sysdigLog.ExtractPort()
@@ -232,6 +249,7 @@ func (p *SysdigParser) ParsePushLine(rawLine string) error {
 		// 先判断是否为分割日志
 		if sysdigLog.IsNodeTriggerStartLog() {
 			conf.NodeLastRequestUUIDMap[sysdigLog.HostID+"#"+sysdigLog.ContainerID] = sysdigLog.Info[3]
+			p.pusher.pin("node#" + sysdigLog.HostID + "#" + sysdigLog.ContainerID)
 			return nil
 		} else if sysdigLog.IsNodeTriggerEndLog() {
 			// 如果当前的lastuuid是此uuid，则清空；否则，不应该改变
@@ -243,6 +261,7 @@ func (p *SysdigParser) ParsePushLine(rawLine string) error {
 			// 此时lastuuid为b，不应当清空
 			if conf.NodeLastRequestUUIDMap[sysdigLog.HostID+"#"+sysdigLog.ContainerID] == sysdigLog.Info[3] {
 				conf.NodeLastRequestUUIDMap[sysdigLog.HostID+"#"+sysdigLog.ContainerID] = UNKNOWN
+				p.pusher.unpin("node#" + sysdigLog.HostID + "#" + sysdigLog.ContainerID)
 			}
 			return nil
 		} else if sysdigLog.IsOfwatchdogTriggerStartLog() {
@@ -250,12 +269,14 @@ func (p *SysdigParser) ParsePushLine(rawLine string) error {
 				conf.OfwatchdogRequestUUIDMap[sysdigLog.HostID+"#"+sysdigLog.ContainerID] = make(map[string]bool)
 			}
 			conf.OfwatchdogRequestUUIDMap[sysdigLog.HostID+"#"+sysdigLog.ContainerID][sysdigLog.Info[3]] = true
+			p.pusher.pin("ofwatchdog#" + sysdigLog.HostID + "#" + sysdigLog.ContainerID + "#" + sysdigLog.Info[3])
 			return nil
 		} else if sysdigLog.IsOfwatchdogTriggerEndLog() {
 			if _, ok := conf.OfwatchdogRequestUUIDMap[sysdigLog.HostID+"#"+sysdigLog.ContainerID]; !ok {
 				return nil
 			}
 			delete(conf.OfwatchdogRequestUUIDMap[sysdigLog.HostID+"#"+sysdigLog.ContainerID], sysdigLog.Info[3])
+			p.pusher.unpin("ofwatchdog#" + sysdigLog.HostID + "#" + sysdigLog.ContainerID + "#" + sysdigLog.Info[3])
 			return nil
 		}
 
@@ -378,6 +399,9 @@ func (p *SysdigParser) ParsePushLine(rawLine string) error {
 		logs.Logger.Errorf("unknown syscall type is %s", sysdigLog.EventType)
 		return nil
 	}
+	if l, ok := pl.Log.(ParsedSysdigLog); ok {
+		pl.Log = sysdigLog.withAttributes(l)
+	}
 	p.pusher.PushParsedLog(pl)
 	return nil
 }
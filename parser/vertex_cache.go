@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"erinyes/conf"
+	"hash/fnv"
+	"sync"
+)
+
+// vertexCache 顶点唯一键到主键的缓存，按键的哈希分片加锁，避免多个 inserter 协程争用同一把锁
+type vertexCache struct {
+	shards []*cacheShard
+	size   int // 每个分片的最大条目数
+}
+
+type cacheShard struct {
+	mu  sync.RWMutex
+	ids map[string]int
+}
+
+var (
+	vertexIDs     *vertexCache
+	vertexIDsOnce sync.Once
+)
+
+// vertexIDCache 返回按 conf.Config.Inserter 创建的全局顶点缓存
+func vertexIDCache() *vertexCache {
+	vertexIDsOnce.Do(func() {
+		vertexIDs = newVertexCache(conf.Config.Inserter.CacheShards, conf.Config.Inserter.CacheSize)
+	})
+	return vertexIDs
+}
+
+func newVertexCache(shards int, size int) *vertexCache {
+	if shards <= 0 {
+		shards = 64
+	}
+	if size <= 0 {
+		size = 65536
+	}
+	c := &vertexCache{shards: make([]*cacheShard, shards), size: size}
+	for i := range c.shards {
+		c.shards[i] = &cacheShard{ids: make(map[string]int)}
+	}
+	return c
+}
+
+func (c *vertexCache) shard(key string) *cacheShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
+}
+
+func (c *vertexCache) get(key string) (int, bool) {
+	s := c.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.ids[key]
+	return id, ok
+}
+
+// put 写入缓存，分片已满时整体清空，之后未命中的顶点重新从数据库回填
+func (c *vertexCache) put(key string, id int) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.ids) >= c.size {
+		s.ids = make(map[string]int)
+	}
+	s.ids[key] = id
+}
+
+// reset 清空缓存，删除顶点后缓存中的主键可能已经失效
+func (c *vertexCache) reset() {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		s.ids = make(map[string]int)
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,291 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v25.3.0
+// source: ingest.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Ingest_StreamSysdigLogs_FullMethodName = "/erinyes.ingest.v1.Ingest/StreamSysdigLogs"
+	Ingest_StreamNetLogs_FullMethodName    = "/erinyes.ingest.v1.Ingest/StreamNetLogs"
+	Ingest_StreamEvents_FullMethodName     = "/erinyes.ingest.v1.Ingest/StreamEvents"
+)
+
+// IngestClient is the client API for Ingest service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type IngestClient interface {
+	// StreamSysdigLogs 上报原始 sysdig 日志
+	StreamSysdigLogs(ctx context.Context, opts ...grpc.CallOption) (Ingest_StreamSysdigLogsClient, error)
+	// StreamNetLogs 上报原始流量日志
+	StreamNetLogs(ctx context.Context, opts ...grpc.CallOption) (Ingest_StreamNetLogsClient, error)
+	// StreamEvents 上报已经解析好的事件
+	StreamEvents(ctx context.Context, opts ...grpc.CallOption) (Ingest_StreamEventsClient, error)
+}
+
+type ingestClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIngestClient(cc grpc.ClientConnInterface) IngestClient {
+	return &ingestClient{cc}
+}
+
+func (c *ingestClient) StreamSysdigLogs(ctx context.Context, opts ...grpc.CallOption) (Ingest_StreamSysdigLogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Ingest_ServiceDesc.Streams[0], Ingest_StreamSysdigLogs_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ingestStreamSysdigLogsClient{stream}
+	return x, nil
+}
+
+type Ingest_StreamSysdigLogsClient interface {
+	Send(*RawLogBatch) error
+	CloseAndRecv() (*IngestSummary, error)
+	grpc.ClientStream
+}
+
+type ingestStreamSysdigLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *ingestStreamSysdigLogsClient) Send(m *RawLogBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *ingestStreamSysdigLogsClient) CloseAndRecv() (*IngestSummary, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(IngestSummary)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *ingestClient) StreamNetLogs(ctx context.Context, opts ...grpc.CallOption) (Ingest_StreamNetLogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Ingest_ServiceDesc.Streams[1], Ingest_StreamNetLogs_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ingestStreamNetLogsClient{stream}
+	return x, nil
+}
+
+type Ingest_StreamNetLogsClient interface {
+	Send(*RawLogBatch) error
+	CloseAndRecv() (*IngestSummary, error)
+	grpc.ClientStream
+}
+
+type ingestStreamNetLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *ingestStreamNetLogsClient) Send(m *RawLogBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *ingestStreamNetLogsClient) CloseAndRecv() (*IngestSummary, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(IngestSummary)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *ingestClient) StreamEvents(ctx context.Context, opts ...grpc.CallOption) (Ingest_StreamEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Ingest_ServiceDesc.Streams[2], Ingest_StreamEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ingestStreamEventsClient{stream}
+	return x, nil
+}
+
+type Ingest_StreamEventsClient interface {
+	Send(*EventBatch) error
+	CloseAndRecv() (*IngestSummary, error)
+	grpc.ClientStream
+}
+
+type ingestStreamEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *ingestStreamEventsClient) Send(m *EventBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *ingestStreamEventsClient) CloseAndRecv() (*IngestSummary, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(IngestSummary)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// IngestServer is the server API for Ingest service.
+// All implementations must embed UnimplementedIngestServer
+// for forward compatibility
+type IngestServer interface {
+	// StreamSysdigLogs 上报原始 sysdig 日志
+	StreamSysdigLogs(Ingest_StreamSysdigLogsServer) error
+	// StreamNetLogs 上报原始流量日志
+	StreamNetLogs(Ingest_StreamNetLogsServer) error
+	// StreamEvents 上报已经解析好的事件
+	StreamEvents(Ingest_StreamEventsServer) error
+	mustEmbedUnimplementedIngestServer()
+}
+
+// UnimplementedIngestServer must be embedded to have forward compatible implementations.
+type UnimplementedIngestServer struct {
+}
+
+func (UnimplementedIngestServer) StreamSysdigLogs(Ingest_StreamSysdigLogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamSysdigLogs not implemented")
+}
+func (UnimplementedIngestServer) StreamNetLogs(Ingest_StreamNetLogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamNetLogs not implemented")
+}
+func (UnimplementedIngestServer) StreamEvents(Ingest_StreamEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedIngestServer) mustEmbedUnimplementedIngestServer() {}
+
+// UnsafeIngestServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IngestServer will
+// result in compilation errors.
+type UnsafeIngestServer interface {
+	mustEmbedUnimplementedIngestServer()
+}
+
+func RegisterIngestServer(s grpc.ServiceRegistrar, srv IngestServer) {
+	s.RegisterService(&Ingest_ServiceDesc, srv)
+}
+
+func _Ingest_StreamSysdigLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngestServer).StreamSysdigLogs(&ingestStreamSysdigLogsServer{stream})
+}
+
+type Ingest_StreamSysdigLogsServer interface {
+	SendAndClose(*IngestSummary) error
+	Recv() (*RawLogBatch, error)
+	grpc.ServerStream
+}
+
+type ingestStreamSysdigLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *ingestStreamSysdigLogsServer) SendAndClose(m *IngestSummary) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *ingestStreamSysdigLogsServer) Recv() (*RawLogBatch, error) {
+	m := new(RawLogBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Ingest_StreamNetLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngestServer).StreamNetLogs(&ingestStreamNetLogsServer{stream})
+}
+
+type Ingest_StreamNetLogsServer interface {
+	SendAndClose(*IngestSummary) error
+	Recv() (*RawLogBatch, error)
+	grpc.ServerStream
+}
+
+type ingestStreamNetLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *ingestStreamNetLogsServer) SendAndClose(m *IngestSummary) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *ingestStreamNetLogsServer) Recv() (*RawLogBatch, error) {
+	m := new(RawLogBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Ingest_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngestServer).StreamEvents(&ingestStreamEventsServer{stream})
+}
+
+type Ingest_StreamEventsServer interface {
+	SendAndClose(*IngestSummary) error
+	Recv() (*EventBatch, error)
+	grpc.ServerStream
+}
+
+type ingestStreamEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *ingestStreamEventsServer) SendAndClose(m *IngestSummary) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *ingestStreamEventsServer) Recv() (*EventBatch, error) {
+	m := new(EventBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Ingest_ServiceDesc is the grpc.ServiceDesc for Ingest service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ingest_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "erinyes.ingest.v1.Ingest",
+	HandlerType: (*IngestServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamSysdigLogs",
+			Handler:       _Ingest_StreamSysdigLogs_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamNetLogs",
+			Handler:       _Ingest_StreamNetLogs_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _Ingest_StreamEvents_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ingest.proto",
+}
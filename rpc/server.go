@@ -0,0 +1,246 @@
+package rpc
+
+import (
+	"encoding/json"
+	"erinyes/conf"
+	"erinyes/logs"
+	"erinyes/parser"
+	"erinyes/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+	"time"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ingest.proto
+
+const maxSummaryErrors = 20 // 汇总消息中最多返回的错误详情数
+
+// server 实现 IngestServer，日志经过校验后放入与 HTTP 上报相同的持久化队列或原始日志 chan
+type server struct {
+	UnimplementedIngestServer
+}
+
+// Serve 在 addr（如 ":9090"）上启动 gRPC 上报服务，阻塞直到服务退出
+func Serve(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	var opts []grpc.ServerOption
+	if conf.Config.GRPC.MaxRecvMsgBytes > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(conf.Config.GRPC.MaxRecvMsgBytes))
+	}
+	if conf.Config.GRPC.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(conf.Config.GRPC.MaxConcurrentStreams))
+	}
+	s := grpc.NewServer(opts...)
+	RegisterIngestServer(s, &server{})
+	logs.Logger.Infof("gRPC ingest service listening on %s", addr)
+	return s.Serve(lis)
+}
+
+func (s *server) StreamSysdigLogs(stream Ingest_StreamSysdigLogsServer) error {
+	return s.streamRawLogs(stream, parser.SYSDIG)
+}
+
+func (s *server) StreamNetLogs(stream Ingest_StreamNetLogsServer) error {
+	return s.streamRawLogs(stream, parser.NET)
+}
+
+// rawLogStream StreamSysdigLogs 与 StreamNetLogs 的公共部分
+type rawLogStream interface {
+	grpc.ServerStream
+	Recv() (*RawLogBatch, error)
+	SendAndClose(*IngestSummary) error
+}
+
+func (s *server) streamRawLogs(stream rawLogStream, parserType string) error {
+	st, err := newStreamState(stream, parserType)
+	if err != nil {
+		return err
+	}
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(st.summary)
+		} else if err != nil {
+			return err
+		}
+		st.setHost(batch.GetHost())
+		if err := st.ingest(batch.GetLines()); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) StreamEvents(stream Ingest_StreamEventsServer) error {
+	st, err := newStreamState(stream, parser.EVENT)
+	if err != nil {
+		return err
+	}
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(st.summary)
+		} else if err != nil {
+			return err
+		}
+		st.setHost(batch.GetHost())
+		lines := make([]string, 0, len(batch.GetEvents()))
+		for _, event := range batch.GetEvents() {
+			line, err := json.Marshal(convertEvent(event))
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			lines = append(lines, string(line))
+		}
+		if err := st.ingest(lines); err != nil {
+			return err
+		}
+	}
+}
+
+// streamState 一个上报流的状态，主机标识和数据集对整个流生效
+type streamState struct {
+	stream     grpc.ServerStream
+	parserType string
+	host       parser.Host
+	hostSet    bool
+	dataset    string
+	index      int64 // 下一条日志在整个流中的下标
+	summary    *IngestSummary
+}
+
+// newStreamState 从 metadata 中读取主机标识和数据集，数据集名称不合法时拒绝整个流
+func newStreamState(stream grpc.ServerStream, parserType string) (*streamState, error) {
+	st := &streamState{stream: stream, parserType: parserType, summary: &IngestSummary{}}
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
+		if datasets := md.Get("dataset"); len(datasets) > 0 && datasets[0] != "" {
+			if err := store.ValidateDataset(datasets[0]); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			st.dataset = datasets[0]
+		}
+		if ids := md.Get("host-id"); len(ids) > 0 && ids[0] != "" {
+			st.host.ID = ids[0]
+			if names := md.Get("host-name"); len(names) > 0 {
+				st.host.Name = names[0]
+			}
+			st.hostSet = true
+		}
+	}
+	return st, nil
+}
+
+// setHost metadata 中没有主机标识时，使用流的第一条消息中的主机标识
+func (st *streamState) setHost(host *HostIdentity) {
+	if st.hostSet {
+		return
+	}
+	st.hostSet = true
+	if host.GetHostId() != "" {
+		st.host = parser.Host{ID: host.GetHostId(), Name: host.GetHostName()}
+	}
+}
+
+// ingest 校验一批日志并放入解析流水线
+// 与 HTTP 接口不同，缓冲区已满时阻塞直到有空间，由 HTTP/2 的流量控制把压力传回客户端
+func (st *streamState) ingest(lines []string) error {
+	st.summary.Batches++
+	var valid []parser.RawLog
+	for _, line := range lines {
+		idx := st.index
+		st.index++
+		if err := parser.ValidateRawLine(st.parserType, line); err != nil {
+			st.summary.Rejected++
+			if len(st.summary.Errors) < maxSummaryErrors {
+				st.summary.Errors = append(st.summary.Errors, &IngestError{Index: idx, Error: err.Error()})
+			}
+			continue
+		}
+		valid = append(valid, parser.RawLog{Line: line, Host: st.host, Dataset: st.dataset})
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+
+	ctx := st.stream.Context()
+	retryAfter := time.Duration(conf.Config.Ingest.RetryAfter) * time.Second
+	if queue := parser.IngestQueue(st.parserType); queue != nil {
+		for conf.Config.Ingest.WAL.MaxBytes > 0 && queue.Backlog() > conf.Config.Ingest.WAL.MaxBytes {
+			select {
+			case <-ctx.Done():
+				return status.FromContextError(ctx.Err()).Err()
+			case <-time.After(retryAfter):
+			}
+		}
+		payloads := make([][]byte, 0, len(valid))
+		for _, rawLog := range valid {
+			payload, err := parser.EncodeQueuedLog(rawLog)
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			payloads = append(payloads, payload)
+		}
+		if err := queue.Append(payloads); err != nil {
+			logs.Logger.WithError(err).Errorf("append %s logs to queue failed", st.parserType)
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		st.summary.Accepted += int64(len(payloads))
+		return nil
+	}
+
+	if !parser.WaitRawChanReady(time.Duration(conf.Config.Ingest.ReadyTimeout) * time.Second) {
+		return status.Error(codes.Unavailable, "log pipeline is not ready")
+	}
+	rawChan := parser.RawChan(st.parserType)
+	for _, rawLog := range valid {
+		select {
+		case rawChan <- rawLog:
+			st.summary.Accepted++
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return nil
+}
+
+// convertEvent 将 protobuf 中的事件转换为 EventParser 解析的结构化事件
+func convertEvent(e *Event) parser.StructuredEvent {
+	return parser.StructuredEvent{
+		Src:        convertVertex(e.GetSrc()),
+		Dst:        convertVertex(e.GetDst()),
+		Relation:   e.GetRelation(),
+		Time:       e.GetTime(),
+		UUID:       e.GetUuid(),
+		PayloadLen: int(e.GetPayloadLen()),
+		SeqNum:     int(e.GetSeqNum()),
+		AckNum:     int(e.GetAckNum()),
+	}
+}
+
+func convertVertex(v *Vertex) parser.EventVertex {
+	vertex := parser.EventVertex{
+		ContainerID:   v.GetContainerId(),
+		ContainerName: v.GetContainerName(),
+	}
+	switch entity := v.GetEntity().(type) {
+	case *Vertex_Process:
+		vertex.Type = parser.EventVertexProcess
+		vertex.ProcessVPID = entity.Process.GetVpid()
+		vertex.ProcessName = entity.Process.GetName()
+		vertex.ProcessExepath = entity.Process.GetExePath()
+	case *Vertex_File:
+		vertex.Type = parser.EventVertexFile
+		vertex.FilePath = entity.File.GetPath()
+	case *Vertex_Socket:
+		vertex.Type = parser.EventVertexSocket
+		vertex.IP = entity.Socket.GetIp()
+		vertex.Port = entity.Socket.GetPort()
+	} // 缺少 entity 时 Type 为空，由校验阶段报错
+	return vertex
+}
@@ -23,95 +23,101 @@ type Data struct {
 	Top10SysCount  []int    `json:"top10SysCount"`
 }
 
-// HandleDashboard 返回数据库中的主机数量、容器数量、顶点数量（进程、文件和套接字数量）和边（流量日志、审计日志）数量、产生活动最多的5个请求
+// HandleDashboard 返回数据集（查询参数 dataset，为空时为默认数据集）中的主机数量、容器数量、顶点数量（进程、文件和套接字数量）和边（流量日志、审计日志）数量、产生活动最多的5个请求
 func HandleDashboard(c *gin.Context) {
 	var data Data
 	hostSet := make(map[string]int)
 	containerSet := make(map[string]int)
-	db := models.GetMysqlDB()
+	s, err := datasetStore(c.Query("dataset"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
 	pageSize := 500 // 分页查，防止内存消耗太大
 
-	pageNumber := 1
+	lastID := 0
 	for {
-		var processes []models.Process
-		db.Order("id").Limit(pageSize).Offset((pageNumber - 1) * pageSize).Find(&processes)
+		processes, _ := s.ScanProcesses(lastID, pageSize)
 		if len(processes) == 0 {
 			break
 		}
 		data.ProcessCount += len(processes)
 		for _, process := range processes { // 遍历所有进程顶点
+			lastID = process.ID
 			hostSet[process.HostID] += 1
 			containerSet[process.ContainerID] += 1
 		}
-		pageNumber++
 	}
 
-	pageNumber = 1
+	lastID = 0
 	for {
-		var files []models.File
-		db.Order("id").Limit(pageSize).Offset((pageNumber - 1) * pageSize).Find(&files)
+		files, _ := s.ScanFiles(lastID, pageSize)
 		if len(files) == 0 {
 			break
 		}
 		data.FileCount += len(files)
 		for _, file := range files { // 遍历所有进程顶点
+			lastID = file.ID
 			hostSet[file.HostID] += 1
 			containerSet[file.ContainerID] += 1
 		}
-		pageNumber++
 	}
 
-	pageNumber = 1
+	lastID = 0
 	for {
-		var sockets []models.Socket
-		db.Order("id").Limit(pageSize).Offset((pageNumber - 1) * pageSize).Find(&sockets)
+		sockets, _ := s.ScanSockets(lastID, pageSize)
 		if len(sockets) == 0 {
 			break
 		}
 		data.SocketCount += len(sockets)
 		for _, socket := range sockets { // 遍历所有进程顶点
+			lastID = socket.ID
 			hostSet[socket.HostID] += 1
 			containerSet[socket.ContainerID] += 1
 		}
-		pageNumber++
 	}
 	data.TotalNode = data.ProcessCount + data.FileCount + data.SocketCount
 	data.HostCount = len(hostSet)
 	data.ContainerCount = len(containerSet)
 
-	pageNumber = 1
 	syscallMap := make(map[string]int)
 	uuidMap := make(map[string]int)
+	mergedEvents, mergedNets := s.MergedCaptureEdges() // 已与 sysdig 事件关联的流量边不重复计数
+	lastID = 0
 	for {
-		var events []models.Event
-		db.Order("id").Limit(pageSize).Offset((pageNumber - 1) * pageSize).Find(&events)
+		events, _ := s.ScanEvents(lastID, pageSize, "")
 		if len(events) == 0 {
 			break
 		}
-		data.SysdigCount += len(events)
 		for _, event := range events {
-			if event.UUID != "" && event.UUID != "unknown" {
-				uuidMap[event.UUID] += 1
+			lastID = event.ID
+			if mergedEvents[event.ID] {
+				continue
+			}
+			data.SysdigCount += 1
+			for _, uuid := range models.SplitUUIDs(event.UUID) {
+				uuidMap[uuid] += 1
 			}
 			syscallMap[event.Relation] += 1
 		}
-		pageNumber++
 	}
 
-	pageNumber = 1
+	lastID = 0
 	for {
-		var nets []models.Net
-		db.Order("id").Limit(pageSize).Offset((pageNumber - 1) * pageSize).Find(&nets)
+		nets, _ := s.ScanNets(lastID, pageSize, "")
 		if len(nets) == 0 {
 			break
 		}
-		data.NetCount += len(nets)
 		for _, net := range nets {
-			if net.UUID != "" && net.UUID != "unknown" {
-				uuidMap[net.UUID] += 1
+			lastID = net.ID
+			if mergedNets[net.ID] {
+				continue
+			}
+			data.NetCount += 1
+			for _, uuid := range models.SplitUUIDs(net.UUID) {
+				uuidMap[uuid] += 1
 			}
 		}
-		pageNumber++
 	}
 
 	data.TotalEdge = data.SysdigCount + data.NetCount
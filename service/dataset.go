@@ -0,0 +1,34 @@
+package service
+
+import (
+	"erinyes/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// datasetStore 返回限定在请求指定的数据集内的存储，未指定时使用默认数据集
+func datasetStore(dataset string) (store.Store, error) {
+	if dataset == "" {
+		return store.GetStore(), nil
+	}
+	if err := store.ValidateDataset(dataset); err != nil {
+		return nil, err
+	}
+	return store.GetStore().WithDataset(dataset), nil
+}
+
+// HandleDatasets 返回所有数据集及其中各类记录的数量
+func HandleDatasets(c *gin.Context) {
+	manager, ok := store.GetStore().(store.DatasetManager)
+	if !ok {
+		s := store.GetStore()
+		c.JSON(http.StatusOK, gin.H{"code": 20000, "message": "success", "data": []store.DatasetInfo{{Name: s.Dataset()}}})
+		return
+	}
+	datasets, err := manager.ListDatasets()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 20000, "message": "success", "data": datasets})
+}
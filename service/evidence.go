@@ -0,0 +1,92 @@
+package service
+
+import (
+	"erinyes/builder"
+	"erinyes/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// EdgeRef 标识 event 或 net 表中的一条边
+type EdgeRef struct {
+	Table string `json:"table"` // event 或 net
+	ID    int    `json:"id"`
+}
+
+type QueryEvidence struct {
+	Edges   []EdgeRef           `json:"edges"`   // 查询指定的边，为空时查询 uuid 对应请求子图中的所有边
+	UUID    string              `json:"uuid"`    // 与 /api/graph 相同，确定请求子图
+	Filter  builder.EventFilter `json:"filter"`  // 过滤请求子图中的 event 边
+	Dataset string              `json:"dataset"` // 请求子图所在的数据集，为空时使用默认数据集
+}
+
+// HandleEvidence 返回边对应的原始日志，用于在报告中引用一手证据
+func HandleEvidence(c *gin.Context) {
+	var req QueryEvidence
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
+	s, err := datasetStore(req.Dataset)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
+	var edges []builder.RecordLoc
+	if len(req.Edges) > 0 {
+		for _, e := range req.Edges {
+			edges = append(edges, builder.RecordLoc{Key: e.ID, Table: e.Table})
+		}
+	} else if req.UUID != "" {
+		if edges, err = requestEdges(s, req.UUID, req.Filter); err != nil {
+			c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+			return
+		}
+	} else {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": "请指定edges或uuid"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 20000, "message": "success", "data": builder.FetchEvidence(s, edges)})
+}
+
+// requestEdges 返回请求子图中的所有边，与 searchAllGraph 展示的边一致
+func requestEdges(s store.Store, uuid string, filter builder.EventFilter) ([]builder.RecordLoc, error) {
+	var edges []builder.RecordLoc
+	pageSize := 100
+	mergedEvents, mergedNets := s.MergedCaptureEdges()
+	lastID := 0
+	for {
+		events, err := s.ScanEvents(lastID, pageSize, uuid)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, event := range events {
+			lastID = event.ID
+			if mergedEvents[event.ID] || !filter.Match(event) {
+				continue
+			}
+			edges = append(edges, builder.RecordLoc{Key: event.ID, Table: event.TableName()})
+		}
+	}
+	lastID = 0
+	for {
+		nets, err := s.ScanNets(lastID, pageSize, uuid)
+		if err != nil {
+			return nil, err
+		}
+		if len(nets) == 0 {
+			break
+		}
+		for _, net := range nets {
+			lastID = net.ID
+			if mergedNets[net.ID] {
+				continue
+			}
+			edges = append(edges, builder.RecordLoc{Key: net.ID, Table: net.TableName()})
+		}
+	}
+	return edges, nil
+}
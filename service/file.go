@@ -10,6 +10,7 @@ type QueryFile struct {
 	CurrPage int    `json:"curr_page"`
 	PageSize int    `json:"page_size"`
 	Query    string `json:"query"`
+	Dataset  string `json:"dataset"` // 为空时查询默认数据集
 }
 
 type DataFile struct {
@@ -34,15 +35,16 @@ func HandleFile(c *gin.Context) {
 		pageSize = 10
 	}
 
-	// 构建模糊查询语句
-	query := "%" + req.Query + "%"
-	var total int64
-	db := models.GetMysqlDB()
-	db.Model(&models.File{}).Where("file_path LIKE ?", query).Count(&total)
-
-	var files []models.File
-	offset := (page - 1) * pageSize
-	db.Where("file_path LIKE ?", query).Order("id").Offset(offset).Limit(pageSize).Find(&files)
+	s, err := datasetStore(req.Dataset)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
+	files, total, err := s.SearchFiles(req.Query, (page-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
 	var data DataFile
 	data.Files = files
 	data.Total = total
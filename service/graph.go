@@ -1,22 +1,37 @@
 package service
 
 import (
-	"erinyes/helper"
-	"erinyes/logs"
+	"erinyes/builder"
 	"erinyes/models"
-	"erinyes/parser"
+	"erinyes/store"
 	"github.com/gin-gonic/gin"
+	"gonum.org/v1/gonum/graph/multi"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type QueryGraph struct {
-	IfAllGraph  bool   `json:"ifAllGraph"` // 若为true，则返回全图；否则，根据指定进程节点进行查询
-	UUID        string `json:"uuid"`       // 根据特定请求进行查询。若为空，则忽略。
-	HostID      string `json:"hostID"`     // <HostID, ContainerID, VPid, ProcessName>唯一定位一个进程节点，只有IfAllGraph为false才有用
-	ContainerID string `json:"containerID"`
-	VPid        string `json:"vpid"`
-	ProcessName string `json:"processName"`
+	IfAllGraph  bool                `json:"ifAllGraph"` // 若为true，则返回全图；否则，根据指定进程节点进行查询
+	UUID        string              `json:"uuid"`       // 根据特定请求进行查询。若为空，则忽略。
+	HostID      string              `json:"hostID"`     // <HostID, ContainerID, VPid, ProcessName>唯一定位一个进程节点，只有IfAllGraph为false才有用
+	ContainerID string              `json:"containerID"`
+	VPid        string              `json:"vpid"`
+	ProcessName string              `json:"processName"`
+	Filter      builder.EventFilter `json:"filter"`    // 按 pid、tid、返回值、字节数、参数过滤 event 边
+	Dataset     string              `json:"dataset"`   // 查询的数据集，为空时使用默认数据集
+	Depth       *int                `json:"depth"`     // 溯源的最大层数，为空时不限制，只有IfAllGraph为false才有用
+	Direction   string              `json:"direction"` // 溯源方向：backward（默认）、forward 或 both，只有IfAllGraph为false才有用
+	// Roots 溯源的起点（进程、文件、socket 或请求），可以有多个，为空时使用上面的进程，只有IfAllGraph为false才有用
+	Roots []builder.Root `json:"roots"`
+	// 以下限制只有IfAllGraph为false才有用：From、To 为边的时间范围（16 位微秒时间戳），其余为 0 或为空时使用配置 Provenance 中的默认值
+	// MaxNodes、MaxEdges、Timeout 只能比配置的值更严格，超过时使用配置的值
+	From     int64    `json:"from"`
+	To       int64    `json:"to"`
+	MaxNodes int      `json:"maxNodes"`
+	MaxEdges int      `json:"maxEdges"`
+	Timeout  int      `json:"timeout"` // 单位秒
+	Exclude  []string `json:"exclude"` // 追加在配置的排除条件之后
 }
 
 type DataGraph struct { // 响应体
@@ -25,6 +40,9 @@ type DataGraph struct { // 响应体
 	Categories []Category     `json:"categories"`
 	Stat       StatDetail     `json:"stat"`
 	Syscalls   map[string]int `json:"syscalls"`
+	// Truncated 溯源子图被截断的原因：max_nodes、max_edges、timeout、canceled 或 error，未截断或全图时为空
+	Truncated       builder.Truncation `json:"truncated,omitempty"`
+	TruncatedReason string             `json:"truncatedReason,omitempty"`
 }
 
 type StatDetail struct {
@@ -44,13 +62,16 @@ type Node struct {
 	Category int    `json:"category"` // 顶点的类别，值为Category数组的下标
 	Symbol   string `json:"symbol"`   // 顶点的形状：rect、circle、diamond
 	Info     string `json:"info"`     // 详情，用空行表示换行即可，前端会处理
+	// Direction 溯源子图中从哪个方向到达该顶点：root、backward、forward 或 both，全图中为空
+	Direction builder.Direction `json:"direction,omitempty"`
 }
 
 type Link struct {
-	Source string `json:"source"` // 起点，Node中的ID字段
-	Target string `json:"target"` // 终点，Node中的ID字段
-	Name   string `json:"name"`   //边的Label
-	Info   string `json:"info"`   // 详情
+	Source string  `json:"source"` // 起点，Node中的ID字段
+	Target string  `json:"target"` // 终点，Node中的ID字段
+	Name   string  `json:"name"`   //边的Label
+	Info   string  `json:"info"`   // 详情
+	Edge   EdgeRef `json:"edge"`   // 边在数据库中的位置，用于查询原始日志
 }
 
 type Category struct { // 类别按照容器进行区分
@@ -64,19 +85,106 @@ func HandleGraph(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
 		return
 	}
+	s, err := datasetStore(req.Dataset)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
 	if req.IfAllGraph { // 搜索全图
-		g := searchAllGraph(req.UUID, false)
+		g := searchAllGraph(s, req.UUID, req.Filter, false)
 		//fmt.Println(g)
 		c.JSON(http.StatusOK, gin.H{"code": 20000, "message": "success", "data": g})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"code": 40001, "message": "请设置IfAllGraph未true"})
-	return
+	direction, err := builder.ParseDirection(req.Direction)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
+	roots := req.Roots
+	if len(roots) == 0 {
+		roots = []builder.Root{builder.ProcessRootOf(req.HostID, req.ContainerID, req.VPid, req.ProcessName)}
+	}
+	opts := builder.DefaultOptions()
+	opts.Direction, opts.Depth, opts.UUID, opts.Filter = direction, req.Depth, req.UUID, req.Filter
+	opts.From, opts.To = req.From, req.To
+	opts.Exclude = append(opts.Exclude, req.Exclude...)
+	opts.MaxNodes = clampLimit(opts.MaxNodes, req.MaxNodes)
+	opts.MaxEdges = clampLimit(opts.MaxEdges, req.MaxEdges)
+	opts.Timeout = time.Duration(clampLimit(int(opts.Timeout/time.Second), req.Timeout)) * time.Second
+	// 使用请求的 ctx，客户端断开后停止溯源
+	sub, err := builder.ProvenanceFrom(c.Request.Context(), s, roots, opts)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40004, "message": err.Error()})
+		return
+	}
+	graph := searchSubGraph(s, sub.Graph)
+	graph.Truncated, graph.TruncatedReason = sub.Truncated, sub.Reason
+	c.JSON(http.StatusOK, gin.H{"code": 20000, "message": "success", "data": graph})
+}
+
+// clampLimit 请求中的上限不超过配置的上限 configured（为 0 时不限制），请求为 0 时使用配置的上限
+func clampLimit(configured int, requested int) int {
+	if requested > 0 && (configured == 0 || requested < configured) {
+		return requested
+	}
+	return configured
+}
+
+// searchSubGraph 将 builder.Provenance 生成的溯源子图转换为与全图相同的格式，顶点标记到达的方向
+func searchSubGraph(s store.Store, sub *multi.WeightedDirectedGraph) DataGraph {
+	var graph DataGraph
+	nodeMap := make(map[string]bool)
+	var nodeSlice []Node
+	categoryMap := make(map[string]int)
+	var categorySlice []Category
+	var linkSlice []Link
+
+	processNum, fileNum, socketNum := 0, 0, 0
+	syscallMap := make(map[string]int)
+
+	for _, edge := range builder.SubgraphEdges(sub) {
+		switch edge.Table {
+		case (models.Event{}).TableName():
+			event, err := s.GetEvent(edge.Key)
+			if err != nil {
+				continue
+			}
+			event.Method = s.LinkedMethods([]int{event.ID})[event.ID]
+			start, end, ok := builder.EventVertices(s, event)
+			if !ok {
+				continue
+			}
+			generateLink(start, end, event, EdgeRef{Table: edge.Table, ID: edge.Key}, &linkSlice, &nodeMap, &nodeSlice, &categoryMap, &categorySlice, &processNum, &fileNum, &socketNum, &syscallMap)
+			graph.Stat.EventNum += 1
+		case (models.Net{}).TableName():
+			net, err := s.GetNet(edge.Key)
+			if err != nil {
+				continue
+			}
+			start, end, ok := builder.NetVertices(s, net)
+			if !ok {
+				continue
+			}
+			generateLink(start, end, net, EdgeRef{Table: edge.Table, ID: edge.Key}, &linkSlice, &nodeMap, &nodeSlice, &categoryMap, &categorySlice, &processNum, &fileNum, &socketNum, &syscallMap)
+			graph.Stat.NetNum += 1
+		}
+	}
+	reached := make(map[string]builder.Direction)
+	nodes := sub.Nodes()
+	for nodes.Next() {
+		n := nodes.Node().(builder.GraphNode)
+		reached[n.LinkID()] = n.Reached()
+	}
+	for i := range nodeSlice {
+		nodeSlice[i].Direction = reached[nodeSlice[i].ID]
+	}
+	fillGraph(&graph, nodeSlice, linkSlice, categorySlice, processNum, fileNum, socketNum, syscallMap)
+	return graph
 }
 
 // searchAllGraph搜索全图
-func searchAllGraph(uuid string, demo bool) DataGraph {
-	db := models.GetMysqlDB()
+func searchAllGraph(s store.Store, uuid string, filter builder.EventFilter, demo bool) DataGraph {
 	var graph DataGraph
 	nodeMap := make(map[string]bool)    //顶点唯一标识符集合
 	var nodeSlice []Node                // 存放所有的Node
@@ -89,108 +197,70 @@ func searchAllGraph(uuid string, demo bool) DataGraph {
 
 	// 遍历 Event 表和 Net 表
 	pageSize := 100
-	pageNumber := 1
+	mergedEvents, mergedNets := s.MergedCaptureEdges() // 已与 sysdig 事件关联的流量边不再重复展示
 	// 1. 遍历 Event 表
-	for {
+	lastID := 0
+	for pageNumber := 1; ; pageNumber++ {
 		if demo && pageNumber == 2 {
 			break
 		}
-		var events []models.Event
-		db.Order("id").Limit(pageSize).Offset((pageNumber - 1) * pageSize).Find(&events)
+		events, _ := s.ScanEvents(lastID, pageSize, uuid)
 		if len(events) == 0 {
 			break
 		}
+		eventIDs := make([]int, 0, len(events))
+		for _, event := range events {
+			eventIDs = append(eventIDs, event.ID)
+		}
+		methods := s.LinkedMethods(eventIDs)
 		for _, event := range events { // 遍历所有边
-			var start models.DotVertex
-			var end models.DotVertex
-			switch event.EventClass { // eventType 决定了从哪两个表中查询数据
-			case parser.PROCESS: // process -> process
-				var startProcess models.Process
-				var endProcess models.Process
-				result1 := startProcess.FindByID(db, event.SrcID)
-				result2 := endProcess.FindByID(db, event.DstID)
-				if !(result1 && result2) {
-					continue
-				}
-				start = startProcess
-				end = endProcess
-			case parser.FILEV1: // process -> file
-				var startProcess models.Process
-				var endFile models.File
-				result1 := startProcess.FindByID(db, event.SrcID)
-				result2 := endFile.FindByID(db, event.DstID)
-				if !(result1 && result2) {
-					continue
-				}
-				start = startProcess
-				end = endFile
-			case parser.FILEV2: // file -> process
-				var startFile models.File
-				var endProcess models.Process
-				result1 := startFile.FindByID(db, event.SrcID)
-				result2 := endProcess.FindByID(db, event.DstID)
-				if !(result1 && result2) {
-					continue
-				}
-				start = startFile
-				end = endProcess
-			case parser.NETWORKV1: // process -> socket
-				var startProcess models.Process
-				var endSocket models.Socket
-				result1 := startProcess.FindByID(db, event.SrcID)
-				result2 := endSocket.FindByID(db, event.DstID)
-				if !(result1 && result2) {
-					continue
-				}
-				start = startProcess
-				end = endSocket
-			case parser.NETWORKV2: // socket -> process
-				var startSocket models.Socket
-				var endProcess models.Process
-				result1 := startSocket.FindByID(db, event.SrcID)
-				result2 := endProcess.FindByID(db, event.DstID)
-				if !(result1 && result2) {
-					continue
-				}
-				start = startSocket
-				end = endProcess
-			default:
-				logs.Logger.Warnf("Unknown event class: %s in event tables", event.EventClass)
+			lastID = event.ID
+			if mergedEvents[event.ID] || !filter.Match(event) {
+				continue
 			}
-			r := generateLink(start, end, event, &linkSlice, uuid, &nodeMap, &nodeSlice, &categoryMap, &categorySlice, &processNum, &fileNum, &socketNum, &syscallMap)
+			event.Method = methods[event.ID]
+			start, end, ok := builder.EventVertices(s, event)
+			if !ok {
+				continue
+			}
+			r := generateLink(start, end, event, EdgeRef{Table: event.TableName(), ID: event.ID}, &linkSlice, &nodeMap, &nodeSlice, &categoryMap, &categorySlice, &processNum, &fileNum, &socketNum, &syscallMap)
 			if r == true {
 				graph.Stat.EventNum += 1
 			}
 		}
-		pageNumber++
 	}
 
 	// 2. 遍历 Net 表
-	pageNumber = 1
-	for {
+	lastID = 0
+	for pageNumber := 1; ; pageNumber++ {
 		if demo && pageNumber == 2 {
 			break
 		}
-		var nets []models.Net
-		db.Order("id").Limit(pageSize).Offset((pageNumber - 1) * pageSize).Find(&nets)
+		nets, _ := s.ScanNets(lastID, pageSize, uuid)
 		if len(nets) == 0 {
 			break
 		}
 		for _, net := range nets {
-			var startSocket models.Socket
-			var endSocket models.Socket
-			result1 := startSocket.FindByID(db, net.SrcID)
-			result2 := endSocket.FindByID(db, net.DstID)
-			if !(result1 && result2) {
+			lastID = net.ID
+			if mergedNets[net.ID] {
+				continue
+			}
+			start, end, ok := builder.NetVertices(s, net)
+			if !ok {
 				continue
 			}
-			r := generateLink(startSocket, endSocket, net, &linkSlice, uuid, &nodeMap, &nodeSlice, &categoryMap, &categorySlice, &processNum, &fileNum, &socketNum, &syscallMap)
+			r := generateLink(start, end, net, EdgeRef{Table: net.TableName(), ID: net.ID}, &linkSlice, &nodeMap, &nodeSlice, &categoryMap, &categorySlice, &processNum, &fileNum, &socketNum, &syscallMap)
 			if r == true {
 				graph.Stat.NetNum += 1
 			}
 		}
-		pageNumber++
 	}
+	fillGraph(&graph, nodeSlice, linkSlice, categorySlice, processNum, fileNum, socketNum, syscallMap)
+	return graph
+}
+
+// fillGraph 填入顶点、边、类别及统计信息
+func fillGraph(graph *DataGraph, nodeSlice []Node, linkSlice []Link, categorySlice []Category, processNum int, fileNum int, socketNum int, syscallMap map[string]int) {
 	graph.Links = linkSlice
 	graph.Nodes = nodeSlice
 	graph.Categories = categorySlice
@@ -206,24 +276,13 @@ func searchAllGraph(uuid string, demo bool) DataGraph {
 	graph.Stat.SocketNum = socketNum
 	graph.Stat.SyscallNum = len(syscallMap)
 	graph.Syscalls = syscallMap
-	return graph
 }
 
 // generateLink 在结构体g中生成link
-func generateLink(startVertex models.DotVertex, endVertex models.DotVertex, edge models.DotEdge,
-	linkSlice *[]Link, uuid string, nodeMap *map[string]bool, nodeSlice *[]Node,
+func generateLink(startVertex models.DotVertex, endVertex models.DotVertex, edge models.DotEdge, ref EdgeRef,
+	linkSlice *[]Link, nodeMap *map[string]bool, nodeSlice *[]Node,
 	categoryMap *map[string]int, categorySlice *[]Category, processNum *int, fileNum *int, socketNum *int, syscallMap *map[string]int) bool {
-	if uuid != "" {
-		if !edge.HasEdgeUUID() {
-			return false
-		}
-		uuidStr := edge.GetUUID()
-		uuids := strings.Split(uuidStr, ",")
-		if !helper.SliceContainsTarget(uuids, uuid) {
-			return false
-		}
-	}
-	var l Link // 一定会产生一个连接，但不一定会有新的节点
+	l := Link{Edge: ref} // 一定会产生一个连接，但不一定会有新的节点
 	l.Name = edge.LinkLabel()
 	l.Info = edge.LinkInfo()
 	(*syscallMap)[edge.LinkLabel()] += 1
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"erinyes/conf"
+	"erinyes/logs"
+	"erinyes/parser"
+	"erinyes/store"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type GeneralLogData struct {
+	Log string `json:"log"`
+}
+
+type GeneralLogsData struct {
+	Logs []string `json:"logs"`
+}
+
+// IngestResult 日志上报接口的响应体
+type IngestResult struct {
+	Accepted int           `json:"accepted"`       // 成功放入缓冲区的日志数
+	Rejected int           `json:"rejected"`       // 格式校验失败的日志数
+	Next     int           `json:"next,omitempty"` // 缓冲区已满时，客户端应从该下标开始重新上报
+	Errors   []IngestError `json:"errors,omitempty"`
+}
+
+type IngestError struct {
+	Index int    `json:"index"` // 日志在请求中的下标
+	Error string `json:"error"`
+}
+
+const maxIngestErrors = 20 // 响应中最多返回的错误详情数
+
+// 上报方通过请求头提供主机标识，未提供时使用 mock 的主机；数据集未提供时写入默认数据集
+const (
+	HeaderHostID   = "X-Host-ID"
+	HeaderHostName = "X-Host-Name"
+	HeaderDataset  = "X-Dataset"
+)
+
+// ingestLine 请求体中的一条日志，err 不为空表示该条日志在解码阶段就已失败
+type ingestLine struct {
+	raw string
+	err error
+}
+
+func HandleSysdigLog(c *gin.Context) {
+	ingest(c, parser.SYSDIG, true)
+}
+
+func HandleSysdigLogs(c *gin.Context) {
+	ingest(c, parser.SYSDIG, false)
+}
+
+func HandleNetLog(c *gin.Context) {
+	ingest(c, parser.NET, true)
+}
+
+func HandleNetLogs(c *gin.Context) {
+	ingest(c, parser.NET, false)
+}
+
+// ingest 校验请求中的原始日志并放入解析流水线
+// 启用持久化队列时，日志 fsync 落盘后才返回 200；否则直接放入 chan，缓冲区已满时返回 429 而不是阻塞
+func ingest(c *gin.Context, parserType string, single bool) {
+	retryAfter := strconv.Itoa(conf.Config.Ingest.RetryAfter)
+	queue := parser.IngestQueue(parserType)
+	if queue == nil && !parser.WaitRawChanReady(time.Duration(conf.Config.Ingest.ReadyTimeout)*time.Second) {
+		c.Header("Retry-After", retryAfter)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "log pipeline is not ready"})
+		return
+	}
+	if queue != nil && conf.Config.Ingest.WAL.MaxBytes > 0 && queue.Backlog() > conf.Config.Ingest.WAL.MaxBytes {
+		c.Header("Retry-After", retryAfter)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "log queue is full"})
+		return
+	}
+	dataset := c.GetHeader(HeaderDataset)
+	if dataset != "" {
+		if err := store.ValidateDataset(dataset); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	lines, err := readIngestBody(c, parserType, single)
+	if errors.Is(err, errBodyTooLarge) { // 客户端应拆分后重新上报
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	host := parser.Host{ID: c.GetHeader(HeaderHostID), Name: c.GetHeader(HeaderHostName)}
+	var result IngestResult
+	var valid []int // 通过校验的日志下标
+	for idx, line := range lines {
+		if line.err == nil {
+			line.err = parser.ValidateRawLine(parserType, line.raw)
+		}
+		if line.err != nil {
+			result.Rejected++
+			if len(result.Errors) < maxIngestErrors {
+				result.Errors = append(result.Errors, IngestError{Index: idx, Error: line.err.Error()})
+			}
+			continue
+		}
+		valid = append(valid, idx)
+	}
+
+	if queue != nil {
+		payloads := make([][]byte, 0, len(valid))
+		for _, idx := range valid {
+			payload, err := parser.EncodeQueuedLog(parser.RawLog{Line: lines[idx].raw, Host: host, Dataset: dataset})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			payloads = append(payloads, payload)
+		}
+		if err := queue.Append(payloads); err != nil {
+			logs.Logger.WithError(err).Errorf("append %s logs to queue failed", parserType)
+			c.Header("Retry-After", retryAfter)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		result.Accepted = len(payloads)
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	rawChan := parser.RawChan(parserType)
+	for _, idx := range valid {
+		select {
+		case rawChan <- parser.RawLog{Line: lines[idx].raw, Host: host, Dataset: dataset}:
+			result.Accepted++
+		default: // 缓冲区已满，已放入的日志不会回滚，客户端从 Next 开始重试
+			result.Next = idx
+			c.Header("Retry-After", retryAfter)
+			c.JSON(http.StatusTooManyRequests, result)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// readIngestBody 按 Content-Encoding 和 Content-Type 解析请求体
+// application/json: {"log": "..."} 或 {"logs": [...]}
+// application/x-ndjson: 每行一个 {"log": "..."}，流量日志也可以直接是原始记录
+// text/plain: 每行一条原始日志
+func readIngestBody(c *gin.Context, parserType string, single bool) ([]ingestLine, error) {
+	var body io.Reader = c.Request.Body
+	if strings.Contains(c.GetHeader("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+	if conf.Config.Ingest.MaxBodyBytes > 0 {
+		body = &limitedReader{r: body, n: conf.Config.Ingest.MaxBodyBytes}
+	}
+
+	switch c.ContentType() {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return scanLines(body, func(line string) ingestLine {
+			var data GeneralLogData
+			if err := json.Unmarshal([]byte(line), &data); err == nil && data.Log != "" {
+				return ingestLine{raw: data.Log}
+			}
+			if parserType == parser.NET { // 原始流量日志本身就是一行 json
+				return ingestLine{raw: line}
+			}
+			return ingestLine{raw: line, err: fmt.Errorf("missing log field")}
+		})
+	case "text/plain":
+		return scanLines(body, func(line string) ingestLine {
+			return ingestLine{raw: line}
+		})
+	}
+
+	decoder := json.NewDecoder(body)
+	if single {
+		var data GeneralLogData
+		if err := decoder.Decode(&data); err != nil {
+			return nil, err
+		}
+		return []ingestLine{{raw: data.Log}}, nil
+	}
+	var data GeneralLogsData
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+	lines := make([]ingestLine, 0, len(data.Logs))
+	for _, value := range data.Logs {
+		lines = append(lines, ingestLine{raw: value})
+	}
+	return lines, nil
+}
+
+// scanLines 逐行读取请求体，忽略空行
+func scanLines(body io.Reader, convert func(line string) ingestLine) ([]ingestLine, error) {
+	var lines []ingestLine
+	s := bufio.NewScanner(body)
+	s.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, convert(line))
+	}
+	return lines, s.Err()
+}
+
+// errBodyTooLarge 解压后的请求体超过 MaxBodyBytes
+var errBodyTooLarge = errors.New("request body is too large")
+
+// limitedReader 超过 n 字节后返回 errBodyTooLarge，防止解压后的请求体过大
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		var b [1]byte
+		if n, err := l.r.Read(b[:]); n == 0 && err == io.EOF { // 恰好 n 字节
+			return 0, io.EOF
+		}
+		return 0, fmt.Errorf("%w: exceeds %d bytes", errBodyTooLarge, conf.Config.Ingest.MaxBodyBytes)
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"erinyes/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// HandleCheckpoints 导出所有签名的检查点，保存在数据库之外后可以用 verify 校验
+func HandleCheckpoints(c *gin.Context) {
+	ledger, ok := store.GetStore().(store.Ledger)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": "current storage does not support ledger"})
+		return
+	}
+	checkpoints, err := ledger.Checkpoints()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 20000, "message": "success", "data": checkpoints})
+}
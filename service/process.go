@@ -10,6 +10,7 @@ type QueryProcess struct {
 	CurrPage int    `json:"curr_page"`
 	PageSize int    `json:"page_size"`
 	Query    string `json:"query"`
+	Dataset  string `json:"dataset"` // 为空时查询默认数据集
 }
 
 type DataProcess struct {
@@ -34,15 +35,16 @@ func HandleProcess(c *gin.Context) {
 		pageSize = 10
 	}
 
-	// 构建模糊查询语句
-	query := "%" + req.Query + "%"
-	var total int64
-	db := models.GetMysqlDB()
-	db.Model(&models.Process{}).Where("process_name LIKE ?", query).Count(&total)
-
-	var processes []models.Process
-	offset := (page - 1) * pageSize
-	db.Where("process_name LIKE ?", query).Order("id").Offset(offset).Limit(pageSize).Find(&processes)
+	s, err := datasetStore(req.Dataset)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
+	processes, total, err := s.SearchProcesses(req.Query, (page-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
 	var data DataProcess
 	data.Processes = processes
 	data.Total = total
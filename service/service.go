@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"erinyes/builder"
 	"erinyes/logs"
-	"erinyes/parser"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"os/exec"
@@ -16,60 +15,6 @@ func HandlePing(c *gin.Context) {
 	c.String(http.StatusOK, "Welcome to use graph build service")
 }
 
-type GeneralLogData struct {
-	Log string `json:"log"`
-}
-
-type GeneralLogsData struct {
-	Logs []string `json:"logs"`
-}
-
-func HandleSysdigLog(c *gin.Context) {
-	var sysdigData GeneralLogData
-	if err := c.ShouldBindJSON(&sysdigData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	parser.SysdigRawChan <- sysdigData.Log
-	c.String(http.StatusOK, "Add sysdig log to chan success")
-}
-
-func HandleSysdigLogs(c *gin.Context) {
-	var sysdigData GeneralLogsData
-	if err := c.ShouldBindJSON(&sysdigData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	for _, value := range sysdigData.Logs {
-		parser.SysdigRawChan <- value
-	}
-
-	c.String(http.StatusOK, "Add all sysdig logs to chan success")
-}
-
-func HandleNetLog(c *gin.Context) {
-	var netData GeneralLogData
-	if err := c.ShouldBindJSON(&netData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	parser.NetRawChan <- netData.Log
-	c.String(http.StatusOK, "Add net log to chan success")
-}
-
-func HandleNetLogs(c *gin.Context) {
-	var netData GeneralLogsData
-	if err := c.ShouldBindJSON(&netData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	for _, value := range netData.Logs {
-		parser.NetRawChan <- value
-	}
-
-	c.String(http.StatusOK, "Add all net logs to chan success")
-}
-
 func HandleGenerate(c *gin.Context) {
 	var req QueryGraph
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -77,11 +22,17 @@ func HandleGenerate(c *gin.Context) {
 		return
 	}
 
+	s, err := datasetStore(req.Dataset)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
+
 	currentTime := time.Now()
 	currentTimeString := currentTime.Format("20060102150405")
 	dotName := currentTimeString + ".dot"
 	svgName := currentTimeString + ".svg"
-	dotString := builder.GenerateDotGraph(req.UUID).String()
+	dotString := builder.GenerateDotGraph(s, req.UUID).String()
 	dotContent := []byte(dotString)
 	err, svgContent := generateSVGFromDot(dotContent) // 替换为你生成 svg 文件的逻辑
 	if err != nil {
@@ -10,6 +10,7 @@ type QuerySocket struct {
 	CurrPage int    `json:"curr_page"`
 	PageSize int    `json:"page_size"`
 	Query    string `json:"query"`
+	Dataset  string `json:"dataset"` // 为空时查询默认数据集
 }
 
 type DataSocket struct {
@@ -34,15 +35,16 @@ func HandleSocket(c *gin.Context) {
 		pageSize = 10
 	}
 
-	// 构建模糊查询语句
-	query := "%" + req.Query + "%"
-	var total int64
-	db := models.GetMysqlDB()
-	db.Model(&models.Socket{}).Where("dst_ip LIKE ?", query).Count(&total)
-
-	var sockets []models.Socket
-	offset := (page - 1) * pageSize
-	db.Where("dst_ip LIKE ?", query).Order("id").Offset(offset).Limit(pageSize).Find(&sockets)
+	s, err := datasetStore(req.Dataset)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
+	sockets, total, err := s.SearchSockets(req.Query, (page-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
+		return
+	}
 	var data DataSocket
 	data.Sockets = sockets
 	data.Total = total
@@ -1,7 +1,7 @@
 package service
 
 import (
-	"erinyes/models"
+	"erinyes/store"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -22,10 +22,8 @@ func HandleLogin(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"code": 40001, "message": err.Error()})
 		return
 	}
-	var user models.User
-	db := models.GetMysqlDB()
-	result := user.FindByName(db, req.Username)
-	if result == false {
+	user, err := store.GetStore().FindUser(req.Username)
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 40002, "message": "用户不存在"})
 		return
 	}
@@ -52,10 +50,7 @@ func HandleInfo(c *gin.Context) {
 		return
 	}
 	username := claims["username"].(string)
-	var user models.User
-	db := models.GetMysqlDB()
-	result := user.FindByName(db, username)
-	if result == false {
+	if _, err := store.GetStore().FindUser(username); err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 40002, "message": "用户不存在"})
 		return
 	}
@@ -1,102 +0,0 @@
-/*
- Navicat MySQL Data Transfer
-
- Source Server         : test1
- Source Server Type    : MySQL
- Source Server Version : 80028
- Source Host           : localhost:3306
- Source Schema         : erinyes
-
- Target Server Type    : MySQL
- Target Server Version : 80028
- File Encoding         : 65001
-
- Date: 28/12/2023 15:48:22
-*/
-
-SET NAMES utf8mb4;
-SET FOREIGN_KEY_CHECKS = 0;
-
--- ----------------------------
--- Table structure for event
--- ----------------------------
-DROP TABLE IF EXISTS `event`;
-CREATE TABLE `event`  (
-  `id` int NOT NULL AUTO_INCREMENT,
-  `src_id` int NOT NULL COMMENT '箭头发出节点主键id',
-  `dst_id` int NOT NULL COMMENT '箭头指向节点主键id',
-  `event_class` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '事件的类型(File, Network, Process)',
-  `relation` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NULL DEFAULT NULL COMMENT '统一的关系',
-  `operation` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '具体的系统调用',
-  `time` bigint NOT NULL COMMENT '时间戳17位',
-  `uuid` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NULL DEFAULT NULL COMMENT '请求uuid',
-  PRIMARY KEY (`id`) USING BTREE
-) ENGINE = InnoDB AUTO_INCREMENT = 42869 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
-
--- ----------------------------
--- Table structure for file
--- ----------------------------
-DROP TABLE IF EXISTS `file`;
-CREATE TABLE `file`  (
-  `id` int NOT NULL AUTO_INCREMENT,
-  `host_id` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '主机id（多主机场景下资产标识符）',
-  `host_name` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NULL DEFAULT NULL COMMENT '主机名',
-  `container_id` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '容器id（多容器场景下资产标识符）',
-  `container_name` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NULL DEFAULT NULL COMMENT '容器名',
-  `file_path` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '文件路径',
-  PRIMARY KEY (`id`) USING BTREE,
-  UNIQUE INDEX `unique_index`(`host_id`, `container_id`, `file_path`) USING BTREE
-) ENGINE = InnoDB AUTO_INCREMENT = 81218 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
-
--- ----------------------------
--- Table structure for net
--- ----------------------------
-DROP TABLE IF EXISTS `net`;
-CREATE TABLE `net`  (
-  `id` int NOT NULL AUTO_INCREMENT,
-  `src_id` int NOT NULL,
-  `dst_id` int NOT NULL,
-  `method` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL,
-  `payload` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NULL DEFAULT NULL,
-  `payload_len` int NULL DEFAULT NULL,
-  `seq_num` int NULL DEFAULT NULL,
-  `ack_num` int NULL DEFAULT NULL,
-  `time` bigint NOT NULL COMMENT '时间戳17位',
-  `uuid` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NULL DEFAULT NULL COMMENT '请求uuid（可能为空）',
-  PRIMARY KEY (`id`) USING BTREE
-) ENGINE = InnoDB AUTO_INCREMENT = 1 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
-
--- ----------------------------
--- Table structure for process
--- ----------------------------
-DROP TABLE IF EXISTS `process`;
-CREATE TABLE `process`  (
-  `id` int NOT NULL AUTO_INCREMENT,
-  `host_id` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '主机id（多主机场景下资产标识符）',
-  `host_name` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NULL DEFAULT NULL COMMENT '主机名',
-  `container_id` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '容器id（多容器场景下资产标识符）',
-  `container_name` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NULL DEFAULT NULL COMMENT '容器名',
-  `process_vpid` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '进程虚拟pid',
-  `process_name` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '进程名',
-  `process_exe_path` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NULL DEFAULT NULL COMMENT '进程执行路径',
-  PRIMARY KEY (`id`) USING BTREE,
-  UNIQUE INDEX `unique_index`(`host_id`, `container_id`, `process_vpid`, `process_name`) USING BTREE
-) ENGINE = InnoDB AUTO_INCREMENT = 119698 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
-
--- ----------------------------
--- Table structure for socket
--- ----------------------------
-DROP TABLE IF EXISTS `socket`;
-CREATE TABLE `socket`  (
-  `id` int NOT NULL AUTO_INCREMENT,
-  `host_id` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '主机id（多主机场景下资产标识符）',
-  `host_name` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NULL DEFAULT NULL COMMENT '主机名',
-  `container_id` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '容器id（多容器场景下资产标识符）',
-  `container_name` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NULL DEFAULT NULL COMMENT '容器名',
-  `dst_ip` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '目的ip',
-  `dst_port` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT '目的port',
-  PRIMARY KEY (`id`) USING BTREE,
-  UNIQUE INDEX `unique_index`(`host_id`, `container_id`, `dst_ip`, `dst_port`) USING BTREE
-) ENGINE = InnoDB AUTO_INCREMENT = 37846 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
-
-SET FOREIGN_KEY_CHECKS = 1;
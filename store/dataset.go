@@ -0,0 +1,456 @@
+package store
+
+import (
+	"erinyes/models"
+	"fmt"
+	"sort"
+)
+
+// DatasetInfo 一个数据集中各类记录的数量
+type DatasetInfo struct {
+	Name      string `json:"name"`
+	Processes int64  `json:"processes"`
+	Files     int64  `json:"files"`
+	Sockets   int64  `json:"sockets"`
+	Events    int64  `json:"events"`
+	Nets      int64  `json:"nets"`
+	Flows     int64  `json:"flows"`
+}
+
+func (d DatasetInfo) String() string {
+	return fmt.Sprintf("processes: %d, files: %d, sockets: %d, events: %d, nets: %d, flows: %d",
+		d.Processes, d.Files, d.Sockets, d.Events, d.Nets, d.Flows)
+}
+
+// DatasetManager 支持列出、复制数据集的存储，删除数据集通过 Purger 完成；内存存储不需要实现
+type DatasetManager interface {
+	// ListDatasets 返回所有至少有一条记录的数据集，按名称排序
+	ListDatasets() ([]DatasetInfo, error)
+	// CopyDataset 将 src 中的顶点、边、flow、请求关联及外部标识符的对应关系复制到不存在的数据集 dst 中，返回复制的记录数
+	// 复制在一个事务中按批完成，原主键与新主键的对应关系暂存在 copy_id_map 表中，失败时全部回滚
+	CopyDataset(src string, dst string) (DatasetInfo, error)
+}
+
+func (s *gormStore) ListDatasets() ([]DatasetInfo, error) {
+	datasets := make(map[string]*DatasetInfo)
+	for _, table := range []struct {
+		model interface{}
+		count func(d *DatasetInfo) *int64
+	}{
+		{&models.Process{}, func(d *DatasetInfo) *int64 { return &d.Processes }},
+		{&models.File{}, func(d *DatasetInfo) *int64 { return &d.Files }},
+		{&models.Socket{}, func(d *DatasetInfo) *int64 { return &d.Sockets }},
+		{&models.Event{}, func(d *DatasetInfo) *int64 { return &d.Events }},
+		{&models.Net{}, func(d *DatasetInfo) *int64 { return &d.Nets }},
+		{&models.Flow{}, func(d *DatasetInfo) *int64 { return &d.Flows }},
+	} {
+		var rows []struct {
+			Dataset string
+			Total   int64
+		}
+		if err := s.db.Model(table.model).Select("dataset, COUNT(*) AS total").Group("dataset").Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			d, ok := datasets[row.Dataset]
+			if !ok {
+				d = &DatasetInfo{Name: row.Dataset}
+				datasets[row.Dataset] = d
+			}
+			*table.count(d) = row.Total
+		}
+	}
+	infos := make([]DatasetInfo, 0, len(datasets))
+	for _, d := range datasets {
+		infos = append(infos, *d)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+func (s *gormStore) CopyDataset(src string, dst string) (DatasetInfo, error) {
+	info := DatasetInfo{Name: dst}
+	if src == dst {
+		return info, fmt.Errorf("cannot copy dataset %s to itself", src)
+	}
+	datasets, err := s.ListDatasets()
+	if err != nil {
+		return info, err
+	}
+	found := false
+	for _, d := range datasets {
+		if d.Name == dst {
+			return info, fmt.Errorf("dataset %s already exists", dst)
+		}
+		found = found || d.Name == src
+	}
+	if !found {
+		return info, fmt.Errorf("dataset %s not found", src)
+	}
+
+	err = s.Transaction(func(tx Store) error {
+		from, to := tx.WithDataset(src).(*gormStore), tx.WithDataset(dst).(*gormStore)
+		var err error
+		if info.Processes, err = from.copyProcesses(to); err != nil {
+			return err
+		}
+		if info.Files, err = from.copyFiles(to); err != nil {
+			return err
+		}
+		if info.Sockets, err = from.copySockets(to); err != nil {
+			return err
+		}
+		if info.Events, err = from.copyEvents(to); err != nil {
+			return err
+		}
+		if info.Nets, err = from.copyNets(to); err != nil {
+			return err
+		}
+		if info.Flows, err = from.copyFlows(to); err != nil {
+			return err
+		}
+		if _, err = from.copyUUIDMaps(to); err != nil {
+			return err
+		}
+		return to.clearCopyIDs()
+	})
+	if err != nil {
+		return DatasetInfo{Name: dst}, err
+	}
+	return info, nil
+}
+
+// saveCopyIDs 记录 table 中原主键 srcIDs[i] 的记录复制为 dstIDs[i]，s 为复制到的数据集
+func (s *gormStore) saveCopyIDs(table string, srcIDs []int, dstIDs []int) error {
+	ms := make([]models.CopyIDMap, len(srcIDs))
+	for i := range srcIDs {
+		ms[i] = models.CopyIDMap{Dataset: s.dataset, RecordTable: table, SrcID: srcIDs[i], DstID: dstIDs[i]}
+	}
+	return chunks(len(ms), func(lo int, hi int) error {
+		return s.db.Create(ms[lo:hi]).Error
+	})
+}
+
+// copyIDs 按表查询一批原主键对应的新主键，没有复制的记录不在结果中
+func (s *gormStore) copyIDs(srcIDs map[string][]int) (map[string]map[int]int, error) {
+	found := make(map[string]map[int]int, len(srcIDs))
+	for table, ids := range srcIDs {
+		found[table] = make(map[int]int, len(ids))
+		err := chunks(len(ids), func(lo int, hi int) error {
+			var ms []models.CopyIDMap
+			if err := s.scoped().Where("record_table = ? AND src_id IN ?", table, ids[lo:hi]).Find(&ms).Error; err != nil {
+				return err
+			}
+			for _, m := range ms {
+				found[table][m.SrcID] = m.DstID
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// clearCopyIDs 复制完成后删除主键的对应关系
+func (s *gormStore) clearCopyIDs() error {
+	return s.scoped().Delete(&models.CopyIDMap{}).Error
+}
+
+func (s *gormStore) copyProcesses(to *gormStore) (int64, error) {
+	var copied int64
+	lastID := 0
+	for {
+		processes, err := s.ScanProcesses(lastID, batchSize)
+		if err != nil || len(processes) == 0 {
+			return copied, err
+		}
+		origins := make([]int, len(processes))
+		copies := make([]*models.Process, len(processes))
+		for i, p := range processes {
+			lastID, origins[i] = p.ID, p.ID
+			p := p
+			p.ID, p.Dataset, p.ChainHash = 0, to.dataset, ""
+			copies[i] = &p
+		}
+		if _, err := to.UpsertProcesses(copies); err != nil {
+			return copied, err
+		}
+		ids := make([]int, len(copies))
+		for i, p := range copies {
+			ids[i] = p.ID
+		}
+		if err := to.saveCopyIDs((models.Process{}).TableName(), origins, ids); err != nil {
+			return copied, err
+		}
+		copied += int64(len(copies))
+	}
+}
+
+func (s *gormStore) copyFiles(to *gormStore) (int64, error) {
+	var copied int64
+	lastID := 0
+	for {
+		files, err := s.ScanFiles(lastID, batchSize)
+		if err != nil || len(files) == 0 {
+			return copied, err
+		}
+		origins := make([]int, len(files))
+		copies := make([]*models.File, len(files))
+		for i, f := range files {
+			lastID, origins[i] = f.ID, f.ID
+			f := f
+			f.ID, f.Dataset, f.ChainHash = 0, to.dataset, ""
+			copies[i] = &f
+		}
+		if _, err := to.UpsertFiles(copies); err != nil {
+			return copied, err
+		}
+		ids := make([]int, len(copies))
+		for i, f := range copies {
+			ids[i] = f.ID
+		}
+		if err := to.saveCopyIDs((models.File{}).TableName(), origins, ids); err != nil {
+			return copied, err
+		}
+		copied += int64(len(copies))
+	}
+}
+
+func (s *gormStore) copySockets(to *gormStore) (int64, error) {
+	var copied int64
+	lastID := 0
+	for {
+		sockets, err := s.ScanSockets(lastID, batchSize)
+		if err != nil || len(sockets) == 0 {
+			return copied, err
+		}
+		origins := make([]int, len(sockets))
+		copies := make([]*models.Socket, len(sockets))
+		for i, so := range sockets {
+			lastID, origins[i] = so.ID, so.ID
+			so := so
+			so.ID, so.Dataset, so.ChainHash = 0, to.dataset, ""
+			copies[i] = &so
+		}
+		if _, err := to.UpsertSockets(copies); err != nil {
+			return copied, err
+		}
+		ids := make([]int, len(copies))
+		for i, so := range copies {
+			ids[i] = so.ID
+		}
+		if err := to.saveCopyIDs((models.Socket{}).TableName(), origins, ids); err != nil {
+			return copied, err
+		}
+		copied += int64(len(copies))
+	}
+}
+
+// copyEvents 按事件类型找到两端顶点的新主键，以原来的方式（是否去重）插入，请求关联随插入重新生成
+// 去重插入时没有插入的边不记录对应关系，其 flow 也不复制
+func (s *gormStore) copyEvents(to *gormStore) (int64, error) {
+	var copied int64
+	lastID := 0
+	for {
+		events, err := s.ScanEvents(lastID, batchSize, "")
+		if err != nil || len(events) == 0 {
+			return copied, err
+		}
+		endpoints := make(map[string][]int)
+		for _, e := range events {
+			tables, ok := eventEndpoints[e.EventClass]
+			if !ok {
+				return copied, fmt.Errorf("unknown event class %s of event %d", e.EventClass, e.ID)
+			}
+			endpoints[tables[0]] = append(endpoints[tables[0]], e.SrcID)
+			endpoints[tables[1]] = append(endpoints[tables[1]], e.DstID)
+		}
+		vertexIDs, err := to.copyIDs(endpoints)
+		if err != nil {
+			return copied, err
+		}
+		var origins [2][]int // 不去重、去重插入的边的原主键
+		var copies [2][]*models.Event
+		for _, e := range events {
+			lastID = e.ID
+			tables := eventEndpoints[e.EventClass]
+			dedup := 0
+			if e.DedupKey != nil {
+				dedup = 1
+			}
+			origins[dedup] = append(origins[dedup], e.ID)
+			e := e
+			e.ID, e.Dataset, e.DedupKey, e.ChainHash = 0, to.dataset, nil, ""
+			srcID, ok := vertexIDs[tables[0]][e.SrcID]
+			if !ok {
+				return copied, fmt.Errorf("%s %d of event %d not copied", tables[0], e.SrcID, lastID)
+			}
+			dstID, ok := vertexIDs[tables[1]][e.DstID]
+			if !ok {
+				return copied, fmt.Errorf("%s %d of event %d not copied", tables[1], e.DstID, lastID)
+			}
+			e.SrcID, e.DstID = srcID, dstID
+			copies[dedup] = append(copies[dedup], &e)
+		}
+		for dedup := range copies {
+			if len(copies[dedup]) == 0 {
+				continue
+			}
+			inserted, err := to.InsertEvents(copies[dedup], dedup == 1)
+			if err != nil {
+				return copied, err
+			}
+			var srcIDs, dstIDs []int
+			for i, e := range copies[dedup] {
+				if inserted[i] {
+					srcIDs, dstIDs = append(srcIDs, origins[dedup][i]), append(dstIDs, e.ID)
+				}
+			}
+			if err := to.saveCopyIDs((models.Event{}).TableName(), srcIDs, dstIDs); err != nil {
+				return copied, err
+			}
+			copied += int64(len(srcIDs))
+		}
+	}
+}
+
+func (s *gormStore) copyNets(to *gormStore) (int64, error) {
+	var copied int64
+	lastID := 0
+	for {
+		nets, err := s.ScanNets(lastID, batchSize, "")
+		if err != nil || len(nets) == 0 {
+			return copied, err
+		}
+		sockets := make([]int, 0, 2*len(nets))
+		for _, n := range nets {
+			sockets = append(sockets, n.SrcID, n.DstID)
+		}
+		socketTable := (models.Socket{}).TableName()
+		vertexIDs, err := to.copyIDs(map[string][]int{socketTable: sockets})
+		if err != nil {
+			return copied, err
+		}
+		var origins [2][]int
+		var copies [2][]*models.Net
+		for _, n := range nets {
+			lastID = n.ID
+			dedup := 0
+			if n.DedupKey != nil {
+				dedup = 1
+			}
+			origins[dedup] = append(origins[dedup], n.ID)
+			n := n
+			n.ID, n.Dataset, n.DedupKey, n.ChainHash = 0, to.dataset, nil, ""
+			srcID, ok := vertexIDs[socketTable][n.SrcID]
+			if !ok {
+				return copied, fmt.Errorf("socket %d of net %d not copied", n.SrcID, lastID)
+			}
+			dstID, ok := vertexIDs[socketTable][n.DstID]
+			if !ok {
+				return copied, fmt.Errorf("socket %d of net %d not copied", n.DstID, lastID)
+			}
+			n.SrcID, n.DstID = srcID, dstID
+			copies[dedup] = append(copies[dedup], &n)
+		}
+		for dedup := range copies {
+			if len(copies[dedup]) == 0 {
+				continue
+			}
+			inserted, err := to.InsertNets(copies[dedup], dedup == 1)
+			if err != nil {
+				return copied, err
+			}
+			var srcIDs, dstIDs []int
+			for i, n := range copies[dedup] {
+				if inserted[i] {
+					srcIDs, dstIDs = append(srcIDs, origins[dedup][i]), append(dstIDs, n.ID)
+				}
+			}
+			if err := to.saveCopyIDs((models.Net{}).TableName(), srcIDs, dstIDs); err != nil {
+				return copied, err
+			}
+			copied += int64(len(srcIDs))
+		}
+	}
+}
+
+// copyFlows 复制边已经复制的 flow，全部复制后再按新主键恢复两侧的关联
+func (s *gormStore) copyFlows(to *gormStore) (int64, error) {
+	var copied int64
+	flowTable := (models.Flow{}).TableName()
+	lastID := 0
+	for {
+		var flows []models.Flow
+		if err := s.scoped().Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&flows).Error; err != nil {
+			return copied, err
+		}
+		if len(flows) == 0 {
+			break
+		}
+		edges := make(map[string][]int)
+		for _, f := range flows {
+			edges[f.EdgeTable] = append(edges[f.EdgeTable], f.EdgeID)
+		}
+		edgeIDs, err := to.copyIDs(edges)
+		if err != nil {
+			return copied, err
+		}
+		var origins []int
+		var copies []*models.Flow
+		for _, f := range flows {
+			lastID = f.ID
+			edgeID, ok := edgeIDs[f.EdgeTable][f.EdgeID]
+			if !ok {
+				continue
+			}
+			origins = append(origins, f.ID)
+			f := f
+			f.ID, f.Dataset, f.PeerID, f.EdgeID = 0, to.dataset, 0, edgeID
+			copies = append(copies, &f)
+		}
+		if err := to.InsertFlows(copies); err != nil {
+			return copied, err
+		}
+		ids := make([]int, len(copies))
+		for i, f := range copies {
+			ids[i] = f.ID
+		}
+		if err := to.saveCopyIDs(flowTable, origins, ids); err != nil {
+			return copied, err
+		}
+		copied += int64(len(copies))
+	}
+
+	lastID = 0
+	for {
+		var flows []models.Flow
+		if err := s.scoped().Select("id", "peer_id").Where("id > ? AND peer_id <> 0", lastID).Order("id").Limit(batchSize).Find(&flows).Error; err != nil {
+			return copied, err
+		}
+		if len(flows) == 0 {
+			return copied, nil
+		}
+		srcIDs := make([]int, 0, 2*len(flows))
+		for _, f := range flows {
+			srcIDs = append(srcIDs, f.ID, f.PeerID)
+		}
+		ids, err := to.copyIDs(map[string][]int{flowTable: srcIDs})
+		if err != nil {
+			return copied, err
+		}
+		for _, f := range flows {
+			lastID = f.ID
+			id, ok := ids[flowTable][f.ID]
+			peer, peerOK := ids[flowTable][f.PeerID]
+			if !ok || !peerOK {
+				continue
+			}
+			if err := to.db.Model(&models.Flow{}).Where("id = ?", id).Update("peer_id", peer).Error; err != nil {
+				return copied, err
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"erinyes/models"
+	"testing"
+)
+
+// copyTestDataset 在数据集 a 中插入 1 个进程、1 个文件、2 个 socket、3 条 event 边（后两条去重后相同）、1 条 net 边及它们的 flow
+// 第一条 event 边与 net 边的 flow 互相关联，被去重的边也有 flow
+func copyTestDataset(t *testing.T, s *gormStore) {
+	a := s.WithDataset("a").(*gormStore)
+	ps := []*models.Process{{HostID: "h", ContainerID: "c", ProcessVPID: "1", ProcessName: "sh"}}
+	fs := []*models.File{{HostID: "h", ContainerID: "c", FilePath: "/etc/passwd"}}
+	ss := []*models.Socket{{HostID: "h", ContainerID: "c", DstIP: "10.0.0.1", DstPort: "80"}, {HostID: "h", ContainerID: "c", DstIP: "10.0.0.2", DstPort: "80"}}
+	if _, err := a.UpsertProcesses(ps); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.UpsertFiles(fs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.UpsertSockets(ss); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.InsertEvents([]*models.Event{testEvent(ps[0].ID, fs[0].ID, 1)}, true); err != nil {
+		t.Fatal(err)
+	}
+	// 两条相同的边在原数据集中有不同的去重键，复制时第二条被去重
+	same := []*models.Event{testEvent(ps[0].ID, fs[0].ID, 2), testEvent(ps[0].ID, fs[0].ID, 3)}
+	same[0].Operation, same[1].Operation = "read", "read"
+	if _, err := a.InsertEvents(same, false); err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range same {
+		if err := s.db.Model(&models.Event{}).Where("id = ?", e.ID).Update("dedup_key", []string{"x", "y"}[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	net := &models.Net{SrcID: ss[0].ID, DstID: ss[1].ID, Method: "GET", Time: 4, UUID: "unknown"}
+	if _, err := a.InsertNets([]*models.Net{net}, false); err != nil {
+		t.Fatal(err)
+	}
+	flows := []*models.Flow{
+		{EdgeTable: "event", EdgeID: 1, Source: models.FlowSourceSysdig, Time: 1},
+		{EdgeTable: "net", EdgeID: net.ID, Source: models.FlowSourceCapture, Time: 4},
+		{EdgeTable: "event", EdgeID: same[1].ID, Source: models.FlowSourceSysdig, Time: 3},
+	}
+	if err := a.InsertFlows(flows); err != nil {
+		t.Fatal(err)
+	}
+	for i, peer := range []int{flows[1].ID, flows[0].ID} {
+		if err := s.db.Model(&models.Flow{}).Where("id = ?", flows[i].ID).Update("peer_id", peer).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.SaveUUIDs([]*models.UUIDMap{{Source: models.UUIDSourceSPADE, UUID: "p", VertexTable: "process", VertexID: ps[0].ID}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyDataset(t *testing.T) {
+	s := openTestStore(t)
+	copyTestDataset(t, s)
+	info, err := s.CopyDataset("a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DatasetInfo{Name: "b", Processes: 1, Files: 1, Sockets: 2, Events: 2, Nets: 1, Flows: 2}
+	if info != want {
+		t.Fatalf("copied %+v, want %+v", info, want)
+	}
+
+	b := s.WithDataset("b").(*gormStore)
+	var flows []models.Flow
+	if err := b.scoped().Order("id").Find(&flows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 2 {
+		t.Fatalf("%d flows copied, want 2", len(flows))
+	}
+	for _, f := range flows {
+		var n int64
+		if err := b.scoped().Table(f.EdgeTable).Where("id = ?", f.EdgeID).Count(&n).Error; err != nil || n != 1 {
+			t.Fatalf("flow %d references %s %d outside dataset b (%v)", f.ID, f.EdgeTable, f.EdgeID, err)
+		}
+	}
+	if flows[0].PeerID != flows[1].ID || flows[1].PeerID != flows[0].ID {
+		t.Fatalf("copied flows %d, %d linked to %d, %d", flows[0].ID, flows[1].ID, flows[0].PeerID, flows[1].PeerID)
+	}
+
+	found, err := b.LookupUUIDs(models.UUIDSourceSPADE, []string{"p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := b.GetProcess(found["p"].VertexID)
+	if err != nil || p.Dataset != "b" {
+		t.Fatalf("uuid p maps to process %+v (%v), want the copy in dataset b", p, err)
+	}
+	var n int64
+	if err := s.db.Model(&models.CopyIDMap{}).Count(&n).Error; err != nil || n != 0 {
+		t.Fatalf("%d id mappings (%v) left after copy", n, err)
+	}
+}
+
+func TestCopyDatasetIsAtomic(t *testing.T) {
+	s := openTestStore(t)
+	copyTestDataset(t, s)
+	// 引用不存在的顶点的边使复制在中途失败
+	if _, err := s.WithDataset("a").InsertEvents([]*models.Event{testEvent(100, 100, 5)}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CopyDataset("a", "b"); err == nil {
+		t.Fatal("copy succeeded, want error")
+	}
+	datasets, err := s.ListDatasets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datasets) != 1 || datasets[0].Name != "a" {
+		t.Fatalf("datasets %+v after failed copy, want only a", datasets)
+	}
+	var n int64
+	if err := s.db.Model(&models.CopyIDMap{}).Count(&n).Error; err != nil || n != 0 {
+		t.Fatalf("%d id mappings (%v) left after failed copy", n, err)
+	}
+}
@@ -0,0 +1,805 @@
+package store
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"erinyes/conf"
+	"erinyes/models"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+)
+
+var errPeerTaken = fmt.Errorf("peer flow has been linked")
+
+// gormStore 基于 GORM 的存储实现，MySQL 与 SQLite 共用
+type gormStore struct {
+	db      *gorm.DB
+	dataset string // 当前视图的数据集
+}
+
+func newGormStore(db *gorm.DB) *gormStore {
+	return &gormStore{db: db, dataset: DefaultDataset}
+}
+
+func (s *gormStore) WithDataset(name string) Store {
+	return &gormStore{db: s.db, dataset: name}
+}
+
+func (s *gormStore) Dataset() string {
+	return s.dataset
+}
+
+// scoped 限定在当前数据集内的查询
+func (s *gormStore) scoped() *gorm.DB {
+	return s.db.Where("dataset = ?", s.dataset)
+}
+
+// datasetOf 写入的记录没有指定数据集时属于当前数据集
+func (s *gormStore) datasetOf(dataset *string) {
+	if *dataset == "" {
+		*dataset = s.dataset
+	}
+}
+
+// batchSize 单条多行 INSERT/SELECT 语句的最大行数，避免超过占位符数量的限制
+const batchSize = 500
+
+// chunks 将 [0, n) 按 batchSize 分段依次处理
+func chunks(n int, fn func(lo int, hi int) error) error {
+	for lo := 0; lo < n; lo += batchSize {
+		hi := lo + batchSize
+		if hi > n {
+			hi = n
+		}
+		if err := fn(lo, hi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upsert 以 INSERT ... ON DUPLICATE KEY UPDATE（SQLite 为 ON CONFLICT DO NOTHING）批量插入顶点，返回新建的数量
+// 已经存在的行不会返回主键，插入后统一由 lookup 按唯一键查询回填；开启 Ledger 时在一个事务中执行，并为新建的顶点追加一项
+func (s *gormStore) upsert(model interface{}, table string, rows interface{}, n int, idOf func(i int) *int, lookup func(db *gorm.DB) error) (int, error) {
+	if !conf.Config.Ledger.Enable {
+		r := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(rows)
+		if r.Error != nil {
+			return 0, r.Error
+		}
+		return int(r.RowsAffected), lookup(s.db)
+	}
+	created := 0
+	err := s.chainedTransaction(func(tx *gorm.DB, l *ledgerLock) error {
+		for i := 0; i < n; i++ {
+			*idOf(i) = 0
+		}
+		// 主键大于插入前最大主键的是本次新建的顶点；其他进程同时插入同一顶点时它可能在两项中，不影响校验
+		var before int
+		if err := tx.Model(model).Select("COALESCE(MAX(id), 0)").Scan(&before).Error; err != nil {
+			return err
+		}
+		r := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(rows)
+		if r.Error != nil {
+			return r.Error
+		}
+		created = int(r.RowsAffected)
+		// 加锁读取最新提交的行，可重复读隔离级别下普通查询看不到其他事务在快照之后插入的同一顶点
+		if err := lookup(tx.Clauses(clause.Locking{Strength: "SHARE"})); err != nil {
+			return err
+		}
+		var ids []int
+		for i := 0; i < n; i++ {
+			if id := *idOf(i); id > before {
+				ids = append(ids, id)
+			}
+		}
+		return chain(tx, l, model, table, ids)
+	})
+	return created, err
+}
+
+func (s *gormStore) UpsertProcesses(ps []*models.Process) (int, error) {
+	created := 0
+	for _, p := range ps {
+		s.datasetOf(&p.Dataset)
+		if conf.Config.Ledger.Enable {
+			p.ChainHash = p.ComputeChainHash()
+		}
+	}
+	err := chunks(len(ps), func(lo int, hi int) error {
+		batch := ps[lo:hi]
+		n, err := s.upsert(&models.Process{}, (models.Process{}).TableName(), batch, len(batch), func(i int) *int { return &batch[i].ID }, func(db *gorm.DB) error {
+			keys := make([][]interface{}, 0, len(batch))
+			for _, p := range batch {
+				keys = append(keys, []interface{}{p.Dataset, p.HostID, p.ContainerID, p.ProcessVPID, p.ProcessName})
+			}
+			var exist []models.Process
+			if err := db.Select("id", "dataset", "host_id", "container_id", "process_vpid", "process_name").
+				Where("(dataset, host_id, container_id, process_vpid, process_name) IN ?", keys).Find(&exist).Error; err != nil {
+				return err
+			}
+			ids := make(map[[5]string]int, len(exist))
+			for _, p := range exist {
+				ids[[5]string{p.Dataset, p.HostID, p.ContainerID, p.ProcessVPID, p.ProcessName}] = p.ID
+			}
+			for _, p := range batch {
+				if p.ID = ids[[5]string{p.Dataset, p.HostID, p.ContainerID, p.ProcessVPID, p.ProcessName}]; p.ID == 0 {
+					return fmt.Errorf("process %s_%s#%s_%s not found after upsert", p.ProcessVPID, p.ProcessName, p.HostID, p.ContainerID)
+				}
+			}
+			return nil
+		})
+		created += n
+		return err
+	})
+	return created, err
+}
+
+func (s *gormStore) UpsertFiles(fs []*models.File) (int, error) {
+	created := 0
+	for _, f := range fs {
+		s.datasetOf(&f.Dataset)
+		if conf.Config.Ledger.Enable {
+			f.ChainHash = f.ComputeChainHash()
+		}
+	}
+	err := chunks(len(fs), func(lo int, hi int) error {
+		batch := fs[lo:hi]
+		n, err := s.upsert(&models.File{}, (models.File{}).TableName(), batch, len(batch), func(i int) *int { return &batch[i].ID }, func(db *gorm.DB) error {
+			keys := make([][]interface{}, 0, len(batch))
+			for _, f := range batch {
+				keys = append(keys, []interface{}{f.Dataset, f.HostID, f.ContainerID, f.FilePath})
+			}
+			var exist []models.File
+			if err := db.Select("id", "dataset", "host_id", "container_id", "file_path").
+				Where("(dataset, host_id, container_id, file_path) IN ?", keys).Find(&exist).Error; err != nil {
+				return err
+			}
+			ids := make(map[[4]string]int, len(exist))
+			for _, f := range exist {
+				ids[[4]string{f.Dataset, f.HostID, f.ContainerID, f.FilePath}] = f.ID
+			}
+			for _, f := range batch {
+				if f.ID = ids[[4]string{f.Dataset, f.HostID, f.ContainerID, f.FilePath}]; f.ID == 0 {
+					return fmt.Errorf("file %s#%s_%s not found after upsert", f.FilePath, f.HostID, f.ContainerID)
+				}
+			}
+			return nil
+		})
+		created += n
+		return err
+	})
+	return created, err
+}
+
+func (s *gormStore) UpsertSockets(ss []*models.Socket) (int, error) {
+	created := 0
+	for _, so := range ss {
+		s.datasetOf(&so.Dataset)
+		if conf.Config.Ledger.Enable {
+			so.ChainHash = so.ComputeChainHash()
+		}
+	}
+	err := chunks(len(ss), func(lo int, hi int) error {
+		batch := ss[lo:hi]
+		n, err := s.upsert(&models.Socket{}, (models.Socket{}).TableName(), batch, len(batch), func(i int) *int { return &batch[i].ID }, func(db *gorm.DB) error {
+			keys := make([][]interface{}, 0, len(batch))
+			for _, so := range batch {
+				keys = append(keys, []interface{}{so.Dataset, so.HostID, so.ContainerID, so.DstIP, so.DstPort})
+			}
+			var exist []models.Socket
+			if err := db.Select("id", "dataset", "host_id", "container_id", "dst_ip", "dst_port").
+				Where("(dataset, host_id, container_id, dst_ip, dst_port) IN ?", keys).Find(&exist).Error; err != nil {
+				return err
+			}
+			ids := make(map[[5]string]int, len(exist))
+			for _, so := range exist {
+				ids[[5]string{so.Dataset, so.HostID, so.ContainerID, so.DstIP, so.DstPort}] = so.ID
+			}
+			for _, so := range batch {
+				if so.ID = ids[[5]string{so.Dataset, so.HostID, so.ContainerID, so.DstIP, so.DstPort}]; so.ID == 0 {
+					return fmt.Errorf("socket %s:%s#%s_%s not found after upsert", so.DstIP, so.DstPort, so.HostID, so.ContainerID)
+				}
+			}
+			return nil
+		})
+		created += n
+		return err
+	})
+	return created, err
+}
+
+func (s *gormStore) GetProcess(id int) (models.Process, error) {
+	var p models.Process
+	err := s.db.First(&p, id).Error
+	return p, err
+}
+
+func (s *gormStore) GetFile(id int) (models.File, error) {
+	var f models.File
+	err := s.db.First(&f, id).Error
+	return f, err
+}
+
+func (s *gormStore) GetSocket(id int) (models.Socket, error) {
+	var so models.Socket
+	err := s.db.First(&so, id).Error
+	return so, err
+}
+
+func (s *gormStore) GetProcesses(ids []int) ([]models.Process, error) {
+	var processes []models.Process
+	err := chunks(len(ids), func(lo int, hi int) error {
+		var batch []models.Process
+		if err := s.db.Where("id IN ?", ids[lo:hi]).Find(&batch).Error; err != nil {
+			return err
+		}
+		processes = append(processes, batch...)
+		return nil
+	})
+	return processes, err
+}
+
+func (s *gormStore) GetFiles(ids []int) ([]models.File, error) {
+	var files []models.File
+	err := chunks(len(ids), func(lo int, hi int) error {
+		var batch []models.File
+		if err := s.db.Where("id IN ?", ids[lo:hi]).Find(&batch).Error; err != nil {
+			return err
+		}
+		files = append(files, batch...)
+		return nil
+	})
+	return files, err
+}
+
+func (s *gormStore) GetSockets(ids []int) ([]models.Socket, error) {
+	var sockets []models.Socket
+	err := chunks(len(ids), func(lo int, hi int) error {
+		var batch []models.Socket
+		if err := s.db.Where("id IN ?", ids[lo:hi]).Find(&batch).Error; err != nil {
+			return err
+		}
+		sockets = append(sockets, batch...)
+		return nil
+	})
+	return sockets, err
+}
+
+func (s *gormStore) FindProcess(hostID string, containerID string, vpid string, name string) (models.Process, error) {
+	var p models.Process
+	err := s.db.First(&p, models.Process{Dataset: s.dataset, HostID: hostID, ContainerID: containerID, ProcessVPID: vpid, ProcessName: name}).Error
+	return p, err
+}
+
+func (s *gormStore) SearchProcesses(keyword string, offset int, limit int) ([]models.Process, int64, error) {
+	var processes []models.Process
+	total, err := s.search(&models.Process{}, &processes, "process_name", keyword, offset, limit)
+	return processes, total, err
+}
+
+func (s *gormStore) SearchFiles(keyword string, offset int, limit int) ([]models.File, int64, error) {
+	var files []models.File
+	total, err := s.search(&models.File{}, &files, "file_path", keyword, offset, limit)
+	return files, total, err
+}
+
+func (s *gormStore) SearchSockets(keyword string, offset int, limit int) ([]models.Socket, int64, error) {
+	var sockets []models.Socket
+	total, err := s.search(&models.Socket{}, &sockets, "dst_ip", keyword, offset, limit)
+	return sockets, total, err
+}
+
+func (s *gormStore) MatchFiles(hostID string, containerID string, pattern string) ([]models.File, error) {
+	var files []models.File
+	db := s.inVertex(hostID, containerID).Where("file_path LIKE ? ESCAPE '"+likeEscape+"'", likePattern(pattern))
+	err := db.Order("id").Find(&files).Error
+	return files, err
+}
+
+func (s *gormStore) MatchSockets(hostID string, containerID string, ipPattern string, portPattern string) ([]models.Socket, error) {
+	var sockets []models.Socket
+	db := s.inVertex(hostID, containerID).
+		Where("dst_ip LIKE ? ESCAPE '"+likeEscape+"'", likePattern(ipPattern)).
+		Where("dst_port LIKE ? ESCAPE '"+likeEscape+"'", likePattern(portPattern))
+	err := db.Order("id").Find(&sockets).Error
+	return sockets, err
+}
+
+// inVertex 限定顶点所在的主机和容器，为空时不限制
+func (s *gormStore) inVertex(hostID string, containerID string) *gorm.DB {
+	db := s.scoped()
+	if hostID != "" {
+		db = db.Where("host_id = ?", hostID)
+	}
+	if containerID != "" {
+		db = db.Where("container_id = ?", containerID)
+	}
+	return db
+}
+
+// search 对 column 做模糊查询并分页
+func (s *gormStore) search(model interface{}, dest interface{}, column string, keyword string, offset int, limit int) (int64, error) {
+	query := "%" + keyword + "%"
+	var total int64
+	if err := s.scoped().Model(model).Where(column+" LIKE ?", query).Count(&total).Error; err != nil {
+		return 0, err
+	}
+	err := s.scoped().Where(column+" LIKE ?", query).Order("id").Offset(offset).Limit(limit).Find(dest).Error
+	return total, err
+}
+
+func (s *gormStore) InsertEvents(es []*models.Event, dedup bool) ([]bool, error) {
+	return s.InsertReducedEvents(es, dedup, nil)
+}
+
+func (s *gormStore) InsertReducedEvents(es []*models.Event, dedup bool, exts []EventExtension) ([]bool, error) {
+	var keys []string
+	for _, e := range es {
+		s.datasetOf(&e.Dataset)
+		if conf.Config.Ledger.Enable {
+			e.ChainHash = e.ComputeChainHash()
+		}
+	}
+	if dedup {
+		keys = make([]string, len(es))
+		for i, e := range es {
+			keys[i] = dedupKey(e.SrcID, e.DstID, e.EventClass, e.Operation, e.UUID)
+			e.DedupKey = &keys[i]
+		}
+	}
+	return s.insertChained(&models.Event{}, (models.Event{}).TableName(), len(es), keys, func(idx []int) interface{} {
+		rows := make([]*models.Event, 0, len(idx))
+		for _, i := range idx {
+			rows = append(rows, es[i])
+		}
+		return rows
+	}, func(i int) *int { return &es[i].ID }, func(i int) []models.EdgeRequest {
+		return models.EdgeRequests(es[i].TableName(), es[i].ID, es[i].UUID)
+	}, func(tx *gorm.DB) error {
+		return extendEvents(tx, exts)
+	})
+}
+
+func (s *gormStore) InsertNets(ns []*models.Net, dedup bool) ([]bool, error) {
+	var keys []string
+	for _, n := range ns {
+		s.datasetOf(&n.Dataset)
+		if conf.Config.Ledger.Enable {
+			n.ChainHash = n.ComputeChainHash()
+		}
+	}
+	if dedup {
+		keys = make([]string, len(ns))
+		for i, n := range ns {
+			keys[i] = dedupKey(n.SrcID, n.DstID, n.Method, n.UUID)
+			n.DedupKey = &keys[i]
+		}
+	}
+	return s.insertChained(&models.Net{}, (models.Net{}).TableName(), len(ns), keys, func(idx []int) interface{} {
+		rows := make([]*models.Net, 0, len(idx))
+		for _, i := range idx {
+			rows = append(rows, ns[i])
+		}
+		return rows
+	}, func(i int) *int { return &ns[i].ID }, func(i int) []models.EdgeRequest {
+		return models.EdgeRequests(ns[i].TableName(), ns[i].ID, ns[i].UUID)
+	}, nil)
+}
+
+// insertChained 在一个事务中插入边、写入请求关联、执行 extra（不为空时），最后为插入的边追加哈希链项，requestsOf 返回插入后第 i 条边的请求关联
+// 任何一步失败时全部回滚，回填的主键恢复为 0，调用方可以用同样的参数整体重试
+func (s *gormStore) insertChained(model interface{}, table string, n int, keys []string, rowsOf func(idx []int) interface{}, idOf func(i int) *int, requestsOf func(i int) []models.EdgeRequest, extra func(tx *gorm.DB) error) ([]bool, error) {
+	var inserted []bool
+	err := s.chainedTransaction(func(tx *gorm.DB, l *ledgerLock) error {
+		for i := 0; i < n; i++ { // 序号冲突重新执行时清除上一次回填的主键
+			*idOf(i) = 0
+		}
+		var err error
+		inserted, err = insertEdges(tx, model, n, keys, rowsOf, idOf)
+		if err != nil {
+			return err
+		}
+		var (
+			requests []models.EdgeRequest
+			chained  []int
+		)
+		for i := 0; i < n; i++ {
+			if inserted[i] {
+				requests = append(requests, requestsOf(i)...)
+				chained = append(chained, *idOf(i))
+			}
+		}
+		if err := s.insertRequests(tx, requests); err != nil {
+			return err
+		}
+		if extra != nil {
+			if err := extra(tx); err != nil {
+				return err
+			}
+		}
+		return chain(tx, l, model, table, chained)
+	})
+	if err != nil {
+		for i := 0; i < n; i++ {
+			*idOf(i) = 0
+		}
+		return make([]bool, n), err
+	}
+	return inserted, nil
+}
+
+// insertRequests 批量写入边与请求的关联，已经存在的关联（并发插入同一条边时）忽略
+func (s *gormStore) insertRequests(db *gorm.DB, requests []models.EdgeRequest) error {
+	return chunks(len(requests), func(lo int, hi int) error {
+		return db.Clauses(clause.OnConflict{DoNothing: true}).Create(requests[lo:hi]).Error
+	})
+}
+
+// inRequest uuid 不为空时将查询限制为属于该请求的边
+func inRequest(db *gorm.DB, edgeTable string, uuid string) *gorm.DB {
+	if uuid == "" {
+		return db
+	}
+	return db.Where("id IN (SELECT edge_id FROM edge_request WHERE edge_table = ? AND uuid = ?)", edgeTable, uuid)
+}
+
+// dedupKey 计算边的去重键，写入带唯一索引的 dedup_key 列
+func dedupKey(srcID int, dstID int, fields ...string) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%d\x00%d", srcID, dstID)
+	for _, f := range fields {
+		h.Write([]byte{0})
+		h.Write([]byte(f))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// insertEdges 批量插入 n 条 event 或 net 边，rowsOf 返回指定下标的边组成的切片，idOf 返回第 i 条边主键的地址，由 GORM 回填
+// keys 为空时直接插入；否则跳过已经存在或本批中重复的边，依靠 dedup_key 的唯一索引保证并发插入时不会重复
+// 返回每条边是否由这次调用插入，已经存在或被其他协程抢先插入的边为 false
+func insertEdges(db *gorm.DB, model interface{}, n int, keys []string, rowsOf func(idx []int) interface{}, idOf func(i int) *int) ([]bool, error) {
+	inserted := make([]bool, n)
+	err := chunks(n, func(lo int, hi int) error {
+		var pending []int
+		if keys == nil {
+			for i := lo; i < hi; i++ {
+				pending = append(pending, i)
+			}
+			if err := db.Create(rowsOf(pending)).Error; err != nil { // 没有唯一约束冲突，主键由 GORM 回填
+				return err
+			}
+			for _, i := range pending {
+				inserted[i] = true
+			}
+			return nil
+		}
+
+		var exist []string
+		if err := db.Model(model).Where("dedup_key IN ?", keys[lo:hi]).Pluck("dedup_key", &exist).Error; err != nil {
+			return err
+		}
+		skip := make(map[string]bool, len(exist))
+		for _, key := range exist {
+			skip[key] = true
+		}
+		for i := lo; i < hi; i++ {
+			if skip[keys[i]] {
+				continue
+			}
+			skip[keys[i]] = true
+			pending = append(pending, i)
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := db.Create(rowsOf(pending)).Error; err == nil { // 没有冲突时一条多行 INSERT 插入，主键由 GORM 回填
+			for _, i := range pending {
+				inserted[i] = true
+			}
+			return nil
+		}
+		// 其他协程同时插入了其中的边，唯一索引冲突使整条语句失败（不留下任何行）
+		// 逐条插入，只有实际写入该行的一方视为已插入，由其写入 flow、请求关联并计数
+		for _, i := range pending {
+			*idOf(i) = 0
+			r := db.Clauses(clause.OnConflict{DoNothing: true}).Create(rowsOf([]int{i}))
+			if r.Error != nil {
+				return r.Error
+			}
+			inserted[i] = r.RowsAffected == 1
+		}
+		return nil
+	})
+	return inserted, err
+}
+
+func (s *gormStore) InsertFlows(fs []*models.Flow) error {
+	for _, f := range fs {
+		s.datasetOf(&f.Dataset)
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error { // 失败时全部回滚，可以整体重试
+		return chunks(len(fs), func(lo int, hi int) error {
+			return tx.Create(fs[lo:hi]).Error
+		})
+	})
+	if err != nil {
+		for _, f := range fs {
+			f.ID = 0
+		}
+	}
+	return err
+}
+
+// extendEvents 在插入边的事务中合并重复事件
+func extendEvents(tx *gorm.DB, exts []EventExtension) error {
+	for _, ext := range exts {
+		err := tx.Model(&models.Event{}).Where("id = ?", ext.ID).Updates(map[string]interface{}{
+			"count":    gorm.Expr("`count` + ?", ext.Count),
+			"bytes":    gorm.Expr("`bytes` + ?", ext.Bytes),
+			"end_time": gorm.Expr("CASE WHEN `end_time` < ? THEN ? ELSE `end_time` END", ext.EndTime, ext.EndTime),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *gormStore) GetEvent(id int) (models.Event, error) {
+	var e models.Event
+	err := s.db.First(&e, id).Error
+	return e, err
+}
+
+func (s *gormStore) GetNet(id int) (models.Net, error) {
+	var n models.Net
+	err := s.db.First(&n, id).Error
+	return n, err
+}
+
+func (s *gormStore) FetchEvents(vertexID int, classes []string, reverse bool, uuid string) ([]models.Event, error) {
+	db := inRequest(s.db.Where("event_class IN ?", classes), (models.Event{}).TableName(), uuid)
+	if reverse {
+		db = db.Where("dst_id = ?", vertexID)
+	} else {
+		db = db.Where("src_id = ?", vertexID)
+	}
+	var events []models.Event
+	err := db.Find(&events).Error
+	return events, err
+}
+
+func (s *gormStore) FetchNets(socketID int, reverse bool, uuid string) ([]models.Net, error) {
+	db := inRequest(s.db, (models.Net{}).TableName(), uuid)
+	if reverse {
+		db = db.Where("dst_id = ?", socketID)
+	} else {
+		db = db.Where("src_id = ?", socketID)
+	}
+	var nets []models.Net
+	err := db.Find(&nets).Error
+	return nets, err
+}
+
+// FetchFrontierEvents 顶点较多时分段查询，每段至多 limit 条，合并后按主键排序再截取前 limit 条
+func (s *gormStore) FetchFrontierEvents(ctx context.Context, vertexIDs []int, classes []string, reverse bool, uuid string, window TimeWindow, afterID int, limit int) ([]models.Event, error) {
+	var events []models.Event
+	err := chunks(len(vertexIDs), func(lo int, hi int) error {
+		db := inRequest(inWindow(s.db.WithContext(ctx).Where("event_class IN ? AND id > ?", classes, afterID), window, "end_time"), (models.Event{}).TableName(), uuid)
+		if reverse {
+			db = db.Where("dst_id IN ?", vertexIDs[lo:hi])
+		} else {
+			db = db.Where("src_id IN ?", vertexIDs[lo:hi])
+		}
+		var batch []models.Event
+		if err := byID(db, limit).Find(&batch).Error; err != nil {
+			return err
+		}
+		events = append(events, batch...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (s *gormStore) FetchFrontierNets(ctx context.Context, socketIDs []int, reverse bool, uuid string, window TimeWindow, afterID int, limit int) ([]models.Net, error) {
+	var nets []models.Net
+	err := chunks(len(socketIDs), func(lo int, hi int) error {
+		db := inRequest(inWindow(s.db.WithContext(ctx).Where("id > ?", afterID), window, "time"), (models.Net{}).TableName(), uuid)
+		if reverse {
+			db = db.Where("dst_id IN ?", socketIDs[lo:hi])
+		} else {
+			db = db.Where("src_id IN ?", socketIDs[lo:hi])
+		}
+		var batch []models.Net
+		if err := byID(db, limit).Find(&batch).Error; err != nil {
+			return err
+		}
+		nets = append(nets, batch...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(nets, func(i, j int) bool { return nets[i].ID < nets[j].ID })
+	if limit > 0 && len(nets) > limit {
+		nets = nets[:limit]
+	}
+	return nets, nil
+}
+
+// byID 按主键排序，limit 大于 0 时至多返回 limit 条
+func byID(db *gorm.DB, limit int) *gorm.DB {
+	db = db.Order("id")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	return db
+}
+
+// inWindow 将查询限制为与 window 相交的边，endColumn 为边最后一次发生的时间（合并的 event 边为 end_time）
+func inWindow(db *gorm.DB, window TimeWindow, endColumn string) *gorm.DB {
+	if window.From != 0 {
+		db = db.Where(endColumn+" >= ?", window.From)
+	}
+	if window.To != 0 {
+		db = db.Where("time <= ?", window.To)
+	}
+	return db
+}
+
+func (s *gormStore) ScanProcesses(afterID int, limit int) ([]models.Process, error) {
+	var processes []models.Process
+	err := s.scan(&processes, afterID, limit)
+	return processes, err
+}
+
+func (s *gormStore) ScanFiles(afterID int, limit int) ([]models.File, error) {
+	var files []models.File
+	err := s.scan(&files, afterID, limit)
+	return files, err
+}
+
+func (s *gormStore) ScanSockets(afterID int, limit int) ([]models.Socket, error) {
+	var sockets []models.Socket
+	err := s.scan(&sockets, afterID, limit)
+	return sockets, err
+}
+
+func (s *gormStore) ScanEvents(afterID int, limit int, uuid string) ([]models.Event, error) {
+	var events []models.Event
+	err := inRequest(s.scoped(), (models.Event{}).TableName(), uuid).Where("id > ?", afterID).Order("id").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (s *gormStore) ScanNets(afterID int, limit int, uuid string) ([]models.Net, error) {
+	var nets []models.Net
+	err := inRequest(s.scoped(), (models.Net{}).TableName(), uuid).Where("id > ?", afterID).Order("id").Limit(limit).Find(&nets).Error
+	return nets, err
+}
+
+func (s *gormStore) scan(dest interface{}, afterID int, limit int) error {
+	return s.scoped().Where("id > ?", afterID).Order("id").Limit(limit).Find(dest).Error
+}
+
+func (s *gormStore) ScanUnlinkedFlows(source string, afterID int, limit int) ([]models.Flow, error) {
+	var flows []models.Flow
+	err := s.scoped().Where("source = ? AND peer_id = 0 AND id > ?", source, afterID).
+		Order("id").Limit(limit).Find(&flows).Error
+	return flows, err
+}
+
+func (s *gormStore) LatestFlowTime(source string) (int64, error) {
+	var latest int64
+	err := s.scoped().Model(&models.Flow{}).Where("source = ?", source).Select("COALESCE(MAX(time), 0)").Scan(&latest).Error
+	return latest, err
+}
+
+func (s *gormStore) FindPeerFlow(flow models.Flow, window int64) (*models.Flow, error) {
+	var peer models.Flow
+	s.datasetOf(&flow.Dataset)
+	err := s.db.Where("dataset = ? AND source = ? AND peer_id = 0 AND src_ip = ? AND src_port = ? AND dst_ip = ? AND dst_port = ? AND payload_len = ? AND time BETWEEN ? AND ?",
+		flow.Dataset, models.FlowSourceCapture, flow.SrcIP, flow.SrcPort, flow.DstIP, flow.DstPort, flow.PayloadLen, flow.Time-window, flow.Time+window).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "ABS(time - ?)", Vars: []interface{}{flow.Time}}}).
+		First(&peer).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &peer, nil
+}
+
+func (s *gormStore) LinkFlows(flow models.Flow, peer models.Flow, uuid string) (bool, error) {
+	err := s.chainedTransaction(func(tx *gorm.DB, l *ledgerLock) error {
+		r := tx.Model(&models.Flow{}).Where("id = ? AND peer_id = 0", peer.ID).Update("peer_id", flow.ID)
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 { // 并发场景下已被其他 flow 关联
+			return errPeerTaken
+		}
+		if err := tx.Model(&models.Flow{}).Where("id = ?", flow.ID).
+			Updates(map[string]interface{}{"peer_id": peer.ID, "method": peer.Method}).Error; err != nil {
+			return err
+		}
+		if uuid != "" && flow.EdgeTable == (models.Event{}).TableName() {
+			r := tx.Model(&models.Event{}).Where("id = ? AND (uuid = ? OR uuid = '' OR uuid IS NULL)", flow.EdgeID, "unknown").
+				Update("uuid", uuid)
+			if r.Error != nil || r.RowsAffected == 0 {
+				return r.Error
+			}
+			if err := s.insertRequests(tx, models.EdgeRequests(flow.EdgeTable, flow.EdgeID, uuid)); err != nil {
+				return err
+			}
+			if conf.Config.Ledger.Enable { // 补全的 uuid 单独追加一项，边的 chain_hash 仍是插入时的值
+				digest := models.LedgerDigest([]string{models.LinkHash(flow.EdgeTable, flow.EdgeID, uuid)})
+				return appendLedger(tx, l, models.LedgerLink, flow.EdgeTable, []int{flow.EdgeID}, digest)
+			}
+		}
+		return nil
+	})
+	if err == errPeerTaken {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *gormStore) MergedCaptureEdges() (events map[int]bool, nets map[int]bool) {
+	events = make(map[int]bool)
+	nets = make(map[int]bool)
+	var flows []models.Flow
+	if err := s.scoped().Select("edge_table", "edge_id").
+		Where("source = ? AND peer_id <> 0", models.FlowSourceCapture).Find(&flows).Error; err != nil {
+		return events, nets
+	}
+	for _, f := range flows {
+		if f.EdgeTable == (models.Net{}).TableName() {
+			nets[f.EdgeID] = true
+		} else {
+			events[f.EdgeID] = true
+		}
+	}
+	return events, nets
+}
+
+func (s *gormStore) LinkedMethods(eventIDs []int) map[int]string {
+	methods := make(map[int]string)
+	if len(eventIDs) == 0 {
+		return methods
+	}
+	var flows []models.Flow
+	if err := s.db.Select("edge_id", "method").
+		Where("edge_table = ? AND source = ? AND peer_id <> 0 AND edge_id IN ?", (models.Event{}).TableName(), models.FlowSourceSysdig, eventIDs).
+		Find(&flows).Error; err != nil {
+		return methods
+	}
+	for _, f := range flows {
+		methods[f.EdgeID] = f.Method
+	}
+	return methods
+}
+
+func (s *gormStore) FindUser(username string) (models.User, error) {
+	var u models.User
+	err := s.db.First(&u, "username = ?", username).Error
+	return u, err
+}
+
+func (s *gormStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
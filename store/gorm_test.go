@@ -0,0 +1,58 @@
+package store
+
+import (
+	"erinyes/logs"
+	"erinyes/models"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"testing"
+)
+
+// openTestStore 在临时目录中创建 SQLite 存储
+func openTestStore(t *testing.T) *gormStore {
+	logs.Logger = logrus.New()
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*gormStore)
+}
+
+func testEvent(src int, dst int, time int64) *models.Event {
+	return &models.Event{SrcID: src, DstID: dst, EventClass: "File_V1", Relation: "write", Operation: "write", Time: time, EndTime: time, Count: 1, UUID: "unknown"}
+}
+
+func TestInsertReducedEventsIsAtomic(t *testing.T) {
+	s := openTestStore(t)
+	if _, err := s.InsertEvents([]*models.Event{testEvent(1, 2, 1)}, false); err != nil {
+		t.Fatal(err)
+	}
+	exts := []EventExtension{{ID: 1, Count: 2, EndTime: 5, Bytes: 10}}
+	// 合并失败时新插入的边一同回滚
+	if err := s.db.Exec("CREATE TRIGGER fail_extend BEFORE UPDATE OF count ON event BEGIN SELECT RAISE(ABORT, 'extend failed'); END").Error; err != nil {
+		t.Fatal(err)
+	}
+	e := testEvent(3, 4, 6)
+	if _, err := s.InsertReducedEvents([]*models.Event{e}, false, exts); err == nil {
+		t.Fatal("insert succeeded, want error")
+	}
+	var n int64
+	if err := s.db.Model(&models.Event{}).Count(&n).Error; err != nil || n != 1 || e.ID != 0 {
+		t.Fatalf("%d events (%v), new event id %d after failed insert, want 1 event and id 0", n, err, e.ID)
+	}
+
+	// 重试只累加一次
+	if err := s.db.Exec("DROP TRIGGER fail_extend").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.InsertReducedEvents([]*models.Event{e}, false, exts); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetEvent(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 3 || got.EndTime != 5 || got.Bytes != 10 || e.ID != 2 {
+		t.Fatalf("extended edge count %d end_time %d bytes %d, new event id %d", got.Count, got.EndTime, got.Bytes, e.ID)
+	}
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"erinyes/models"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// Leaser 支持跨进程租约的存储，内存存储不需要实现
+// 插入边的进程缓存了顶点主键，其他进程回收孤立顶点会使这些主键失效，回收前需要确认没有其他插入进程
+type Leaser interface {
+	// RenewLease 登记或续期 holder 的租约，ttl 后过期
+	RenewLease(holder string, ttl time.Duration) error
+	// ReleaseLease 删除 holder 的租约
+	ReleaseLease(holder string) error
+	// LiveLeases 返回租约尚未过期的持有者
+	LiveLeases() ([]string, error)
+}
+
+func (s *gormStore) RenewLease(holder string, ttl time.Duration) error {
+	lease := models.InserterLease{Holder: holder, ExpiresAt: time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "holder"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expires_at"}),
+	}).Create(&lease).Error
+}
+
+func (s *gormStore) ReleaseLease(holder string) error {
+	return s.db.Where("holder = ?", holder).Delete(&models.InserterLease{}).Error
+}
+
+func (s *gormStore) LiveLeases() ([]string, error) {
+	var holders []string
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	err := s.db.Model(&models.InserterLease{}).Where("expires_at > ?", now).Order("holder").Pluck("holder", &holders).Error
+	return holders, err
+}
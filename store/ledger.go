@@ -0,0 +1,567 @@
+package store
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"erinyes/conf"
+	"erinyes/models"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxLedgerProblems VerifyLedger 最多返回的问题数
+const maxLedgerProblems = 100
+
+// LedgerProblem 校验哈希链时发现的一处篡改或缺失
+type LedgerProblem struct {
+	Seq    int    `json:"seq"` // 所在的项或检查点对应的项，0 表示不在链中
+	Table  string `json:"table,omitempty"`
+	ID     int    `json:"id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (p LedgerProblem) String() string {
+	if p.Table == "" {
+		return fmt.Sprintf("ledger entry %d: %s", p.Seq, p.Reason)
+	}
+	if p.Seq == 0 {
+		return fmt.Sprintf("%s %d: %s", p.Table, p.ID, p.Reason)
+	}
+	return fmt.Sprintf("ledger entry %d, %s %d: %s", p.Seq, p.Table, p.ID, p.Reason)
+}
+
+// LedgerReport 校验的结果，Problems 按所在的项排序，不在链中的记录排在最后
+type LedgerReport struct {
+	Entries      int             `json:"entries"`
+	Head         string          `json:"head"` // 链头的哈希
+	Events       int64           `json:"events"`
+	Nets         int64           `json:"nets"`
+	Vertices     int64           `json:"vertices"`
+	Purged       int64           `json:"purged"`    // 链中记录为已删除的边和顶点数
+	Unchained    int64           `json:"unchained"` // 开启 Ledger 之前插入、不在链中的边和顶点数
+	Checkpoints  int             `json:"checkpoints"`
+	ProblemCount int             `json:"problemCount"`
+	Problems     []LedgerProblem `json:"problems"` // 最多 maxLedgerProblems 条
+}
+
+func (r LedgerReport) String() string {
+	return fmt.Sprintf("entries: %d, events: %d, nets: %d, vertices: %d, purged: %d, unchained: %d, checkpoints: %d, problems: %d",
+		r.Entries, r.Events, r.Nets, r.Vertices, r.Purged, r.Unchained, r.Checkpoints, r.ProblemCount)
+}
+
+func (r *LedgerReport) problem(p LedgerProblem) {
+	r.ProblemCount++
+	r.Problems = append(r.Problems, p)
+}
+
+// Ledger 支持防篡改哈希链的存储，内存存储不需要实现
+// 开启 conf.Config.Ledger.Enable 后，每批插入的边、新建的顶点，purge 删除的每一批边、顶点，以及流量关联补全的 uuid 都会追加一项
+type Ledger interface {
+	// VerifyLedger 重新计算哈希链，逐条校验链中的边、顶点和边的请求关联，并校验数据库中保存的和 extra 中的检查点
+	// trusted 不为空时检查点必须由其对应的私钥签名
+	VerifyLedger(extra []models.LedgerCheckpoint, trusted ed25519.PublicKey) (LedgerReport, error)
+	// Checkpoint 对当前的链头签名并保存，链头已经由同一私钥签名过时返回已有的检查点
+	Checkpoint(key ed25519.PrivateKey) (models.LedgerCheckpoint, error)
+	// Checkpoints 返回保存的所有检查点，按链头序号排序
+	Checkpoints() ([]models.LedgerCheckpoint, error)
+}
+
+// ledgerMu 同一进程中追加项的事务从读取链头到提交之间不能交错，其他进程由链头的行锁和 seq 主键冲突发现
+// 追加项是事务的最后一步，持有 ledgerMu 期间只写入 ledger 表，其他写入在获取之前完成，插入、删除的主要工作可以并发执行
+var ledgerMu sync.Mutex
+
+// errLedgerConflict 其他进程同时追加了同一序号的项
+var errLedgerConflict = errors.New("ledger head changed by another writer")
+
+// ledgerLock 一个事务对 ledgerMu 的持有状态，第一次追加项时获取，事务结束后释放
+type ledgerLock struct {
+	held bool
+}
+
+func (l *ledgerLock) lock() {
+	if !l.held {
+		ledgerMu.Lock()
+		l.held = true
+	}
+}
+
+func (l *ledgerLock) unlock() {
+	if l.held {
+		ledgerMu.Unlock()
+		l.held = false
+	}
+}
+
+// maxLedgerAttempts 序号冲突时重新执行整个事务的次数上限
+const maxLedgerAttempts = 3
+
+// chainedTransaction 执行一个可能追加哈希链项的事务，fn 在追加项之后不能再写入其他表
+// 序号冲突时重新执行整个事务：MySQL 可重复读隔离级别下，在原事务中重新读取链头得到的仍是事务开始时的快照
+func (s *gormStore) chainedTransaction(fn func(tx *gorm.DB, l *ledgerLock) error) error {
+	for attempt := 1; ; attempt++ {
+		var l ledgerLock
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			return fn(tx, &l)
+		})
+		l.unlock()
+		if !errors.Is(err, errLedgerConflict) || attempt >= maxLedgerAttempts {
+			return err
+		}
+	}
+}
+
+// chain 为一批刚插入的边或顶点追加一项，tx 为插入它们的事务
+// 摘要取自数据库中的 chain_hash；去重时只有实际插入的一方追加，每条边只在一项中
+func chain(tx *gorm.DB, l *ledgerLock, model interface{}, table string, ids []int) error {
+	if !conf.Config.Ledger.Enable || len(ids) == 0 {
+		return nil
+	}
+	found, hashes, err := chainHashes(tx, model, ids)
+	if err != nil {
+		return err
+	}
+	return appendLedger(tx, l, models.LedgerInsert, table, found, models.LedgerDigest(hashes))
+}
+
+// chainHashes 按主键顺序返回存在的边及其 chain_hash
+func chainHashes(db *gorm.DB, model interface{}, ids []int) ([]int, []string, error) {
+	var (
+		found  []int
+		hashes []string
+	)
+	err := chunks(len(ids), func(lo int, hi int) error {
+		var rows []struct {
+			ID        int
+			ChainHash string
+		}
+		if err := db.Model(model).Select("id, chain_hash").Where("id IN ?", ids[lo:hi]).Scan(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			found = append(found, row.ID)
+			hashes = append(hashes, row.ChainHash)
+		}
+		return nil
+	})
+	sort.Sort(idHashes{found, hashes})
+	return found, hashes, err
+}
+
+type idHashes struct {
+	ids    []int
+	hashes []string
+}
+
+func (h idHashes) Len() int           { return len(h.ids) }
+func (h idHashes) Less(i, j int) bool { return h.ids[i] < h.ids[j] }
+func (h idHashes) Swap(i, j int) {
+	h.ids[i], h.ids[j] = h.ids[j], h.ids[i]
+	h.hashes[i], h.hashes[j] = h.hashes[j], h.hashes[i]
+}
+
+// appendLedger 在链头之后追加一项，获取 ledgerMu 并以 FOR UPDATE 读取链头；追加失败时返回 errLedgerConflict，由 chainedTransaction 重新执行整个事务
+func appendLedger(tx *gorm.DB, l *ledgerLock, kind string, table string, ids []int, digest string) error {
+	l.lock()
+	var head models.LedgerEntry
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("seq DESC").Limit(1).Find(&head).Error; err != nil {
+		return err
+	}
+	entry := models.LedgerEntry{
+		Seq:       head.Seq + 1,
+		Kind:      kind,
+		EdgeTable: table,
+		EdgeIDs:   models.EncodeIDs(ids),
+		Digest:    digest,
+		Time:      time.Now().Unix(),
+		PrevHash:  head.Hash,
+	}
+	if head.Seq == 0 {
+		entry.PrevHash = models.LedgerGenesis
+	}
+	entry.Hash = entry.ComputeHash()
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("%w: append entry %d: %v", errLedgerConflict, entry.Seq, err)
+	}
+	return nil
+}
+
+// Checkpoint 不获取 ledgerMu：SQLite 只有一个连接，等待 ledgerMu 的事务正占用该连接；同时追加的项只会让检查点落后于链头
+func (s *gormStore) Checkpoint(key ed25519.PrivateKey) (models.LedgerCheckpoint, error) {
+	var head models.LedgerEntry
+	if err := s.db.Order("seq DESC").Limit(1).Find(&head).Error; err != nil {
+		return models.LedgerCheckpoint{}, err
+	}
+	if head.Seq == 0 {
+		return models.LedgerCheckpoint{}, fmt.Errorf("ledger is empty")
+	}
+	publicKey := hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	var c models.LedgerCheckpoint
+	if err := s.db.Where("seq = ? AND hash = ? AND public_key = ?", head.Seq, head.Hash, publicKey).Limit(1).Find(&c).Error; err != nil || c.ID != 0 {
+		return c, err
+	}
+	c = models.LedgerCheckpoint{Seq: head.Seq, Hash: head.Hash, Time: time.Now().Unix()}
+	c.Sign(key)
+	err := s.db.Create(&c).Error
+	return c, err
+}
+
+func (s *gormStore) Checkpoints() ([]models.LedgerCheckpoint, error) {
+	var checkpoints []models.LedgerCheckpoint
+	err := s.db.Order("seq, id").Find(&checkpoints).Error
+	return checkpoints, err
+}
+
+// chainedEntry 链中的一批插入的记录或补全的 uuid，等待逐条校验
+type chainedEntry struct {
+	seq    int
+	kind   string
+	table  string
+	ids    []int
+	digest string
+}
+
+// chainedTables 哈希链中的表及其模型
+func chainedTables() map[string]interface{} {
+	return map[string]interface{}{
+		(models.Event{}).TableName():   &models.Event{},
+		(models.Net{}).TableName():     &models.Net{},
+		(models.Process{}).TableName(): &models.Process{},
+		(models.File{}).TableName():    &models.File{},
+		(models.Socket{}).TableName():  &models.Socket{},
+	}
+}
+
+// isEdgeTable table 是否为边所在的表
+func isEdgeTable(table string) bool {
+	return table == (models.Event{}).TableName() || table == (models.Net{}).TableName()
+}
+
+// recordKind 问题描述中的记录类型
+func recordKind(table string) string {
+	if isEdgeTable(table) {
+		return "edge"
+	}
+	return "vertex"
+}
+
+func (s *gormStore) VerifyLedger(extra []models.LedgerCheckpoint, trusted ed25519.PublicKey) (LedgerReport, error) {
+	var report LedgerReport
+	tables := chainedTables()
+	purged := map[string]map[int]bool{}
+	covered := map[string]map[int]bool{}
+	linked := map[string]map[int]bool{}
+	for table := range tables {
+		purged[table], covered[table], linked[table] = make(map[int]bool), make(map[int]bool), make(map[int]bool)
+	}
+
+	// 1. 校验链：序号连续、每一项的 prev_hash 等于上一项的哈希、哈希与内容一致
+	hashes := make(map[int]string) // 序号 -> 哈希，用于校验检查点
+	var entries []chainedEntry
+	prevSeq, prevHash := 0, models.LedgerGenesis
+	for {
+		var batch []models.LedgerEntry
+		if err := s.db.Where("seq > ?", prevSeq).Order("seq").Limit(batchSize).Find(&batch).Error; err != nil {
+			return report, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, entry := range batch {
+			report.Entries++
+			if entry.Seq != prevSeq+1 {
+				report.problem(LedgerProblem{Seq: prevSeq + 1, Reason: fmt.Sprintf("entries %d-%d are missing", prevSeq+1, entry.Seq-1)})
+			} else if entry.PrevHash != prevHash {
+				report.problem(LedgerProblem{Seq: entry.Seq, Reason: "prev_hash does not match the previous entry"})
+			}
+			if entry.ComputeHash() != entry.Hash {
+				report.problem(LedgerProblem{Seq: entry.Seq, Reason: "entry has been modified"})
+			}
+			prevSeq, prevHash = entry.Seq, entry.Hash
+			hashes[entry.Seq] = entry.Hash
+
+			ids, err := models.DecodeIDs(entry.EdgeIDs)
+			_, ok := tables[entry.EdgeTable]
+			if err != nil || !ok || entry.Kind == models.LedgerLink && !isEdgeTable(entry.EdgeTable) {
+				report.problem(LedgerProblem{Seq: entry.Seq, Reason: fmt.Sprintf("invalid records %s %s", entry.EdgeTable, entry.EdgeIDs)})
+				continue
+			}
+			switch entry.Kind {
+			case models.LedgerPurge:
+				for _, id := range ids {
+					purged[entry.EdgeTable][id] = true
+				}
+				report.Purged += int64(len(ids))
+				continue
+			case models.LedgerLink:
+				for _, id := range ids {
+					if linked[entry.EdgeTable][id] {
+						report.problem(LedgerProblem{Seq: entry.Seq, Table: entry.EdgeTable, ID: id, Reason: "uuid of edge was linked twice"})
+					}
+					linked[entry.EdgeTable][id] = true
+				}
+			}
+			entries = append(entries, chainedEntry{seq: entry.Seq, kind: entry.Kind, table: entry.EdgeTable, ids: ids, digest: entry.Digest})
+		}
+	}
+	report.Head = prevHash
+
+	// 2. 逐条校验链中的记录：内容与 chain_hash 一致，边的请求关联与 uuid 一致，整批的 chain_hash 与摘要一致；
+	// 补全过 uuid 的边按补全前的 uuid 校验 chain_hash，补全后的 uuid 与补全项的摘要一致；之后被删除的记录只能逐条校验
+	minChained := map[string]int{}
+	for _, entry := range entries {
+		rows, err := s.chainedRows(entry.table, entry.ids, linked[entry.table])
+		if err != nil {
+			return report, err
+		}
+		complete := true
+		var entryHashes []string
+		for _, id := range entry.ids {
+			if entry.kind == models.LedgerInsert {
+				if min, ok := minChained[entry.table]; !ok || id < min {
+					minChained[entry.table] = id
+				}
+				covered[entry.table][id] = true
+			}
+			if purged[entry.table][id] {
+				complete = false
+				continue
+			}
+			row, ok := rows[id]
+			if entry.kind == models.LedgerLink {
+				if !ok { // 缺失的边由插入项报告
+					complete = false
+					continue
+				}
+				entryHashes = append(entryHashes, row.link)
+				continue
+			}
+			if !ok {
+				complete = false
+				report.problem(LedgerProblem{Seq: entry.seq, Table: entry.table, ID: id, Reason: recordKind(entry.table) + " is missing"})
+				continue
+			}
+			if row.computed != row.stored {
+				report.problem(LedgerProblem{Seq: entry.seq, Table: entry.table, ID: id, Reason: recordKind(entry.table) + " has been modified"})
+			}
+			if !row.requests {
+				report.problem(LedgerProblem{Seq: entry.seq, Table: entry.table, ID: id, Reason: "requests of edge do not match its uuid"})
+			}
+			entryHashes = append(entryHashes, row.stored)
+		}
+		if !complete || models.LedgerDigest(entryHashes) == entry.digest {
+			continue
+		}
+		if entry.kind == models.LedgerLink {
+			report.problem(LedgerProblem{Seq: entry.seq, Reason: "uuid of edges does not match the digest"})
+		} else if isEdgeTable(entry.table) {
+			report.problem(LedgerProblem{Seq: entry.seq, Reason: "chain_hash of edges does not match the digest"})
+		} else {
+			report.problem(LedgerProblem{Seq: entry.seq, Reason: "chain_hash of vertices does not match the digest"})
+		}
+	}
+
+	// 3. 不在链中的记录：主键小于链中最小主键的视为开启 Ledger 之前插入的，其余视为篡改
+	for table, model := range tables {
+		lastID := 0
+		for {
+			var ids []int
+			if err := s.db.Model(model).Where("id > ?", lastID).Order("id").Limit(batchSize).Pluck("id", &ids).Error; err != nil {
+				return report, err
+			}
+			if len(ids) == 0 {
+				break
+			}
+			for _, id := range ids {
+				lastID = id
+				switch {
+				case covered[table][id] && purged[table][id]:
+					report.problem(LedgerProblem{Table: table, ID: id, Reason: recordKind(table) + " was purged but exists"})
+				case covered[table][id]:
+					switch table {
+					case (models.Event{}).TableName():
+						report.Events++
+					case (models.Net{}).TableName():
+						report.Nets++
+					default:
+						report.Vertices++
+					}
+				case purged[table][id]:
+				default:
+					if min, ok := minChained[table]; !ok || id < min {
+						report.Unchained++
+					} else {
+						report.problem(LedgerProblem{Table: table, ID: id, Reason: recordKind(table) + " is not in the ledger"})
+					}
+				}
+			}
+		}
+	}
+
+	// 4. 检查点：签名有效，且与链中对应的项一致
+	checkpoints, err := s.Checkpoints()
+	if err != nil {
+		return report, err
+	}
+	for _, c := range append(checkpoints, extra...) {
+		report.Checkpoints++
+		switch hash, ok := hashes[c.Seq]; {
+		case !c.VerifySignature():
+			report.problem(LedgerProblem{Seq: c.Seq, Reason: "checkpoint signature is invalid"})
+		case trusted != nil && c.PublicKey != hex.EncodeToString(trusted):
+			report.problem(LedgerProblem{Seq: c.Seq, Reason: "checkpoint is signed by an unknown key " + c.PublicKey})
+		case !ok:
+			report.problem(LedgerProblem{Seq: c.Seq, Reason: fmt.Sprintf("checkpoint refers to an entry beyond the head %d", prevSeq)})
+		case hash != c.Hash:
+			report.problem(LedgerProblem{Seq: c.Seq, Reason: "checkpoint does not match the entry, ledger has been rewritten"})
+		}
+	}
+
+	sort.SliceStable(report.Problems, func(i, j int) bool {
+		si, sj := report.Problems[i].Seq, report.Problems[j].Seq
+		if si == 0 || sj == 0 {
+			return si != 0 && sj == 0
+		}
+		return si < sj
+	})
+	if len(report.Problems) > maxLedgerProblems {
+		report.Problems = report.Problems[:maxLedgerProblems]
+	}
+	return report, nil
+}
+
+// chainedRow 链中一条记录的校验数据
+type chainedRow struct {
+	computed string // 按插入时的内容重新计算的 chain_hash
+	stored   string // 保存的 chain_hash
+	link     string // 当前 uuid 的 LinkHash，只用于 event
+	requests bool   // 边的请求关联与 uuid 一致，顶点总是为 true
+}
+
+// chainedRows 返回主键 -> 校验数据，linked 中的 event 补全过 uuid，按补全前的未知 uuid 重新计算 chain_hash
+func (s *gormStore) chainedRows(table string, ids []int, linked map[int]bool) (map[int]chainedRow, error) {
+	rows := make(map[int]chainedRow, len(ids))
+	err := chunks(len(ids), func(lo int, hi int) error {
+		uuids := make(map[int]string, hi-lo)
+		switch table {
+		case (models.Event{}).TableName():
+			var events []models.Event
+			if err := s.db.Where("id IN ?", ids[lo:hi]).Find(&events).Error; err != nil {
+				return err
+			}
+			for _, e := range events {
+				uuids[e.ID] = e.UUID
+				row := chainedRow{stored: e.ChainHash, link: models.LinkHash(table, e.ID, e.UUID)}
+				if linked[e.ID] {
+					e.UUID = ""
+				}
+				row.computed = e.ComputeChainHash()
+				rows[e.ID] = row
+			}
+		case (models.Net{}).TableName():
+			var nets []models.Net
+			if err := s.db.Where("id IN ?", ids[lo:hi]).Find(&nets).Error; err != nil {
+				return err
+			}
+			for _, n := range nets {
+				uuids[n.ID] = n.UUID
+				rows[n.ID] = chainedRow{computed: n.ComputeChainHash(), stored: n.ChainHash}
+			}
+		case (models.Process{}).TableName():
+			var ps []models.Process
+			if err := s.db.Where("id IN ?", ids[lo:hi]).Find(&ps).Error; err != nil {
+				return err
+			}
+			for _, p := range ps {
+				rows[p.ID] = chainedRow{computed: p.ComputeChainHash(), stored: p.ChainHash, requests: true}
+			}
+		case (models.File{}).TableName():
+			var fs []models.File
+			if err := s.db.Where("id IN ?", ids[lo:hi]).Find(&fs).Error; err != nil {
+				return err
+			}
+			for _, f := range fs {
+				rows[f.ID] = chainedRow{computed: f.ComputeChainHash(), stored: f.ChainHash, requests: true}
+			}
+		case (models.Socket{}).TableName():
+			var ss []models.Socket
+			if err := s.db.Where("id IN ?", ids[lo:hi]).Find(&ss).Error; err != nil {
+				return err
+			}
+			for _, so := range ss {
+				rows[so.ID] = chainedRow{computed: so.ComputeChainHash(), stored: so.ChainHash, requests: true}
+			}
+		}
+		if !isEdgeTable(table) {
+			return nil
+		}
+		// 请求关联由边的 uuid 生成，逐条比较
+		var requests []models.EdgeRequest
+		if err := s.db.Where("edge_table = ? AND edge_id IN ?", table, ids[lo:hi]).Find(&requests).Error; err != nil {
+			return err
+		}
+		got := make(map[int][]string)
+		for _, r := range requests {
+			got[r.EdgeID] = append(got[r.EdgeID], r.UUID)
+		}
+		for id, uuid := range uuids {
+			row := rows[id]
+			row.requests = sameUUIDs(got[id], models.SplitUUIDs(uuid))
+			rows[id] = row
+		}
+		return nil
+	})
+	return rows, err
+}
+
+// sameUUIDs a、b 去重后是否包含相同的 uuid
+func sameUUIDs(a []string, b []string) bool {
+	set := func(uuids []string) map[string]bool {
+		m := make(map[string]bool, len(uuids))
+		for _, u := range uuids {
+			m[u] = true
+		}
+		return m
+	}
+	sa, sb := set(a), set(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for u := range sa {
+		if !sb[u] {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadLedgerKey 读取 hex 编码的 ed25519 私钥种子，文件不存在且 create 为 true 时生成新的私钥
+func LoadLedgerKey(path string, create bool) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && create {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(key.Seed())+"\n"), 0600); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid ledger key %s", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
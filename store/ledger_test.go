@@ -0,0 +1,243 @@
+package store
+
+import (
+	"erinyes/conf"
+	"erinyes/logs"
+	"erinyes/models"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// openLedgerStore 在临时目录中创建开启 Ledger 的 SQLite 存储，并插入 3 条 event 边（主键 1-3，在第 1 项中）和 2 个进程（在第 2 项中）
+func openLedgerStore(t *testing.T) *gormStore {
+	logs.Logger = logrus.New()
+	enable := conf.Config.Ledger.Enable
+	conf.Config.Ledger.Enable = true
+	t.Cleanup(func() { conf.Config.Ledger.Enable = enable })
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "ledger.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []*models.Event
+	for i := 1; i <= 3; i++ {
+		events = append(events, &models.Event{SrcID: i, DstID: i + 1, EventClass: "File_V1", Relation: "write", Operation: "write", Time: int64(i), EndTime: int64(i), Count: 1, UUID: "unknown"})
+	}
+	if _, err := s.InsertEvents(events, false); err != nil {
+		t.Fatal(err)
+	}
+	ps := []*models.Process{{HostID: "h", ContainerID: "c", ProcessVPID: "1", ProcessName: "a"}, {HostID: "h", ContainerID: "c", ProcessVPID: "2", ProcessName: "b"}}
+	if _, err := s.UpsertProcesses(ps); err != nil {
+		t.Fatal(err)
+	}
+	return s.(*gormStore)
+}
+
+func TestVerifyLedger(t *testing.T) {
+	const event = "event"
+	cases := []struct {
+		name   string
+		tamper func(db *gorm.DB) error
+		want   []LedgerProblem
+	}{
+		{
+			name:   "intact",
+			tamper: func(db *gorm.DB) error { return nil },
+		},
+		{
+			name: "modified",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("UPDATE event SET relation = 'read' WHERE id = 2").Error
+			},
+			want: []LedgerProblem{{Seq: 1, Table: event, ID: 2, Reason: "edge has been modified"}},
+		},
+		{
+			name: "missing",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("DELETE FROM event WHERE id = 2").Error
+			},
+			want: []LedgerProblem{{Seq: 1, Table: event, ID: 2, Reason: "edge is missing"}},
+		},
+		{
+			name: "purged but present",
+			tamper: func(db *gorm.DB) error {
+				var l ledgerLock
+				defer l.unlock()
+				return appendLedger(db, &l, models.LedgerPurge, event, []int{2}, models.LedgerDigest(nil))
+			},
+			want: []LedgerProblem{{Table: event, ID: 2, Reason: "edge was purged but exists"}},
+		},
+		{
+			name: "not in ledger",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("INSERT INTO event (src_id, dst_id, event_class, relation, operation, time, end_time, count, uuid, dataset) VALUES (9, 10, 'File_V1', 'write', 'write', 9, 9, 1, 'unknown', 'default')").Error
+			},
+			want: []LedgerProblem{{Table: event, ID: 4, Reason: "edge is not in the ledger"}},
+		},
+		{
+			name: "vertex modified",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("UPDATE process SET process_exe_path = '/bin/sh' WHERE id = 2").Error
+			},
+			want: []LedgerProblem{{Seq: 2, Table: "process", ID: 2, Reason: "vertex has been modified"}},
+		},
+		{
+			name: "vertex not in ledger",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("INSERT INTO process (host_id, container_id, process_vpid, process_name, dataset) VALUES ('h', 'c', '3', 'x', 'default')").Error
+			},
+			want: []LedgerProblem{{Table: "process", ID: 3, Reason: "vertex is not in the ledger"}},
+		},
+		{
+			name: "uuid modified",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("UPDATE event SET uuid = 'forged' WHERE id = 3").Error
+			},
+			want: []LedgerProblem{
+				{Seq: 1, Table: event, ID: 3, Reason: "edge has been modified"},
+				{Seq: 1, Table: event, ID: 3, Reason: "requests of edge do not match its uuid"},
+			},
+		},
+		{
+			name: "request added",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("INSERT INTO edge_request (edge_table, edge_id, uuid) VALUES ('event', 2, 'forged')").Error
+			},
+			want: []LedgerProblem{{Seq: 1, Table: event, ID: 2, Reason: "requests of edge do not match its uuid"}},
+		},
+		{
+			name: "entry modified",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("UPDATE ledger SET edge_ids = '1-2' WHERE seq = 1").Error
+			},
+			want: []LedgerProblem{
+				{Seq: 1, Reason: "entry has been modified"},
+				{Seq: 1, Reason: "chain_hash of edges does not match the digest"},
+				{Table: event, ID: 3, Reason: "edge is not in the ledger"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := openLedgerStore(t)
+			if err := c.tamper(s.db); err != nil {
+				t.Fatal(err)
+			}
+			report, err := s.VerifyLedger(nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.ProblemCount != len(c.want) || len(c.want) > 0 && !reflect.DeepEqual(report.Problems, c.want) {
+				t.Fatalf("problems %v, want %v", report.Problems, c.want)
+			}
+		})
+	}
+}
+
+func TestVerifyLedgerLinkedUUID(t *testing.T) {
+	cases := []struct {
+		name   string
+		tamper func(db *gorm.DB) error
+		want   []LedgerProblem
+	}{
+		{
+			name:   "intact",
+			tamper: func(db *gorm.DB) error { return nil },
+		},
+		{
+			name: "linked uuid modified",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("UPDATE event SET uuid = 'forged' WHERE id = 1").Error
+			},
+			want: []LedgerProblem{
+				{Seq: 1, Table: "event", ID: 1, Reason: "requests of edge do not match its uuid"},
+				{Seq: 3, Reason: "uuid of edges does not match the digest"},
+			},
+		},
+		{
+			name: "request of linked uuid deleted",
+			tamper: func(db *gorm.DB) error {
+				return db.Exec("DELETE FROM edge_request WHERE edge_id = 1").Error
+			},
+			want: []LedgerProblem{{Seq: 1, Table: "event", ID: 1, Reason: "requests of edge do not match its uuid"}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := openLedgerStore(t)
+			flow := &models.Flow{EdgeTable: "event", EdgeID: 1, Source: models.FlowSourceSysdig, SrcIP: "a", SrcPort: "1", DstIP: "b", DstPort: "2", PayloadLen: 10, Time: 1}
+			peer := &models.Flow{EdgeTable: "net", EdgeID: 1, Source: models.FlowSourceCapture, SrcIP: "a", SrcPort: "1", DstIP: "b", DstPort: "2", PayloadLen: 10, Time: 1}
+			if err := s.InsertFlows([]*models.Flow{flow, peer}); err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := s.LinkFlows(*flow, *peer, "req-1"); err != nil || !ok {
+				t.Fatalf("link flows: %v, %v", ok, err)
+			}
+			if err := c.tamper(s.db); err != nil {
+				t.Fatal(err)
+			}
+			report, err := s.VerifyLedger(nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Entries != 3 || report.ProblemCount != len(c.want) || len(c.want) > 0 && !reflect.DeepEqual(report.Problems, c.want) {
+				t.Fatalf("%d entries, problems %v, want 3 entries and %v", report.Entries, report.Problems, c.want)
+			}
+		})
+	}
+}
+
+func TestLedgerConflictRestartsTransaction(t *testing.T) {
+	s := openLedgerStore(t)
+	// 模拟其他进程抢先追加了同一序号：第一次写入 ledger 失败
+	conflicts := 1
+	err := s.db.Callback().Create().Before("gorm:create").Register("test:ledger_conflict", func(db *gorm.DB) {
+		if db.Statement.Table == "ledger" && conflicts > 0 {
+			conflicts--
+			db.AddError(errors.New("UNIQUE constraint failed: ledger.seq"))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &models.Event{SrcID: 7, DstID: 8, EventClass: "File_V1", Relation: "write", Operation: "write", Time: 7, EndTime: 7, Count: 1, UUID: "req-2"}
+	if _, err := s.InsertEvents([]*models.Event{e}, false); err != nil {
+		t.Fatal(err)
+	}
+	if conflicts != 0 || e.ID != 4 {
+		t.Fatalf("%d conflicts left, event id %d, want 0 and 4", conflicts, e.ID)
+	}
+	report, err := s.VerifyLedger(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entries != 3 || report.Events != 4 || report.ProblemCount != 0 {
+		t.Fatalf("report %s, problems %v", report, report.Problems)
+	}
+}
+
+func TestPurgeIsChained(t *testing.T) {
+	s := openLedgerStore(t)
+	opts := PurgeOptions{Before: 100, ChunkSize: 2}
+	if _, err := s.PurgeEdges(opts); err != nil {
+		t.Fatal(err)
+	}
+	report, err := s.PurgeVertices(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Processes != 2 {
+		t.Fatalf("%d processes purged, want 2", report.Processes)
+	}
+	verify, err := s.VerifyLedger(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 两批边、一批顶点
+	if verify.Entries != 5 || verify.Purged != 5 || verify.ProblemCount != 0 {
+		t.Fatalf("report %s, problems %v", verify, verify.Problems)
+	}
+}
@@ -0,0 +1,824 @@
+package store
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"erinyes/models"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrNotFound = fmt.Errorf("record not found")
+
+type processKey struct{ dataset, hostID, containerID, vpid, name string }
+type fileKey struct{ dataset, hostID, containerID, path string }
+type socketKey struct{ dataset, hostID, containerID, ip, port string }
+type eventKey struct {
+	srcID, dstID           int
+	class, operation, uuid string
+}
+type netKey struct {
+	srcID, dstID int
+	method, uuid string
+}
+type flowKey struct {
+	srcIP, srcPort, dstIP, dstPort string
+	payloadLen                     int
+}
+
+// MemoryStore 将顶点和边保存在内存中，用于不连接数据库的一次性分析
+// 各类记录按主键顺序保存在切片中（主键即下标加一），并按唯一键和邻接关系建立索引，同一份数据的不同数据集视图共享 memoryTables
+type MemoryStore struct {
+	*memoryTables
+	dataset string // 当前视图的数据集
+}
+
+type memoryTables struct {
+	mu sync.RWMutex
+
+	processes []models.Process
+	files     []models.File
+	sockets   []models.Socket
+	events    []models.Event
+	nets      []models.Net
+	flows     []models.Flow
+
+	processIndex map[processKey]int
+	fileIndex    map[fileKey]int
+	socketIndex  map[socketKey]int
+	eventIndex   map[string]int // 去重键 -> event 主键，只包含以去重方式插入的边
+	netIndex     map[string]int
+	eventsBySrc  map[int][]int // 顶点主键 -> event 主键，顶点可能来自不同的表，由事件类型区分
+	eventsByDst  map[int][]int
+	netsBySrc    map[int][]int
+	netsByDst    map[int][]int
+	captureIndex map[flowKey][]int // 流量侧 flow 的四元组与载荷长度 -> flow 主键
+	eventReqs    map[string][]int  // 请求 uuid -> 属于该请求的 event 主键（有序）
+	netReqs      map[string][]int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{dataset: DefaultDataset, memoryTables: &memoryTables{
+		processIndex: make(map[processKey]int),
+		fileIndex:    make(map[fileKey]int),
+		socketIndex:  make(map[socketKey]int),
+		eventIndex:   make(map[string]int),
+		netIndex:     make(map[string]int),
+		eventsBySrc:  make(map[int][]int),
+		eventsByDst:  make(map[int][]int),
+		netsBySrc:    make(map[int][]int),
+		netsByDst:    make(map[int][]int),
+		captureIndex: make(map[flowKey][]int),
+		eventReqs:    make(map[string][]int),
+		netReqs:      make(map[string][]int),
+	}}
+}
+
+func (m *MemoryStore) WithDataset(name string) Store {
+	return &MemoryStore{memoryTables: m.memoryTables, dataset: name}
+}
+
+func (m *MemoryStore) Dataset() string {
+	return m.dataset
+}
+
+// datasetOf 写入的记录没有指定数据集时属于当前数据集
+func (m *MemoryStore) datasetOf(dataset *string) {
+	if *dataset == "" {
+		*dataset = m.dataset
+	}
+}
+
+// OpenMemory 创建内存存储，path 指向的快照文件存在时从快照中加载
+func OpenMemory(path string) (Store, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return LoadSnapshot(path)
+		}
+	}
+	return NewMemoryStore(), nil
+}
+
+func (m *MemoryStore) UpsertProcesses(ps []*models.Process) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	created := 0
+	for _, p := range ps {
+		if m.upsertProcess(p) {
+			created++
+		}
+	}
+	return created, nil
+}
+
+func (m *MemoryStore) UpsertFiles(fs []*models.File) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	created := 0
+	for _, f := range fs {
+		if m.upsertFile(f) {
+			created++
+		}
+	}
+	return created, nil
+}
+
+func (m *MemoryStore) UpsertSockets(ss []*models.Socket) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	created := 0
+	for _, s := range ss {
+		if m.upsertSocket(s) {
+			created++
+		}
+	}
+	return created, nil
+}
+
+// upsertProcess 等单条写入的方法由调用方持有写锁
+func (m *MemoryStore) upsertProcess(p *models.Process) bool {
+	m.datasetOf(&p.Dataset)
+	key := processKey{p.Dataset, p.HostID, p.ContainerID, p.ProcessVPID, p.ProcessName}
+	if id, ok := m.processIndex[key]; ok {
+		*p = m.processes[id-1]
+		return false
+	}
+	p.ID = len(m.processes) + 1
+	m.processes = append(m.processes, *p)
+	m.processIndex[key] = p.ID
+	return true
+}
+
+func (m *MemoryStore) upsertFile(f *models.File) bool {
+	m.datasetOf(&f.Dataset)
+	key := fileKey{f.Dataset, f.HostID, f.ContainerID, f.FilePath}
+	if id, ok := m.fileIndex[key]; ok {
+		*f = m.files[id-1]
+		return false
+	}
+	f.ID = len(m.files) + 1
+	m.files = append(m.files, *f)
+	m.fileIndex[key] = f.ID
+	return true
+}
+
+func (m *MemoryStore) upsertSocket(s *models.Socket) bool {
+	m.datasetOf(&s.Dataset)
+	key := socketKey{s.Dataset, s.HostID, s.ContainerID, s.DstIP, s.DstPort}
+	if id, ok := m.socketIndex[key]; ok {
+		*s = m.sockets[id-1]
+		return false
+	}
+	s.ID = len(m.sockets) + 1
+	m.sockets = append(m.sockets, *s)
+	m.socketIndex[key] = s.ID
+	return true
+}
+
+func (m *MemoryStore) GetProcess(id int) (models.Process, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id < 1 || id > len(m.processes) {
+		return models.Process{}, ErrNotFound
+	}
+	return m.processes[id-1], nil
+}
+
+func (m *MemoryStore) GetFile(id int) (models.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id < 1 || id > len(m.files) {
+		return models.File{}, ErrNotFound
+	}
+	return m.files[id-1], nil
+}
+
+func (m *MemoryStore) GetSocket(id int) (models.Socket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id < 1 || id > len(m.sockets) {
+		return models.Socket{}, ErrNotFound
+	}
+	return m.sockets[id-1], nil
+}
+
+func (m *MemoryStore) GetProcesses(ids []int) ([]models.Process, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var processes []models.Process
+	for _, id := range ids {
+		if id >= 1 && id <= len(m.processes) {
+			processes = append(processes, m.processes[id-1])
+		}
+	}
+	return processes, nil
+}
+
+func (m *MemoryStore) GetFiles(ids []int) ([]models.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var files []models.File
+	for _, id := range ids {
+		if id >= 1 && id <= len(m.files) {
+			files = append(files, m.files[id-1])
+		}
+	}
+	return files, nil
+}
+
+func (m *MemoryStore) GetSockets(ids []int) ([]models.Socket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var sockets []models.Socket
+	for _, id := range ids {
+		if id >= 1 && id <= len(m.sockets) {
+			sockets = append(sockets, m.sockets[id-1])
+		}
+	}
+	return sockets, nil
+}
+
+func (m *MemoryStore) FindProcess(hostID string, containerID string, vpid string, name string) (models.Process, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id, ok := m.processIndex[processKey{m.dataset, hostID, containerID, vpid, name}]; ok {
+		return m.processes[id-1], nil
+	}
+	return models.Process{}, ErrNotFound
+}
+
+func (m *MemoryStore) SearchProcesses(keyword string, offset int, limit int) ([]models.Process, int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []models.Process
+	for _, p := range m.processes {
+		if p.Dataset == m.dataset && strings.Contains(p.ProcessName, keyword) {
+			matched = append(matched, p)
+		}
+	}
+	return page(matched, offset, limit).([]models.Process), int64(len(matched)), nil
+}
+
+func (m *MemoryStore) SearchFiles(keyword string, offset int, limit int) ([]models.File, int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []models.File
+	for _, f := range m.files {
+		if f.Dataset == m.dataset && strings.Contains(f.FilePath, keyword) {
+			matched = append(matched, f)
+		}
+	}
+	return page(matched, offset, limit).([]models.File), int64(len(matched)), nil
+}
+
+func (m *MemoryStore) SearchSockets(keyword string, offset int, limit int) ([]models.Socket, int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []models.Socket
+	for _, s := range m.sockets {
+		if s.Dataset == m.dataset && strings.Contains(s.DstIP, keyword) {
+			matched = append(matched, s)
+		}
+	}
+	return page(matched, offset, limit).([]models.Socket), int64(len(matched)), nil
+}
+
+func (m *MemoryStore) MatchFiles(hostID string, containerID string, pattern string) ([]models.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []models.File
+	for _, f := range m.files {
+		if f.Dataset == m.dataset && matchVertex(hostID, containerID, f.HostID, f.ContainerID) && MatchPattern(pattern, f.FilePath) {
+			matched = append(matched, f)
+		}
+	}
+	return matched, nil
+}
+
+func (m *MemoryStore) MatchSockets(hostID string, containerID string, ipPattern string, portPattern string) ([]models.Socket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []models.Socket
+	for _, s := range m.sockets {
+		if s.Dataset == m.dataset && matchVertex(hostID, containerID, s.HostID, s.ContainerID) &&
+			MatchPattern(ipPattern, s.DstIP) && MatchPattern(portPattern, s.DstPort) {
+			matched = append(matched, s)
+		}
+	}
+	return matched, nil
+}
+
+// page 返回切片中 [offset, offset+limit) 的部分
+func page(records interface{}, offset int, limit int) interface{} {
+	switch r := records.(type) {
+	case []models.Process:
+		lo, hi := bounds(len(r), offset, limit)
+		return r[lo:hi]
+	case []models.File:
+		lo, hi := bounds(len(r), offset, limit)
+		return r[lo:hi]
+	case []models.Socket:
+		lo, hi := bounds(len(r), offset, limit)
+		return r[lo:hi]
+	}
+	return records
+}
+
+func bounds(n int, offset int, limit int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	end := n
+	if limit >= 0 && offset+limit < n {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+func (m *MemoryStore) InsertEvents(es []*models.Event, dedup bool) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inserted := make([]bool, len(es))
+	for i, e := range es {
+		inserted[i] = m.insertEvent(e, dedup)
+	}
+	return inserted, nil
+}
+
+func (m *MemoryStore) InsertNets(ns []*models.Net, dedup bool) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inserted := make([]bool, len(ns))
+	for i, n := range ns {
+		inserted[i] = m.insertNet(n, dedup)
+	}
+	return inserted, nil
+}
+
+func (m *MemoryStore) InsertFlows(fs []*models.Flow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range fs {
+		m.insertFlow(f)
+	}
+	return nil
+}
+
+func (m *MemoryStore) InsertReducedEvents(es []*models.Event, dedup bool, exts []EventExtension) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inserted := make([]bool, len(es))
+	for i, e := range es {
+		inserted[i] = m.insertEvent(e, dedup)
+	}
+	for _, ext := range exts {
+		if ext.ID < 1 || ext.ID > len(m.events) {
+			continue
+		}
+		e := &m.events[ext.ID-1]
+		e.Count += ext.Count
+		e.Bytes += ext.Bytes
+		if e.EndTime < ext.EndTime {
+			e.EndTime = ext.EndTime
+		}
+	}
+	return inserted, nil
+}
+
+func (m *MemoryStore) insertEvent(e *models.Event, dedup bool) bool {
+	m.datasetOf(&e.Dataset)
+	if dedup {
+		key := dedupKey(e.SrcID, e.DstID, e.EventClass, e.Operation, e.UUID)
+		if _, ok := m.eventIndex[key]; ok {
+			return false
+		}
+		e.DedupKey = &key
+		m.eventIndex[key] = len(m.events) + 1
+	}
+	e.ID = len(m.events) + 1
+	m.events = append(m.events, *e)
+	m.eventsBySrc[e.SrcID] = append(m.eventsBySrc[e.SrcID], e.ID)
+	m.eventsByDst[e.DstID] = append(m.eventsByDst[e.DstID], e.ID)
+	addRequests(m.eventReqs, e.ID, e.UUID)
+	return true
+}
+
+func (m *MemoryStore) insertNet(n *models.Net, dedup bool) bool {
+	m.datasetOf(&n.Dataset)
+	if dedup {
+		key := dedupKey(n.SrcID, n.DstID, n.Method, n.UUID)
+		if _, ok := m.netIndex[key]; ok {
+			return false
+		}
+		n.DedupKey = &key
+		m.netIndex[key] = len(m.nets) + 1
+	}
+	n.ID = len(m.nets) + 1
+	m.nets = append(m.nets, *n)
+	m.netsBySrc[n.SrcID] = append(m.netsBySrc[n.SrcID], n.ID)
+	m.netsByDst[n.DstID] = append(m.netsByDst[n.DstID], n.ID)
+	addRequests(m.netReqs, n.ID, n.UUID)
+	return true
+}
+
+// addRequests 将边加入其所属请求的索引，每个请求的主键保持有序
+func addRequests(index map[string][]int, id int, uuid string) {
+	for _, u := range models.SplitUUIDs(uuid) {
+		ids := index[u]
+		i := sort.SearchInts(ids, id)
+		if i < len(ids) && ids[i] == id {
+			continue
+		}
+		ids = append(ids, 0)
+		copy(ids[i+1:], ids[i:])
+		ids[i] = id
+		index[u] = ids
+	}
+}
+
+// belongsTo uuid 为空或边属于该请求
+func belongsTo(index map[string][]int, id int, uuid string) bool {
+	if uuid == "" {
+		return true
+	}
+	ids := index[uuid]
+	i := sort.SearchInts(ids, id)
+	return i < len(ids) && ids[i] == id
+}
+
+// requestIDs 返回请求索引中主键大于 afterID 的所有主键
+func requestIDs(index map[string][]int, uuid string, afterID int) []int {
+	ids := index[uuid]
+	return ids[sort.SearchInts(ids, afterID+1):]
+}
+
+func (m *MemoryStore) insertFlow(f *models.Flow) {
+	m.datasetOf(&f.Dataset)
+	f.ID = len(m.flows) + 1
+	m.flows = append(m.flows, *f)
+	if f.Source == models.FlowSourceCapture {
+		key := flowKey{f.SrcIP, f.SrcPort, f.DstIP, f.DstPort, f.PayloadLen}
+		m.captureIndex[key] = append(m.captureIndex[key], f.ID)
+	}
+}
+
+func (m *MemoryStore) GetEvent(id int) (models.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id < 1 || id > len(m.events) {
+		return models.Event{}, ErrNotFound
+	}
+	return m.events[id-1], nil
+}
+
+func (m *MemoryStore) GetNet(id int) (models.Net, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id < 1 || id > len(m.nets) {
+		return models.Net{}, ErrNotFound
+	}
+	return m.nets[id-1], nil
+}
+
+func (m *MemoryStore) FetchEvents(vertexID int, classes []string, reverse bool, uuid string) ([]models.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := m.eventsBySrc[vertexID]
+	if reverse {
+		ids = m.eventsByDst[vertexID]
+	}
+	var events []models.Event
+	for _, id := range ids {
+		if !belongsTo(m.eventReqs, id, uuid) {
+			continue
+		}
+		e := m.events[id-1]
+		for _, class := range classes {
+			if e.EventClass == class {
+				events = append(events, e)
+				break
+			}
+		}
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) FetchNets(socketID int, reverse bool, uuid string) ([]models.Net, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := m.netsBySrc[socketID]
+	if reverse {
+		ids = m.netsByDst[socketID]
+	}
+	nets := make([]models.Net, 0, len(ids))
+	for _, id := range ids {
+		if belongsTo(m.netReqs, id, uuid) {
+			nets = append(nets, m.nets[id-1])
+		}
+	}
+	return nets, nil
+}
+
+func (m *MemoryStore) FetchFrontierEvents(ctx context.Context, vertexIDs []int, classes []string, reverse bool, uuid string, window TimeWindow, afterID int, limit int) ([]models.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var events []models.Event
+	for _, id := range vertexIDs {
+		batch, _ := m.FetchEvents(id, classes, reverse, uuid)
+		for _, e := range batch {
+			if e.ID > afterID && window.Overlaps(e.Time, e.EndTime) {
+				events = append(events, e)
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) FetchFrontierNets(ctx context.Context, socketIDs []int, reverse bool, uuid string, window TimeWindow, afterID int, limit int) ([]models.Net, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var nets []models.Net
+	for _, id := range socketIDs {
+		batch, _ := m.FetchNets(id, reverse, uuid)
+		for _, n := range batch {
+			if n.ID > afterID && window.Contains(n.Time) {
+				nets = append(nets, n)
+			}
+		}
+	}
+	sort.Slice(nets, func(i, j int) bool { return nets[i].ID < nets[j].ID })
+	if limit > 0 && len(nets) > limit {
+		nets = nets[:limit]
+	}
+	return nets, nil
+}
+
+// ScanProcesses 等只扫描当前数据集中的记录，主键即下标加一，从 afterID 对应的下标开始向后查找
+func (m *MemoryStore) ScanProcesses(afterID int, limit int) ([]models.Process, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var processes []models.Process
+	for i := afterID; i < len(m.processes) && len(processes) < limit; i++ {
+		if m.processes[i].Dataset == m.dataset {
+			processes = append(processes, m.processes[i])
+		}
+	}
+	return processes, nil
+}
+
+func (m *MemoryStore) ScanFiles(afterID int, limit int) ([]models.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var files []models.File
+	for i := afterID; i < len(m.files) && len(files) < limit; i++ {
+		if m.files[i].Dataset == m.dataset {
+			files = append(files, m.files[i])
+		}
+	}
+	return files, nil
+}
+
+func (m *MemoryStore) ScanSockets(afterID int, limit int) ([]models.Socket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var sockets []models.Socket
+	for i := afterID; i < len(m.sockets) && len(sockets) < limit; i++ {
+		if m.sockets[i].Dataset == m.dataset {
+			sockets = append(sockets, m.sockets[i])
+		}
+	}
+	return sockets, nil
+}
+
+func (m *MemoryStore) ScanEvents(afterID int, limit int, uuid string) ([]models.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var events []models.Event
+	if uuid != "" {
+		for _, id := range requestIDs(m.eventReqs, uuid, afterID) {
+			if len(events) >= limit {
+				break
+			}
+			if m.events[id-1].Dataset == m.dataset {
+				events = append(events, m.events[id-1])
+			}
+		}
+		return events, nil
+	}
+	for i := afterID; i < len(m.events) && len(events) < limit; i++ {
+		if m.events[i].Dataset == m.dataset {
+			events = append(events, m.events[i])
+		}
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) ScanNets(afterID int, limit int, uuid string) ([]models.Net, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var nets []models.Net
+	if uuid != "" {
+		for _, id := range requestIDs(m.netReqs, uuid, afterID) {
+			if len(nets) >= limit {
+				break
+			}
+			if m.nets[id-1].Dataset == m.dataset {
+				nets = append(nets, m.nets[id-1])
+			}
+		}
+		return nets, nil
+	}
+	for i := afterID; i < len(m.nets) && len(nets) < limit; i++ {
+		if m.nets[i].Dataset == m.dataset {
+			nets = append(nets, m.nets[i])
+		}
+	}
+	return nets, nil
+}
+
+func (m *MemoryStore) ScanUnlinkedFlows(source string, afterID int, limit int) ([]models.Flow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var flows []models.Flow
+	for i := afterID; i < len(m.flows) && len(flows) < limit; i++ {
+		if f := m.flows[i]; f.Dataset == m.dataset && f.Source == source && f.PeerID == 0 {
+			flows = append(flows, f)
+		}
+	}
+	return flows, nil
+}
+
+func (m *MemoryStore) LatestFlowTime(source string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var latest int64
+	for _, f := range m.flows {
+		if f.Dataset == m.dataset && f.Source == source && f.Time > latest {
+			latest = f.Time
+		}
+	}
+	return latest, nil
+}
+
+func (m *MemoryStore) FindPeerFlow(flow models.Flow, window int64) (*models.Flow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.datasetOf(&flow.Dataset)
+	var peer *models.Flow
+	var best int64
+	for _, id := range m.captureIndex[flowKey{flow.SrcIP, flow.SrcPort, flow.DstIP, flow.DstPort, flow.PayloadLen}] {
+		f := m.flows[id-1]
+		diff := f.Time - flow.Time
+		if diff < 0 {
+			diff = -diff
+		}
+		if f.Dataset != flow.Dataset || f.PeerID != 0 || diff > window {
+			continue
+		}
+		if peer == nil || diff < best {
+			candidate := f
+			peer, best = &candidate, diff
+		}
+	}
+	return peer, nil
+}
+
+func (m *MemoryStore) LinkFlows(flow models.Flow, peer models.Flow, uuid string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.flows[peer.ID-1].PeerID != 0 { // 已被其他 flow 关联
+		return false, nil
+	}
+	m.flows[peer.ID-1].PeerID = flow.ID
+	m.flows[flow.ID-1].PeerID = peer.ID
+	m.flows[flow.ID-1].Method = peer.Method
+	if uuid != "" && flow.EdgeTable == (models.Event{}).TableName() {
+		if e := &m.events[flow.EdgeID-1]; e.UUID == "unknown" || e.UUID == "" {
+			e.UUID = uuid
+			addRequests(m.eventReqs, e.ID, uuid)
+		}
+	}
+	return true, nil
+}
+
+func (m *MemoryStore) MergedCaptureEdges() (events map[int]bool, nets map[int]bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events = make(map[int]bool)
+	nets = make(map[int]bool)
+	for _, f := range m.flows {
+		if f.Dataset != m.dataset || f.Source != models.FlowSourceCapture || f.PeerID == 0 {
+			continue
+		}
+		if f.EdgeTable == (models.Net{}).TableName() {
+			nets[f.EdgeID] = true
+		} else {
+			events[f.EdgeID] = true
+		}
+	}
+	return events, nets
+}
+
+func (m *MemoryStore) LinkedMethods(eventIDs []int) map[int]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	wanted := make(map[int]bool, len(eventIDs))
+	for _, id := range eventIDs {
+		wanted[id] = true
+	}
+	methods := make(map[int]string)
+	for _, f := range m.flows {
+		if f.Source == models.FlowSourceSysdig && f.PeerID != 0 && f.EdgeTable == (models.Event{}).TableName() && wanted[f.EdgeID] {
+			methods[f.EdgeID] = f.Method
+		}
+	}
+	return methods
+}
+
+// FindUser 内存存储没有用户表
+func (m *MemoryStore) FindUser(username string) (models.User, error) {
+	return models.User{}, ErrNotFound
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// memorySnapshot 快照文件的内容，加载时重新建立索引
+type memorySnapshot struct {
+	Processes []models.Process
+	Files     []models.File
+	Sockets   []models.Socket
+	Events    []models.Event
+	Nets      []models.Net
+	Flows     []models.Flow
+}
+
+// Save 将内存中的图保存为 gzip 压缩的 gob 快照文件
+func (m *MemoryStore) Save(path string) error {
+	m.mu.RLock()
+	snapshot := memorySnapshot{m.processes, m.files, m.sockets, m.events, m.nets, m.flows}
+	defer m.mu.RUnlock()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	if err := gob.NewEncoder(gz).Encode(snapshot); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// LoadSnapshot 从快照文件恢复内存存储
+func LoadSnapshot(path string) (*MemoryStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	var snapshot memorySnapshot
+	if err := gob.NewDecoder(gz).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	m := NewMemoryStore()
+	for _, p := range snapshot.Processes {
+		m.upsertProcess(&p)
+	}
+	for _, f := range snapshot.Files {
+		m.upsertFile(&f)
+	}
+	for _, s := range snapshot.Sockets {
+		m.upsertSocket(&s)
+	}
+	// 边按主键顺序插入，主键与保存时一致
+	sort.Slice(snapshot.Events, func(i, j int) bool { return snapshot.Events[i].ID < snapshot.Events[j].ID })
+	for _, e := range snapshot.Events {
+		m.insertEvent(&e, e.DedupKey != nil)
+	}
+	for _, n := range snapshot.Nets {
+		m.insertNet(&n, n.DedupKey != nil)
+	}
+	for _, fl := range snapshot.Flows {
+		m.insertFlow(&fl)
+	}
+	return m, nil
+}
@@ -0,0 +1,311 @@
+package store
+
+import (
+	"embed"
+	"erinyes/conf"
+	"erinyes/logs"
+	"fmt"
+	"gorm.io/gorm"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFS embed.FS
+
+// schemaVersionTable 记录已经执行的迁移，每个版本一行，当前版本为最大的 version
+const schemaVersionTable = "schema_version"
+
+// Migration 一个版本的表结构变更，Up 升级到该版本，Down 回退到上一个版本
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// AppliedMigration schema_version 表中的一行
+type AppliedMigration struct {
+	Version   int    `gorm:"primaryKey;column:version;autoIncrement:false"`
+	Name      string `gorm:"column:name"`
+	AppliedAt int64  `gorm:"column:applied_at"` // 秒级时间戳
+}
+
+func (AppliedMigration) TableName() string {
+	return schemaVersionTable
+}
+
+// Migrator 按版本顺序执行内嵌在程序中的迁移
+type Migrator struct {
+	db         *gorm.DB
+	driver     string
+	migrations []Migration
+}
+
+// NewMigrator 按 conf.Config.Storage.Driver 打开数据库，不检查表结构版本
+func NewMigrator() (*Migrator, error) {
+	driver := conf.Config.Storage.Driver
+	var (
+		db  *gorm.DB
+		err error
+	)
+	switch driver {
+	case DriverSQLite:
+		db, err = openSQLiteDB(conf.Config.Storage.Path)
+	case DriverMySQL, "":
+		driver = DriverMySQL
+		db, err = openMySQLDB()
+	default:
+		return nil, fmt.Errorf("storage driver %s has no schema", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newMigrator(db, driver)
+}
+
+func newMigrator(db *gorm.DB, driver string) (*Migrator, error) {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, driver: driver, migrations: migrations}, nil
+}
+
+// loadMigrations 读取 migrations/<driver>/<版本>_<名称>.up.sql 及对应的 .down.sql
+func loadMigrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := migrationFS.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var up bool
+		if strings.HasSuffix(name, ".up.sql") {
+			up = true
+		} else if !strings.HasSuffix(name, ".down.sql") {
+			continue
+		}
+		sep := strings.Index(name, "_")
+		if sep < 0 {
+			return nil, fmt.Errorf("invalid migration file name %s", name)
+		}
+		version, err := strconv.Atoi(name[:sep])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %s", name)
+		}
+		content, err := migrationFS.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: strings.TrimSuffix(strings.TrimSuffix(name[sep+1:], ".up.sql"), ".down.sql")}
+			byVersion[version] = m
+		}
+		if up {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration version %d is missing", i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down sql", m.Version, m.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// Latest 程序内嵌的最新版本
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Current 数据库当前的版本，没有 schema_version 表时为 0
+func (m *Migrator) Current() (int, error) {
+	if !m.db.Migrator().HasTable(schemaVersionTable) {
+		return 0, nil
+	}
+	var version int
+	err := m.db.Model(&AppliedMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// Applied 已经执行的迁移
+func (m *Migrator) Applied() ([]AppliedMigration, error) {
+	var applied []AppliedMigration
+	if !m.db.Migrator().HasTable(schemaVersionTable) {
+		return applied, nil
+	}
+	err := m.db.Order("version").Find(&applied).Error
+	return applied, err
+}
+
+// Up 升级到最新版本，返回执行的迁移数
+func (m *Migrator) Up() (int, error) {
+	return m.To(m.Latest())
+}
+
+// Down 回退 steps 个版本，返回执行的迁移数
+func (m *Migrator) Down(steps int) (int, error) {
+	current, err := m.Current()
+	if err != nil {
+		return 0, err
+	}
+	target := current - steps
+	if target < 0 {
+		target = 0
+	}
+	return m.To(target)
+}
+
+// To 升级或回退到指定版本，返回执行的迁移数
+func (m *Migrator) To(target int) (int, error) {
+	if target < 0 || target > m.Latest() {
+		return 0, fmt.Errorf("version %d out of range [0, %d]", target, m.Latest())
+	}
+	if err := m.ensureVersionTable(); err != nil {
+		return 0, err
+	}
+	current, err := m.Current()
+	if err != nil {
+		return 0, err
+	}
+	if current > m.Latest() {
+		return 0, fmt.Errorf("database schema version %d is newer than this binary (%d)", current, m.Latest())
+	}
+	count := 0
+	for v := current + 1; v <= target; v++ {
+		mig := m.migrations[v-1]
+		logs.Logger.Infof("migrate up %04d_%s", mig.Version, mig.Name)
+		err := m.apply(mig.Up, func(tx *gorm.DB) error {
+			return tx.Create(&AppliedMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now().Unix()}).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("migrate up %04d_%s failed: %w", mig.Version, mig.Name, err)
+		}
+		count++
+	}
+	for v := current; v > target; v-- {
+		mig := m.migrations[v-1]
+		logs.Logger.Infof("migrate down %04d_%s", mig.Version, mig.Name)
+		err := m.apply(mig.Down, func(tx *gorm.DB) error {
+			return tx.Delete(&AppliedMigration{}, mig.Version).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("migrate down %04d_%s failed: %w", mig.Version, mig.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// apply 执行一个迁移并更新 schema_version。SQLite 的 DDL 支持事务，二者在同一个事务中生效，失败时整体回滚；
+// MySQL 的 DDL 会隐式提交，执行到一半失败时已经执行的语句无法回滚，版本也没有记录，需要按 README 手动恢复
+func (m *Migrator) apply(sql string, record func(tx *gorm.DB) error) error {
+	if m.driver != DriverSQLite {
+		if err := m.exec(m.db, sql); err != nil {
+			return err
+		}
+		return record(m.db)
+	}
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := m.exec(tx, sql); err != nil {
+			return err
+		}
+		return record(tx)
+	})
+}
+
+// ensureVersionTable 创建 schema_version 表；早期版本没有该表但已经建过表，按现有结构记录基线版本
+func (m *Migrator) ensureVersionTable() error {
+	if m.db.Migrator().HasTable(schemaVersionTable) {
+		return nil
+	}
+	baseline := 0
+	if m.db.Migrator().HasTable("process") {
+		baseline = 1
+		if m.db.Migrator().HasColumn("event", "dedup_key") {
+			baseline = 2
+		}
+	}
+	if baseline > 0 {
+		// 旧的建表脚本可能缺少后来加入的表（如 flow），0001 全部为 IF NOT EXISTS，补建缺少的表后再记录基线
+		logs.Logger.Infof("create missing tables of %04d_%s", 1, m.migrations[0].Name)
+		if err := m.exec(m.db, m.migrations[0].Up); err != nil {
+			return fmt.Errorf("baseline %04d_%s failed: %w", 1, m.migrations[0].Name, err)
+		}
+	}
+	if err := m.db.Migrator().CreateTable(&AppliedMigration{}); err != nil {
+		return err
+	}
+	for v := 1; v <= baseline; v++ {
+		logs.Logger.Infof("baseline existing schema at %04d_%s", v, m.migrations[v-1].Name)
+		applied := AppliedMigration{Version: v, Name: m.migrations[v-1].Name, AppliedAt: time.Now().Unix()}
+		if err := m.db.Create(&applied).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exec 在 db 上逐条执行迁移中的语句，语句以行尾的分号结束，-- 开头的行为注释
+func (m *Migrator) exec(db *gorm.DB, sql string) error {
+	var stmt strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if err := db.Exec(stmt.String()).Error; err != nil {
+				return err
+			}
+			stmt.Reset()
+		}
+	}
+	if strings.TrimSpace(stmt.String()) != "" {
+		return db.Exec(stmt.String()).Error
+	}
+	return nil
+}
+
+// checkSchema 打开数据库时检查表结构版本：版本更高说明数据库已被新版本程序升级，旧程序不能写入；
+// 版本更低时需要先执行 migrate up。全新的 SQLite 文件直接建表
+func checkSchema(db *gorm.DB, driver string) error {
+	m, err := newMigrator(db, driver)
+	if err != nil {
+		return err
+	}
+	current, err := m.Current()
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("数据库表结构版本 %d 高于当前程序支持的版本 %d，请升级 erinyes", current, m.Latest())
+	}
+	if current == m.Latest() {
+		return nil
+	}
+	if driver == DriverSQLite && current == 0 && !db.Migrator().HasTable("process") {
+		_, err := m.Up()
+		return err
+	}
+	return fmt.Errorf("数据库表结构版本 %d 低于当前程序需要的版本 %d，请先执行 erinyes migrate up", current, m.Latest())
+}
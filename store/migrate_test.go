@@ -0,0 +1,68 @@
+package store
+
+import (
+	"erinyes/logs"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"testing"
+)
+
+func openTestMigrator(t *testing.T) *Migrator {
+	logs.Logger = logrus.New()
+	db, err := openSQLiteDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newMigrator(db, DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestBaselineCreatesMissingTables(t *testing.T) {
+	m := openTestMigrator(t)
+	// 旧的建表脚本没有 flow 表，也没有 schema_version 表
+	if err := m.exec(m.db, m.migrations[0].Up); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.db.Exec("DROP TABLE `flow`").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.db.Migrator().HasTable("flow") {
+		t.Fatal("flow table was not created when baselining")
+	}
+	applied, err := m.Applied()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != m.Latest() || applied[0].Version != 1 {
+		t.Fatalf("%d migrations applied, want %d", len(applied), m.Latest())
+	}
+}
+
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	m := openTestMigrator(t)
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	latest := m.Latest()
+	m.migrations = append(m.migrations, Migration{
+		Version: latest + 1,
+		Name:    "broken",
+		Up:      "CREATE TABLE `half` (`id` integer);\nINSERT INTO `missing` VALUES (1);",
+		Down:    "DROP TABLE `half`;",
+	})
+	if _, err := m.Up(); err == nil {
+		t.Fatal("migrate up succeeded, want error")
+	}
+	if m.db.Migrator().HasTable("half") {
+		t.Fatal("statements of the failed migration were not rolled back")
+	}
+	if current, err := m.Current(); err != nil || current != latest {
+		t.Fatalf("version %d (%v) after failed migration, want %d", current, err, latest)
+	}
+}
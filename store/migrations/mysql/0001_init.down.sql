@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS `user`;
+DROP TABLE IF EXISTS `flow`;
+DROP TABLE IF EXISTS `net`;
+DROP TABLE IF EXISTS `event`;
+DROP TABLE IF EXISTS `socket`;
+DROP TABLE IF EXISTS `file`;
+DROP TABLE IF EXISTS `process`;
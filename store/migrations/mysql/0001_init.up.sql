@@ -0,0 +1,89 @@
+-- 溯源图的顶点表、边表、flow 表和用户表
+CREATE TABLE IF NOT EXISTS `process` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `host_id` varchar(100) NOT NULL COMMENT '主机id（多主机场景下资产标识符）',
+  `host_name` varchar(255) NULL DEFAULT NULL COMMENT '主机名',
+  `container_id` varchar(100) NOT NULL COMMENT '容器id（多容器场景下资产标识符）',
+  `container_name` varchar(255) NULL DEFAULT NULL COMMENT '容器名',
+  `process_vpid` varchar(100) NOT NULL COMMENT '进程虚拟pid',
+  `process_name` varchar(100) NOT NULL COMMENT '进程名',
+  `process_exe_path` varchar(255) NULL DEFAULT NULL COMMENT '进程执行路径',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE INDEX `unique_index`(`host_id`, `container_id`, `process_vpid`, `process_name`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
+
+CREATE TABLE IF NOT EXISTS `file` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `host_id` varchar(100) NOT NULL COMMENT '主机id（多主机场景下资产标识符）',
+  `host_name` varchar(255) NULL DEFAULT NULL COMMENT '主机名',
+  `container_id` varchar(100) NOT NULL COMMENT '容器id（多容器场景下资产标识符）',
+  `container_name` varchar(255) NULL DEFAULT NULL COMMENT '容器名',
+  `file_path` varchar(100) NOT NULL COMMENT '文件路径',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE INDEX `unique_index`(`host_id`, `container_id`, `file_path`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
+
+CREATE TABLE IF NOT EXISTS `socket` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `host_id` varchar(100) NOT NULL COMMENT '主机id（多主机场景下资产标识符）',
+  `host_name` varchar(255) NULL DEFAULT NULL COMMENT '主机名',
+  `container_id` varchar(100) NOT NULL COMMENT '容器id（多容器场景下资产标识符）',
+  `container_name` varchar(255) NULL DEFAULT NULL COMMENT '容器名',
+  `dst_ip` varchar(100) NOT NULL COMMENT '目的ip',
+  `dst_port` varchar(100) NOT NULL COMMENT '目的port',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE INDEX `unique_index`(`host_id`, `container_id`, `dst_ip`, `dst_port`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
+
+CREATE TABLE IF NOT EXISTS `event` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `src_id` int NOT NULL COMMENT '箭头发出节点主键id',
+  `dst_id` int NOT NULL COMMENT '箭头指向节点主键id',
+  `event_class` varchar(255) NOT NULL COMMENT '事件的类型(File, Network, Process)',
+  `relation` varchar(255) NULL DEFAULT NULL COMMENT '统一的关系',
+  `operation` varchar(255) NOT NULL COMMENT '具体的系统调用',
+  `time` bigint NOT NULL COMMENT '时间戳17位',
+  `uuid` varchar(255) NULL DEFAULT NULL COMMENT '请求uuid',
+  PRIMARY KEY (`id`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
+
+CREATE TABLE IF NOT EXISTS `net` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `src_id` int NOT NULL,
+  `dst_id` int NOT NULL,
+  `method` varchar(255) NOT NULL,
+  `payload` varchar(255) NULL DEFAULT NULL,
+  `payload_len` int NULL DEFAULT NULL,
+  `seq_num` int NULL DEFAULT NULL,
+  `ack_num` int NULL DEFAULT NULL,
+  `time` bigint NOT NULL COMMENT '时间戳17位',
+  `uuid` varchar(255) NULL DEFAULT NULL COMMENT '请求uuid（可能为空）',
+  PRIMARY KEY (`id`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
+
+CREATE TABLE IF NOT EXISTS `flow` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `edge_table` varchar(20) NOT NULL COMMENT '边所在的表(event, net)',
+  `edge_id` int NOT NULL COMMENT '边在对应表中的主键id',
+  `source` varchar(20) NOT NULL COMMENT '来源(sysdig, capture)',
+  `src_ip` varchar(100) NOT NULL COMMENT '数据流动方向上的源ip',
+  `src_port` varchar(100) NOT NULL COMMENT '数据流动方向上的源port',
+  `dst_ip` varchar(100) NOT NULL COMMENT '数据流动方向上的目的ip',
+  `dst_port` varchar(100) NOT NULL COMMENT '数据流动方向上的目的port',
+  `payload_len` int NOT NULL COMMENT '载荷长度',
+  `method` varchar(255) NULL DEFAULT NULL COMMENT 'HTTP方法',
+  `time` bigint NOT NULL COMMENT '时间戳16位',
+  `peer_id` int NOT NULL DEFAULT 0 COMMENT '关联到的另一侧flow主键id，0表示未关联',
+  PRIMARY KEY (`id`) USING BTREE,
+  INDEX `edge_index`(`edge_table`, `edge_id`) USING BTREE,
+  INDEX `tuple_index`(`source`, `src_ip`, `src_port`, `dst_ip`, `dst_port`, `payload_len`, `time`) USING BTREE,
+  INDEX `peer_index`(`source`, `peer_id`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
+
+CREATE TABLE IF NOT EXISTS `user` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `username` varchar(100) NOT NULL,
+  `password` varchar(255) NOT NULL,
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE INDEX `unique_index`(`username`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
@@ -0,0 +1,4 @@
+DROP INDEX `net_dedup_index` ON `net`;
+ALTER TABLE `net` DROP COLUMN `dedup_key`;
+DROP INDEX `event_dedup_index` ON `event`;
+ALTER TABLE `event` DROP COLUMN `dedup_key`;
@@ -0,0 +1,6 @@
+DROP INDEX `net_uuid_index` ON `net`;
+DROP INDEX `net_dst_index` ON `net`;
+DROP INDEX `net_src_index` ON `net`;
+DROP INDEX `event_uuid_index` ON `event`;
+DROP INDEX `event_dst_class_index` ON `event`;
+DROP INDEX `event_src_class_index` ON `event`;
@@ -0,0 +1,7 @@
+-- 溯源时按起点或终点查询边（event 同时按事件类型过滤），按 uuid 查询同一请求的边
+CREATE INDEX `event_src_class_index` ON `event` (`src_id`, `event_class`);
+CREATE INDEX `event_dst_class_index` ON `event` (`dst_id`, `event_class`);
+CREATE INDEX `event_uuid_index` ON `event` (`uuid`);
+CREATE INDEX `net_src_index` ON `net` (`src_id`);
+CREATE INDEX `net_dst_index` ON `net` (`dst_id`);
+CREATE INDEX `net_uuid_index` ON `net` (`uuid`);
@@ -0,0 +1,2 @@
+ALTER TABLE `event` DROP COLUMN `count`;
+ALTER TABLE `event` DROP COLUMN `end_time`;
@@ -0,0 +1,4 @@
+-- 合并重复读写边时记录最后一次的时间和合并的次数
+ALTER TABLE `event` ADD COLUMN `end_time` bigint NOT NULL DEFAULT 0 COMMENT '合并后最后一次事件的时间戳';
+ALTER TABLE `event` ADD COLUMN `count` int NOT NULL DEFAULT 1 COMMENT '合并的事件数';
+UPDATE `event` SET `end_time` = `time`;
@@ -0,0 +1,5 @@
+ALTER TABLE `event` DROP COLUMN `args`;
+ALTER TABLE `event` DROP COLUMN `bytes`;
+ALTER TABLE `event` DROP COLUMN `ret`;
+ALTER TABLE `event` DROP COLUMN `tid`;
+ALTER TABLE `event` DROP COLUMN `pid`;
@@ -0,0 +1,6 @@
+-- 保留 sysdig 事件的主机 pid、线程 id、返回值、读写字节数，原始参数可选地以 gzip 压缩的 JSON 保存
+ALTER TABLE `event` ADD COLUMN `pid` varchar(20) NOT NULL DEFAULT '' COMMENT '主机上的进程pid';
+ALTER TABLE `event` ADD COLUMN `tid` varchar(20) NOT NULL DEFAULT '' COMMENT '线程id';
+ALTER TABLE `event` ADD COLUMN `ret` varchar(64) NOT NULL DEFAULT '' COMMENT '系统调用返回值';
+ALTER TABLE `event` ADD COLUMN `bytes` bigint NOT NULL DEFAULT 0 COMMENT '读写的字节数，合并后为总和';
+ALTER TABLE `event` ADD COLUMN `args` blob NULL DEFAULT NULL COMMENT 'gzip压缩的evt.info参数(JSON数组)';
@@ -0,0 +1,26 @@
+-- 边与请求的关联：并发请求时 uuid 列中以逗号拼接了多个请求，拆分后每个请求一行
+CREATE TABLE IF NOT EXISTS `edge_request` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `edge_table` varchar(20) NOT NULL COMMENT '边所在的表(event, net)',
+  `edge_id` int NOT NULL COMMENT '边在对应表中的主键id',
+  `uuid` varchar(128) NOT NULL COMMENT '请求uuid',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE INDEX `edge_request_edge_index` (`edge_table`, `edge_id`, `uuid`) USING BTREE,
+  INDEX `edge_request_uuid_index` (`uuid`, `edge_table`, `edge_id`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
+
+INSERT IGNORE INTO `edge_request` (`edge_table`, `edge_id`, `uuid`)
+WITH RECURSIVE `split` (`edge_id`, `uuid`, `rest`) AS (
+  SELECT `id`, CAST('' AS CHAR(255)), CONCAT(`uuid`, ',') FROM `event` WHERE `uuid` IS NOT NULL AND `uuid` <> '' AND `uuid` <> 'unknown'
+  UNION ALL
+  SELECT `edge_id`, SUBSTRING_INDEX(`rest`, ',', 1), SUBSTRING(`rest`, LOCATE(',', `rest`) + 1) FROM `split` WHERE `rest` <> ''
+)
+SELECT 'event', `edge_id`, `uuid` FROM `split` WHERE `uuid` <> '' AND `uuid` <> 'unknown';
+
+INSERT IGNORE INTO `edge_request` (`edge_table`, `edge_id`, `uuid`)
+WITH RECURSIVE `split` (`edge_id`, `uuid`, `rest`) AS (
+  SELECT `id`, CAST('' AS CHAR(255)), CONCAT(`uuid`, ',') FROM `net` WHERE `uuid` IS NOT NULL AND `uuid` <> '' AND `uuid` <> 'unknown'
+  UNION ALL
+  SELECT `edge_id`, SUBSTRING_INDEX(`rest`, ',', 1), SUBSTRING(`rest`, LOCATE(',', `rest`) + 1) FROM `split` WHERE `rest` <> ''
+)
+SELECT 'net', `edge_id`, `uuid` FROM `split` WHERE `uuid` <> '' AND `uuid` <> 'unknown';
@@ -0,0 +1,17 @@
+-- 回退后顶点的唯一键不再包含数据集，不同数据集中的同一顶点会冲突，需要先删除 default 之外的数据集
+-- 先恢复顶点的唯一索引，存在冲突时在删除任何列之前失败
+DROP INDEX `unique_index` ON `process`;
+CREATE UNIQUE INDEX `unique_index` ON `process` (`host_id`, `container_id`, `process_vpid`, `process_name`);
+DROP INDEX `unique_index` ON `file`;
+CREATE UNIQUE INDEX `unique_index` ON `file` (`host_id`, `container_id`, `file_path`);
+DROP INDEX `unique_index` ON `socket`;
+CREATE UNIQUE INDEX `unique_index` ON `socket` (`host_id`, `container_id`, `dst_ip`, `dst_port`);
+ALTER TABLE `process` DROP COLUMN `dataset`;
+ALTER TABLE `file` DROP COLUMN `dataset`;
+ALTER TABLE `socket` DROP COLUMN `dataset`;
+DROP INDEX `flow_dataset_index` ON `flow`;
+ALTER TABLE `flow` DROP COLUMN `dataset`;
+DROP INDEX `net_dataset_index` ON `net`;
+ALTER TABLE `net` DROP COLUMN `dataset`;
+DROP INDEX `event_dataset_index` ON `event`;
+ALTER TABLE `event` DROP COLUMN `dataset`;
@@ -0,0 +1,16 @@
+-- 数据集：同一个数据库中保存多次采集（例如正常基线和不同的攻击重放），顶点的唯一键和所有查询都限定在一个数据集内
+ALTER TABLE `process` ADD COLUMN `dataset` varchar(64) NOT NULL DEFAULT 'default' COMMENT '数据集';
+DROP INDEX `unique_index` ON `process`;
+CREATE UNIQUE INDEX `unique_index` ON `process` (`dataset`, `host_id`, `container_id`, `process_vpid`, `process_name`);
+ALTER TABLE `file` ADD COLUMN `dataset` varchar(64) NOT NULL DEFAULT 'default' COMMENT '数据集';
+DROP INDEX `unique_index` ON `file`;
+CREATE UNIQUE INDEX `unique_index` ON `file` (`dataset`, `host_id`, `container_id`, `file_path`);
+ALTER TABLE `socket` ADD COLUMN `dataset` varchar(64) NOT NULL DEFAULT 'default' COMMENT '数据集';
+DROP INDEX `unique_index` ON `socket`;
+CREATE UNIQUE INDEX `unique_index` ON `socket` (`dataset`, `host_id`, `container_id`, `dst_ip`, `dst_port`);
+ALTER TABLE `event` ADD COLUMN `dataset` varchar(64) NOT NULL DEFAULT 'default' COMMENT '数据集';
+CREATE INDEX `event_dataset_index` ON `event` (`dataset`);
+ALTER TABLE `net` ADD COLUMN `dataset` varchar(64) NOT NULL DEFAULT 'default' COMMENT '数据集';
+CREATE INDEX `net_dataset_index` ON `net` (`dataset`);
+ALTER TABLE `flow` ADD COLUMN `dataset` varchar(64) NOT NULL DEFAULT 'default' COMMENT '数据集';
+CREATE INDEX `flow_dataset_index` ON `flow` (`dataset`, `source`, `peer_id`);
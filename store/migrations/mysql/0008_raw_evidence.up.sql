@@ -0,0 +1,7 @@
+-- 边对应的原始日志在归档中的位置：分段文件的 sha256、解压后的偏移与长度，未开启归档时为空
+ALTER TABLE `event` ADD COLUMN `raw_segment` char(64) NOT NULL DEFAULT '' COMMENT '原始日志所在分段的sha256';
+ALTER TABLE `event` ADD COLUMN `raw_offset` bigint NOT NULL DEFAULT 0 COMMENT '原始日志在解压后分段中的偏移';
+ALTER TABLE `event` ADD COLUMN `raw_length` int NOT NULL DEFAULT 0 COMMENT '原始日志的字节数';
+ALTER TABLE `net` ADD COLUMN `raw_segment` char(64) NOT NULL DEFAULT '' COMMENT '原始日志所在分段的sha256';
+ALTER TABLE `net` ADD COLUMN `raw_offset` bigint NOT NULL DEFAULT 0 COMMENT '原始日志在解压后分段中的偏移';
+ALTER TABLE `net` ADD COLUMN `raw_length` int NOT NULL DEFAULT 0 COMMENT '原始日志的字节数';
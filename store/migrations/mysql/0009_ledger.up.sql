@@ -0,0 +1,24 @@
+-- 防篡改的哈希链：每批插入或删除的边追加一项，每项的哈希包含上一项的哈希
+ALTER TABLE `event` ADD COLUMN `chain_hash` char(64) NOT NULL DEFAULT '' COMMENT '插入时不可变字段的sha256，未开启Ledger时为空';
+ALTER TABLE `net` ADD COLUMN `chain_hash` char(64) NOT NULL DEFAULT '' COMMENT '插入时不可变字段的sha256，未开启Ledger时为空';
+CREATE TABLE IF NOT EXISTS `ledger` (
+  `seq` int NOT NULL COMMENT '链中的序号，从1开始连续递增',
+  `kind` varchar(10) NOT NULL COMMENT 'insert或purge',
+  `edge_table` varchar(20) NOT NULL COMMENT '边所在的表(event, net)',
+  `edge_ids` mediumtext NOT NULL COMMENT '边主键的区间列表，如1-500,503',
+  `digest` char(64) NOT NULL COMMENT '这批边chain_hash按主键顺序拼接后的sha256',
+  `time` bigint NOT NULL COMMENT '追加的时间，unix秒',
+  `prev_hash` char(64) NOT NULL COMMENT '上一项的哈希',
+  `hash` char(64) NOT NULL COMMENT '本项的哈希',
+  PRIMARY KEY (`seq`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
+CREATE TABLE IF NOT EXISTS `ledger_checkpoint` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `seq` int NOT NULL COMMENT '签名时链头的序号',
+  `hash` char(64) NOT NULL COMMENT '签名时链头的哈希',
+  `time` bigint NOT NULL COMMENT '签名的时间，unix秒',
+  `public_key` char(64) NOT NULL COMMENT 'ed25519公钥',
+  `signature` char(128) NOT NULL COMMENT 'ed25519签名',
+  PRIMARY KEY (`id`) USING BTREE,
+  INDEX `ledger_checkpoint_seq_index` (`seq`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
@@ -0,0 +1,12 @@
+-- 外部数据集（DARPA TC CDM、SPADE）中顶点的标识符与顶点主键的对应关系，分批导入时后续记录按标识符引用之前导入的顶点
+CREATE TABLE IF NOT EXISTS `uuid_map` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `dataset` varchar(64) NOT NULL DEFAULT 'default' COMMENT '数据集',
+  `source` varchar(10) NOT NULL COMMENT '外部数据集的格式(cdm, spade)',
+  `uuid` varchar(128) NOT NULL COMMENT '外部数据集中顶点的标识符',
+  `vertex_table` varchar(20) NOT NULL COMMENT '顶点所在的表(process, file, socket)',
+  `vertex_id` int NOT NULL COMMENT '顶点在对应表中的主键',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE INDEX `uuid_map_unique_index` (`dataset`, `source`, `uuid`) USING BTREE,
+  INDEX `uuid_map_vertex_index` (`vertex_table`, `vertex_id`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
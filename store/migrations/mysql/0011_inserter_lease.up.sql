@@ -0,0 +1,6 @@
+-- 正在插入边的进程（service、graph）定期续期的租约，其他进程回收孤立顶点前据此判断是否有进程缓存了顶点主键
+CREATE TABLE IF NOT EXISTS `inserter_lease` (
+  `holder` varchar(255) NOT NULL COMMENT '持有者(<主机名>#<pid>)',
+  `expires_at` bigint NOT NULL COMMENT '过期时间(毫秒时间戳)',
+  PRIMARY KEY (`holder`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
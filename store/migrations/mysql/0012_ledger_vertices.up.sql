@@ -0,0 +1,4 @@
+-- 哈希链同时记录插入和删除的顶点
+ALTER TABLE `process` ADD COLUMN `chain_hash` char(64) NOT NULL DEFAULT '' COMMENT '插入时字段的sha256，未开启Ledger时为空';
+ALTER TABLE `file` ADD COLUMN `chain_hash` char(64) NOT NULL DEFAULT '' COMMENT '插入时字段的sha256，未开启Ledger时为空';
+ALTER TABLE `socket` ADD COLUMN `chain_hash` char(64) NOT NULL DEFAULT '' COMMENT '插入时字段的sha256，未开启Ledger时为空';
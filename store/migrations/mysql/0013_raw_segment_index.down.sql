@@ -0,0 +1,2 @@
+DROP INDEX `net_raw_segment_index` ON `net`;
+DROP INDEX `event_raw_segment_index` ON `event`;
@@ -0,0 +1,8 @@
+-- 复制数据集时原记录与新记录主键的对应关系，只在复制的事务中使用，提交前清空
+CREATE TABLE IF NOT EXISTS `copy_id_map` (
+  `dataset` varchar(64) NOT NULL COMMENT '复制到的数据集',
+  `record_table` varchar(20) NOT NULL COMMENT '记录所在的表(process, file, socket, event, net, flow)',
+  `src_id` int NOT NULL COMMENT '原记录的主键',
+  `dst_id` int NOT NULL COMMENT '复制出的记录的主键',
+  PRIMARY KEY (`dataset`, `record_table`, `src_id`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_0900_ai_ci ROW_FORMAT = Dynamic;
@@ -0,0 +1,81 @@
+-- 溯源图的顶点表、边表、flow 表和用户表，与 mysql 下的同名迁移保持一致
+CREATE TABLE IF NOT EXISTS `process` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `host_id` TEXT NOT NULL,
+  `host_name` TEXT,
+  `container_id` TEXT NOT NULL,
+  `container_name` TEXT,
+  `process_vpid` TEXT NOT NULL,
+  `process_name` TEXT NOT NULL,
+  `process_exe_path` TEXT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `process_unique_index` ON `process` (`host_id`, `container_id`, `process_vpid`, `process_name`);
+
+CREATE TABLE IF NOT EXISTS `file` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `host_id` TEXT NOT NULL,
+  `host_name` TEXT,
+  `container_id` TEXT NOT NULL,
+  `container_name` TEXT,
+  `file_path` TEXT NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `file_unique_index` ON `file` (`host_id`, `container_id`, `file_path`);
+
+CREATE TABLE IF NOT EXISTS `socket` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `host_id` TEXT NOT NULL,
+  `host_name` TEXT,
+  `container_id` TEXT NOT NULL,
+  `container_name` TEXT,
+  `dst_ip` TEXT NOT NULL,
+  `dst_port` TEXT NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `socket_unique_index` ON `socket` (`host_id`, `container_id`, `dst_ip`, `dst_port`);
+
+CREATE TABLE IF NOT EXISTS `event` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `src_id` INTEGER NOT NULL,
+  `dst_id` INTEGER NOT NULL,
+  `event_class` TEXT NOT NULL,
+  `relation` TEXT,
+  `operation` TEXT NOT NULL,
+  `time` INTEGER NOT NULL,
+  `uuid` TEXT
+);
+
+CREATE TABLE IF NOT EXISTS `net` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `src_id` INTEGER NOT NULL,
+  `dst_id` INTEGER NOT NULL,
+  `method` TEXT NOT NULL,
+  `payload` TEXT,
+  `payload_len` INTEGER,
+  `seq_num` INTEGER,
+  `ack_num` INTEGER,
+  `time` INTEGER NOT NULL,
+  `uuid` TEXT
+);
+
+CREATE TABLE IF NOT EXISTS `flow` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `edge_table` TEXT NOT NULL,
+  `edge_id` INTEGER NOT NULL,
+  `source` TEXT NOT NULL,
+  `src_ip` TEXT NOT NULL,
+  `src_port` TEXT NOT NULL,
+  `dst_ip` TEXT NOT NULL,
+  `dst_port` TEXT NOT NULL,
+  `payload_len` INTEGER NOT NULL,
+  `method` TEXT,
+  `time` INTEGER NOT NULL,
+  `peer_id` INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS `flow_edge_index` ON `flow` (`edge_table`, `edge_id`);
+CREATE INDEX IF NOT EXISTS `flow_tuple_index` ON `flow` (`source`, `src_ip`, `src_port`, `dst_ip`, `dst_port`, `payload_len`, `time`);
+CREATE INDEX IF NOT EXISTS `flow_peer_index` ON `flow` (`source`, `peer_id`);
+
+CREATE TABLE IF NOT EXISTS `user` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `username` TEXT NOT NULL UNIQUE,
+  `password` TEXT NOT NULL
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS `net_dedup_index`;
+ALTER TABLE `net` DROP COLUMN `dedup_key`;
+DROP INDEX IF EXISTS `event_dedup_index`;
+ALTER TABLE `event` DROP COLUMN `dedup_key`;
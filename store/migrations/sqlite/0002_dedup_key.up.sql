@@ -0,0 +1,5 @@
+-- 边的去重键，不允许重复边时写入，由唯一索引保证同一条边只插入一次
+ALTER TABLE `event` ADD COLUMN `dedup_key` TEXT;
+CREATE UNIQUE INDEX `event_dedup_index` ON `event` (`dedup_key`);
+ALTER TABLE `net` ADD COLUMN `dedup_key` TEXT;
+CREATE UNIQUE INDEX `net_dedup_index` ON `net` (`dedup_key`);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS `net_uuid_index`;
+DROP INDEX IF EXISTS `net_dst_index`;
+DROP INDEX IF EXISTS `net_src_index`;
+DROP INDEX IF EXISTS `event_uuid_index`;
+DROP INDEX IF EXISTS `event_dst_class_index`;
+DROP INDEX IF EXISTS `event_src_class_index`;
@@ -0,0 +1,10 @@
+-- 溯源时按起点或终点查询边（event 同时按事件类型过滤），按 uuid 查询同一请求的边
+-- 早期版本建立的单列索引被联合索引覆盖
+DROP INDEX IF EXISTS `event_src_index`;
+DROP INDEX IF EXISTS `event_dst_index`;
+CREATE INDEX IF NOT EXISTS `event_src_class_index` ON `event` (`src_id`, `event_class`);
+CREATE INDEX IF NOT EXISTS `event_dst_class_index` ON `event` (`dst_id`, `event_class`);
+CREATE INDEX IF NOT EXISTS `event_uuid_index` ON `event` (`uuid`);
+CREATE INDEX IF NOT EXISTS `net_src_index` ON `net` (`src_id`);
+CREATE INDEX IF NOT EXISTS `net_dst_index` ON `net` (`dst_id`);
+CREATE INDEX IF NOT EXISTS `net_uuid_index` ON `net` (`uuid`);
@@ -0,0 +1,4 @@
+-- 合并重复读写边时记录最后一次的时间和合并的次数
+ALTER TABLE `event` ADD COLUMN `end_time` INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `event` ADD COLUMN `count` INTEGER NOT NULL DEFAULT 1;
+UPDATE `event` SET `end_time` = `time`;
@@ -0,0 +1,6 @@
+-- 保留 sysdig 事件的主机 pid、线程 id、返回值、读写字节数，原始参数可选地以 gzip 压缩的 JSON 保存
+ALTER TABLE `event` ADD COLUMN `pid` TEXT NOT NULL DEFAULT '';
+ALTER TABLE `event` ADD COLUMN `tid` TEXT NOT NULL DEFAULT '';
+ALTER TABLE `event` ADD COLUMN `ret` TEXT NOT NULL DEFAULT '';
+ALTER TABLE `event` ADD COLUMN `bytes` INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `event` ADD COLUMN `args` BLOB;
@@ -0,0 +1,25 @@
+-- 边与请求的关联：并发请求时 uuid 列中以逗号拼接了多个请求，拆分后每个请求一行
+CREATE TABLE IF NOT EXISTS `edge_request` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `edge_table` TEXT NOT NULL,
+  `edge_id` INTEGER NOT NULL,
+  `uuid` TEXT NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `edge_request_edge_index` ON `edge_request` (`edge_table`, `edge_id`, `uuid`);
+CREATE INDEX IF NOT EXISTS `edge_request_uuid_index` ON `edge_request` (`uuid`, `edge_table`, `edge_id`);
+
+INSERT OR IGNORE INTO `edge_request` (`edge_table`, `edge_id`, `uuid`)
+WITH RECURSIVE `split` (`edge_id`, `uuid`, `rest`) AS (
+  SELECT `id`, '', `uuid` || ',' FROM `event` WHERE `uuid` IS NOT NULL AND `uuid` <> '' AND `uuid` <> 'unknown'
+  UNION ALL
+  SELECT `edge_id`, substr(`rest`, 1, instr(`rest`, ',') - 1), substr(`rest`, instr(`rest`, ',') + 1) FROM `split` WHERE `rest` <> ''
+)
+SELECT 'event', `edge_id`, `uuid` FROM `split` WHERE `uuid` <> '' AND `uuid` <> 'unknown';
+
+INSERT OR IGNORE INTO `edge_request` (`edge_table`, `edge_id`, `uuid`)
+WITH RECURSIVE `split` (`edge_id`, `uuid`, `rest`) AS (
+  SELECT `id`, '', `uuid` || ',' FROM `net` WHERE `uuid` IS NOT NULL AND `uuid` <> '' AND `uuid` <> 'unknown'
+  UNION ALL
+  SELECT `edge_id`, substr(`rest`, 1, instr(`rest`, ',') - 1), substr(`rest`, instr(`rest`, ',') + 1) FROM `split` WHERE `rest` <> ''
+)
+SELECT 'net', `edge_id`, `uuid` FROM `split` WHERE `uuid` <> '' AND `uuid` <> 'unknown';
@@ -0,0 +1,6 @@
+ALTER TABLE `net` DROP COLUMN `raw_length`;
+ALTER TABLE `net` DROP COLUMN `raw_offset`;
+ALTER TABLE `net` DROP COLUMN `raw_segment`;
+ALTER TABLE `event` DROP COLUMN `raw_length`;
+ALTER TABLE `event` DROP COLUMN `raw_offset`;
+ALTER TABLE `event` DROP COLUMN `raw_segment`;
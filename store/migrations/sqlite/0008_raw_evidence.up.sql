@@ -0,0 +1,7 @@
+-- 边对应的原始日志在归档中的位置：分段文件的 sha256、解压后的偏移与长度，未开启归档时为空
+ALTER TABLE `event` ADD COLUMN `raw_segment` TEXT NOT NULL DEFAULT '';
+ALTER TABLE `event` ADD COLUMN `raw_offset` INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `event` ADD COLUMN `raw_length` INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `net` ADD COLUMN `raw_segment` TEXT NOT NULL DEFAULT '';
+ALTER TABLE `net` ADD COLUMN `raw_offset` INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `net` ADD COLUMN `raw_length` INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS `ledger_checkpoint`;
+DROP TABLE IF EXISTS `ledger`;
+ALTER TABLE `net` DROP COLUMN `chain_hash`;
+ALTER TABLE `event` DROP COLUMN `chain_hash`;
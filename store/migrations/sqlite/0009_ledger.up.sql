@@ -0,0 +1,22 @@
+-- 防篡改的哈希链：每批插入或删除的边追加一项，每项的哈希包含上一项的哈希
+ALTER TABLE `event` ADD COLUMN `chain_hash` TEXT NOT NULL DEFAULT '';
+ALTER TABLE `net` ADD COLUMN `chain_hash` TEXT NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS `ledger` (
+  `seq` INTEGER PRIMARY KEY,
+  `kind` TEXT NOT NULL,
+  `edge_table` TEXT NOT NULL,
+  `edge_ids` TEXT NOT NULL,
+  `digest` TEXT NOT NULL,
+  `time` INTEGER NOT NULL,
+  `prev_hash` TEXT NOT NULL,
+  `hash` TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS `ledger_checkpoint` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `seq` INTEGER NOT NULL,
+  `hash` TEXT NOT NULL,
+  `time` INTEGER NOT NULL,
+  `public_key` TEXT NOT NULL,
+  `signature` TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS `ledger_checkpoint_seq_index` ON `ledger_checkpoint` (`seq`);
@@ -0,0 +1,11 @@
+-- 外部数据集（DARPA TC CDM、SPADE）中顶点的标识符与顶点主键的对应关系，分批导入时后续记录按标识符引用之前导入的顶点
+CREATE TABLE IF NOT EXISTS `uuid_map` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `dataset` TEXT NOT NULL DEFAULT 'default',
+  `source` TEXT NOT NULL,
+  `uuid` TEXT NOT NULL,
+  `vertex_table` TEXT NOT NULL,
+  `vertex_id` INTEGER NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `uuid_map_unique_index` ON `uuid_map` (`dataset`, `source`, `uuid`);
+CREATE INDEX IF NOT EXISTS `uuid_map_vertex_index` ON `uuid_map` (`vertex_table`, `vertex_id`);
@@ -0,0 +1,5 @@
+-- 正在插入边的进程（service、graph）定期续期的租约，其他进程回收孤立顶点前据此判断是否有进程缓存了顶点主键
+CREATE TABLE IF NOT EXISTS `inserter_lease` (
+  `holder` TEXT NOT NULL PRIMARY KEY,
+  `expires_at` INTEGER NOT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE `socket` DROP COLUMN `chain_hash`;
+ALTER TABLE `file` DROP COLUMN `chain_hash`;
+ALTER TABLE `process` DROP COLUMN `chain_hash`;
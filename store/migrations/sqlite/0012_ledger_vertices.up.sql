@@ -0,0 +1,4 @@
+-- 哈希链同时记录插入和删除的顶点
+ALTER TABLE `process` ADD COLUMN `chain_hash` TEXT NOT NULL DEFAULT '';
+ALTER TABLE `file` ADD COLUMN `chain_hash` TEXT NOT NULL DEFAULT '';
+ALTER TABLE `socket` ADD COLUMN `chain_hash` TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS `net_raw_segment_index`;
+DROP INDEX IF EXISTS `event_raw_segment_index`;
@@ -0,0 +1,3 @@
+-- 回收归档分段时按分段查询引用它的边
+CREATE INDEX IF NOT EXISTS `event_raw_segment_index` ON `event` (`raw_segment`);
+CREATE INDEX IF NOT EXISTS `net_raw_segment_index` ON `net` (`raw_segment`);
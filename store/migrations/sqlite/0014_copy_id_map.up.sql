@@ -0,0 +1,8 @@
+-- 复制数据集时原记录与新记录主键的对应关系，只在复制的事务中使用，提交前清空
+CREATE TABLE IF NOT EXISTS `copy_id_map` (
+  `dataset` TEXT NOT NULL,
+  `record_table` TEXT NOT NULL,
+  `src_id` INTEGER NOT NULL,
+  `dst_id` INTEGER NOT NULL,
+  PRIMARY KEY (`dataset`, `record_table`, `src_id`)
+);
@@ -1,4 +1,4 @@
-package models
+package store
 
 import (
 	"erinyes/conf"
@@ -7,42 +7,43 @@ import (
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
-	"sync"
 	"time"
 )
 
-var (
-	_db *gorm.DB
-	Mu  sync.Mutex
-)
+// OpenMySQL 按 conf.Config.Mysql 连接 MySQL
+func OpenMySQL() (Store, error) {
+	db, err := openMySQLDB()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchema(db, DriverMySQL); err != nil {
+		return nil, err
+	}
+	logs.Logger.Info("成功连接到数据库")
+	return newGormStore(db), nil
+}
 
-func Init() {
+func openMySQLDB() (*gorm.DB, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8&parseTime=True&loc=Local",
 		conf.Config.Mysql.Username,
 		conf.Config.Mysql.Password,
 		conf.Config.Mysql.Host,
 		conf.Config.Mysql.Port,
 		conf.Config.Mysql.DBName)
-	var err error
-	_db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
 	if err != nil {
-		panic("连接数据库失败，error=" + err.Error())
+		return nil, err
 	}
-	_db.Logger.LogMode(logger.Silent)
-	sqlDB, err := _db.DB()
+	sqlDB, err := db.DB()
 	if err != nil {
-		panic("获取数据库sqlDB失败，error=" + err.Error())
+		return nil, fmt.Errorf("获取数据库sqlDB失败: %w", err)
 	}
 	sqlDB.SetMaxIdleConns(conf.Config.Mysql.MaxIdleConns)
 	sqlDB.SetMaxOpenConns(conf.Config.Mysql.MaxOpenConns)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	if err := sqlDB.Ping(); err != nil {
-		panic("无法ping数据库: " + err.Error())
+		return nil, fmt.Errorf("无法ping数据库: %w", err)
 	}
-	logs.Logger.Info("成功连接到数据库")
-}
-
-func GetMysqlDB() *gorm.DB {
-	return _db
+	return db, nil
 }
@@ -0,0 +1,37 @@
+package store
+
+import "strings"
+
+// likeEscape LIKE 中的转义字符，MySQL 与 SQLite 对反斜杠的处理不同，使用 ! 保持一致
+const likeEscape = "!"
+
+// likePattern 将 * 通配的模式转换为 LIKE 的模式，其他字符（包括 % 与 _）按原样匹配
+func likePattern(pattern string) string {
+	r := strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_", "*", "%")
+	return r.Replace(pattern)
+}
+
+// MatchPattern * 通配匹配，与 likePattern 的语义相同，用于内存存储以及溯源时排除顶点
+func MatchPattern(pattern string, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return s == pattern
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+// matchVertex 顶点是否属于指定的主机和容器，为空时不限制
+func matchVertex(hostID string, containerID string, vertexHostID string, vertexContainerID string) bool {
+	return (hostID == "" || hostID == vertexHostID) && (containerID == "" || containerID == vertexContainerID)
+}
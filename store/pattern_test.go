@@ -0,0 +1,59 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchPatternAgreesWithLike(t *testing.T) {
+	db, err := openSQLiteDB(filepath.Join(t.TempDir(), "pattern.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"/etc/passwd", "/etc/passwd", true},
+		{"/etc/passwd", "/etc/passwd2", false},
+		{"*", "", true},
+		{"*", "/etc/passwd", true},
+		{"**", "x", true},
+		{"", "", true},
+		{"", "x", false},
+		{"/etc/*", "/etc/passwd", true},
+		{"/etc/*", "/etc", false},
+		{"*.log", "/var/log/a.log", true},
+		{"*.log", "/var/log/a.log.1", false},
+		{"/proc/*/status", "/proc/1/status", true},
+		{"/proc/*/status", "/proc/1/stat", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "acb", false},
+		{"a*a", "a", false},
+		{"a*a", "aa", true},
+		{"*ab*ab", "ab", false},
+		{"*ab*ab", "abab", true},
+		{"100%", "100%", true},
+		{"100%", "1000", false},
+		{"a_c", "a_c", true},
+		{"a_c", "abc", false},
+		{"a!b", "a!b", true},
+		{"a!%", "a!x", false},
+		{"10.0.0.*", "10.0.0.12", true},
+		{"10.0.0.*", "10.0.1.12", false},
+	}
+	for _, c := range cases {
+		if got := MatchPattern(c.pattern, c.s); got != c.want {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", c.pattern, c.s, got, c.want)
+		}
+		var like bool
+		if err := db.Raw("SELECT ? LIKE ? ESCAPE '"+likeEscape+"'", c.s, likePattern(c.pattern)).Row().Scan(&like); err != nil {
+			t.Fatal(err)
+		}
+		if like != c.want {
+			t.Errorf("%q LIKE %q (from %q) = %v, want %v", c.s, likePattern(c.pattern), c.pattern, like, c.want)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package store
+
+import (
+	"erinyes/conf"
+	"erinyes/models"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// eventEndpoints 各事件类型（见 parser 中的 PROCESS、FILEV1 等）起点、终点所在的顶点表
+var eventEndpoints = map[string][2]string{
+	"Process":    {"process", "process"},
+	"File_V1":    {"process", "file"},
+	"File_V2":    {"file", "process"},
+	"Network_V1": {"process", "socket"},
+	"Network_V2": {"socket", "process"},
+}
+
+// EventEndpoints 返回事件类型的起点、终点所在的顶点表
+func EventEndpoints(eventClass string) (string, string, bool) {
+	tables, ok := eventEndpoints[eventClass]
+	return tables[0], tables[1], ok
+}
+
+// PurgeOptions 删除数据的范围，Dataset、HostID、ContainerID、UUID 为空表示不限制
+type PurgeOptions struct {
+	Before      int64 // 删除时间戳（16 位微秒）小于该值的边
+	Dataset     string
+	HostID      string
+	ContainerID string
+	UUID        string // 属于该请求的边，同时属于其他请求的边一并删除
+	ChunkSize   int    // 每个事务删除的最大行数
+	DryRun      bool   // 只统计将要删除的数据
+}
+
+// PurgeReport 删除（DryRun 时为将要删除）的各类记录数
+type PurgeReport struct {
+	Events    int64
+	Nets      int64
+	Flows     int64
+	Processes int64
+	Files     int64
+	Sockets   int64
+	Segments  int64  // 删除的原始日志分段
+	Skipped   string // 没有回收孤立顶点的原因
+}
+
+func (r PurgeReport) String() string {
+	report := fmt.Sprintf("events: %d, nets: %d, flows: %d, processes: %d, files: %d, sockets: %d",
+		r.Events, r.Nets, r.Flows, r.Processes, r.Files, r.Sockets)
+	if r.Segments > 0 {
+		report += fmt.Sprintf(", archive segments: %d", r.Segments)
+	}
+	if r.Skipped != "" {
+		report += ", orphan vertices not collected: " + r.Skipped
+	}
+	return report
+}
+
+// Purger 支持按时间删除边并回收孤立顶点的存储，内存存储不需要实现
+type Purger interface {
+	// PurgeEdges 分批删除匹配的 event、net 边及其 flow
+	PurgeEdges(opts PurgeOptions) (PurgeReport, error)
+	// PurgeVertices 分批删除没有任何边的顶点；DryRun 时统计删除匹配的边之后将会孤立的顶点
+	PurgeVertices(opts PurgeOptions) (PurgeReport, error)
+	// ReferencedSegments 返回 segments 中仍被任一数据集的边引用的原始日志分段
+	ReferencedSegments(segments []string) (map[string]bool, error)
+}
+
+// vertexCond 顶点属于指定主机、容器的条件
+func (opts PurgeOptions) vertexCond() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if opts.HostID != "" {
+		conds = append(conds, "host_id = ?")
+		args = append(args, opts.HostID)
+	}
+	if opts.ContainerID != "" {
+		conds = append(conds, "container_id = ?")
+		args = append(args, opts.ContainerID)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// eventCond event 边匹配的条件：按进程一端所在的主机、容器过滤，合并的重复边最后一次事件早于 Before 时才删除
+func (opts PurgeOptions) eventCond() (string, []interface{}) {
+	conds := []string{"end_time < ?"}
+	args := []interface{}{opts.Before}
+	if opts.Dataset != "" {
+		conds = append(conds, "dataset = ?")
+		args = append(args, opts.Dataset)
+	}
+	if opts.UUID != "" {
+		conds = append(conds, "id IN (SELECT edge_id FROM edge_request WHERE edge_table = ? AND uuid = ?)")
+		args = append(args, (models.Event{}).TableName(), opts.UUID)
+	}
+	if vc, vargs := opts.vertexCond(); vc != "" {
+		var srcClasses, dstClasses []string
+		for class, tables := range eventEndpoints {
+			if tables[0] == "process" {
+				srcClasses = append(srcClasses, class)
+			} else {
+				dstClasses = append(dstClasses, class)
+			}
+		}
+		sub := "SELECT id FROM process WHERE " + vc
+		conds = append(conds, "((event_class IN ? AND src_id IN ("+sub+")) OR (event_class IN ? AND dst_id IN ("+sub+")))")
+		args = append(args, srcClasses)
+		args = append(args, vargs...)
+		args = append(args, dstClasses)
+		args = append(args, vargs...)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// netCond net 边匹配的条件：任意一端的 socket 属于指定的主机、容器
+func (opts PurgeOptions) netCond() (string, []interface{}) {
+	conds := []string{"time < ?"}
+	args := []interface{}{opts.Before}
+	if opts.Dataset != "" {
+		conds = append(conds, "dataset = ?")
+		args = append(args, opts.Dataset)
+	}
+	if opts.UUID != "" {
+		conds = append(conds, "id IN (SELECT edge_id FROM edge_request WHERE edge_table = ? AND uuid = ?)")
+		args = append(args, (models.Net{}).TableName(), opts.UUID)
+	}
+	if vc, vargs := opts.vertexCond(); vc != "" {
+		sub := "SELECT id FROM socket WHERE " + vc
+		conds = append(conds, "(src_id IN ("+sub+") OR dst_id IN ("+sub+"))")
+		args = append(args, vargs...)
+		args = append(args, vargs...)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func (s *gormStore) PurgeEdges(opts PurgeOptions) (PurgeReport, error) {
+	var report PurgeReport
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = batchSize
+	}
+	eventCond, eventArgs := opts.eventCond()
+	netCond, netArgs := opts.netCond()
+	if opts.DryRun {
+		if err := s.db.Model(&models.Event{}).Where(eventCond, eventArgs...).Count(&report.Events).Error; err != nil {
+			return report, err
+		}
+		if err := s.db.Model(&models.Net{}).Where(netCond, netArgs...).Count(&report.Nets).Error; err != nil {
+			return report, err
+		}
+		flows := s.db.Model(&models.Flow{}).Where(
+			s.db.Where("edge_table = ? AND edge_id IN (?)", (models.Event{}).TableName(), s.db.Model(&models.Event{}).Select("id").Where(eventCond, eventArgs...)).
+				Or("edge_table = ? AND edge_id IN (?)", (models.Net{}).TableName(), s.db.Model(&models.Net{}).Select("id").Where(netCond, netArgs...)))
+		err := flows.Count(&report.Flows).Error
+		return report, err
+	}
+
+	for _, edge := range []struct {
+		model interface{}
+		table string
+		cond  string
+		args  []interface{}
+		count *int64
+	}{
+		{&models.Event{}, (models.Event{}).TableName(), eventCond, eventArgs, &report.Events},
+		{&models.Net{}, (models.Net{}).TableName(), netCond, netArgs, &report.Nets},
+	} {
+		for {
+			var ids []int
+			if err := s.db.Model(edge.model).Where(edge.cond, edge.args...).Order("id").Limit(opts.ChunkSize).Pluck("id", &ids).Error; err != nil {
+				return report, err
+			}
+			if len(ids) == 0 {
+				break
+			}
+			flows, err := s.deleteEdges(edge.model, edge.table, ids)
+			if err != nil {
+				return report, err
+			}
+			*edge.count += int64(len(ids))
+			report.Flows += flows
+		}
+	}
+	return report, nil
+}
+
+// deleteEdges 在一个事务中删除一批边及其 flow、请求关联，与被删除 flow 关联的另一侧 flow 恢复为未关联
+// 开启 Ledger 时在同一个事务中最后追加一项，记录删除的边
+func (s *gormStore) deleteEdges(model interface{}, table string, ids []int) (int64, error) {
+	var deleted int64
+	err := s.chainedTransaction(func(tx *gorm.DB, l *ledgerLock) error {
+		deleted = 0
+		var flowIDs []int
+		if err := tx.Model(&models.Flow{}).Where("edge_table = ? AND edge_id IN ?", table, ids).Pluck("id", &flowIDs).Error; err != nil {
+			return err
+		}
+		if len(flowIDs) > 0 {
+			if err := tx.Model(&models.Flow{}).Where("peer_id IN ?", flowIDs).Update("peer_id", 0).Error; err != nil {
+				return err
+			}
+			r := tx.Delete(&models.Flow{}, flowIDs)
+			if r.Error != nil {
+				return r.Error
+			}
+			deleted = r.RowsAffected
+		}
+		if err := tx.Where("edge_table = ? AND edge_id IN ?", table, ids).Delete(&models.EdgeRequest{}).Error; err != nil {
+			return err
+		}
+		return deleteChained(tx, l, model, table, ids)
+	})
+	return deleted, err
+}
+
+// deleteChained 删除 ids 对应的边或顶点，开启 Ledger 时追加一项记录删除的行，摘要取自删除前的 chain_hash
+func deleteChained(tx *gorm.DB, l *ledgerLock, model interface{}, table string, ids []int) error {
+	if !conf.Config.Ledger.Enable {
+		return tx.Delete(model, ids).Error
+	}
+	found, hashes, err := chainHashes(tx, model, ids)
+	if err != nil {
+		return err
+	}
+	if err := tx.Delete(model, ids).Error; err != nil {
+		return err
+	}
+	return appendLedger(tx, l, models.LedgerPurge, table, found, models.LedgerDigest(hashes))
+}
+
+func (s *gormStore) PurgeVertices(opts PurgeOptions) (PurgeReport, error) {
+	var report PurgeReport
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = batchSize
+	}
+	for _, vertex := range []struct {
+		model interface{}
+		table string
+		count *int64
+	}{
+		{&models.Process{}, (models.Process{}).TableName(), &report.Processes},
+		{&models.File{}, (models.File{}).TableName(), &report.Files},
+		{&models.Socket{}, (models.Socket{}).TableName(), &report.Sockets},
+	} {
+		lastID := 0
+		for {
+			var ids []int
+			db := s.db.Model(vertex.model)
+			if opts.Dataset != "" {
+				db = db.Where("dataset = ?", opts.Dataset)
+			}
+			if err := db.Where("id > ?", lastID).Order("id").Limit(opts.ChunkSize).Pluck("id", &ids).Error; err != nil {
+				return report, err
+			}
+			if len(ids) == 0 {
+				break
+			}
+			lastID = ids[len(ids)-1]
+			if opts.DryRun {
+				orphans, err := orphanVertices(s.db, vertex.table, ids, opts)
+				if err != nil {
+					return report, err
+				}
+				*vertex.count += int64(len(orphans))
+				continue
+			}
+			// 在删除的事务中锁定顶点并判断是否孤立，与查找顶点主键的插入互斥
+			var deleted int
+			err := s.chainedTransaction(func(tx *gorm.DB, l *ledgerLock) error {
+				deleted = 0
+				var locked []int
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(vertex.model).Where("id IN ?", ids).Pluck("id", &locked).Error; err != nil {
+					return err
+				}
+				if len(locked) == 0 {
+					return nil
+				}
+				orphans, err := orphanVertices(tx, vertex.table, locked, opts)
+				if err != nil || len(orphans) == 0 {
+					return err
+				}
+				deleted = len(orphans)
+				if err := tx.Where("vertex_table = ? AND vertex_id IN ?", vertex.table, orphans).Delete(&models.UUIDMap{}).Error; err != nil {
+					return err
+				}
+				return deleteChained(tx, l, vertex.model, vertex.table, orphans)
+			})
+			if err != nil {
+				return report, err
+			}
+			*vertex.count += int64(deleted)
+		}
+	}
+	return report, nil
+}
+
+// orphanVertices 返回 ids 中没有被任何边引用的顶点；DryRun 时不计入匹配删除条件的边
+func orphanVertices(db *gorm.DB, table string, ids []int, opts PurgeOptions) ([]int, error) {
+	referenced, err := referencedVertices(db, table, ids, opts)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []int
+	for _, id := range ids {
+		if !referenced[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	return orphans, nil
+}
+
+// referencedVertices 返回 ids 中仍被边引用的顶点；DryRun 时不计入匹配删除条件的边
+func referencedVertices(tx *gorm.DB, table string, ids []int, opts PurgeOptions) (map[int]bool, error) {
+	referenced := make(map[int]bool)
+	pluck := func(model interface{}, column string, cond string, args []interface{}, excludeCond string, excludeArgs []interface{}) error {
+		db := tx.Model(model).Where(column+" IN ?", ids)
+		if cond != "" {
+			db = db.Where(cond, args...)
+		}
+		if opts.DryRun {
+			db = db.Where("NOT ("+excludeCond+")", excludeArgs...)
+		}
+		var found []int
+		if err := db.Distinct().Pluck(column, &found).Error; err != nil {
+			return err
+		}
+		for _, id := range found {
+			referenced[id] = true
+		}
+		return nil
+	}
+
+	eventCond, eventArgs := opts.eventCond()
+	for _, end := range []struct {
+		index  int
+		column string
+	}{{0, "src_id"}, {1, "dst_id"}} {
+		var classes []string
+		for class, tables := range eventEndpoints {
+			if tables[end.index] == table {
+				classes = append(classes, class)
+			}
+		}
+		if len(classes) == 0 {
+			continue
+		}
+		if err := pluck(&models.Event{}, end.column, "event_class IN ?", []interface{}{classes}, eventCond, eventArgs); err != nil {
+			return nil, err
+		}
+	}
+	if table == (models.Socket{}).TableName() {
+		netCond, netArgs := opts.netCond()
+		for _, column := range []string{"src_id", "dst_id"} {
+			if err := pluck(&models.Net{}, column, "", nil, netCond, netArgs); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return referenced, nil
+}
+
+func (s *gormStore) ReferencedSegments(segments []string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for _, model := range []interface{}{&models.Event{}, &models.Net{}} {
+		var found []string
+		if err := s.db.Model(model).Where("raw_segment IN ?", segments).Distinct().Pluck("raw_segment", &found).Error; err != nil {
+			return nil, err
+		}
+		for _, segment := range found {
+			referenced[segment] = true
+		}
+	}
+	return referenced, nil
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"erinyes/logs"
+	"fmt"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// OpenSQLite 打开（或创建）本地的 SQLite 数据库文件，不需要单独部署数据库服务
+func OpenSQLite(path string) (Store, error) {
+	db, err := openSQLiteDB(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchema(db, DriverSQLite); err != nil {
+		return nil, err
+	}
+	logs.Logger.Infof("成功打开数据库文件 %s", path)
+	return newGormStore(db), nil
+}
+
+func openSQLiteDB(path string) (*gorm.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite path is empty")
+	}
+	dsn := path + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1) // SQLite 同一时刻只允许一个写者，多个 inserter 协程共用一个连接
+	return db, nil
+}
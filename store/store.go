@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"erinyes/conf"
+	"erinyes/logs"
+	"erinyes/models"
+	"fmt"
+	"regexp"
+)
+
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+	DriverMemory = "memory"
+)
+
+// DefaultDataset 未指定数据集时使用的数据集，迁移 0007_dataset 之前的数据都属于该数据集
+const DefaultDataset = "default"
+
+var datasetPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ValidateDataset 数据集名称由字母、数字和 _ . - 组成，不超过 64 个字符
+func ValidateDataset(name string) error {
+	if !datasetPattern.MatchString(name) {
+		return fmt.Errorf("invalid dataset name %q", name)
+	}
+	return nil
+}
+
+// Store 溯源图的存储接口，parser、builder 和 service 只通过该接口访问数据
+type Store interface {
+	// WithDataset 返回限定在指定数据集内的视图，与原存储共享连接和数据
+	// 按唯一键、关键字查询和分页扫描只返回该数据集中的记录，按主键（或顶点主键）查询不受限制；写入时没有指定数据集的记录属于该数据集
+	WithDataset(name string) Store
+	// Dataset 当前视图的数据集
+	Dataset() string
+
+	// UpsertProcesses 批量插入不存在的顶点，返回新建的数量，调用后每个顶点的 ID 为其主键
+	UpsertProcesses(ps []*models.Process) (int, error)
+	UpsertFiles(fs []*models.File) (int, error)
+	UpsertSockets(ss []*models.Socket) (int, error)
+	GetProcess(id int) (models.Process, error)
+	GetFile(id int) (models.File, error)
+	GetSocket(id int) (models.Socket, error)
+	// GetProcesses 等按主键批量读取顶点，不存在的主键被忽略，返回的顺序不确定
+	GetProcesses(ids []int) ([]models.Process, error)
+	GetFiles(ids []int) ([]models.File, error)
+	GetSockets(ids []int) ([]models.Socket, error)
+	// FindProcess 根据 <HostID, ContainerID, VPid, ProcessName> 查询进程顶点
+	FindProcess(hostID string, containerID string, vpid string, name string) (models.Process, error)
+	// SearchProcesses 按名称模糊查询，返回当前页与总数，文件按路径、套接字按 ip 查询
+	SearchProcesses(keyword string, offset int, limit int) ([]models.Process, int64, error)
+	SearchFiles(keyword string, offset int, limit int) ([]models.File, int64, error)
+	SearchSockets(keyword string, offset int, limit int) ([]models.Socket, int64, error)
+	// MatchFiles 返回路径匹配 pattern 的文件，pattern 中的 * 匹配任意字符串，其他字符按原样匹配；hostID、containerID 为空时不限制
+	MatchFiles(hostID string, containerID string, pattern string) ([]models.File, error)
+	// MatchSockets 返回 ip、端口分别匹配 ipPattern、portPattern 的 socket，规则同上
+	MatchSockets(hostID string, containerID string, ipPattern string, portPattern string) ([]models.Socket, error)
+
+	// InsertEvents 批量插入边，dedup 为 true 时已经存在（或在本批中重复）的边不插入，返回每条边是否插入，插入的边 ID 为其主键
+	// 插入的边按 uuid 写入边与请求的关联；返回错误时没有写入任何记录（主键为 0），可以整体重试
+	InsertEvents(es []*models.Event, dedup bool) ([]bool, error)
+	InsertNets(ns []*models.Net, dedup bool) ([]bool, error)
+	InsertFlows(fs []*models.Flow) error // 返回错误时没有写入任何记录
+	// InsertReducedEvents 与 InsertEvents 相同，并在同一个事务中将后续的重复事件合并到已经插入的边上：累加 Count、Bytes，EndTime 取较大值
+	// 返回错误时插入与合并都没有生效，可以整体重试
+	InsertReducedEvents(es []*models.Event, dedup bool, exts []EventExtension) ([]bool, error)
+	GetEvent(id int) (models.Event, error)
+	GetNet(id int) (models.Net, error)
+	// FetchEvents 返回以该顶点为起点（reverse 时为终点）且事件类型属于 classes 的 event 边，uuid 不为空时只返回属于该请求的边
+	FetchEvents(vertexID int, classes []string, reverse bool, uuid string) ([]models.Event, error)
+	// FetchNets 返回以该 socket 为起点（reverse 时为终点）的 net 边，uuid 含义同上
+	FetchNets(socketID int, reverse bool, uuid string) ([]models.Net, error)
+	// FetchFrontierEvents 与 FetchEvents 相同，但一次返回以 vertexIDs 中任一顶点为起点（reverse 时为终点）的边，只返回时间在 window 内的边
+	// 按主键分页：返回主键大于 afterID 的至多 limit 条边（limit 为 0 时不限制），按主键排序；ctx 结束时查询随之取消
+	FetchFrontierEvents(ctx context.Context, vertexIDs []int, classes []string, reverse bool, uuid string, window TimeWindow, afterID int, limit int) ([]models.Event, error)
+	// FetchFrontierNets 与 FetchNets 相同，一次查询多个 socket，含义同上
+	FetchFrontierNets(ctx context.Context, socketIDs []int, reverse bool, uuid string, window TimeWindow, afterID int, limit int) ([]models.Net, error)
+
+	// ScanProcesses 等按主键顺序分页扫描，返回主键大于 afterID 的至多 limit 条记录
+	ScanProcesses(afterID int, limit int) ([]models.Process, error)
+	ScanFiles(afterID int, limit int) ([]models.File, error)
+	ScanSockets(afterID int, limit int) ([]models.Socket, error)
+	// ScanEvents、ScanNets 的 uuid 不为空时只扫描属于该请求的边
+	ScanEvents(afterID int, limit int, uuid string) ([]models.Event, error)
+	ScanNets(afterID int, limit int, uuid string) ([]models.Net, error)
+
+	// ScanUnlinkedFlows 分页扫描某一侧尚未关联的 flow
+	ScanUnlinkedFlows(source string, afterID int, limit int) ([]models.Flow, error)
+	// LatestFlowTime 返回某一侧 flow 的最大时间，没有 flow 时为 0
+	LatestFlowTime(source string) (int64, error)
+	// FindPeerFlow 为 sysdig 侧的 flow 寻找四元组与载荷长度一致、时间最接近的流量侧 flow，没有时返回 nil
+	FindPeerFlow(flow models.Flow, window int64) (*models.Flow, error)
+	// LinkFlows 原子地互相记录对方主键，peer 已被其他 flow 关联时返回 false；uuid 不为空时补全 sysdig 事件中未知的 uuid 及其请求关联
+	LinkFlows(flow models.Flow, peer models.Flow, uuid string) (bool, error)
+	// MergedCaptureEdges 返回已经与 sysdig 事件关联的流量侧边，这些边在统计和展示时视为重复边
+	MergedCaptureEdges() (events map[int]bool, nets map[int]bool)
+	// LinkedMethods 返回已关联的 sysdig 事件对应的 HTTP 方法，key 为 event 主键
+	LinkedMethods(eventIDs []int) map[int]string
+
+	FindUser(username string) (models.User, error)
+	Close() error
+}
+
+// EventExtension 合并到 ID 对应的边上的重复事件
+type EventExtension struct {
+	ID      int
+	Count   int   // 合并的事件数
+	EndTime int64 // 其中最后一次事件的时间
+	Bytes   int64 // 读写的字节数之和
+}
+
+// TimeWindow 边的时间范围 [From, To]，为 0 的一端不限制
+type TimeWindow struct {
+	From int64
+	To   int64
+}
+
+// Contains 时间 t 是否在范围内
+func (w TimeWindow) Contains(t int64) bool {
+	return (w.From == 0 || t >= w.From) && (w.To == 0 || t <= w.To)
+}
+
+// Overlaps 时间段 [start, end] 是否与范围相交，合并的重复边覆盖第一次到最后一次事件的时间
+func (w TimeWindow) Overlaps(start int64, end int64) bool {
+	if end < start {
+		end = start
+	}
+	return (w.From == 0 || end >= w.From) && (w.To == 0 || start <= w.To)
+}
+
+var _store Store
+
+// Init 根据配置打开存储后端
+func Init() {
+	var err error
+	switch conf.Config.Storage.Driver {
+	case DriverSQLite:
+		_store, err = OpenSQLite(conf.Config.Storage.Path)
+	case DriverMemory:
+		_store, err = OpenMemory(conf.Config.Storage.Path)
+	case DriverMySQL, "":
+		_store, err = OpenMySQL()
+	default:
+		logs.Logger.Fatalf("unknown storage driver %s", conf.Config.Storage.Driver)
+	}
+	if err != nil {
+		panic("连接数据库失败，error=" + err.Error())
+	}
+}
+
+func GetStore() Store {
+	return _store
+}
+
+// SetStore 替换全局存储，供不连接数据库的命令使用
+func SetStore(s Store) {
+	_store = s
+}
+
+// UseDataset 将全局存储切换为指定数据集的视图，之后的解析、建图和查询都只作用于该数据集
+func UseDataset(name string) error {
+	if err := ValidateDataset(name); err != nil {
+		return err
+	}
+	_store = _store.WithDataset(name)
+	return nil
+}
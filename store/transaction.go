@@ -0,0 +1,15 @@
+package store
+
+import "gorm.io/gorm"
+
+// Transactor 支持在一个事务中完成多次写入的存储，内存存储不需要实现
+type Transactor interface {
+	// Transaction 在事务中执行 fn，fn 中的读写都通过 tx 完成，返回错误时全部回滚
+	Transaction(fn func(tx Store) error) error
+}
+
+func (s *gormStore) Transaction(fn func(tx Store) error) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		return fn(&gormStore{db: db, dataset: s.dataset})
+	})
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"erinyes/models"
+	"gorm.io/gorm/clause"
+)
+
+// UUIDMapper 保存外部数据集中顶点标识符的存储，同一个数据集可以分多次、多个文件导入；内存存储不需要实现
+type UUIDMapper interface {
+	// SaveUUIDs 保存标识符与顶点的对应关系，标识符已经存在时改为对应新的顶点
+	SaveUUIDs(ms []*models.UUIDMap) error
+	// LookupUUIDs 返回当前数据集中已经保存的对应关系，key 为标识符，不存在的标识符不返回
+	LookupUUIDs(source string, uuids []string) (map[string]models.UUIDMap, error)
+}
+
+func (s *gormStore) SaveUUIDs(ms []*models.UUIDMap) error {
+	for _, m := range ms {
+		s.datasetOf(&m.Dataset)
+	}
+	return chunks(len(ms), func(lo int, hi int) error {
+		return s.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "dataset"}, {Name: "source"}, {Name: "uuid"}},
+			DoUpdates: clause.AssignmentColumns([]string{"vertex_table", "vertex_id"}),
+		}).Create(ms[lo:hi]).Error
+	})
+}
+
+func (s *gormStore) LookupUUIDs(source string, uuids []string) (map[string]models.UUIDMap, error) {
+	found := make(map[string]models.UUIDMap, len(uuids))
+	err := chunks(len(uuids), func(lo int, hi int) error {
+		var ms []models.UUIDMap
+		if err := s.scoped().Where("source = ? AND uuid IN ?", source, uuids[lo:hi]).Find(&ms).Error; err != nil {
+			return err
+		}
+		for _, m := range ms {
+			found[m.UUID] = m
+		}
+		return nil
+	})
+	return found, err
+}
+
+// copyUUIDMaps 按顶点的新主键复制标识符的对应关系
+func (s *gormStore) copyUUIDMaps(to *gormStore) (int64, error) {
+	var copied int64
+	lastID := 0
+	for {
+		var ms []models.UUIDMap
+		if err := s.scoped().Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&ms).Error; err != nil {
+			return copied, err
+		}
+		if len(ms) == 0 {
+			return copied, nil
+		}
+		vertices := make(map[string][]int)
+		for _, m := range ms {
+			vertices[m.VertexTable] = append(vertices[m.VertexTable], m.VertexID)
+		}
+		vertexIDs, err := to.copyIDs(vertices)
+		if err != nil {
+			return copied, err
+		}
+		copies := make([]*models.UUIDMap, 0, len(ms))
+		for _, m := range ms {
+			lastID = m.ID
+			id, ok := vertexIDs[m.VertexTable][m.VertexID]
+			if !ok {
+				continue
+			}
+			m := m
+			m.ID, m.Dataset, m.VertexID = 0, to.dataset, id
+			copies = append(copies, &m)
+		}
+		if err := to.SaveUUIDs(copies); err != nil {
+			return copied, err
+		}
+		copied += int64(len(copies))
+	}
+}
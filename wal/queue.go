@@ -0,0 +1,494 @@
+package wal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"erinyes/logs"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentSuffix = ".seg"
+	offsetFile    = "consumer.offset"
+	headerSize    = 8 // 4 字节长度 + 4 字节 crc32
+)
+
+var ErrClosed = fmt.Errorf("wal queue is closed")
+
+// Position 标识队列中的一个位置：段文件编号与段内偏移
+type Position struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+type Options struct {
+	SegmentBytes   int64         // 单个段文件的最大字节数，超过后滚动到新段
+	CommitInterval time.Duration // 持久化消费者偏移的间隔
+}
+
+// inflight 已经交给消费者但尚未确认的记录
+type inflight struct {
+	end  Position
+	done bool
+}
+
+// Queue 基于分段文件的持久化队列
+// 写入时 fsync 后才返回；消费者确认后的偏移定期持久化，进程重启后从最后一次提交的偏移重放，保证至少一次投递
+type Queue struct {
+	dir  string
+	opts Options
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	closed    bool
+	broken    error            // 写入失败且无法回滚时的错误
+	sizes     map[uint64]int64 // 段文件编号 -> 大小
+	writeSeg  uint64
+	writeFile *os.File
+
+	readPos  Position
+	readSeg  uint64
+	readFile *os.File
+
+	inflight  []inflight // 按投递顺序排列
+	firstSeq  uint64     // inflight[0] 的序号
+	nextSeq   uint64
+	acked     Position // 内存中已确认的位置
+	committed Position // 已持久化的位置
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open 打开（或创建）dir 下的队列，并截断最后一个段文件中写了一半的记录
+func Open(dir string, opts Options) (*Queue, error) {
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = 64 << 20
+	}
+	if opts.CommitInterval <= 0 {
+		opts.CommitInterval = time.Second
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &Queue{
+		dir:   dir,
+		opts:  opts,
+		sizes: make(map[uint64]int64),
+		stop:  make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	segments, err := q.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range segments {
+		info, err := os.Stat(q.segmentPath(seg))
+		if err != nil {
+			return nil, err
+		}
+		q.sizes[seg] = info.Size()
+	}
+	committed, err := q.readOffset()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 { // 没有段文件，从提交点所在编号开始写
+		q.writeSeg = committed.Segment
+		committed.Offset = 0
+	} else {
+		q.writeSeg = segments[len(segments)-1]
+		if err := q.recoverSegment(q.writeSeg); err != nil {
+			return nil, err
+		}
+		if committed.Segment < segments[0] { // 提交点所在的段已被删除，从最早的段开始
+			committed = Position{Segment: segments[0]}
+		} else if committed.Segment > q.writeSeg {
+			committed = Position{Segment: q.writeSeg, Offset: q.sizes[q.writeSeg]}
+		} else if size, ok := q.sizes[committed.Segment]; ok && committed.Offset > size {
+			committed.Offset = size
+		}
+	}
+	q.writeFile, err = os.OpenFile(q.segmentPath(q.writeSeg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := q.sizes[q.writeSeg]; !ok {
+		q.sizes[q.writeSeg] = 0
+		if err := syncDir(dir); err != nil {
+			return nil, err
+		}
+	}
+	q.committed, q.acked, q.readPos = committed, committed, committed
+	if backlog := q.backlogLocked(); backlog > 0 {
+		logs.Logger.Infof("wal %s: replay %d bytes from segment %d offset %d", dir, backlog, committed.Segment, committed.Offset)
+	}
+	q.wg.Add(1)
+	go q.commitLoop()
+	return q, nil
+}
+
+// Append 写入一批记录，所有记录 fsync 落盘后才返回
+// 写入失败时截断回写入前的位置，不在段文件中留下写了一半的记录；截断也失败时之后的写入都返回该错误
+func (q *Queue) Append(payloads [][]byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if q.broken != nil {
+		return q.broken
+	}
+	start := Position{Segment: q.writeSeg, Offset: q.sizes[q.writeSeg]}
+	if err := q.appendLocked(payloads); err != nil {
+		if rerr := q.rollbackLocked(start); rerr != nil {
+			q.broken = fmt.Errorf("wal %s: roll back failed append: %v", q.dir, rerr)
+			logs.Logger.Error(q.broken)
+		}
+		return err
+	}
+	q.cond.Broadcast()
+	return nil
+}
+
+func (q *Queue) appendLocked(payloads [][]byte) error {
+	for _, payload := range payloads {
+		recordSize := int64(headerSize + len(payload))
+		if q.sizes[q.writeSeg] > 0 && q.sizes[q.writeSeg]+recordSize > q.opts.SegmentBytes {
+			if err := q.rotateLocked(); err != nil {
+				return err
+			}
+		}
+		buf := make([]byte, recordSize)
+		binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+		binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+		copy(buf[headerSize:], payload)
+		if _, err := q.writeFile.Write(buf); err != nil {
+			return err
+		}
+		q.sizes[q.writeSeg] += recordSize
+	}
+	return q.writeFile.Sync()
+}
+
+// rollbackLocked 删除 start 之后这一批滚动出的段文件，并把 start 所在的段截断回 start
+// 持有锁期间消费者看不到这一批记录，因此不会有记录已被投递
+func (q *Queue) rollbackLocked(start Position) error {
+	if q.writeSeg != start.Segment {
+		q.writeFile.Close()
+		for seg := start.Segment + 1; seg <= q.writeSeg; seg++ {
+			if err := os.Remove(q.segmentPath(seg)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			delete(q.sizes, seg)
+		}
+		q.writeSeg = start.Segment
+		f, err := os.OpenFile(q.segmentPath(q.writeSeg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		q.writeFile = f
+	}
+	if err := q.writeFile.Truncate(start.Offset); err != nil {
+		return err
+	}
+	q.sizes[q.writeSeg] = start.Offset
+	if err := q.writeFile.Sync(); err != nil {
+		return err
+	}
+	return syncDir(q.dir)
+}
+
+// Next 阻塞直到有新的记录，返回记录内容与确认函数，记录处理完成后调用确认函数
+// 提交的偏移不会越过没有确认的记录，处理失败时不确认，重启后从该记录开始重放
+// 记录损坏时返回错误，不跳过之后的记录
+func (q *Queue) Next() ([]byte, func(), error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed {
+			return nil, nil, ErrClosed
+		}
+		if q.readPos.Offset < q.sizes[q.readPos.Segment] {
+			payload, err := q.readLocked()
+			if err != nil { // 只有崩溃时写了一半的末尾记录可以丢弃（Open 时已截断），已确认写入的记录损坏时不能跳过
+				return nil, nil, fmt.Errorf("wal %s: read segment %d at offset %d: %w", q.dir, q.readPos.Segment, q.readPos.Offset, err)
+			}
+			seq := q.nextSeq
+			q.nextSeq++
+			q.inflight = append(q.inflight, inflight{end: q.readPos})
+			return payload, func() { q.ack(seq) }, nil
+		}
+		if q.readPos.Segment < q.writeSeg {
+			q.readPos = Position{Segment: q.readPos.Segment + 1}
+			continue
+		}
+		q.cond.Wait()
+	}
+}
+
+// Backlog 返回已写入但尚未确认的字节数
+func (q *Queue) Backlog() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.backlogLocked()
+}
+
+// Close 持久化已确认的偏移并关闭文件
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	close(q.stop)
+	q.wg.Wait()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	err := q.commitLocked()
+	if q.readFile != nil {
+		q.readFile.Close()
+	}
+	if cerr := q.writeFile.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (q *Queue) ack(seq uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if seq < q.firstSeq {
+		return // 重复确认
+	}
+	q.inflight[seq-q.firstSeq].done = true
+	popped := 0
+	for popped < len(q.inflight) && q.inflight[popped].done {
+		q.acked = q.inflight[popped].end
+		popped++
+	}
+	q.inflight = q.inflight[popped:]
+	q.firstSeq += uint64(popped)
+}
+
+func (q *Queue) commitLoop() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(q.opts.CommitInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			q.mu.Lock()
+			if err := q.commitLocked(); err != nil {
+				logs.Logger.WithError(err).Errorf("wal %s: commit consumer offset failed", q.dir)
+			}
+			q.mu.Unlock()
+		}
+	}
+}
+
+// commitLocked 持久化已确认的偏移，并删除已经完全消费的段文件
+func (q *Queue) commitLocked() error {
+	if q.acked == q.committed {
+		return nil
+	}
+	data, err := json.Marshal(q.acked)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(q.dir, offsetFile+".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, offsetFile)); err != nil {
+		return err
+	}
+	if err := syncDir(q.dir); err != nil {
+		return err
+	}
+	q.committed = q.acked
+	for seg := range q.sizes {
+		if seg < q.committed.Segment && seg != q.writeSeg && seg != q.readSeg {
+			if err := os.Remove(q.segmentPath(seg)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			delete(q.sizes, seg)
+		}
+	}
+	return nil
+}
+
+func (q *Queue) rotateLocked() error {
+	if err := q.writeFile.Sync(); err != nil {
+		return err
+	}
+	if err := q.writeFile.Close(); err != nil {
+		return err
+	}
+	q.writeSeg++
+	f, err := os.OpenFile(q.segmentPath(q.writeSeg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	q.writeFile = f
+	q.sizes[q.writeSeg] = 0
+	return syncDir(q.dir)
+}
+
+// readLocked 读取 readPos 处的一条记录并前移 readPos
+func (q *Queue) readLocked() ([]byte, error) {
+	if q.readFile == nil || q.readSeg != q.readPos.Segment {
+		if q.readFile != nil {
+			q.readFile.Close()
+		}
+		f, err := os.Open(q.segmentPath(q.readPos.Segment))
+		if err != nil {
+			q.readFile = nil
+			return nil, err
+		}
+		q.readFile, q.readSeg = f, q.readPos.Segment
+	}
+	payload, err := readRecord(q.readFile, q.readPos.Offset)
+	if err != nil {
+		return nil, err
+	}
+	q.readPos.Offset += int64(headerSize + len(payload))
+	return payload, nil
+}
+
+func (q *Queue) backlogLocked() int64 {
+	var backlog int64
+	for seg, size := range q.sizes {
+		if seg > q.acked.Segment {
+			backlog += size
+		} else if seg == q.acked.Segment {
+			backlog += size - q.acked.Offset
+		}
+	}
+	return backlog
+}
+
+// recoverSegment 校验段文件中的记录，截断末尾不完整或损坏的记录
+func (q *Queue) recoverSegment(seg uint64) error {
+	f, err := os.OpenFile(q.segmentPath(seg), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var offset int64
+	for offset < q.sizes[seg] {
+		payload, err := readRecord(f, offset)
+		if err != nil {
+			break
+		}
+		offset += int64(headerSize + len(payload))
+	}
+	if offset == q.sizes[seg] {
+		return nil
+	}
+	logs.Logger.Warnf("wal %s: truncate segment %d from %d to %d bytes", q.dir, seg, q.sizes[seg], offset)
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	q.sizes[seg] = offset
+	return f.Sync()
+}
+
+func (q *Queue) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seg, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seg)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func (q *Queue) readOffset() (Position, error) {
+	var pos Position
+	data, err := os.ReadFile(filepath.Join(q.dir, offsetFile))
+	if os.IsNotExist(err) {
+		return pos, nil
+	} else if err != nil {
+		return pos, err
+	}
+	if err := json.Unmarshal(data, &pos); err != nil {
+		return pos, fmt.Errorf("invalid consumer offset file: %w", err)
+	}
+	return pos, nil
+}
+
+func (q *Queue) segmentPath(seg uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seg, segmentSuffix))
+}
+
+func readRecord(f *os.File, offset int64) ([]byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := f.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	payload := make([]byte, length)
+	if _, err := f.ReadAt(payload, offset+headerSize); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("checksum mismatch at offset %d", offset)
+	}
+	return payload, nil
+}
+
+func writeFileSync(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,228 @@
+package wal
+
+import (
+	"erinyes/logs"
+	"github.com/sirupsen/logrus"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// openQueue 打开 dir 下的队列，消费偏移只在 Close 时提交
+func openQueue(t *testing.T, dir string, segmentBytes int64) *Queue {
+	logs.Logger = logrus.New()
+	q, err := Open(dir, Options{SegmentBytes: segmentBytes, CommitInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func records(names ...string) [][]byte {
+	var payloads [][]byte
+	for _, name := range names {
+		payloads = append(payloads, []byte(name))
+	}
+	return payloads
+}
+
+// next 读取 n 条记录，返回内容与确认函数
+func next(t *testing.T, q *Queue, n int) ([]string, []func()) {
+	var (
+		got  []string
+		acks []func()
+	)
+	for i := 0; i < n; i++ {
+		payload, ack, err := q.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, acks = append(got, string(payload)), append(acks, ack)
+	}
+	return got, acks
+}
+
+func expect(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func expectSize(t *testing.T, name string, size int64) {
+	t.Helper()
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != size {
+		t.Fatalf("%s has %d bytes, want %d", name, info.Size(), size)
+	}
+}
+
+func closeQueue(t *testing.T, q *Queue) {
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplayAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, 0)
+	if err := q.Append(records("a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+	got, acks := next(t, q, 2)
+	expect(t, got, "a", "b")
+	acks[0]()
+	closeQueue(t, q)
+
+	q = openQueue(t, dir, 0)
+	defer closeQueue(t, q)
+	got, _ = next(t, q, 2)
+	expect(t, got, "b", "c")
+	if backlog := q.Backlog(); backlog != 2*(headerSize+1) {
+		t.Fatalf("backlog %d, want %d", backlog, 2*(headerSize+1))
+	}
+}
+
+func TestSegmentRotation(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, 2*(headerSize+2)) // 每个段保存两条记录
+	if err := q.Append(records("r0", "r1", "r2", "r3", "r4")); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := q.listSegments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(segments, []uint64{0, 1, 2}) {
+		t.Fatalf("segments %v, want [0 1 2]", segments)
+	}
+	got, acks := next(t, q, 5)
+	expect(t, got, "r0", "r1", "r2", "r3", "r4")
+	for _, ack := range acks[:3] {
+		ack()
+	}
+	closeQueue(t, q) // 提交点在段 1 中，段 0 被删除
+
+	q = openQueue(t, dir, 2*(headerSize+2))
+	defer closeQueue(t, q)
+	if segments, _ = q.listSegments(); !reflect.DeepEqual(segments, []uint64{1, 2}) {
+		t.Fatalf("segments %v, want [1 2]", segments)
+	}
+	got, _ = next(t, q, 2)
+	expect(t, got, "r3", "r4")
+}
+
+func TestTornTail(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, 0)
+	if err := q.Append(records("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	closeQueue(t, q)
+	// 崩溃时最后一条记录只写了头部和部分内容
+	f, err := os.OpenFile(q.segmentPath(0), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0, 0, 0, 5, 1, 2, 3, 4, 'x'}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	q = openQueue(t, dir, 0)
+	defer closeQueue(t, q)
+	if err := q.Append(records("c")); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := next(t, q, 3)
+	expect(t, got, "a", "b", "c")
+	expectSize(t, q.segmentPath(0), 3*(headerSize+1))
+}
+
+func TestOutOfOrderAck(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, 0)
+	if err := q.Append(records("a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+	got, acks := next(t, q, 3)
+	expect(t, got, "a", "b", "c")
+	acks[2]()
+	acks[1]()
+	if backlog := q.Backlog(); backlog != 3*(headerSize+1) {
+		t.Fatalf("backlog %d, want %d", backlog, 3*(headerSize+1))
+	}
+	closeQueue(t, q)
+
+	q = openQueue(t, dir, 0)
+	got, acks = next(t, q, 3)
+	expect(t, got, "a", "b", "c")
+	acks[0]()
+	acks[0]() // 重复确认
+	if backlog := q.Backlog(); backlog != 2*(headerSize+1) {
+		t.Fatalf("backlog %d, want %d", backlog, 2*(headerSize+1))
+	}
+	acks[1]()
+	acks[2]()
+	if backlog := q.Backlog(); backlog != 0 {
+		t.Fatalf("backlog %d, want 0", backlog)
+	}
+	closeQueue(t, q)
+}
+
+func TestCorruptRecordIsNotSkipped(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, 2*(headerSize+2))
+	if err := q.Append(records("r0", "r1", "r2")); err != nil {
+		t.Fatal(err)
+	}
+	closeQueue(t, q)
+	// 段 0 不是最后一个段，其中的记录损坏不是崩溃造成的
+	f, err := os.OpenFile(q.segmentPath(0), os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("x"), 2*headerSize+2); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	q = openQueue(t, dir, 2*(headerSize+2))
+	defer closeQueue(t, q)
+	got, _ := next(t, q, 1)
+	expect(t, got, "r0")
+	for i := 0; i < 2; i++ {
+		if payload, _, err := q.Next(); err == nil {
+			t.Fatalf("read %q from a corrupted record", payload)
+		}
+	}
+}
+
+func TestFailedAppendIsRolledBack(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, 3*(headerSize+2))
+	defer closeQueue(t, q)
+	if err := q.Append(records("r0")); err != nil {
+		t.Fatal(err)
+	}
+	// 段 1 的位置被目录占用，这一批在写入 r3 滚动时失败，r1、r2 已经写入段 0
+	if err := os.Mkdir(q.segmentPath(1), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Append(records("r1", "r2", "r3")); err == nil {
+		t.Fatal("append succeeded, want error")
+	}
+	expectSize(t, q.segmentPath(0), headerSize+2)
+	if err := q.Append(records("r4")); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := next(t, q, 2)
+	expect(t, got, "r0", "r4")
+	if backlog := q.Backlog(); backlog != 2*(headerSize+2) {
+		t.Fatalf("backlog %d, want %d", backlog, 2*(headerSize+2))
+	}
+}